@@ -0,0 +1,95 @@
+// Package auth authenticates clients of the OTLP receivers from the value of
+// their authorization header or gRPC metadata.
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Authenticator checks the credentials of a request.
+type Authenticator interface {
+	// Authenticate returns the principal the authorization header value
+	// belongs to, or an error if the credentials are missing or invalid.
+	Authenticate(authorization string) (string, error)
+}
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Config struct {
+	// File with one "principal:token" pair per line. Clients send
+	// "Authorization: Bearer <token>", or "Authorization: Splunk <token>" as
+	// Splunk HEC clients do, or "Authorization: Token <token>" as InfluxDB
+	// clients do.
+	TokenFile string
+	// htpasswd file with bcrypt or SHA1 hashed passwords. Clients send
+	// "Authorization: Basic <base64(user:password)>".
+	HtpasswdFile string
+}
+
+// New returns an Authenticator for cfg, or nil if authentication is not
+// configured. If both files are set, a client may use either scheme.
+func New(cfg Config) (Authenticator, error) {
+	schemes := schemeAuthenticator{}
+
+	if cfg.TokenFile != "" {
+		tokens, err := LoadTokenFile(cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		schemes["bearer"] = tokens
+		schemes["splunk"] = tokens
+		schemes["token"] = tokens
+	}
+
+	if cfg.HtpasswdFile != "" {
+		htpasswd, err := LoadHtpasswdFile(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		schemes["basic"] = htpasswd
+	}
+
+	if len(schemes) == 0 {
+		return nil, nil
+	}
+	return schemes, nil
+}
+
+// schemeAuthenticator picks the authenticator by the scheme of the
+// authorization header, such as "Bearer" or "Basic".
+type schemeAuthenticator map[string]Authenticator
+
+func (s schemeAuthenticator) Authenticate(authorization string) (string, error) {
+	if authorization == "" {
+		return "", ErrMissingCredentials
+	}
+
+	scheme, credentials, ok := strings.Cut(authorization, " ")
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+
+	a, ok := s[strings.ToLower(scheme)]
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	return a.Authenticate(strings.TrimSpace(credentials))
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated principal.
+func NewContext(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal authenticated for the request, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
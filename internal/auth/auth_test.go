@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestAuthenticate(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := sha1.Sum([]byte("hunter2"))
+	shaHash := "{SHA}" + base64.StdEncoding.EncodeToString(sha[:])
+
+	a, err := New(Config{
+		TokenFile:    writeFile(t, "# ingest tokens\nteam-a:token-a\nteam-b:token-b\n"),
+		HtpasswdFile: writeFile(t, "alice:"+string(bcryptHash)+"\nbob:"+shaHash+"\n"),
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		authorization string
+		principal     string
+		err           error
+	}{
+		{"Bearer token-a", "team-a", nil},
+		{"bearer token-b", "team-b", nil},
+		{"Splunk token-a", "team-a", nil},
+		{"Token token-a", "team-a", nil},
+		{basic("alice", "secret"), "alice", nil},
+		{basic("alice", "secret"), "alice", nil}, // cached
+		{basic("bob", "hunter2"), "bob", nil},
+		{"", "", ErrMissingCredentials},
+		{"Bearer wrong", "", ErrInvalidCredentials},
+		{basic("alice", "wrong"), "", ErrInvalidCredentials},
+		{basic("mallory", "secret"), "", ErrInvalidCredentials},
+		{"Digest token-a", "", ErrInvalidCredentials},
+		{"token-a", "", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		principal, err := a.Authenticate(tt.authorization)
+		if principal != tt.principal || !errors.Is(err, tt.err) {
+			t.Errorf("Authenticate(%q) = %q, %v, expected %q, %v", tt.authorization, principal, err, tt.principal, tt.err)
+		}
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	a, err := New(Config{})
+	if a != nil || err != nil {
+		t.Errorf("Expected no authenticator, got %v, %v", a, err)
+	}
+}
+
+func TestLoadHtpasswdFileUnsupportedHash(t *testing.T) {
+	// MD5 (apr1) is the htpasswd default but is not supported.
+	path := writeFile(t, "alice:$apr1$salt$hash\n")
+	if _, err := LoadHtpasswdFile(path); err == nil {
+		t.Error("Expected an error for an apr1 hash")
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// readPairs reads "name:secret" lines from path. Empty lines and lines
+// starting with '#' are skipped.
+func readPairs(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairs [][2]string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, secret, ok := strings.Cut(line, ":")
+		if !ok || name == "" || secret == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"name:secret\"", path, lineNum)
+		}
+		pairs = append(pairs, [2]string{name, secret})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%s: no credentials found", path)
+	}
+
+	return pairs, nil
+}
+
+// Tokens authenticates bearer tokens against a static list.
+type Tokens struct {
+	// principals by the SHA-256 of their token, so that lookups do not leak
+	// the token through timing.
+	principals map[[sha256.Size]byte]string
+}
+
+// LoadTokenFile reads a file of "principal:token" lines.
+func LoadTokenFile(path string) (*Tokens, error) {
+	pairs, err := readPairs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tokens{principals: make(map[[sha256.Size]byte]string, len(pairs))}
+	for _, pair := range pairs {
+		t.principals[sha256.Sum256([]byte(pair[1]))] = pair[0]
+	}
+	return t, nil
+}
+
+func (t *Tokens) Authenticate(token string) (string, error) {
+	if token == "" {
+		return "", ErrMissingCredentials
+	}
+
+	principal, ok := t.principals[sha256.Sum256([]byte(token))]
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	return principal, nil
+}
+
+// Htpasswd authenticates basic auth credentials against an htpasswd file.
+// Only bcrypt ("htpasswd -B") and SHA1 ("htpasswd -s") hashes are supported.
+type Htpasswd struct {
+	hashes map[string]string
+
+	// Verified credentials, bcrypt is too slow to run on every request.
+	verified sync.Map // [sha256.Size]byte -> string
+}
+
+// LoadHtpasswdFile reads an htpasswd file.
+func LoadHtpasswdFile(path string) (*Htpasswd, error) {
+	pairs, err := readPairs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Htpasswd{hashes: make(map[string]string, len(pairs))}
+	for _, pair := range pairs {
+		user, hash := pair[0], pair[1]
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("%s: unsupported hash for user %q, use bcrypt (htpasswd -B) or SHA1 (htpasswd -s)", path, user)
+		}
+		h.hashes[user] = hash
+	}
+	return h, nil
+}
+
+func (h *Htpasswd) Authenticate(credentials string) (string, error) {
+	if credentials == "" {
+		return "", ErrMissingCredentials
+	}
+
+	key := sha256.Sum256([]byte(credentials))
+	if user, ok := h.verified.Load(key); ok {
+		return user.(string), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+
+	hash, ok := h.hashes[user]
+	if !ok || !checkPassword(hash, password) {
+		return "", ErrInvalidCredentials
+	}
+
+	h.verified.Store(key, user)
+	return user, nil
+}
+
+func checkPassword(hash, password string) bool {
+	if sha, ok := strings.CutPrefix(hash, "{SHA}"); ok {
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(sha), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,111 @@
+// Package elasticsearch decodes Elasticsearch bulk requests, as sent by the
+// Elasticsearch outputs of log shippers, and translates their documents to
+// OTLP logs.
+// Ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Item is an action of a bulk request and its document.
+type Item struct {
+	// Action is index or create, other actions have Err set.
+	Action   string
+	Index    string
+	ID       string
+	Document map[string]any
+	// Err, if set, is why the item is rejected. The other items of the
+	// request are still indexed.
+	Err error
+}
+
+var errMalformedAction = errors.New("malformed action")
+
+// Actions followed by a document line.
+var actionsWithSource = map[string]bool{"index": true, "create": true, "update": true}
+
+// ParseBulk parses a bulk request body, newline separated action and
+// document lines. defaultIndex is the index in the request path, used by
+// actions without one. An error is returned for a malformed action line, as
+// the lines that follow cannot be told apart.
+func ParseBulk(body []byte, defaultIndex string) ([]Item, error) {
+	var items []Item
+	var pending *Item
+	for line := range bytes.Lines(body) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if pending != nil {
+			pending.Document, pending.Err = parseDocument(line, pending.Err)
+			items = append(items, *pending)
+			pending = nil
+			continue
+		}
+
+		item, err := parseAction(line, defaultIndex)
+		if err != nil {
+			return nil, err
+		}
+		if actionsWithSource[item.Action] {
+			pending = &item
+		} else {
+			items = append(items, item)
+		}
+	}
+
+	if pending != nil {
+		return nil, fmt.Errorf("%w: %s action without a document", errMalformedAction, pending.Action)
+	}
+	return items, nil
+}
+
+func parseAction(line []byte, defaultIndex string) (Item, error) {
+	var action map[string]struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	}
+	if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+		return Item{}, fmt.Errorf("%w: %s", errMalformedAction, line)
+	}
+
+	var item Item
+	for name, meta := range action {
+		item = Item{Action: name, Index: meta.Index, ID: meta.ID}
+	}
+	if item.Index == "" {
+		item.Index = defaultIndex
+	}
+
+	switch {
+	case item.Action != "index" && item.Action != "create":
+		item.Err = fmt.Errorf("unsupported action %s, only index and create are accepted", item.Action)
+	case item.Index == "":
+		item.Err = errors.New("index is missing")
+	}
+	return item, nil
+}
+
+// parseDocument decodes the document line of an action, unless the action
+// is already rejected by err. Numbers are json.Number.
+func parseDocument(line []byte, err error) (map[string]any, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	if doc == nil {
+		return nil, errors.New("document is not an object")
+	}
+	return doc, nil
+}
@@ -0,0 +1,127 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestParseBulk(t *testing.T) {
+	body := `{"index": {"_index": "logs-app", "_id": "1"}}
+{"message": "hello", "n": 1}
+{"create": {}}
+{"message": "second"}
+
+{"delete": {"_index": "logs-app", "_id": "1"}}
+{"update": {"_id": "2"}}
+{"doc": {"message": "updated"}}
+{"index": {}}
+not json
+`
+	items, err := ParseBulk([]byte(body), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 5 {
+		t.Fatalf("got %d items, want 5", len(items))
+	}
+	want := []Item{
+		{Action: "index", Index: "logs-app", ID: "1", Document: map[string]any{"message": "hello", "n": json.Number("1")}},
+		{Action: "create", Index: "default", Document: map[string]any{"message": "second"}},
+	}
+	if !reflect.DeepEqual(items[:2], want) {
+		t.Errorf("items = %+v, want %+v", items[:2], want)
+	}
+	for i, action := range []string{"delete", "update", "index"} {
+		if item := items[2+i]; item.Action != action || item.Err == nil {
+			t.Errorf("item %d = %+v, want a rejected %s", 2+i, item, action)
+		}
+	}
+
+	if items, _ := ParseBulk([]byte("{\"index\": {}}\n{}\n"), ""); len(items) != 1 || items[0].Err == nil {
+		t.Errorf("items without an index = %+v, want rejected", items)
+	}
+
+	for _, body := range []string{
+		"not json\n",
+		`{"index": {}, "create": {}}` + "\n{}\n",
+		`{"index": {}}` + "\n",
+	} {
+		if _, err := ParseBulk([]byte(body), "default"); !errors.Is(err, errMalformedAction) {
+			t.Errorf("ParseBulk(%q) error = %v, want %v", body, err, errMalformedAction)
+		}
+	}
+}
+
+func TestToLogs(t *testing.T) {
+	observed := pcommon.NewTimestampFromTime(time.Unix(1700000100, 0))
+	items := []Item{
+		{Action: "index", Index: "filebeat", Document: map[string]any{
+			"@timestamp": "2023-11-14T22:13:20.5Z",
+			"message":    "hello",
+			"log":        map[string]any{"level": "WARN", "file": map[string]any{"path": "/var/log/app.log"}},
+			"service":    map[string]any{"name": "api"},
+			"host.name":  "web-1",
+		}},
+		{Action: "create", Index: "filebeat", Document: map[string]any{
+			"ts":      json.Number("1700000000123"),
+			"service": map[string]any{"name": "api"},
+			"level":   json.Number("30"),
+		}},
+		{Action: "index", Index: "filebeat", Err: errors.New("rejected")},
+		{Action: "index", Index: "other", Document: map[string]any{"message": map[string]any{"structured": true}}},
+	}
+
+	ld := ToLogs(items, DefaultMapping, observed)
+	if ld.ResourceLogs().Len() != 2 || ld.LogRecordCount() != 3 {
+		t.Fatalf("got %d resources and %d log records, want 2 and 3", ld.ResourceLogs().Len(), ld.LogRecordCount())
+	}
+
+	rl := ld.ResourceLogs().At(0)
+	wantResource := map[string]any{"service.name": "api", "elasticsearch.index": "filebeat"}
+	if got := rl.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource = %v, want %v", got, wantResource)
+	}
+	lr := rl.ScopeLogs().At(0).LogRecords().At(0)
+	if lr.Timestamp().AsTime() != time.Unix(1700000000, 5e8).UTC() || lr.ObservedTimestamp() != observed {
+		t.Errorf("timestamps = %v, observed %v", lr.Timestamp(), lr.ObservedTimestamp())
+	}
+	if lr.Body().Str() != "hello" || lr.SeverityText() != "WARN" || lr.SeverityNumber() != plog.SeverityNumberWarn {
+		t.Errorf("log record = %q, severity %q %v", lr.Body().Str(), lr.SeverityText(), lr.SeverityNumber())
+	}
+	wantAttrs := map[string]any{
+		"log":       map[string]any{"file": map[string]any{"path": "/var/log/app.log"}},
+		"host.name": "web-1",
+	}
+	if got := lr.Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+
+	// Only the default mapping is tried, other fields stay attributes.
+	lr = rl.ScopeLogs().At(0).LogRecords().At(1)
+	if lr.Timestamp() != 0 || lr.SeverityNumber() != plog.SeverityNumberUnspecified {
+		t.Errorf("log record without mapped fields = %v, %v", lr.Timestamp(), lr.SeverityNumber())
+	}
+
+	items[1].Document = map[string]any{"ts": json.Number("1700000000123"), "level": "error"}
+	ld = ToLogs(items[1:2], Mapping{TimestampField: "ts", SeverityField: "level"}, observed)
+	lr = ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	if lr.Timestamp().AsTime() != time.UnixMilli(1700000000123).UTC() || lr.SeverityNumber() != plog.SeverityNumberError {
+		t.Errorf("custom mapping = %v, %v", lr.Timestamp(), lr.SeverityNumber())
+	}
+	if lr.Attributes().Len() != 0 {
+		t.Errorf("attributes = %v, want none", lr.Attributes().AsRaw())
+	}
+
+	items = []Item{{Action: "index", Index: "other", Document: map[string]any{"message": map[string]any{"structured": true}}}}
+	body := ToLogs(items, DefaultMapping, observed).ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body()
+	if got := body.Map().AsRaw(); !reflect.DeepEqual(got, map[string]any{"structured": true}) {
+		t.Errorf("structured body = %v", got)
+	}
+}
@@ -0,0 +1,228 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Resource attributes of a document.
+const (
+	attrServiceName = "service.name"
+	attrIndex       = "elasticsearch.index"
+)
+
+// Mapping names the document fields that become the timestamp, body,
+// severity and service of a log record. A name is a path of dot separated
+// keys, as in Elasticsearch: "log.level" is found as a key of its own or in
+// {"log": {"level": ...}}.
+type Mapping struct {
+	TimestampField string
+	MessageField   string
+	SeverityField  string
+	ServiceField   string
+}
+
+// DefaultMapping is the Elastic Common Schema fields Beats, Vector and
+// Logstash documents usually have.
+var DefaultMapping = Mapping{
+	TimestampField: "@timestamp",
+	MessageField:   "message",
+	SeverityField:  "log.level",
+	ServiceField:   "service.name",
+}
+
+// Severity numbers of the usual level names, lower case.
+var severityNumbers = map[string]plog.SeverityNumber{
+	"trace":         plog.SeverityNumberTrace,
+	"debug":         plog.SeverityNumberDebug,
+	"info":          plog.SeverityNumberInfo,
+	"informational": plog.SeverityNumberInfo,
+	"notice":        plog.SeverityNumberInfo2,
+	"warn":          plog.SeverityNumberWarn,
+	"warning":       plog.SeverityNumberWarn,
+	"error":         plog.SeverityNumberError,
+	"err":           plog.SeverityNumberError,
+	"critical":      plog.SeverityNumberFatal,
+	"crit":          plog.SeverityNumberFatal,
+	"alert":         plog.SeverityNumberFatal,
+	"emergency":     plog.SeverityNumberFatal,
+	"emerg":         plog.SeverityNumberFatal,
+	"fatal":         plog.SeverityNumberFatal,
+	"panic":         plog.SeverityNumberFatal,
+}
+
+type resourceKey struct {
+	index   string
+	service string
+}
+
+// ToLogs translates the documents of the items without an error to OTLP
+// logs:
+//
+//   - The index and the service field become resource attributes,
+//     documents with the same index and service share a resource.
+//   - The timestamp, message and severity fields become the timestamp, body
+//     and severity of the log record.
+//   - The other fields become attributes.
+//
+// A mapped field of an unexpected type is left as an attribute. Documents
+// without a timestamp only have the observed timestamp. The mapped fields are
+// deleted from the documents.
+func ToLogs(items []Item, mapping Mapping, observed pcommon.Timestamp) plog.Logs {
+	ld := plog.NewLogs()
+	scopes := map[resourceKey]plog.ScopeLogs{}
+
+	for _, item := range items {
+		if item.Err != nil {
+			continue
+		}
+		doc := item.Document
+
+		key := resourceKey{index: item.Index}
+		if v, ok := lookupField(doc, mapping.ServiceField).(string); ok {
+			key.service = v
+			deleteField(doc, mapping.ServiceField)
+		}
+		sl, ok := scopes[key]
+		if !ok {
+			rl := ld.ResourceLogs().AppendEmpty()
+			attrs := rl.Resource().Attributes()
+			if key.service != "" {
+				attrs.PutStr(attrServiceName, key.service)
+			}
+			attrs.PutStr(attrIndex, key.index)
+			sl = rl.ScopeLogs().AppendEmpty()
+			scopes[key] = sl
+		}
+
+		lr := sl.LogRecords().AppendEmpty()
+		lr.SetObservedTimestamp(observed)
+		if t, ok := parseTimestamp(lookupField(doc, mapping.TimestampField)); ok {
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(t))
+			deleteField(doc, mapping.TimestampField)
+		}
+		if v := lookupField(doc, mapping.MessageField); v != nil {
+			putValue(lr.Body(), v)
+			deleteField(doc, mapping.MessageField)
+		}
+		if v, ok := lookupField(doc, mapping.SeverityField).(string); ok {
+			lr.SetSeverityText(v)
+			lr.SetSeverityNumber(severityNumbers[strings.ToLower(v)])
+			deleteField(doc, mapping.SeverityField)
+		}
+
+		for k, v := range doc {
+			putValue(lr.Attributes().PutEmpty(k), v)
+		}
+	}
+
+	return ld
+}
+
+// lookupField returns the value at a dot separated path in doc, or nil.
+func lookupField(doc map[string]any, path string) any {
+	if path == "" {
+		return nil
+	}
+	if v, ok := doc[path]; ok {
+		return v
+	}
+	for i := strings.IndexByte(path, '.'); i > 0; i = nextDot(path, i) {
+		if inner, ok := doc[path[:i]].(map[string]any); ok {
+			if v := lookupField(inner, path[i+1:]); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// deleteField deletes the value at a dot separated path in doc, and the
+// objects it leaves empty.
+func deleteField(doc map[string]any, path string) {
+	if _, ok := doc[path]; ok {
+		delete(doc, path)
+		return
+	}
+	for i := strings.IndexByte(path, '.'); i > 0; i = nextDot(path, i) {
+		if inner, ok := doc[path[:i]].(map[string]any); ok && lookupField(inner, path[i+1:]) != nil {
+			deleteField(inner, path[i+1:])
+			if len(inner) == 0 {
+				delete(doc, path[:i])
+			}
+			return
+		}
+	}
+}
+
+// nextDot returns the index of the dot in path after the one at i, or -1.
+func nextDot(path string, i int) int {
+	j := strings.IndexByte(path[i+1:], '.')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// Date formats of timestamps without a time zone, which are UTC as in
+// Elasticsearch.
+var localTimestampLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+// parseTimestamp parses an RFC 3339 timestamp, or milliseconds since the
+// epoch, the default date formats of Elasticsearch.
+func parseTimestamp(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		for _, layout := range localTimestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	case json.Number:
+		if ms, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return time.UnixMilli(ms), true
+		}
+		if ms, err := v.Float64(); err == nil {
+			return time.Unix(0, int64(ms*float64(time.Millisecond))), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// putValue sets dest to a decoded JSON value.
+func putValue(dest pcommon.Value, v any) {
+	switch v := v.(type) {
+	case bool:
+		dest.SetBool(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			dest.SetInt(i)
+		} else if f, err := v.Float64(); err == nil {
+			dest.SetDouble(f)
+		} else {
+			dest.SetStr(string(v))
+		}
+	case string:
+		dest.SetStr(v)
+	case []any:
+		s := dest.SetEmptySlice()
+		s.EnsureCapacity(len(v))
+		for _, e := range v {
+			putValue(s.AppendEmpty(), e)
+		}
+	case map[string]any:
+		m := dest.SetEmptyMap()
+		m.EnsureCapacity(len(v))
+		for k, e := range v {
+			putValue(m.PutEmpty(k), e)
+		}
+	}
+}
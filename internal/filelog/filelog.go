@@ -0,0 +1,285 @@
+// Package filelog tails local log files into the logs table, like the
+// filelog receiver of the OTel Collector.
+package filelog
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+)
+
+// StartAt is where files found when the tailer starts are read from. Files
+// with a saved offset resume from it, and files created later are read from
+// the beginning.
+type StartAt string
+
+const (
+	StartAtBeginning StartAt = "beginning"
+	StartAtEnd       StartAt = "end"
+)
+
+const (
+	DefaultPollInterval = 200 * time.Millisecond
+	DefaultStartAt      = StartAtEnd
+)
+
+// Log attributes of the file a record was read from.
+const (
+	attrFilePath = "log.file.path"
+	attrFileName = "log.file.name"
+)
+
+// Followed files, read records and truncated files, served on /debug/vars.
+var filelogStats = expvar.NewMap("filelog")
+
+type Config struct {
+	// Include is the glob patterns of the files to follow, as for
+	// filepath.Match.
+	Include []string
+	// Exclude is the glob patterns of the matched files to leave out.
+	Exclude []string
+	StartAt StartAt
+	// LineStartPattern, if set, is a regular expression matching the first
+	// line of a record, the lines that do not match are joined to the
+	// record before them. Otherwise each line is a record.
+	LineStartPattern string
+	// How often the files are checked for new lines.
+	PollInterval time.Duration
+	// OffsetsFile, if set, is where the read offsets are saved, to resume
+	// from them after a restart.
+	OffsetsFile string
+}
+
+// StartTailer follows the files matching cfg.Include and queues their lines
+// to the pipeline, for the default tenant. Rotated files are read to their
+// end, truncated files from their beginning. Records are delivered at least
+// once: the offsets are saved once they are queued. It returns when ctx is
+// canceled.
+func StartTailer(ctx context.Context, pl *pipeline.Pipeline, cfg Config) error {
+	if len(cfg.Include) == 0 || cfg.PollInterval <= 0 || (cfg.StartAt != StartAtBeginning && cfg.StartAt != StartAtEnd) {
+		return fmt.Errorf("invalid filelog config: %+v", cfg)
+	}
+	for _, pattern := range slices.Concat(cfg.Include, cfg.Exclude) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid filelog pattern %q: %w", pattern, err)
+		}
+	}
+	var lineStart *regexp.Regexp
+	if cfg.LineStartPattern != "" {
+		var err error
+		if lineStart, err = regexp.Compile(cfg.LineStartPattern); err != nil {
+			return fmt.Errorf("invalid filelog line start pattern: %w", err)
+		}
+	}
+
+	var saved []offset
+	if cfg.OffsetsFile != "" {
+		var err error
+		if saved, err = loadOffsets(cfg.OffsetsFile); err != nil {
+			return fmt.Errorf("failed to load filelog offsets: %w", err)
+		}
+	}
+
+	t := &tailer{
+		cfg:       cfg,
+		pipeline:  pl,
+		lineStart: lineStart,
+		saved:     saved,
+	}
+	defer t.close()
+
+	log.Printf("File tailer following %s", strings.Join(cfg.Include, ", "))
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// A file with more to read than a poll reads is polled again
+		// right away.
+		for more := true; more && ctx.Err() == nil; {
+			more = t.poll(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type tailer struct {
+	cfg       Config
+	pipeline  *pipeline.Pipeline
+	lineStart *regexp.Regexp
+	readers   []*reader
+	// saved is the offsets last saved, or loaded on start.
+	saved []offset
+	// started is set after the first poll, the files found later are new.
+	started bool
+}
+
+// match returns the absolute paths of the files matching the patterns.
+func (t *tailer) match() []string {
+	var paths []string
+	for _, pattern := range t.cfg.Include {
+		// The patterns were checked on start.
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			if !slices.Contains(paths, path) && !t.excluded(path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+func (t *tailer) excluded(path string) bool {
+	for _, pattern := range t.cfg.Exclude {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// poll reads the new lines of the files, and reports whether a file has
+// more to read.
+func (t *tailer) poll(ctx context.Context) bool {
+	found := map[*reader]bool{}
+	for _, path := range t.match() {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if i := slices.IndexFunc(t.readers, func(r *reader) bool { return os.SameFile(r.info, info) }); i >= 0 {
+			// The file may have been renamed to another matching path.
+			t.readers[i].path = path
+			found[t.readers[i]] = true
+			continue
+		}
+
+		r, err := openReader(path, t.lineStart)
+		if err != nil {
+			log.Printf("filelog: %v", err)
+			continue
+		}
+		if !t.started {
+			if offset, ok := findOffset(t.saved, r.fingerprint); ok {
+				r.offset = offset
+			} else if t.cfg.StartAt == StartAtEnd {
+				r.offset = r.info.Size()
+			}
+		}
+		filelogStats.Add("files", 1)
+		t.readers = append(t.readers, r)
+		found[r] = true
+	}
+	t.started = true
+
+	var (
+		records []record
+		states  = make([]readerState, len(t.readers))
+		done    = map[*reader]bool{}
+		more    bool
+	)
+	emit := func(rec record) {
+		records = append(records, rec)
+	}
+	for i, r := range t.readers {
+		truncated, err := r.checkTruncated()
+		if err == nil {
+			if truncated {
+				filelogStats.Add("truncated_files", 1)
+			}
+			states[i] = r.readerState
+			// A file that no longer matches was rotated away or removed,
+			// it is read to its end before it is closed.
+			var m bool
+			m, err = r.read(!found[r], emit)
+			more = more || m
+			done[r] = !found[r] && !m
+		}
+		if err != nil {
+			log.Printf("filelog: closing %s: %v", r.path, err)
+			done[r] = true
+		}
+	}
+
+	if len(records) > 0 {
+		ld := toLogs(records, pcommon.NewTimestampFromTime(time.Now()))
+		if _, err := t.pipeline.ConsumeLogs(ctx, ld); err != nil {
+			// The records are read again on the next poll.
+			log.Printf("failed to write file logs: %v", err)
+			for i, r := range t.readers {
+				r.readerState = states[i]
+			}
+			return false
+		}
+		filelogStats.Add("records", int64(len(records)))
+	}
+
+	t.readers = slices.DeleteFunc(t.readers, func(r *reader) bool {
+		if done[r] {
+			r.Close()
+		}
+		return done[r]
+	})
+	t.saveOffsets()
+	return more
+}
+
+// saveOffsets saves the offsets of the followed files, if they changed.
+func (t *tailer) saveOffsets() {
+	offsets := make([]offset, 0, len(t.readers))
+	for _, r := range t.readers {
+		if len(r.fingerprint) == 0 {
+			continue
+		}
+		offsets = append(offsets, offset{Path: r.path, Fingerprint: r.fingerprint, Offset: r.committedOffset()})
+	}
+	if t.cfg.OffsetsFile == "" || slices.EqualFunc(offsets, t.saved, func(a, b offset) bool {
+		return a.Path == b.Path && a.Offset == b.Offset && string(a.Fingerprint) == string(b.Fingerprint)
+	}) {
+		return
+	}
+	if err := saveOffsets(t.cfg.OffsetsFile, offsets); err != nil {
+		log.Printf("failed to save filelog offsets: %v", err)
+		return
+	}
+	t.saved = offsets
+}
+
+func (t *tailer) close() {
+	for _, r := range t.readers {
+		r.Close()
+	}
+}
+
+// toLogs translates records to OTLP logs, the lines are the bodies and the
+// file is the log.file.path and log.file.name attributes.
+func toLogs(records []record, observed pcommon.Timestamp) plog.Logs {
+	ld := plog.NewLogs()
+	logs := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	logs.EnsureCapacity(len(records))
+	for _, rec := range records {
+		lr := logs.AppendEmpty()
+		lr.SetObservedTimestamp(observed)
+		lr.Body().SetStr(rec.body)
+		lr.Attributes().PutStr(attrFilePath, rec.path)
+		lr.Attributes().PutStr(attrFileName, filepath.Base(rec.path))
+	}
+	return ld
+}
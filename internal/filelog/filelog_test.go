@@ -0,0 +1,138 @@
+package filelog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAll polls r once, and returns the bodies of the records read.
+func readAll(t *testing.T, r *reader, final bool) []string {
+	t.Helper()
+	if _, err := r.checkTruncated(); err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	if _, err := r.read(final, func(rec record) {
+		bodies = append(bodies, rec.body)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return bodies
+}
+
+func TestReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "first\r\nsecond\nthi")
+
+	r, err := openReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The incomplete line is left for the next read.
+	if got, want := readAll(t, r, false), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	appendFile(t, path, "rd\n\nfourth\n")
+	if got, want := readAll(t, r, false), []string{"third", "fourth"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	if got := readAll(t, r, false); got != nil {
+		t.Errorf("records = %q, want none", got)
+	}
+
+	// Truncated files start over.
+	if err := os.WriteFile(path, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readAll(t, r, false), []string{"new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records after truncation = %q, want %q", got, want)
+	}
+
+	// A file rotated away is read to its end.
+	appendFile(t, path, "last")
+	if got, want := readAll(t, r, true), []string{"last"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("final records = %q, want %q", got, want)
+	}
+}
+
+func TestReaderMultiline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "panic: boom\n\tat main.go:1\n\tat main.go:2\nINFO: ok\n\tdetail\n")
+
+	r, err := openReader(path, regexp.MustCompile(`^\S`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The last record may continue, it is pending until the file has no
+	// new lines.
+	if got, want := readAll(t, r, false), []string{"panic: boom\n\tat main.go:1\n\tat main.go:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	if r.committedOffset() != int64(len("panic: boom\n\tat main.go:1\n\tat main.go:2\n")) {
+		t.Errorf("committed offset = %d", r.committedOffset())
+	}
+	if got, want := readAll(t, r, false), []string{"INFO: ok\n\tdetail"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("idle records = %q, want %q", got, want)
+	}
+	if r.committedOffset() != r.offset {
+		t.Errorf("committed offset = %d, want %d", r.committedOffset(), r.offset)
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.json")
+	if offsets, err := loadOffsets(path); err != nil || offsets != nil {
+		t.Fatalf("loadOffsets() = %v, %v, want none", offsets, err)
+	}
+
+	offsets := []offset{
+		{Path: "/var/log/a.log", Fingerprint: []byte("line 1\n"), Offset: 7},
+		{Path: "/var/log/b.log", Fingerprint: []byte("line 1\nline 2\n"), Offset: 14},
+	}
+	if err := saveOffsets(path, offsets); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadOffsets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, offsets) {
+		t.Errorf("loadOffsets() = %+v, want %+v", loaded, offsets)
+	}
+
+	for _, tt := range []struct {
+		fingerprint string
+		offset      int64
+		ok          bool
+	}{
+		{"line 1\n", 7, true},
+		// The file grew, the longest fingerprint wins.
+		{"line 1\nline 2\nline 3\n", 14, true},
+		{"other\n", 0, false},
+		{"", 0, false},
+	} {
+		offset, ok := findOffset(loaded, []byte(tt.fingerprint))
+		if offset != tt.offset || ok != tt.ok {
+			t.Errorf("findOffset(%q) = %d, %t, want %d, %t", tt.fingerprint, offset, ok, tt.offset, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package filelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// offset is the read position of a file, saved across restarts.
+type offset struct {
+	Path        string `json:"path"`
+	Fingerprint []byte `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+}
+
+// loadOffsets reads the offsets saved in path, if it exists.
+func loadOffsets(path string) ([]offset, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var offsets []offset
+	if err := json.Unmarshal(buf, &offsets); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// saveOffsets replaces the offsets saved in path.
+func saveOffsets(path string, offsets []offset) error {
+	buf, err := json.Marshal(offsets)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// findOffset returns the saved offset of the file with fingerprint, the
+// longest matching one. A file shorter than fingerprintSize when it was
+// saved may have grown since.
+func findOffset(offsets []offset, fingerprint []byte) (int64, bool) {
+	var found *offset
+	for i, o := range offsets {
+		if len(o.Fingerprint) > 0 && bytes.HasPrefix(fingerprint, o.Fingerprint) &&
+			(found == nil || len(o.Fingerprint) > len(found.Fingerprint)) {
+			found = &offsets[i]
+		}
+	}
+	if found == nil {
+		return 0, false
+	}
+	return found.Offset, true
+}
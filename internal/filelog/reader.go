@@ -0,0 +1,184 @@
+package filelog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Files are identified by their first bytes, which survive renames and
+	// restarts, unlike paths and inode numbers.
+	fingerprintSize = 1000
+	// Longer lines are split.
+	maxLineSize = 1 << 20
+	// Most bytes read from a file per poll, so that a large file is queued
+	// in bounded batches.
+	maxReadSize = 4 << 20
+)
+
+// record is a log record read from a file.
+type record struct {
+	path string
+	body string
+}
+
+// readerState is the position of a reader. It is saved before a read and
+// restored if the records read cannot be queued.
+type readerState struct {
+	// offset is where the next read starts.
+	offset int64
+	// pending is the multiline record being joined, which started at
+	// pendingOffset.
+	pending       []string
+	pendingOffset int64
+}
+
+// reader follows one file.
+type reader struct {
+	file        *os.File
+	info        os.FileInfo
+	path        string
+	fingerprint []byte
+	lineStart   *regexp.Regexp
+	readerState
+}
+
+func openReader(path string, lineStart *regexp.Regexp) (*reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := &reader{file: f, info: info, path: path, lineStart: lineStart}
+	if r.fingerprint, err = r.readFingerprint(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *reader) Close() error {
+	return r.file.Close()
+}
+
+func (r *reader) readFingerprint() ([]byte, error) {
+	buf := make([]byte, fingerprintSize)
+	n, err := r.file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// committedOffset is the offset up to which every record was read.
+func (r *reader) committedOffset() int64 {
+	if len(r.pending) > 0 {
+		return r.pendingOffset
+	}
+	return r.offset
+}
+
+// checkTruncated starts over a file that was truncated, or overwritten with
+// different content, and updates the fingerprint of a file still shorter
+// than fingerprintSize. It reports whether the file was truncated.
+func (r *reader) checkTruncated() (bool, error) {
+	info, err := r.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	fingerprint, err := r.readFingerprint()
+	if err != nil {
+		return false, err
+	}
+
+	truncated := info.Size() < r.offset || !bytes.HasPrefix(fingerprint, r.fingerprint)
+	if truncated {
+		r.readerState = readerState{}
+	}
+	r.fingerprint = fingerprint
+	return truncated, nil
+}
+
+// read calls emit with the records appended to the file since the last
+// read, up to maxReadSize bytes, and reports whether there is more to read.
+// An incomplete last line is left for the next read, unless final is set,
+// as for a file that was rotated away. A multiline record is only emitted
+// once the next one starts, or when the file has no new lines.
+func (r *reader) read(final bool, emit func(record)) (more bool, err error) {
+	if _, err := r.file.Seek(r.offset, io.SeekStart); err != nil {
+		return false, err
+	}
+	br := bufio.NewReaderSize(io.LimitReader(r.file, maxReadSize), 64<<10)
+
+	var (
+		line []byte
+		read int64
+	)
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull) && len(line) < maxLineSize:
+			continue
+		case errors.Is(err, io.EOF):
+			more = read+int64(len(line)) >= maxReadSize
+			// The file is not at its end yet.
+			final = final && !more
+			if final && len(line) > 0 {
+				r.addLine(line, emit)
+				read += int64(len(line))
+				r.offset += int64(len(line))
+			}
+			if read == 0 || final {
+				r.flush(emit)
+			}
+			return more, nil
+		case err != nil && !errors.Is(err, bufio.ErrBufferFull):
+			return false, err
+		}
+
+		r.addLine(line, emit)
+		read += int64(len(line))
+		r.offset += int64(len(line))
+		line = line[:0]
+	}
+}
+
+// addLine adds the line that ends at r.offset+len(line) to the pending
+// record, or emits it.
+func (r *reader) addLine(line []byte, emit func(record)) {
+	text := strings.ToValidUTF8(strings.TrimRight(string(line), "\r\n"), "�")
+	if r.lineStart == nil {
+		if text != "" {
+			emit(record{path: r.path, body: text})
+		}
+		return
+	}
+
+	if r.lineStart.MatchString(text) || len(r.pending) == 0 {
+		r.flush(emit)
+		r.pendingOffset = r.offset
+	}
+	r.pending = append(r.pending, text)
+}
+
+// flush emits the pending multiline record.
+func (r *reader) flush(emit func(record)) {
+	if len(r.pending) == 0 {
+		return
+	}
+	body := strings.TrimRight(strings.Join(r.pending, "\n"), "\n")
+	if body != "" {
+		emit(record{path: r.path, body: body})
+	}
+	r.pending = nil
+}
@@ -0,0 +1,286 @@
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The encode functions write the MessagePack subset the tests need, in the
+// smallest encodings as Fluent Bit does.
+
+func encodeValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		switch {
+		case v >= 0 && v <= 0x7f:
+			return append(b, byte(v))
+		case v >= -32 && v < 0:
+			return append(b, byte(int8(v)))
+		default:
+			b = append(b, 0xd3)
+			return binary.BigEndian.AppendUint64(b, uint64(v))
+		}
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case string:
+		if len(v) < 32 {
+			b = append(b, 0xa0|byte(len(v)))
+		} else {
+			b = append(b, 0xda)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+		}
+		return append(b, v...)
+	case []byte:
+		b = append(b, 0xc4, byte(len(v)))
+		return append(b, v...)
+	case time.Time:
+		b = append(b, 0xd7, eventTimeExt)
+		b = binary.BigEndian.AppendUint32(b, uint32(v.Unix()))
+		return binary.BigEndian.AppendUint32(b, uint32(v.Nanosecond()))
+	case []any:
+		b = append(b, 0xdc)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+		for _, e := range v {
+			b = encodeValue(b, e)
+		}
+		return b
+	case map[string]any:
+		b = append(b, 0xde)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+		for k, e := range v {
+			b = encodeValue(b, k)
+			b = encodeValue(b, e)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+func decodeBytes(t *testing.T, buf []byte) any {
+	t.Helper()
+	v, err := newDecoder(bytes.NewReader(buf)).decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecoder(t *testing.T) {
+	in := map[string]any{
+		"nil":    nil,
+		"bool":   true,
+		"fixint": 5,
+		"negint": -3,
+		"int":    -100000,
+		"float":  1.5,
+		"str":    "a string longer than thirty-one bytes",
+		"bin":    []byte{1, 2},
+		"array":  []any{"a", 1},
+	}
+	want := map[string]any{
+		"nil":    nil,
+		"bool":   true,
+		"fixint": int64(5),
+		"negint": int64(-3),
+		"int":    int64(-100000),
+		"float":  1.5,
+		"str":    "a string longer than thirty-one bytes",
+		"bin":    []byte{1, 2},
+		"array":  []any{"a", int64(1)},
+	}
+
+	buf := encodeValue(nil, in)
+	if got := decodeBytes(t, buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	for n := 1; n < len(buf); n++ {
+		if _, err := newDecoder(bytes.NewReader(buf[:n])).decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("decoding %d of %d bytes: got %v, want %v", n, len(buf), err, io.ErrUnexpectedEOF)
+		}
+	}
+	if _, err := newDecoder(bytes.NewReader(nil)).decode(); err != io.EOF {
+		t.Errorf("decoding an empty stream: got %v, want EOF", err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	// A str32 read in several chunks.
+	long := strings.Repeat("x", 3*readChunkSize+1)
+	str32 := binary.BigEndian.AppendUint32([]byte{0xdb}, uint32(len(long)))
+	if got := decodeBytes(t, append(str32, long...)); got != long {
+		t.Errorf("decoding a str32 of %d bytes: got %d bytes", len(long), len(got.(string)))
+	}
+
+	// A str32 header declaring more bytes than the stream holds.
+	truncated := []byte{0xdb, 0x02, 0x00, 0x00, 0x00, 'a', 'b', 'c'}
+	if _, err := newDecoder(bytes.NewReader(truncated)).decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("decoding a truncated str32: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	tooLarge := []byte{0xdb, 0xff, 0xff, 0xff, 0xff}
+	if _, err := newDecoder(bytes.NewReader(tooLarge)).decode(); !errors.Is(err, errTooLarge) {
+		t.Errorf("decoding a str32 larger than the limit: got %v, want %v", err, errTooLarge)
+	}
+
+	// Values under the limit, in a message over it.
+	buf := encodeValue(nil, []any{strings.Repeat("a", 600), strings.Repeat("b", 600)})
+	dec := newDecoder(bytes.NewReader(append(buf, buf...)))
+	dec.maxSize = 1000
+	if _, err := dec.decode(); !errors.Is(err, errTooLarge) {
+		t.Errorf("decoding a message larger than the limit: got %v, want %v", err, errTooLarge)
+	}
+	dec = newDecoder(bytes.NewReader(append(buf, buf...)))
+	dec.maxSize = len(buf)
+	for range 2 {
+		if _, err := dec.decode(); err != nil {
+			t.Errorf("decoding messages at the limit: %v", err)
+		}
+	}
+}
+
+var testTime = time.Unix(1700000000, 123)
+
+func TestDecodeMessage(t *testing.T) {
+	record := map[string]any{"log": "hello", "level": "info"}
+	wantRecord := map[string]any{"log": "hello", "level": "info"}
+	option := map[string]any{"chunk": "c1"}
+
+	var packed []byte
+	packed = encodeValue(packed, []any{testTime, record})
+	packed = encodeValue(packed, []any{1700000000, record})
+
+	var compressed bytes.Buffer
+	// Two gzip members, as Fluent Bit sends for appended chunks.
+	for _, entry := range [][]any{{testTime, record}, {1700000000, record}} {
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(encodeValue(nil, entry))
+		zw.Close()
+	}
+
+	twoEvents := []Event{
+		{Tag: "app", Time: testTime, Record: wantRecord},
+		{Tag: "app", Time: time.Unix(1700000000, 0), Record: wantRecord},
+	}
+
+	tests := []struct {
+		name      string
+		msg       []any
+		want      []Event
+		wantChunk string
+	}{
+		{
+			name: "message",
+			msg:  []any{"app", testTime, record},
+			want: []Event{{Tag: "app", Time: testTime, Record: wantRecord}},
+		},
+		{
+			name:      "message with option",
+			msg:       []any{"app", 1700000000, record, option},
+			want:      []Event{{Tag: "app", Time: time.Unix(1700000000, 0), Record: wantRecord}},
+			wantChunk: "c1",
+		},
+		{
+			name:      "forward",
+			msg:       []any{"app", []any{[]any{testTime, record}, []any{1700000000, record}}, option},
+			want:      twoEvents,
+			wantChunk: "c1",
+		},
+		{
+			name: "packed forward",
+			msg:  []any{"app", packed},
+			want: twoEvents,
+		},
+		{
+			name:      "compressed packed forward",
+			msg:       []any{"app", compressed.Bytes(), map[string]any{"compressed": "gzip", "chunk": "c2"}},
+			want:      twoEvents,
+			wantChunk: "c2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, chunk, err := DecodeMessage(decodeBytes(t, encodeValue(nil, tt.msg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("events = %+v, want %+v", events, tt.want)
+			}
+			if chunk != tt.wantChunk {
+				t.Errorf("chunk = %q, want %q", chunk, tt.wantChunk)
+			}
+		})
+	}
+
+	for _, msg := range []any{
+		"app",
+		[]any{"app"},
+		[]any{1, 1700000000, record},
+		[]any{"app", 1700000000},
+		[]any{"app", "not msgpack \xc1"},
+		[]any{"app", []any{[]any{"now", record}}},
+		[]any{"app", []any{[]any{1700000000, "record"}}},
+		[]any{"app", []byte{}, map[string]any{"compressed": "lz4"}},
+	} {
+		if _, _, err := DecodeMessage(decodeBytes(t, encodeValue(nil, msg))); !errors.Is(err, errMalformedMessage) {
+			t.Errorf("DecodeMessage(%v) error = %v, want %v", msg, err, errMalformedMessage)
+		}
+	}
+}
+
+func TestAppendAck(t *testing.T) {
+	for _, chunk := range []string{"c1", string(make([]byte, 40)), string(make([]byte, 300))} {
+		got := decodeBytes(t, appendAck(nil, chunk))
+		if want := map[string]any{"ack": chunk}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ack of a %d byte chunk = %v", len(chunk), got)
+		}
+	}
+}
+
+func TestToLogs(t *testing.T) {
+	ld := ToLogs([]Event{
+		{Tag: "app", Time: testTime, Record: map[string]any{
+			"message": "ignored, log takes precedence",
+			"log":     "hello",
+			"nested":  map[string]any{"a": []any{int64(1), "b"}},
+		}},
+		{Tag: "app", Time: testTime, Record: map[string]any{"level": "info"}},
+	})
+	if ld.LogRecordCount() != 2 {
+		t.Fatalf("got %d log records, want 2", ld.LogRecordCount())
+	}
+
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	lr := records.At(0)
+	if lr.Body().Str() != "hello" || lr.Timestamp().AsTime() != testTime.UTC() {
+		t.Errorf("log record = %q at %v", lr.Body().Str(), lr.Timestamp())
+	}
+	wantAttrs := map[string]any{
+		"fluent.tag": "app",
+		"message":    "ignored, log takes precedence",
+		"nested":     map[string]any{"a": []any{int64(1), "b"}},
+	}
+	if got := lr.Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+
+	if body := records.At(1).Body(); body.Str() != "" {
+		t.Errorf("body without a log field = %q, want empty", body.Str())
+	}
+}
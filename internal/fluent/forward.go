@@ -0,0 +1,176 @@
+// Package fluent receives logs from Fluent Bit and Fluentd over the Forward
+// protocol and translates them to OTLP logs.
+//
+// The Message, Forward, PackedForward and CompressedPackedForward modes
+// are supported, with acknowledgements. The handshake of shared key
+// authentication is not.
+// Ref: https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1.5
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event is a Fluent event, a record of a tag at a point in time.
+type Event struct {
+	Tag    string
+	Time   time.Time
+	Record map[string]any
+}
+
+// Extension type of EventTime, seconds and nanoseconds as two big endian
+// 32-bit integers.
+const eventTimeExt = 0
+
+// Upper bound of the entries of a CompressedPackedForward message after
+// decompression.
+const maxDecompressedSize = 64 << 20
+
+var errMalformedMessage = errors.New("malformed forward message")
+
+// DecodeMessage decodes a message of any mode to its events, and the chunk
+// ID the client asks to acknowledge, if any.
+func DecodeMessage(v any) (events []Event, chunk string, err error) {
+	msg, ok := v.([]any)
+	if !ok || len(msg) < 2 {
+		return nil, "", fmt.Errorf("%w: not an array of at least 2 values", errMalformedMessage)
+	}
+	tag, ok := msg[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: tag is not a string", errMalformedMessage)
+	}
+
+	var entries []any
+	var option any
+	switch second := msg[1].(type) {
+	case []any:
+		// Forward mode: [tag, [[time, record], ...], option]
+		entries = second
+		option = optionalValue(msg, 2)
+	case string, []byte:
+		// PackedForward mode: [tag, msgpack stream of [time, record], option]
+		option = optionalValue(msg, 2)
+		entries, err = unpackEntries(second, option)
+		if err != nil {
+			return nil, "", err
+		}
+	default:
+		// Message mode: [tag, time, record, option]
+		if len(msg) < 3 {
+			return nil, "", fmt.Errorf("%w: message without a record", errMalformedMessage)
+		}
+		entries = []any{[]any{msg[1], msg[2]}}
+		option = optionalValue(msg, 3)
+	}
+
+	if opts, ok := option.(map[string]any); ok {
+		chunk, _ = opts["chunk"].(string)
+	}
+
+	events = make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		event, err := decodeEntry(tag, entry)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, event)
+	}
+	return events, chunk, nil
+}
+
+func optionalValue(msg []any, i int) any {
+	if i < len(msg) {
+		return msg[i]
+	}
+	return nil
+}
+
+// unpackEntries decodes the entries of a PackedForward message, decompressing
+// them if the option says they are.
+func unpackEntries(packed any, option any) ([]any, error) {
+	var buf []byte
+	switch p := packed.(type) {
+	case string:
+		buf = []byte(p)
+	case []byte:
+		buf = p
+	}
+
+	var r io.Reader = bytes.NewReader(buf)
+	if opts, ok := option.(map[string]any); ok {
+		switch compressed, _ := opts["compressed"].(string); compressed {
+		case "", "text":
+		case "gzip":
+			// Clients may send several gzip members, which the reader
+			// concatenates.
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errMalformedMessage, err)
+			}
+			defer zr.Close()
+			decompressed, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errMalformedMessage, err)
+			}
+			if len(decompressed) > maxDecompressedSize {
+				return nil, fmt.Errorf("%w: entries exceed %d bytes after decompression", errMalformedMessage, maxDecompressedSize)
+			}
+			r = bytes.NewReader(decompressed)
+		default:
+			return nil, fmt.Errorf("%w: unsupported compression %q", errMalformedMessage, compressed)
+		}
+	}
+
+	var entries []any
+	dec := newDecoder(r)
+	for {
+		entry, err := dec.decode()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errMalformedMessage, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func decodeEntry(tag string, v any) (Event, error) {
+	entry, ok := v.([]any)
+	if !ok || len(entry) < 2 {
+		return Event{}, fmt.Errorf("%w: entry is not a [time, record] array", errMalformedMessage)
+	}
+	t, err := decodeTime(entry[0])
+	if err != nil {
+		return Event{}, err
+	}
+	record, ok := entry[1].(map[string]any)
+	if !ok {
+		return Event{}, fmt.Errorf("%w: record is not a map", errMalformedMessage)
+	}
+	return Event{Tag: tag, Time: t, Record: record}, nil
+}
+
+func decodeTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0), nil
+	case uint64:
+		return time.Unix(int64(t), 0), nil
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))), nil
+	case ext:
+		if t.typ == eventTimeExt && len(t.data) == 8 {
+			seconds := binary.BigEndian.Uint32(t.data[:4])
+			nanos := binary.BigEndian.Uint32(t.data[4:])
+			return time.Unix(int64(seconds), int64(nanos)), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid time %v", errMalformedMessage, v)
+}
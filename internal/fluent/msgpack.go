@@ -0,0 +1,280 @@
+package fluent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// Limits of a value decoded from the stream, a forward message or a packed
+// entry. The size counts the bytes of the encoded value, which bounds what
+// the decoder allocates for it.
+const (
+	maxValueSize  = 64 << 20
+	maxValueDepth = 64
+)
+
+// Strings and binaries are read in chunks of up to readChunkSize, so that a
+// length prefix alone does not allocate more than the stream holds.
+const readChunkSize = 64 << 10
+
+var errTooLarge = errors.New("msgpack value too large")
+
+// ext is a MessagePack extension value.
+type ext struct {
+	typ  int8
+	data []byte
+}
+
+// decoder reads MessagePack values from a stream. Values are decoded to
+// nil, bool, int64, uint64, float64, string, []byte, []any, map[string]any
+// and ext. Map keys that are not strings are formatted with %v.
+// Ref: https://github.com/msgpack/msgpack/blob/master/spec.md
+type decoder struct {
+	r *bufio.Reader
+	// Largest value, and bytes the current value may still read.
+	maxSize   int
+	remaining int
+}
+
+func newDecoder(r io.Reader) *decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &decoder{r: br, maxSize: maxValueSize}
+}
+
+// decode reads the next value. It returns io.EOF if the stream ends before
+// the value starts, and io.ErrUnexpectedEOF if it ends inside it.
+func (d *decoder) decode() (any, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+	d.remaining = d.maxSize
+	v, err := d.value(0)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxValueDepth {
+		return nil, errors.New("msgpack value nested too deep")
+	}
+
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b >= 0x80 && b <= 0x8f:
+		return d.mapValue(int(b&0x0f), depth)
+	case b >= 0x90 && b <= 0x9f:
+		return d.arrayValue(int(b&0x0f), depth)
+	case b >= 0xa0 && b <= 0xbf:
+		return d.str(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(b - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(b - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (b - 0xcc))
+	case 0xd0:
+		v, err := d.uint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.uint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.uint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.uint(8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(b - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(b - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayValue(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(b - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	}
+	return nil, fmt.Errorf("invalid msgpack type 0x%x", b)
+}
+
+// take counts n more bytes of the current value.
+func (d *decoder) take(n int) error {
+	if n > d.remaining {
+		return errTooLarge
+	}
+	d.remaining -= n
+	return nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	if err := d.take(1); err != nil {
+		return 0, err
+	}
+	return d.r.ReadByte()
+}
+
+// uint reads a big endian unsigned integer of size bytes.
+func (d *decoder) uint(size int) (uint64, error) {
+	if err := d.take(size); err != nil {
+		return 0, err
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// length reads a length of 1, 2 or 4 bytes for sizeClass 0, 1 or 2. Each
+// byte, element or entry takes at least a byte, so a length larger than the
+// rest of the value is rejected before it is read.
+func (d *decoder) length(sizeClass byte) (int, error) {
+	n, err := d.uint(1 << sizeClass)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(d.remaining) {
+		return 0, errTooLarge
+	}
+	return int(n), nil
+}
+
+// bytes reads n bytes. The buffer grows as they arrive, n comes from the
+// stream.
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if err := d.take(n); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, min(n, readChunkSize))
+	for len(buf) < n {
+		if len(buf) == cap(buf) {
+			buf = slices.Grow(buf, min(n-len(buf), len(buf)))
+		}
+		read, err := io.ReadFull(d.r, buf[len(buf):min(n, cap(buf))])
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func (d *decoder) str(n int) (string, error) {
+	buf, err := d.bytes(n)
+	return string(buf), err
+}
+
+func (d *decoder) ext(n int) (ext, error) {
+	typ, err := d.readByte()
+	if err != nil {
+		return ext{}, err
+	}
+	data, err := d.bytes(n)
+	return ext{typ: int8(typ), data: data}, err
+}
+
+func (d *decoder) arrayValue(n, depth int) ([]any, error) {
+	// n comes from the stream, the slice grows as values are read.
+	values := make([]any, 0, min(n, 1024))
+	for range n {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (d *decoder) mapValue(n, depth int) (map[string]any, error) {
+	m := make(map[string]any, min(n, 1024))
+	for range n {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k := k.(type) {
+		case string:
+			m[k] = v
+		case []byte:
+			m[string(k)] = v
+		default:
+			m[fmt.Sprint(k)] = v
+		}
+	}
+	return m, nil
+}
+
+// appendAck appends the MessagePack encoding of {"ack": chunk}.
+func appendAck(b []byte, chunk string) []byte {
+	b = append(b, 0x81, 0xa3, 'a', 'c', 'k')
+	switch n := len(chunk); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 1<<8:
+		b = append(b, 0xd9, byte(n))
+	case n < 1<<16:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, chunk...)
+}
@@ -0,0 +1,105 @@
+package fluent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+)
+
+const (
+	// Time a client has to send the next message, idle connections are
+	// closed after it.
+	readTimeout = time.Minute
+	// Time a client has to read an acknowledgement.
+	ackTimeout = 10 * time.Second
+)
+
+// Received and malformed messages, served on /debug/vars.
+var fluentStats = expvar.NewMap("fluent")
+
+type ServerConfig struct {
+	Addr string
+	// TLS, if set, is used to serve the Forward protocol over TLS.
+	TLS *tls.Config
+}
+
+// StartServer listens for Forward protocol connections at cfg.Addr and
+// queues their events to the pipeline, for the default tenant. Chunks are
+// acknowledged once queued, a client whose events cannot be queued is
+// disconnected without an acknowledgement and resends them.
+func StartServer(ctx context.Context, pl *pipeline.Pipeline, cfg ServerConfig) error {
+	lis, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if cfg.TLS != nil {
+		lis = tls.NewListener(lis, cfg.TLS)
+	}
+
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
+	log.Printf("Fluent Forward server listening on %s (tls=%t)", lis.Addr(), cfg.TLS != nil)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveConn(ctx, pl, conn)
+	}
+}
+
+func serveConn(ctx context.Context, pl *pipeline.Pipeline, conn net.Conn) {
+	defer conn.Close()
+
+	dec := newDecoder(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		v, err := dec.decode()
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+		if err != nil {
+			fluentStats.Add("invalid_messages", 1)
+			log.Printf("fluent: closing connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		fluentStats.Add("messages", 1)
+		events, chunk, err := DecodeMessage(v)
+		if err != nil {
+			fluentStats.Add("invalid_messages", 1)
+			log.Printf("fluent: closing connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		if len(events) > 0 {
+			// Fluent has no partial success, rejected events are only
+			// counted in the pipeline stats.
+			if _, err := pl.ConsumeLogs(ctx, ToLogs(events)); err != nil {
+				log.Printf("fluent: closing connection from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+
+		if chunk != "" {
+			conn.SetWriteDeadline(time.Now().Add(ackTimeout))
+			if _, err := conn.Write(appendAck(nil, chunk)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package fluent
+
+import (
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Attribute holding the tag of an event, as in the OTel Collector's Fluent
+// Forward receiver.
+const attrTag = "fluent.tag"
+
+// Record fields holding the message of an event, in order of precedence.
+var bodyFields = []string{"log", "message"}
+
+// ToLogs translates events to OTLP logs. The log or message field of a
+// record becomes the body, the other fields and the tag become attributes.
+func ToLogs(events []Event) plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	records.EnsureCapacity(len(events))
+
+	for _, event := range events {
+		lr := records.AppendEmpty()
+		lr.SetTimestamp(pcommon.NewTimestampFromTime(event.Time))
+		lr.Attributes().PutStr(attrTag, event.Tag)
+
+		bodyField := ""
+		for _, field := range bodyFields {
+			if v, ok := event.Record[field]; ok {
+				bodyField = field
+				putValue(lr.Body(), v)
+				break
+			}
+		}
+		for k, v := range event.Record {
+			if k == bodyField {
+				continue
+			}
+			putValue(lr.Attributes().PutEmpty(k), v)
+		}
+	}
+
+	return ld
+}
+
+// putValue sets dest to a decoded MessagePack value.
+func putValue(dest pcommon.Value, v any) {
+	switch v := v.(type) {
+	case bool:
+		dest.SetBool(v)
+	case int64:
+		dest.SetInt(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			dest.SetDouble(float64(v))
+		} else {
+			dest.SetInt(int64(v))
+		}
+	case float64:
+		dest.SetDouble(v)
+	case string:
+		dest.SetStr(v)
+	case []byte:
+		dest.SetEmptyBytes().FromRaw(v)
+	case ext:
+		dest.SetEmptyBytes().FromRaw(v.data)
+	case []any:
+		s := dest.SetEmptySlice()
+		s.EnsureCapacity(len(v))
+		for _, e := range v {
+			putValue(s.AppendEmpty(), e)
+		}
+	case map[string]any:
+		m := dest.SetEmptyMap()
+		m.EnsureCapacity(len(v))
+		for k, e := range v {
+			putValue(m.PutEmpty(k), e)
+		}
+	}
+}
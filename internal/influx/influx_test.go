@@ -0,0 +1,112 @@
+package influx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestParseLines(t *testing.T) {
+	body := `# comment
+cpu,host=server\ 01,region=us-west usage_idle=92.5,usage_user=3i 1700000000000000000
+weather\,daily temp=-1.5e1,ok=t,up=7u,note="say \"hi\", ok"
+
+mem free=1 1700000000
+bad line
+cpu usage=NaN
+disk,path= used=1
+`
+	points, errs := ParseLines([]byte(body), time.Nanosecond)
+	want := []Point{
+		{
+			Measurement: "cpu",
+			Tags:        []Tag{{"host", "server 01"}, {"region", "us-west"}},
+			Fields:      []Field{{"usage_idle", 92.5}, {"usage_user", int64(3)}},
+			Time:        time.Unix(1700000000, 0),
+		},
+		{
+			Measurement: "weather,daily",
+			Fields:      []Field{{"temp", -15.0}, {"ok", true}, {"up", uint64(7)}, {"note", `say "hi", ok`}},
+		},
+		{
+			Measurement: "mem",
+			Fields:      []Field{{"free", 1.0}},
+			Time:        time.Unix(1, 700000000),
+		},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("points = %+v, want %+v", points, want)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("errors = %v, want 3", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "unable to parse 'bad line'") {
+		t.Errorf("error = %v", errs[0])
+	}
+
+	points, errs = ParseLines([]byte("mem free=1 1700000000"), time.Second)
+	if len(errs) != 0 || !points[0].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("point at second precision = %+v, %v", points, errs)
+	}
+	if _, errs := ParseLines([]byte("mem free=1 9223372036854775807"), time.Second); len(errs) != 1 {
+		t.Errorf("overflowing timestamp errors = %v", errs)
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for precision, want := range map[string]time.Duration{
+		"":   time.Nanosecond,
+		"ns": time.Nanosecond,
+		"n":  time.Nanosecond,
+		"us": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"h":  time.Hour,
+	} {
+		if got, err := ParsePrecision(precision); err != nil || got != want {
+			t.Errorf("ParsePrecision(%q) = %v, %v, want %v", precision, got, err, want)
+		}
+	}
+	if _, err := ParsePrecision("d"); err == nil {
+		t.Error("ParsePrecision(d) succeeded")
+	}
+}
+
+func TestToMetrics(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+	points := []Point{
+		{Measurement: "cpu", Tags: []Tag{{"host", "a"}}, Fields: []Field{{"usage", 1.5}, {"up", true}}, Time: time.Unix(1700000000, 0)},
+		{Measurement: "cpu", Tags: []Tag{{"host", "b"}}, Fields: []Field{{"usage", int64(2)}, {"note", "x"}}},
+	}
+	md, skipped := ToMetrics(points, now)
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want 1", skipped)
+	}
+
+	metrics := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	if metrics.Len() != 2 {
+		t.Fatalf("metric count = %d, want 2", metrics.Len())
+	}
+	usage := metrics.At(0)
+	if usage.Name() != "cpu_usage" || usage.Type() != pmetric.MetricTypeGauge || usage.Gauge().DataPoints().Len() != 2 {
+		t.Fatalf("metric = %s %v", usage.Name(), usage.Type())
+	}
+	dp := usage.Gauge().DataPoints().At(0)
+	if dp.DoubleValue() != 1.5 || dp.Timestamp() != pcommon.NewTimestampFromTime(time.Unix(1700000000, 0)) {
+		t.Errorf("data point = %v at %v", dp.DoubleValue(), dp.Timestamp())
+	}
+	if got := dp.Attributes().AsRaw(); !reflect.DeepEqual(got, map[string]any{"host": "a"}) {
+		t.Errorf("attributes = %v", got)
+	}
+	dp = usage.Gauge().DataPoints().At(1)
+	if dp.IntValue() != 2 || dp.Timestamp() != pcommon.NewTimestampFromTime(now) {
+		t.Errorf("data point = %v at %v", dp.IntValue(), dp.Timestamp())
+	}
+	if up := metrics.At(1); up.Name() != "cpu_up" || up.Gauge().DataPoints().At(0).IntValue() != 1 {
+		t.Errorf("metric = %s", up.Name())
+	}
+}
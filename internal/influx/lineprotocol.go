@@ -0,0 +1,226 @@
+// Package influx parses the InfluxDB line protocol.
+// Ref: https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/
+package influx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a line: a measurement, its tags and fields, and the time of the
+// line, zero if it has none.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	Time        time.Time
+}
+
+type Tag struct {
+	Key, Value string
+}
+
+// Field is a field of a point. Value is a float64, int64, uint64, string or
+// bool.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// ParsePrecision returns the unit of the timestamps of a write request, from
+// its precision parameter. The 1.x names n, u, m and h are accepted as well.
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid precision %q, expected one of ns, us, ms, s", precision)
+}
+
+// ParseLines parses the lines of body, timestamps being in units of
+// precision. It returns the points of the valid lines, and the errors of
+// the others, as InfluxDB writes the valid lines of a request.
+func ParseLines(body []byte, precision time.Duration) ([]Point, []error) {
+	var (
+		points []Point
+		errs   []error
+	)
+	for line := range bytes.Lines(body) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		p, err := parseLine(string(line), precision)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse '%s': %w", line, err))
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, errs
+}
+
+var (
+	errMissingMeasurement = errors.New("missing measurement")
+	errMissingFields      = errors.New("missing fields")
+	errMissingTagValue    = errors.New("missing tag value")
+	errMissingFieldValue  = errors.New("missing field value")
+	errUnterminatedString = errors.New("unterminated string field")
+	errInvalidTimestamp   = errors.New("invalid timestamp")
+)
+
+// scanner reads the elements of a line.
+type scanner struct {
+	line string
+	pos  int
+}
+
+// token reads up to the first unescaped byte of stop. A backslash escapes
+// the bytes of escapable, and is kept before any other byte.
+func (s *scanner) token(stop, escapable string) string {
+	var b strings.Builder
+	for s.pos < len(s.line) {
+		c := s.line[s.pos]
+		if c == '\\' && s.pos+1 < len(s.line) && strings.IndexByte(escapable, s.line[s.pos+1]) >= 0 {
+			b.WriteByte(s.line[s.pos+1])
+			s.pos += 2
+			continue
+		}
+		if strings.IndexByte(stop, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+		s.pos++
+	}
+	return b.String()
+}
+
+// peek returns the next byte, or 0 at the end of the line.
+func (s *scanner) peek() byte {
+	if s.pos < len(s.line) {
+		return s.line[s.pos]
+	}
+	return 0
+}
+
+func (s *scanner) skipSpaces() {
+	for s.pos < len(s.line) && s.line[s.pos] == ' ' {
+		s.pos++
+	}
+}
+
+func parseLine(line string, precision time.Duration) (Point, error) {
+	s := &scanner{line: line}
+	var p Point
+
+	p.Measurement = s.token(", ", ", ")
+	if p.Measurement == "" {
+		return p, errMissingMeasurement
+	}
+
+	for s.peek() == ',' {
+		s.pos++
+		key := s.token("=, ", ",= ")
+		if s.peek() != '=' || key == "" {
+			return p, fmt.Errorf("invalid tag %q", key)
+		}
+		s.pos++
+		value := s.token(", ", ",= ")
+		if value == "" {
+			return p, errMissingTagValue
+		}
+		p.Tags = append(p.Tags, Tag{Key: key, Value: value})
+	}
+
+	s.skipSpaces()
+	for {
+		key := s.token("=, ", ",= ")
+		if key == "" {
+			return p, errMissingFields
+		}
+		if s.peek() != '=' {
+			return p, fmt.Errorf("invalid field %q", key)
+		}
+		s.pos++
+		value, err := s.fieldValue()
+		if err != nil {
+			return p, fmt.Errorf("field %q: %w", key, err)
+		}
+		p.Fields = append(p.Fields, Field{Key: key, Value: value})
+		if s.peek() != ',' {
+			break
+		}
+		s.pos++
+	}
+
+	s.skipSpaces()
+	if s.pos < len(s.line) {
+		ts, err := strconv.ParseInt(s.line[s.pos:], 10, 64)
+		if err != nil {
+			return p, errInvalidTimestamp
+		}
+		if ts > math.MaxInt64/int64(precision) || ts < math.MinInt64/int64(precision) {
+			return p, errInvalidTimestamp
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+	return p, nil
+}
+
+func (s *scanner) fieldValue() (any, error) {
+	if s.peek() == '"' {
+		s.pos++
+		var b strings.Builder
+		for s.pos < len(s.line) {
+			c := s.line[s.pos]
+			switch {
+			case c == '\\' && s.pos+1 < len(s.line) && (s.line[s.pos+1] == '"' || s.line[s.pos+1] == '\\'):
+				b.WriteByte(s.line[s.pos+1])
+				s.pos += 2
+			case c == '"':
+				s.pos++
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+				s.pos++
+			}
+		}
+		return nil, errUnterminatedString
+	}
+
+	value := s.token(", ", "")
+	switch value {
+	case "":
+		return nil, errMissingFieldValue
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	switch value[len(value)-1] {
+	case 'i':
+		return strconv.ParseInt(value[:len(value)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(value[:len(value)-1], 10, 64)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("invalid number %q", value)
+	}
+	return f, nil
+}
@@ -0,0 +1,79 @@
+package influx
+
+import (
+	"math"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// ToMetrics translates points to OTLP gauges:
+//
+//   - Each field is a data point of the gauge named "<measurement>_<field>",
+//     as Telegraf names the metrics it converts to OTLP.
+//   - Tags become data point attributes.
+//   - Booleans become 1 and 0. Strings have no numeric value, they are
+//     skipped and counted in the returned number.
+//
+// Points without a timestamp are at now.
+func ToMetrics(points []Point, now time.Time) (pmetric.Metrics, int) {
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+	gauges := map[string]pmetric.NumberDataPointSlice{}
+
+	skipped := 0
+	for _, p := range points {
+		ts := p.Time
+		if ts.IsZero() {
+			ts = now
+		}
+
+		for _, f := range p.Fields {
+			if _, ok := f.Value.(string); ok {
+				skipped++
+				continue
+			}
+
+			name := p.Measurement + "_" + f.Key
+			dps, ok := gauges[name]
+			if !ok {
+				m := metrics.AppendEmpty()
+				m.SetName(name)
+				dps = m.SetEmptyGauge().DataPoints()
+				gauges[name] = dps
+			}
+
+			dp := dps.AppendEmpty()
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+			setValue(dp, f.Value)
+			attrs := dp.Attributes()
+			attrs.EnsureCapacity(len(p.Tags))
+			for _, tag := range p.Tags {
+				attrs.PutStr(tag.Key, tag.Value)
+			}
+		}
+	}
+	return md, skipped
+}
+
+func setValue(dp pmetric.NumberDataPoint, value any) {
+	switch v := value.(type) {
+	case float64:
+		dp.SetDoubleValue(v)
+	case int64:
+		dp.SetIntValue(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			dp.SetDoubleValue(float64(v))
+		} else {
+			dp.SetIntValue(int64(v))
+		}
+	case bool:
+		if v {
+			dp.SetIntValue(1)
+		} else {
+			dp.SetIntValue(0)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package jaeger decodes Jaeger span batches, from the api_v2 protobuf
+// model or the Thrift binary protocol, and translates them to OTLP traces.
+//
+// Both encodings are decoded by hand into the same model so that the Jaeger
+// and Thrift modules are not needed for a handful of messages.
+// Ref: https://github.com/jaegertracing/jaeger-idl
+package jaeger
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire"
+)
+
+// Batch is the spans of one process.
+type Batch struct {
+	Process Process
+	Spans   []Span
+}
+
+type Process struct {
+	ServiceName string
+	Tags        []KeyValue
+}
+
+type Span struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// ParentSpanID is only set by the Thrift encoding, the protobuf encoding
+	// has a CHILD_OF reference instead.
+	ParentSpanID  [8]byte
+	OperationName string
+	References    []SpanRef
+	Flags         uint32
+	StartTime     time.Time
+	Duration      time.Duration
+	Tags          []KeyValue
+	Logs          []Log
+	// Process, if set, overrides the process of the batch.
+	Process *Process
+}
+
+type SpanRefType int32
+
+const (
+	ChildOf     SpanRefType = 0
+	FollowsFrom SpanRefType = 1
+)
+
+type SpanRef struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	RefType SpanRefType
+}
+
+type Log struct {
+	Timestamp time.Time
+	Fields    []KeyValue
+}
+
+// ValueType is the type of a KeyValue, with the values of the protobuf
+// encoding.
+type ValueType int32
+
+const (
+	ValueTypeString  ValueType = 0
+	ValueTypeBool    ValueType = 1
+	ValueTypeInt64   ValueType = 2
+	ValueTypeFloat64 ValueType = 3
+	ValueTypeBinary  ValueType = 4
+)
+
+// KeyValue is a tag or a log field. The field of Type holds the value.
+type KeyValue struct {
+	Key     string
+	Type    ValueType
+	Str     string
+	Bool    bool
+	Int64   int64
+	Float64 float64
+	Binary  []byte
+}
+
+// DecodePostSpansRequest decodes an api_v2 PostSpansRequest, the message of
+// CollectorService.PostSpans.
+// Ref: https://github.com/jaegertracing/jaeger-idl/blob/main/proto/api_v2/collector.proto
+func DecodePostSpansRequest(buf []byte) (Batch, error) {
+	var batch Batch
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		if num != 1 {
+			return nil
+		}
+		var err error
+		batch, err = decodeBatch(f.Bytes)
+		return err
+	})
+	return batch, err
+}
+
+// Ref: https://github.com/jaegertracing/jaeger-idl/blob/main/proto/api_v2/model.proto
+func decodeBatch(buf []byte) (Batch, error) {
+	var batch Batch
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			span, err := decodeSpan(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("span: %w", err)
+			}
+			batch.Spans = append(batch.Spans, span)
+		case 2:
+			process, err := decodeProcess(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("process: %w", err)
+			}
+			batch.Process = process
+		}
+		return nil
+	})
+	return batch, err
+}
+
+func decodeSpan(buf []byte) (Span, error) {
+	var span Span
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		var err error
+		switch num {
+		case 1:
+			err = copyID(span.TraceID[:], f.Bytes, "trace_id")
+		case 2:
+			err = copyID(span.SpanID[:], f.Bytes, "span_id")
+		case 3:
+			span.OperationName = f.String()
+		case 4:
+			var ref SpanRef
+			ref, err = decodeSpanRef(f.Bytes)
+			span.References = append(span.References, ref)
+		case 5:
+			span.Flags = uint32(f.Num)
+		case 6:
+			var seconds, nanos int64
+			seconds, nanos, err = decodeSecondsNanos(f.Bytes)
+			span.StartTime = time.Unix(seconds, nanos)
+		case 7:
+			var seconds, nanos int64
+			seconds, nanos, err = decodeSecondsNanos(f.Bytes)
+			span.Duration = time.Duration(seconds)*time.Second + time.Duration(nanos)
+		case 8:
+			var kv KeyValue
+			kv, err = decodeKeyValue(f.Bytes)
+			span.Tags = append(span.Tags, kv)
+		case 9:
+			var log Log
+			log, err = decodeLog(f.Bytes)
+			span.Logs = append(span.Logs, log)
+		case 10:
+			var process Process
+			process, err = decodeProcess(f.Bytes)
+			span.Process = &process
+		}
+		return err
+	})
+	return span, err
+}
+
+// copyID copies a trace or span ID, which must have the length of dst.
+func copyID(dst, src []byte, name string) error {
+	if len(src) != len(dst) {
+		return fmt.Errorf("%s has %d bytes, want %d", name, len(src), len(dst))
+	}
+	copy(dst, src)
+	return nil
+}
+
+func decodeSpanRef(buf []byte) (SpanRef, error) {
+	var ref SpanRef
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			return copyID(ref.TraceID[:], f.Bytes, "reference trace_id")
+		case 2:
+			return copyID(ref.SpanID[:], f.Bytes, "reference span_id")
+		case 3:
+			ref.RefType = SpanRefType(f.Num)
+		}
+		return nil
+	})
+	return ref, err
+}
+
+// decodeSecondsNanos decodes a google.protobuf.Timestamp or Duration.
+func decodeSecondsNanos(buf []byte) (seconds, nanos int64, err error) {
+	err = pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			seconds = int64(f.Num)
+		case 2:
+			nanos = int64(int32(f.Num))
+		}
+		return nil
+	})
+	return seconds, nanos, err
+}
+
+func decodeKeyValue(buf []byte) (KeyValue, error) {
+	var kv KeyValue
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			kv.Key = f.String()
+		case 2:
+			kv.Type = ValueType(f.Num)
+		case 3:
+			kv.Str = f.String()
+		case 4:
+			kv.Bool = f.Bool()
+		case 5:
+			kv.Int64 = int64(f.Num)
+		case 6:
+			kv.Float64 = f.Double()
+		case 7:
+			kv.Binary = f.Bytes
+		}
+		return nil
+	})
+	return kv, err
+}
+
+func decodeLog(buf []byte) (Log, error) {
+	var log Log
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			seconds, nanos, err := decodeSecondsNanos(f.Bytes)
+			log.Timestamp = time.Unix(seconds, nanos)
+			return err
+		case 2:
+			kv, err := decodeKeyValue(f.Bytes)
+			log.Fields = append(log.Fields, kv)
+			return err
+		}
+		return nil
+	})
+	return log, err
+}
+
+func decodeProcess(buf []byte) (Process, error) {
+	var process Process
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			process.ServiceName = f.String()
+		case 2:
+			kv, err := decodeKeyValue(f.Bytes)
+			process.Tags = append(process.Tags, kv)
+			return err
+		}
+		return nil
+	})
+	return process, err
+}
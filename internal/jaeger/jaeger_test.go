@@ -0,0 +1,297 @@
+package jaeger
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire/pbwiretest"
+)
+
+var (
+	testTraceID  = [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	testSpanID   = [8]byte{1, 1, 1, 1, 1, 1, 1, 1}
+	testParentID = [8]byte{2, 2, 2, 2, 2, 2, 2, 2}
+	testLinkID   = [8]byte{3, 3, 3, 3, 3, 3, 3, 3}
+	testStart    = time.Unix(1700000000, 123456000)
+)
+
+// testBatch is the batch encoded by the encode functions below.
+func testBatch() Batch {
+	return Batch{
+		Process: Process{
+			ServiceName: "frontend",
+			Tags:        []KeyValue{{Key: "hostname", Type: ValueTypeString, Str: "host-1"}},
+		},
+		Spans: []Span{{
+			TraceID:       testTraceID,
+			SpanID:        testSpanID,
+			OperationName: "GET /api",
+			References: []SpanRef{
+				{TraceID: testTraceID, SpanID: testParentID, RefType: ChildOf},
+				{TraceID: testTraceID, SpanID: testLinkID, RefType: FollowsFrom},
+			},
+			StartTime: testStart,
+			Duration:  1500 * time.Microsecond,
+			Tags: []KeyValue{
+				{Key: "span.kind", Type: ValueTypeString, Str: "server"},
+				{Key: "error", Type: ValueTypeBool, Bool: true},
+				{Key: "http.status_code", Type: ValueTypeInt64, Int64: 500},
+				{Key: "ratio", Type: ValueTypeFloat64, Float64: 0.5},
+			},
+			Logs: []Log{{
+				Timestamp: testStart.Add(time.Millisecond),
+				Fields: []KeyValue{
+					{Key: "event", Type: ValueTypeString, Str: "retry"},
+					{Key: "attempt", Type: ValueTypeInt64, Int64: 2},
+				},
+			}},
+		}},
+	}
+}
+
+func encodeProtoTime(t time.Time) []byte {
+	b := pbwiretest.AppendVarint(nil, 1, uint64(t.Unix()))
+	return pbwiretest.AppendVarint(b, 2, uint64(t.Nanosecond()))
+}
+
+func encodeProtoKeyValue(kv KeyValue) []byte {
+	b := pbwiretest.AppendBytes(nil, 1, []byte(kv.Key))
+	b = pbwiretest.AppendVarint(b, 2, uint64(kv.Type))
+	switch kv.Type {
+	case ValueTypeString:
+		b = pbwiretest.AppendBytes(b, 3, []byte(kv.Str))
+	case ValueTypeBool:
+		b = pbwiretest.AppendVarint(b, 4, 1)
+	case ValueTypeInt64:
+		b = pbwiretest.AppendVarint(b, 5, uint64(kv.Int64))
+	case ValueTypeFloat64:
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(kv.Float64))
+	}
+	return b
+}
+
+func encodePostSpansRequest(batch Batch) []byte {
+	var b []byte
+	for _, span := range batch.Spans {
+		var s []byte
+		s = pbwiretest.AppendBytes(s, 1, span.TraceID[:])
+		s = pbwiretest.AppendBytes(s, 2, span.SpanID[:])
+		s = pbwiretest.AppendBytes(s, 3, []byte(span.OperationName))
+		for _, ref := range span.References {
+			r := pbwiretest.AppendBytes(nil, 1, ref.TraceID[:])
+			r = pbwiretest.AppendBytes(r, 2, ref.SpanID[:])
+			r = pbwiretest.AppendVarint(r, 3, uint64(ref.RefType))
+			s = pbwiretest.AppendBytes(s, 4, r)
+		}
+		s = pbwiretest.AppendBytes(s, 6, encodeProtoTime(span.StartTime))
+		s = pbwiretest.AppendBytes(s, 7, pbwiretest.AppendVarint(nil, 2, uint64(span.Duration)))
+		for _, kv := range span.Tags {
+			s = pbwiretest.AppendBytes(s, 8, encodeProtoKeyValue(kv))
+		}
+		for _, log := range span.Logs {
+			l := pbwiretest.AppendBytes(nil, 1, encodeProtoTime(log.Timestamp))
+			for _, kv := range log.Fields {
+				l = pbwiretest.AppendBytes(l, 2, encodeProtoKeyValue(kv))
+			}
+			s = pbwiretest.AppendBytes(s, 9, l)
+		}
+		b = pbwiretest.AppendBytes(b, 1, s)
+	}
+
+	p := pbwiretest.AppendBytes(nil, 1, []byte(batch.Process.ServiceName))
+	for _, kv := range batch.Process.Tags {
+		p = pbwiretest.AppendBytes(p, 2, encodeProtoKeyValue(kv))
+	}
+	b = pbwiretest.AppendBytes(b, 2, p)
+
+	return pbwiretest.AppendBytes(nil, 1, b)
+}
+
+// thriftWriter writes the Thrift binary protocol.
+type thriftWriter []byte
+
+func (w *thriftWriter) field(typ byte, id int16) {
+	*w = append(*w, typ)
+	*w = binary.BigEndian.AppendUint16(*w, uint16(id))
+}
+
+func (w *thriftWriter) stop() {
+	*w = append(*w, thriftStop)
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(thriftI32, id)
+	*w = binary.BigEndian.AppendUint32(*w, uint32(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(thriftI64, id)
+	*w = binary.BigEndian.AppendUint64(*w, uint64(v))
+}
+
+func (w *thriftWriter) string(id int16, v string) {
+	w.field(thriftString, id)
+	*w = binary.BigEndian.AppendUint32(*w, uint32(len(v)))
+	*w = append(*w, v...)
+}
+
+func (w *thriftWriter) list(id int16, elemType byte, size int) {
+	w.field(thriftList, id)
+	*w = append(*w, elemType)
+	*w = binary.BigEndian.AppendUint32(*w, uint32(size))
+}
+
+func (w *thriftWriter) tags(id int16, tags []KeyValue) {
+	w.list(id, thriftStruct, len(tags))
+	for _, kv := range tags {
+		w.string(1, kv.Key)
+		switch kv.Type {
+		case ValueTypeString:
+			w.i32(2, 0)
+			w.string(3, kv.Str)
+		case ValueTypeFloat64:
+			w.i32(2, 1)
+			w.field(thriftDouble, 4)
+			*w = binary.BigEndian.AppendUint64(*w, math.Float64bits(kv.Float64))
+		case ValueTypeBool:
+			w.i32(2, 2)
+			w.field(thriftBool, 5)
+			*w = append(*w, 1)
+		case ValueTypeInt64:
+			w.i32(2, 3)
+			w.i64(6, kv.Int64)
+		}
+		w.stop()
+	}
+}
+
+func encodeThriftBatch(batch Batch) []byte {
+	var w thriftWriter
+	w.field(thriftStruct, 1)
+	w.string(1, batch.Process.ServiceName)
+	w.tags(2, batch.Process.Tags)
+	w.stop()
+
+	w.list(2, thriftStruct, len(batch.Spans))
+	for _, span := range batch.Spans {
+		w.i64(1, int64(binary.BigEndian.Uint64(span.TraceID[8:])))
+		w.i64(2, int64(binary.BigEndian.Uint64(span.TraceID[:8])))
+		w.i64(3, int64(binary.BigEndian.Uint64(span.SpanID[:])))
+		w.i64(4, int64(binary.BigEndian.Uint64(span.ParentSpanID[:])))
+		w.string(5, span.OperationName)
+		w.list(6, thriftStruct, len(span.References))
+		for _, ref := range span.References {
+			w.i32(1, int32(ref.RefType))
+			w.i64(2, int64(binary.BigEndian.Uint64(ref.TraceID[8:])))
+			w.i64(3, int64(binary.BigEndian.Uint64(ref.TraceID[:8])))
+			w.i64(4, int64(binary.BigEndian.Uint64(ref.SpanID[:])))
+			w.stop()
+		}
+		w.i32(7, 1)
+		w.i64(8, span.StartTime.UnixMicro())
+		w.i64(9, span.Duration.Microseconds())
+		w.tags(10, span.Tags)
+		w.list(11, thriftStruct, len(span.Logs))
+		for _, log := range span.Logs {
+			w.i64(1, log.Timestamp.UnixMicro())
+			w.tags(2, log.Fields)
+			w.stop()
+		}
+		// An unknown field, skipped by the decoder.
+		w.list(99, thriftString, 1)
+		w = binary.BigEndian.AppendUint32(w, 1)
+		w = append(w, 'x')
+		w.stop()
+	}
+	w.stop()
+	return w
+}
+
+func TestDecodePostSpansRequest(t *testing.T) {
+	got, err := DecodePostSpansRequest(encodePostSpansRequest(testBatch()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testBatch(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeThriftBatch(t *testing.T) {
+	buf := encodeThriftBatch(testBatch())
+	got, err := DecodeThriftBatch(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testBatch()
+	want.Spans[0].Flags = 1
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for n := range len(buf) - 1 {
+		if _, err := DecodeThriftBatch(buf[:n]); err == nil {
+			t.Fatalf("decoding %d of %d bytes succeeded, want error", n, len(buf))
+		}
+	}
+}
+
+func TestToTraces(t *testing.T) {
+	td := ToTraces(testBatch())
+	if td.SpanCount() != 1 {
+		t.Fatalf("got %d spans, want 1", td.SpanCount())
+	}
+
+	rs := td.ResourceSpans().At(0)
+	wantResource := map[string]any{"service.name": "frontend", "hostname": "host-1"}
+	if got := rs.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource attributes = %v, want %v", got, wantResource)
+	}
+
+	span := rs.ScopeSpans().At(0).Spans().At(0)
+	if span.TraceID() != pcommon.TraceID(testTraceID) || span.SpanID() != pcommon.SpanID(testSpanID) {
+		t.Errorf("IDs = %s %s", span.TraceID(), span.SpanID())
+	}
+	if span.ParentSpanID() != pcommon.SpanID(testParentID) {
+		t.Errorf("parent span ID = %s, want %x", span.ParentSpanID(), testParentID)
+	}
+	if span.Kind() != ptrace.SpanKindServer {
+		t.Errorf("kind = %v, want server", span.Kind())
+	}
+	if span.Status().Code() != ptrace.StatusCodeError {
+		t.Errorf("status = %v, want error", span.Status().Code())
+	}
+	if got := span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime()); got != 1500*time.Microsecond {
+		t.Errorf("duration = %v", got)
+	}
+
+	wantAttrs := map[string]any{"http.status_code": int64(500), "ratio": 0.5}
+	if got := span.Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+
+	if span.Links().Len() != 1 {
+		t.Fatalf("got %d links, want 1", span.Links().Len())
+	}
+	link := span.Links().At(0)
+	if link.SpanID() != pcommon.SpanID(testLinkID) {
+		t.Errorf("link span ID = %s", link.SpanID())
+	}
+	if v, _ := link.Attributes().Get("opentracing.ref_type"); v.Str() != "follows_from" {
+		t.Errorf("link ref type = %q", v.Str())
+	}
+
+	event := span.Events().At(0)
+	if event.Name() != "retry" || event.Attributes().Len() != 1 {
+		t.Errorf("event = %q %v", event.Name(), event.Attributes().AsRaw())
+	}
+}
@@ -0,0 +1,386 @@
+package jaeger
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Field types of the Thrift binary protocol.
+const (
+	thriftStop   = 0
+	thriftBool   = 2
+	thriftByte   = 3
+	thriftDouble = 4
+	thriftI16    = 6
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftMap    = 13
+	thriftSet    = 14
+	thriftList   = 15
+)
+
+// Thrift structs nest a few levels deep in jaeger.thrift, this bounds the
+// recursion when skipping unknown fields.
+const maxThriftDepth = 64
+
+var errThriftTruncated = errors.New("truncated thrift message")
+
+// Tag types of jaeger.thrift, which differ from the protobuf ValueType.
+var thriftTagTypes = []ValueType{ValueTypeString, ValueTypeFloat64, ValueTypeBool, ValueTypeInt64, ValueTypeBinary}
+
+// DecodeThriftBatch decodes a jaeger.thrift Batch in the Thrift binary
+// protocol, the body of POST /api/traces.
+// Ref: https://github.com/jaegertracing/jaeger-idl/blob/main/thrift/jaeger.thrift
+func DecodeThriftBatch(buf []byte) (Batch, error) {
+	r := thriftReader{buf: buf}
+	var batch Batch
+	err := r.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftStruct:
+			return r.readProcess(&batch.Process)
+		case id == 2 && typ == thriftList:
+			return r.readList(thriftStruct, func() error {
+				var span Span
+				if err := r.readSpan(&span); err != nil {
+					return fmt.Errorf("span: %w", err)
+				}
+				batch.Spans = append(batch.Spans, span)
+				return nil
+			})
+		}
+		return r.skip(typ, 0)
+	})
+	return batch, err
+}
+
+type thriftReader struct {
+	buf []byte
+}
+
+func (r *thriftReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.buf) < n {
+		return nil, errThriftTruncated
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *thriftReader) readByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *thriftReader) readI16() (int16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (r *thriftReader) readI32() (int32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *thriftReader) readI64() (int64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (r *thriftReader) readBinary() ([]byte, error) {
+	n, err := r.readI32()
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+func (r *thriftReader) readString() (string, error) {
+	b, err := r.readBinary()
+	return string(b), err
+}
+
+// readStruct calls fn with the id and type of each field of a struct. fn
+// must read or skip the value.
+func (r *thriftReader) readStruct(fn func(id int16, typ byte) error) error {
+	for {
+		typ, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if typ == thriftStop {
+			return nil
+		}
+		id, err := r.readI16()
+		if err != nil {
+			return err
+		}
+		if err := fn(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// readList calls fn for each element of a list, which must be of type
+// elemType.
+func (r *thriftReader) readList(elemType byte, fn func() error) error {
+	typ, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	size, err := r.readI32()
+	if err != nil {
+		return err
+	}
+	if typ != elemType {
+		return fmt.Errorf("list of type %d, want %d", typ, elemType)
+	}
+	for range size {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip skips a value of type typ.
+func (r *thriftReader) skip(typ byte, depth int) error {
+	if depth > maxThriftDepth {
+		return errors.New("thrift message nested too deep")
+	}
+
+	var err error
+	switch typ {
+	case thriftBool, thriftByte:
+		_, err = r.next(1)
+	case thriftI16:
+		_, err = r.next(2)
+	case thriftI32:
+		_, err = r.next(4)
+	case thriftDouble, thriftI64:
+		_, err = r.next(8)
+	case thriftString:
+		_, err = r.readBinary()
+	case thriftStruct:
+		err = r.readStruct(func(_ int16, typ byte) error {
+			return r.skip(typ, depth+1)
+		})
+	case thriftMap:
+		var keyType, valueType byte
+		var size int32
+		if keyType, err = r.readByte(); err != nil {
+			return err
+		}
+		if valueType, err = r.readByte(); err != nil {
+			return err
+		}
+		if size, err = r.readI32(); err != nil {
+			return err
+		}
+		for range size {
+			if err := r.skip(keyType, depth+1); err != nil {
+				return err
+			}
+			if err := r.skip(valueType, depth+1); err != nil {
+				return err
+			}
+		}
+	case thriftSet, thriftList:
+		var elemType byte
+		var size int32
+		if elemType, err = r.readByte(); err != nil {
+			return err
+		}
+		if size, err = r.readI32(); err != nil {
+			return err
+		}
+		for range size {
+			if err := r.skip(elemType, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown thrift type %d", typ)
+	}
+	return err
+}
+
+func (r *thriftReader) readProcess(process *Process) error {
+	return r.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftString:
+			var err error
+			process.ServiceName, err = r.readString()
+			return err
+		case id == 2 && typ == thriftList:
+			return r.readTags(&process.Tags)
+		}
+		return r.skip(typ, 0)
+	})
+}
+
+func (r *thriftReader) readTags(tags *[]KeyValue) error {
+	return r.readList(thriftStruct, func() error {
+		var kv KeyValue
+		if err := r.readTag(&kv); err != nil {
+			return err
+		}
+		*tags = append(*tags, kv)
+		return nil
+	})
+}
+
+func (r *thriftReader) readTag(kv *KeyValue) error {
+	return r.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftString:
+			kv.Key, err = r.readString()
+		case id == 2 && typ == thriftI32:
+			var tagType int32
+			tagType, err = r.readI32()
+			if tagType < 0 || int(tagType) >= len(thriftTagTypes) {
+				return fmt.Errorf("unknown tag type %d", tagType)
+			}
+			kv.Type = thriftTagTypes[tagType]
+		case id == 3 && typ == thriftString:
+			kv.Str, err = r.readString()
+		case id == 4 && typ == thriftDouble:
+			var bits int64
+			bits, err = r.readI64()
+			kv.Float64 = math.Float64frombits(uint64(bits))
+		case id == 5 && typ == thriftBool:
+			var b byte
+			b, err = r.readByte()
+			kv.Bool = b != 0
+		case id == 6 && typ == thriftI64:
+			kv.Int64, err = r.readI64()
+		case id == 7 && typ == thriftString:
+			kv.Binary, err = r.readBinary()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+}
+
+func (r *thriftReader) readSpan(span *Span) error {
+	var traceIDLow, traceIDHigh, spanID, parentSpanID int64
+	var startTime, duration int64
+	err := r.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI64:
+			traceIDLow, err = r.readI64()
+		case id == 2 && typ == thriftI64:
+			traceIDHigh, err = r.readI64()
+		case id == 3 && typ == thriftI64:
+			spanID, err = r.readI64()
+		case id == 4 && typ == thriftI64:
+			parentSpanID, err = r.readI64()
+		case id == 5 && typ == thriftString:
+			span.OperationName, err = r.readString()
+		case id == 6 && typ == thriftList:
+			err = r.readList(thriftStruct, func() error {
+				var ref SpanRef
+				if err := r.readSpanRef(&ref); err != nil {
+					return err
+				}
+				span.References = append(span.References, ref)
+				return nil
+			})
+		case id == 7 && typ == thriftI32:
+			var flags int32
+			flags, err = r.readI32()
+			span.Flags = uint32(flags)
+		case id == 8 && typ == thriftI64:
+			startTime, err = r.readI64()
+		case id == 9 && typ == thriftI64:
+			duration, err = r.readI64()
+		case id == 10 && typ == thriftList:
+			err = r.readTags(&span.Tags)
+		case id == 11 && typ == thriftList:
+			err = r.readList(thriftStruct, func() error {
+				var log Log
+				if err := r.readLog(&log); err != nil {
+					return err
+				}
+				span.Logs = append(span.Logs, log)
+				return nil
+			})
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+
+	span.TraceID = traceID(traceIDHigh, traceIDLow)
+	binary.BigEndian.PutUint64(span.SpanID[:], uint64(spanID))
+	binary.BigEndian.PutUint64(span.ParentSpanID[:], uint64(parentSpanID))
+	span.StartTime = time.UnixMicro(startTime)
+	span.Duration = time.Duration(duration) * time.Microsecond
+	return err
+}
+
+func (r *thriftReader) readSpanRef(ref *SpanRef) error {
+	var traceIDLow, traceIDHigh, spanID int64
+	err := r.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI32:
+			var refType int32
+			refType, err = r.readI32()
+			ref.RefType = SpanRefType(refType)
+		case id == 2 && typ == thriftI64:
+			traceIDLow, err = r.readI64()
+		case id == 3 && typ == thriftI64:
+			traceIDHigh, err = r.readI64()
+		case id == 4 && typ == thriftI64:
+			spanID, err = r.readI64()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+
+	ref.TraceID = traceID(traceIDHigh, traceIDLow)
+	binary.BigEndian.PutUint64(ref.SpanID[:], uint64(spanID))
+	return err
+}
+
+func (r *thriftReader) readLog(log *Log) error {
+	return r.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftI64:
+			us, err := r.readI64()
+			log.Timestamp = time.UnixMicro(us)
+			return err
+		case id == 2 && typ == thriftList:
+			return r.readTags(&log.Fields)
+		}
+		return r.skip(typ, 0)
+	})
+}
+
+func traceID(high, low int64) [16]byte {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(high))
+	binary.BigEndian.PutUint64(id[8:], uint64(low))
+	return id
+}
@@ -0,0 +1,221 @@
+package jaeger
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Tags with a meaning in the OTel Jaeger mapping. They are not copied to the
+// span attributes.
+// Ref: https://opentelemetry.io/docs/specs/otel/trace/sdk_exporters/jaeger/
+const (
+	tagSpanKind          = "span.kind"
+	tagError             = "error"
+	tagStatusCode        = "otel.status_code"
+	tagStatusDescription = "otel.status_description"
+	tagScopeName         = "otel.scope.name"
+	tagScopeVersion      = "otel.scope.version"
+	tagLibraryName       = "otel.library.name"
+	tagLibraryVersion    = "otel.library.version"
+	tagTraceState        = "w3c.tracestate"
+
+	// Log field holding the name of the event.
+	fieldEvent = "event"
+)
+
+const (
+	attrServiceName = "service.name"
+	// Attribute of a link with the type of the reference.
+	// Ref: https://opentelemetry.io/docs/specs/semconv/attributes-registry/opentracing/
+	attrRefType = "opentracing.ref_type"
+)
+
+type scopeKey struct {
+	resource *Process
+	name     string
+	version  string
+}
+
+// ToTraces translates batch to OTLP traces:
+//
+//   - The process service name becomes the service.name resource attribute
+//     and the process tags the other resource attributes. Spans with their
+//     own process get their own resource.
+//   - The parent span ID of Thrift spans, or else the first CHILD_OF
+//     reference in the same trace, becomes the parent. Other references
+//     become links.
+//   - Logs become span events, named after their event field.
+//   - span.kind, error, otel.status_code, otel.status_description and
+//     w3c.tracestate tags set the fields of the same meaning, otel.scope.*
+//     and otel.library.* tags the scope. Other tags become span attributes.
+func ToTraces(batch Batch) ptrace.Traces {
+	td := ptrace.NewTraces()
+	resources := map[*Process]ptrace.ResourceSpans{}
+	scopes := map[scopeKey]ptrace.ScopeSpans{}
+
+	for i := range batch.Spans {
+		span := &batch.Spans[i]
+
+		process := span.Process
+		if process == nil {
+			process = &batch.Process
+		}
+		rs, ok := resources[process]
+		if !ok {
+			rs = td.ResourceSpans().AppendEmpty()
+			putProcess(rs.Resource().Attributes(), process)
+			resources[process] = rs
+		}
+
+		key := scopeKey{resource: process}
+		key.name, key.version = scopeOf(span.Tags)
+		ss, ok := scopes[key]
+		if !ok {
+			ss = rs.ScopeSpans().AppendEmpty()
+			ss.Scope().SetName(key.name)
+			ss.Scope().SetVersion(key.version)
+			scopes[key] = ss
+		}
+
+		translateSpan(span, ss.Spans().AppendEmpty())
+	}
+
+	return td
+}
+
+func putProcess(attrs pcommon.Map, process *Process) {
+	if process.ServiceName != "" {
+		attrs.PutStr(attrServiceName, process.ServiceName)
+	}
+	for _, kv := range process.Tags {
+		putValue(attrs.PutEmpty(kv.Key), kv)
+	}
+}
+
+func scopeOf(tags []KeyValue) (name, version string) {
+	var libraryName, libraryVersion string
+	for _, kv := range tags {
+		switch kv.Key {
+		case tagScopeName:
+			name = kv.Str
+		case tagScopeVersion:
+			version = kv.Str
+		case tagLibraryName:
+			libraryName = kv.Str
+		case tagLibraryVersion:
+			libraryVersion = kv.Str
+		}
+	}
+	if name == "" {
+		return libraryName, libraryVersion
+	}
+	return name, version
+}
+
+func translateSpan(span *Span, dest ptrace.Span) {
+	dest.SetTraceID(span.TraceID)
+	dest.SetSpanID(span.SpanID)
+	dest.SetName(span.OperationName)
+	dest.SetStartTimestamp(pcommon.NewTimestampFromTime(span.StartTime))
+	dest.SetEndTimestamp(pcommon.NewTimestampFromTime(span.StartTime.Add(span.Duration)))
+
+	parent := pcommon.SpanID(span.ParentSpanID)
+	if parent.IsEmpty() {
+		for _, ref := range span.References {
+			if ref.RefType == ChildOf && ref.TraceID == span.TraceID {
+				parent = ref.SpanID
+				break
+			}
+		}
+	}
+	dest.SetParentSpanID(parent)
+
+	for _, ref := range span.References {
+		if ref.TraceID == span.TraceID && ref.SpanID == parent {
+			continue
+		}
+		link := dest.Links().AppendEmpty()
+		link.SetTraceID(ref.TraceID)
+		link.SetSpanID(ref.SpanID)
+		if ref.RefType == FollowsFrom {
+			link.Attributes().PutStr(attrRefType, "follows_from")
+		} else {
+			link.Attributes().PutStr(attrRefType, "child_of")
+		}
+	}
+
+	var errorTag bool
+	var statusCode, statusDescription string
+	attrs := dest.Attributes()
+	for _, kv := range span.Tags {
+		switch kv.Key {
+		case tagSpanKind:
+			dest.SetKind(spanKind(kv.Str))
+		case tagError:
+			errorTag = kv.Bool || kv.Str == "true"
+		case tagStatusCode:
+			statusCode = kv.Str
+		case tagStatusDescription:
+			statusDescription = kv.Str
+		case tagTraceState:
+			dest.TraceState().FromRaw(kv.Str)
+		case tagScopeName, tagScopeVersion, tagLibraryName, tagLibraryVersion:
+		default:
+			putValue(attrs.PutEmpty(kv.Key), kv)
+		}
+	}
+
+	switch {
+	case strings.EqualFold(statusCode, "OK"):
+		dest.Status().SetCode(ptrace.StatusCodeOk)
+	case strings.EqualFold(statusCode, "ERROR"), statusCode == "" && errorTag:
+		dest.Status().SetCode(ptrace.StatusCodeError)
+		dest.Status().SetMessage(statusDescription)
+	}
+
+	for _, log := range span.Logs {
+		event := dest.Events().AppendEmpty()
+		event.SetTimestamp(pcommon.NewTimestampFromTime(log.Timestamp))
+		for _, kv := range log.Fields {
+			if kv.Key == fieldEvent && kv.Type == ValueTypeString {
+				event.SetName(kv.Str)
+				continue
+			}
+			putValue(event.Attributes().PutEmpty(kv.Key), kv)
+		}
+	}
+}
+
+func putValue(dest pcommon.Value, kv KeyValue) {
+	switch kv.Type {
+	case ValueTypeBool:
+		dest.SetBool(kv.Bool)
+	case ValueTypeInt64:
+		dest.SetInt(kv.Int64)
+	case ValueTypeFloat64:
+		dest.SetDouble(kv.Float64)
+	case ValueTypeBinary:
+		dest.SetEmptyBytes().FromRaw(kv.Binary)
+	default:
+		dest.SetStr(kv.Str)
+	}
+}
+
+func spanKind(kind string) ptrace.SpanKind {
+	switch kind {
+	case "client":
+		return ptrace.SpanKindClient
+	case "server":
+		return ptrace.SpanKindServer
+	case "producer":
+		return ptrace.SpanKindProducer
+	case "consumer":
+		return ptrace.SpanKindConsumer
+	case "internal":
+		return ptrace.SpanKindInternal
+	default:
+		return ptrace.SpanKindUnspecified
+	}
+}
@@ -0,0 +1,236 @@
+// Package loki decodes Loki push requests and translates them to OTLP logs.
+//
+// The protobuf is decoded by hand so that the Loki module is not needed for
+// a handful of messages.
+// Ref: https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+package loki
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire"
+)
+
+// PushRequest is logproto.PushRequest.
+type PushRequest struct {
+	Streams []Stream
+}
+
+// Stream is the entries of one set of labels.
+type Stream struct {
+	Labels  []Label
+	Entries []Entry
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Entry struct {
+	Timestamp          time.Time
+	Line               string
+	StructuredMetadata []Label
+}
+
+// DecodeProto decodes an uncompressed logproto.PushRequest.
+// Ref: https://github.com/grafana/loki/blob/main/pkg/push/push.proto
+func DecodeProto(buf []byte) (PushRequest, error) {
+	var req PushRequest
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		if num != 1 {
+			return nil
+		}
+		stream, err := decodeStream(f.Bytes)
+		if err != nil {
+			return fmt.Errorf("stream: %w", err)
+		}
+		req.Streams = append(req.Streams, stream)
+		return nil
+	})
+	return req, err
+}
+
+func decodeStream(buf []byte) (Stream, error) {
+	var stream Stream
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		var err error
+		switch num {
+		case 1:
+			stream.Labels, err = ParseLabels(f.String())
+		case 2:
+			var entry Entry
+			entry, err = decodeEntry(f.Bytes)
+			stream.Entries = append(stream.Entries, entry)
+		}
+		return err
+	})
+	return stream, err
+}
+
+func decodeEntry(buf []byte) (Entry, error) {
+	var entry Entry
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			var seconds, nanos int64
+			err := pbwire.Decode(f.Bytes, func(num protowire.Number, f pbwire.Field) error {
+				switch num {
+				case 1:
+					seconds = int64(f.Num)
+				case 2:
+					nanos = int64(int32(f.Num))
+				}
+				return nil
+			})
+			entry.Timestamp = time.Unix(seconds, nanos)
+			return err
+		case 2:
+			entry.Line = f.String()
+		case 3:
+			var l Label
+			err := pbwire.Decode(f.Bytes, func(num protowire.Number, f pbwire.Field) error {
+				switch num {
+				case 1:
+					l.Name = f.String()
+				case 2:
+					l.Value = f.String()
+				}
+				return nil
+			})
+			entry.StructuredMetadata = append(entry.StructuredMetadata, l)
+			return err
+		}
+		return nil
+	})
+	return entry, err
+}
+
+type jsonPushRequest struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	// Each value is [timestamp, line] or [timestamp, line, metadata], with
+	// the timestamp in nanoseconds as a string.
+	Values [][]json.RawMessage `json:"values"`
+}
+
+// DecodeJSON decodes a push request in its JSON form.
+func DecodeJSON(buf []byte) (PushRequest, error) {
+	var in jsonPushRequest
+	if err := json.Unmarshal(buf, &in); err != nil {
+		return PushRequest{}, err
+	}
+
+	req := PushRequest{Streams: make([]Stream, 0, len(in.Streams))}
+	for _, s := range in.Streams {
+		stream := Stream{
+			Labels:  labelsFromMap(s.Stream),
+			Entries: make([]Entry, 0, len(s.Values)),
+		}
+		for _, v := range s.Values {
+			entry, err := decodeJSONEntry(v)
+			if err != nil {
+				return PushRequest{}, err
+			}
+			stream.Entries = append(stream.Entries, entry)
+		}
+		req.Streams = append(req.Streams, stream)
+	}
+	return req, nil
+}
+
+func decodeJSONEntry(v []json.RawMessage) (Entry, error) {
+	var entry Entry
+	if len(v) != 2 && len(v) != 3 {
+		return entry, fmt.Errorf("entry has %d values, want 2 or 3", len(v))
+	}
+
+	var ts string
+	if err := json.Unmarshal(v[0], &ts); err != nil {
+		return entry, fmt.Errorf("timestamp: %w", err)
+	}
+	ns, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return entry, fmt.Errorf("timestamp: %w", err)
+	}
+	entry.Timestamp = time.Unix(0, ns)
+
+	if err := json.Unmarshal(v[1], &entry.Line); err != nil {
+		return entry, fmt.Errorf("line: %w", err)
+	}
+
+	if len(v) == 3 {
+		var metadata map[string]string
+		if err := json.Unmarshal(v[2], &metadata); err != nil {
+			return entry, fmt.Errorf("structured metadata: %w", err)
+		}
+		entry.StructuredMetadata = labelsFromMap(metadata)
+	}
+	return entry, nil
+}
+
+// labelsFromMap returns the labels of m sorted by name.
+func labelsFromMap(m map[string]string) []Label {
+	labels := make([]Label, 0, len(m))
+	for name, value := range m {
+		labels = append(labels, Label{Name: name, Value: value})
+	}
+	slices.SortFunc(labels, func(a, b Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return labels
+}
+
+var errMalformedLabels = errors.New("malformed labels")
+
+// ParseLabels parses the labels of a stream in the Prometheus format,
+// {name="value", ...}.
+func ParseLabels(s string) ([]Label, error) {
+	rest := strings.TrimSpace(s)
+	if !strings.HasPrefix(rest, "{") {
+		return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+	}
+	rest = strings.TrimLeft(rest[1:], " ")
+
+	var labels []Label
+	for !strings.HasPrefix(rest, "}") {
+		i := strings.IndexByte(rest, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+		}
+		name := strings.TrimSpace(rest[:i])
+		rest = strings.TrimLeft(rest[i+1:], " ")
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+
+		rest = strings.TrimLeft(rest[len(quoted):], " ")
+		if after, ok := strings.CutPrefix(rest, ","); ok {
+			rest = strings.TrimLeft(after, " ")
+		} else if !strings.HasPrefix(rest, "}") {
+			return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+		}
+	}
+	if strings.TrimSpace(rest[1:]) != "" {
+		return nil, fmt.Errorf("%w %q", errMalformedLabels, s)
+	}
+	return labels, nil
+}
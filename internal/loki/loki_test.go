@@ -0,0 +1,145 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire/pbwiretest"
+)
+
+var testTime = time.Unix(1700000000, 5)
+
+func testPushRequest() PushRequest {
+	return PushRequest{Streams: []Stream{{
+		Labels: []Label{{Name: "app", Value: "api"}, {Name: "env", Value: `prod "eu"`}},
+		Entries: []Entry{
+			{Timestamp: testTime, Line: "started"},
+			{
+				Timestamp:          testTime.Add(time.Second),
+				Line:               "request failed",
+				StructuredMetadata: []Label{{Name: "trace_id", Value: "abc"}},
+			},
+		},
+	}}}
+}
+
+func TestDecodeProto(t *testing.T) {
+	var stream []byte
+	stream = pbwiretest.AppendBytes(stream, 1, []byte(`{app="api", env="prod \"eu\""}`))
+	for _, e := range testPushRequest().Streams[0].Entries {
+		ts := pbwiretest.AppendVarint(nil, 1, uint64(e.Timestamp.Unix()))
+		ts = pbwiretest.AppendVarint(ts, 2, uint64(e.Timestamp.Nanosecond()))
+		entry := pbwiretest.AppendBytes(nil, 1, ts)
+		entry = pbwiretest.AppendBytes(entry, 2, []byte(e.Line))
+		for _, l := range e.StructuredMetadata {
+			entry = pbwiretest.AppendBytes(entry, 3, pbwiretest.AppendBytes(pbwiretest.AppendBytes(nil, 1, []byte(l.Name)), 2, []byte(l.Value)))
+		}
+		stream = pbwiretest.AppendBytes(stream, 2, entry)
+	}
+
+	got, err := DecodeProto(pbwiretest.AppendBytes(nil, 1, stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testPushRequest(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	body := `{"streams": [{
+		"stream": {"env": "prod \"eu\"", "app": "api"},
+		"values": [
+			["1700000000000000005", "started"],
+			["1700000001000000005", "request failed", {"trace_id": "abc"}]
+		]
+	}]}`
+
+	got, err := DecodeJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testPushRequest(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, body := range []string{
+		`{"streams": [{"stream": {}, "values": [["1700000000000000005"]]}]}`,
+		`{"streams": [{"stream": {}, "values": [["now", "line"]]}]}`,
+		`{"streams": [{"stream": {}, "values": [["1", "line", {"a": 1}]]}]}`,
+	} {
+		if _, err := DecodeJSON([]byte(body)); err == nil {
+			t.Errorf("DecodeJSON(%s) succeeded, want error", body)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Label
+		wantErr bool
+	}{
+		{in: `{}`, want: nil},
+		{in: `{a="1"}`, want: []Label{{Name: "a", Value: "1"}}},
+		{in: ` { a = "1" ,b="x,}" } `, want: []Label{{Name: "a", Value: "1"}, {Name: "b", Value: "x,}"}}},
+		{in: `a="1"`, wantErr: true},
+		{in: `{a="1"`, wantErr: true},
+		{in: `{a=1}`, wantErr: true},
+		{in: `{="1"}`, wantErr: true},
+		{in: `{a="1"} b`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLabels(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLabels(%q) error = %v, wantErr %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLabels(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToLogs(t *testing.T) {
+	req := testPushRequest()
+	// A second stream with the same labels shares the resource.
+	req.Streams = append(req.Streams, Stream{
+		Labels:  req.Streams[0].Labels,
+		Entries: []Entry{{Timestamp: testTime, Line: "stopped"}},
+	}, Stream{
+		Labels:  []Label{{Name: "service_name", Value: "worker"}, {Name: "job", Value: "batch"}},
+		Entries: []Entry{{Timestamp: testTime, Line: "tick"}},
+	}, Stream{
+		Entries: []Entry{{Timestamp: testTime, Line: "orphan"}},
+	})
+
+	ld := ToLogs(req)
+	if ld.ResourceLogs().Len() != 3 {
+		t.Fatalf("got %d resources, want 3", ld.ResourceLogs().Len())
+	}
+	if ld.LogRecordCount() != 5 {
+		t.Fatalf("got %d log records, want 5", ld.LogRecordCount())
+	}
+
+	wantServices := []string{"api", "worker", "unknown_service"}
+	for i, want := range wantServices {
+		v, _ := ld.ResourceLogs().At(i).Resource().Attributes().Get("service.name")
+		if v.Str() != want {
+			t.Errorf("resource %d service.name = %q, want %q", i, v.Str(), want)
+		}
+	}
+
+	rl := ld.ResourceLogs().At(0)
+	if v, _ := rl.Resource().Attributes().Get("env"); v.Str() != `prod "eu"` {
+		t.Errorf("env = %q", v.Str())
+	}
+	lr := rl.ScopeLogs().At(0).LogRecords().At(1)
+	if lr.Body().Str() != "request failed" || lr.Timestamp().AsTime() != testTime.Add(time.Second).UTC() {
+		t.Errorf("log record = %q at %v", lr.Body().Str(), lr.Timestamp())
+	}
+	if v, _ := lr.Attributes().Get("trace_id"); v.Str() != "abc" {
+		t.Errorf("trace_id attribute = %q", v.Str())
+	}
+}
@@ -0,0 +1,93 @@
+package loki
+
+import (
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+const attrServiceName = "service.name"
+
+// Labels service.name is derived from, in order of precedence, as Loki
+// derives its service_name label.
+// Ref: https://grafana.com/docs/loki/latest/configure/#limits_config
+var serviceNameLabels = []string{
+	"service_name",
+	"service",
+	"app",
+	"application",
+	"app_name",
+	"name",
+	"app_kubernetes_io_name",
+	"container",
+	"container_name",
+	"k8s_container_name",
+	"component",
+	"workload",
+	"job",
+	"k8s_job_name",
+}
+
+// Service name of streams without any of serviceNameLabels.
+const unknownServiceName = "unknown_service"
+
+// ToLogs translates req to OTLP logs:
+//
+//   - The labels of a stream become resource attributes, streams with the
+//     same labels share a resource.
+//   - service.name is the first of serviceNameLabels in the labels.
+//   - Entries become log records with the line as body and the structured
+//     metadata as attributes.
+func ToLogs(req PushRequest) plog.Logs {
+	ld := plog.NewLogs()
+	scopes := map[string]plog.ScopeLogs{}
+
+	for _, stream := range req.Streams {
+		key := labelsKey(stream.Labels)
+		sl, ok := scopes[key]
+		if !ok {
+			rl := ld.ResourceLogs().AppendEmpty()
+			attrs := rl.Resource().Attributes()
+			for _, l := range stream.Labels {
+				attrs.PutStr(l.Name, l.Value)
+			}
+			attrs.PutStr(attrServiceName, serviceName(stream.Labels))
+			sl = rl.ScopeLogs().AppendEmpty()
+			scopes[key] = sl
+		}
+
+		for _, entry := range stream.Entries {
+			lr := sl.LogRecords().AppendEmpty()
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(entry.Timestamp))
+			lr.Body().SetStr(entry.Line)
+			for _, l := range entry.StructuredMetadata {
+				lr.Attributes().PutStr(l.Name, l.Value)
+			}
+		}
+	}
+
+	return ld
+}
+
+func serviceName(labels []Label) string {
+	for _, name := range serviceNameLabels {
+		for _, l := range labels {
+			if l.Name == name && l.Value != "" {
+				return l.Value
+			}
+		}
+	}
+	return unknownServiceName
+}
+
+// labelsKey identifies a set of labels, in the order they were sent.
+func labelsKey(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(strconv.Quote(l.Name))
+		b.WriteString(strconv.Quote(l.Value))
+	}
+	return b.String()
+}
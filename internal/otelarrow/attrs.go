@@ -0,0 +1,116 @@
+package otelarrow
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// anyValue is the columns of an AnyValue: its pcommon.ValueType, and one
+// column per type. Maps and slices are CBOR encoded in ser.
+type anyValue struct {
+	typ, str, int, double, bool, bytes, ser arrow.Array
+}
+
+// anyValueOf returns the columns of an AnyValue, found by get.
+func anyValueOf(get func(name string) arrow.Array) anyValue {
+	return anyValue{
+		typ:    get("type"),
+		str:    get("str"),
+		int:    get("int"),
+		double: get("double"),
+		bool:   get("bool"),
+		bytes:  get("bytes"),
+		ser:    get("ser"),
+	}
+}
+
+func (v anyValue) valueType(i int) pcommon.ValueType {
+	return pcommon.ValueType(intAt(v.typ, i))
+}
+
+// put sets dest to the value of row i.
+func (v anyValue) put(dest pcommon.Value, i int) error {
+	switch v.valueType(i) {
+	case pcommon.ValueTypeStr:
+		dest.SetStr(strAt(v.str, i))
+	case pcommon.ValueTypeInt:
+		dest.SetInt(intAt(v.int, i))
+	case pcommon.ValueTypeDouble:
+		dest.SetDouble(floatAt(v.double, i))
+	case pcommon.ValueTypeBool:
+		dest.SetBool(boolAt(v.bool, i))
+	case pcommon.ValueTypeBytes:
+		dest.SetEmptyBytes().FromRaw(bytes.Clone(bytesAt(v.bytes, i)))
+	case pcommon.ValueTypeMap, pcommon.ValueTypeSlice:
+		if err := decodeCBOR(dest, bytesAt(v.ser, i)); err != nil {
+			return fmt.Errorf("serialized value: %w", err)
+		}
+	}
+	return nil
+}
+
+// equal tells whether rows i and j have the same scalar value. Maps, slices
+// and empty values are never equal, as for the exporter.
+func (v anyValue) equal(i, j int) bool {
+	typ := v.valueType(i)
+	if typ != v.valueType(j) {
+		return false
+	}
+	switch typ {
+	case pcommon.ValueTypeStr:
+		return strAt(v.str, i) == strAt(v.str, j)
+	case pcommon.ValueTypeInt:
+		return intAt(v.int, i) == intAt(v.int, j)
+	case pcommon.ValueTypeDouble:
+		return floatAt(v.double, i) == floatAt(v.double, j)
+	case pcommon.ValueTypeBool:
+		return boolAt(v.bool, i) == boolAt(v.bool, j)
+	case pcommon.ValueTypeBytes:
+		return bytes.Equal(bytesAt(v.bytes, i), bytesAt(v.bytes, j))
+	}
+	return false
+}
+
+// attrsByID is the attributes of an attribute table, by parent ID.
+type attrsByID map[uint32]pcommon.Map
+
+// decodeAttrs decodes an attribute table. Its parent IDs are quasi-delta
+// encoded by default, grouped by key and value.
+func decodeAttrs(rec arrow.RecordBatch) (attrsByID, error) {
+	if rec == nil {
+		return nil, nil
+	}
+
+	key := column(rec, "key")
+	values := anyValueOf(func(name string) arrow.Array { return column(rec, name) })
+	parents := parentIDs(rec, encodingQuasiDelta, func(i, j int) bool {
+		return strAt(key, i) == strAt(key, j) && values.equal(i, j)
+	})
+
+	attrs := attrsByID{}
+	for i := range int(rec.NumRows()) {
+		parent, ok := parents.next(i)
+		if !ok {
+			continue
+		}
+		m, ok := attrs[parent]
+		if !ok {
+			m = pcommon.NewMap()
+			attrs[parent] = m
+		}
+		if err := values.put(m.PutEmpty(strAt(key, i)), i); err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", strAt(key, i), err)
+		}
+	}
+	return attrs, nil
+}
+
+// copyTo copies the attributes of id, if any, to dest.
+func (a attrsByID) copyTo(dest pcommon.Map, id uint32, ok bool) {
+	if m, found := a[id]; ok && found {
+		m.CopyTo(dest)
+	}
+}
@@ -0,0 +1,181 @@
+package otelarrow
+
+import (
+	"errors"
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Map and slice values are serialized with CBOR, definite length items of
+// the types an AnyValue can hold.
+// Ref: https://www.rfc-editor.org/rfc/rfc8949
+
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+// Nesting limit of decoded values.
+const maxCBORDepth = 64
+
+// decodeCBOR sets dest to the CBOR encoded value in buf.
+func decodeCBOR(dest pcommon.Value, buf []byte) error {
+	d := cborDecoder{buf: buf}
+	if err := d.decode(dest, 0); err != nil {
+		return err
+	}
+	if len(d.buf) > 0 {
+		return errInvalidCBOR
+	}
+	return nil
+}
+
+type cborDecoder struct {
+	buf []byte
+}
+
+// head reads the initial byte of an item and its argument.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	if len(d.buf) == 0 {
+		return 0, 0, 0, errInvalidCBOR
+	}
+	major, info = d.buf[0]>>5, d.buf[0]&0x1f
+	d.buf = d.buf[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		// Indefinite lengths are not used by the exporter.
+		return 0, 0, 0, errInvalidCBOR
+	}
+	if len(d.buf) < n {
+		return 0, 0, 0, errInvalidCBOR
+	}
+	for _, b := range d.buf[:n] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.buf = d.buf[n:]
+	return major, info, arg, nil
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if uint64(len(d.buf)) < n {
+		return nil, errInvalidCBOR
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *cborDecoder) decode(dest pcommon.Value, depth int) error {
+	if depth > maxCBORDepth {
+		return errInvalidCBOR
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			dest.SetDouble(float64(arg))
+		} else {
+			dest.SetInt(int64(arg))
+		}
+	case 1:
+		if arg > math.MaxInt64 {
+			dest.SetDouble(-1 - float64(arg))
+		} else {
+			dest.SetInt(-1 - int64(arg))
+		}
+	case 2:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return err
+		}
+		dest.SetEmptyBytes().FromRaw(append([]byte(nil), b...))
+	case 3:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return err
+		}
+		dest.SetStr(string(b))
+	case 4:
+		if arg > uint64(len(d.buf)) {
+			return errInvalidCBOR
+		}
+		s := dest.SetEmptySlice()
+		s.EnsureCapacity(int(arg))
+		for range arg {
+			if err := d.decode(s.AppendEmpty(), depth+1); err != nil {
+				return err
+			}
+		}
+	case 5:
+		if arg > uint64(len(d.buf)) {
+			return errInvalidCBOR
+		}
+		m := dest.SetEmptyMap()
+		m.EnsureCapacity(int(arg))
+		for range arg {
+			key := pcommon.NewValueEmpty()
+			if err := d.decode(key, depth+1); err != nil {
+				return err
+			}
+			if err := d.decode(m.PutEmpty(key.AsString()), depth+1); err != nil {
+				return err
+			}
+		}
+	case 6:
+		// Tags only annotate the item that follows.
+		return d.decode(dest, depth+1)
+	case 7:
+		switch info {
+		case 20:
+			dest.SetBool(false)
+		case 21:
+			dest.SetBool(true)
+		case 22, 23:
+			// null and undefined are empty values.
+		case 25:
+			dest.SetDouble(float16(uint16(arg)))
+		case 26:
+			dest.SetDouble(float64(math.Float32frombits(uint32(arg))))
+		case 27:
+			dest.SetDouble(math.Float64frombits(arg))
+		default:
+			return errInvalidCBOR
+		}
+	}
+	return nil
+}
+
+// float16 converts an IEEE 754 half precision float.
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(1024+frac, exp-25)
+}
@@ -0,0 +1,187 @@
+package otelarrow
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// The OTAP schemas are adaptive: an optional column is left out of a record
+// when it has no values, and a column may be dictionary encoded or not, as
+// the exporter sees fit. The accessors below return the zero value for an
+// absent column or a null value, and read through dictionaries.
+
+// column returns the column of rec named name, or nil.
+func column(rec arrow.RecordBatch, name string) arrow.Array {
+	if rec == nil {
+		return nil
+	}
+	indices := rec.Schema().FieldIndices(name)
+	if len(indices) == 0 {
+		return nil
+	}
+	return rec.Column(indices[0])
+}
+
+// columnField returns the schema field of the column of rec named name.
+func columnField(rec arrow.RecordBatch, name string) (arrow.Field, bool) {
+	if rec == nil {
+		return arrow.Field{}, false
+	}
+	fields, ok := rec.Schema().FieldsByName(name)
+	if !ok {
+		return arrow.Field{}, false
+	}
+	return fields[0], true
+}
+
+// structField returns the field of the struct column arr named name, or
+// nil.
+func structField(arr arrow.Array, name string) arrow.Array {
+	st, ok := arr.(*array.Struct)
+	if !ok {
+		return nil
+	}
+	idx, ok := st.DataType().(*arrow.StructType).FieldIdx(name)
+	if !ok {
+		return nil
+	}
+	return st.Field(idx)
+}
+
+// structFieldMeta returns the schema field of the field of the struct column
+// arr named name.
+func structFieldMeta(arr arrow.Array, name string) (arrow.Field, bool) {
+	if arr == nil {
+		return arrow.Field{}, false
+	}
+	st, ok := arr.DataType().(*arrow.StructType)
+	if !ok {
+		return arrow.Field{}, false
+	}
+	return st.FieldByName(name)
+}
+
+func isValid(arr arrow.Array, i int) bool {
+	return arr != nil && arr.IsValid(i)
+}
+
+// value returns the array and index holding the value at i, the dictionary
+// of a dictionary encoded column.
+func value(arr arrow.Array, i int) (arrow.Array, int) {
+	if dict, ok := arr.(*array.Dictionary); ok {
+		return dict.Dictionary(), dict.GetValueIndex(i)
+	}
+	return arr, i
+}
+
+// intAt returns an integer, timestamp or duration value.
+func intAt(arr arrow.Array, i int) int64 {
+	if !isValid(arr, i) {
+		return 0
+	}
+	switch a, i := value(arr, i); a := a.(type) {
+	case *array.Int8:
+		return int64(a.Value(i))
+	case *array.Int16:
+		return int64(a.Value(i))
+	case *array.Int32:
+		return int64(a.Value(i))
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Uint8:
+		return int64(a.Value(i))
+	case *array.Uint16:
+		return int64(a.Value(i))
+	case *array.Uint32:
+		return int64(a.Value(i))
+	case *array.Uint64:
+		return int64(a.Value(i))
+	case *array.Timestamp:
+		return int64(a.Value(i))
+	case *array.Duration:
+		return int64(a.Value(i))
+	}
+	return 0
+}
+
+func uintAt(arr arrow.Array, i int) uint64 {
+	if !isValid(arr, i) {
+		return 0
+	}
+	if a, i := value(arr, i); a.DataType().ID() == arrow.UINT64 {
+		return a.(*array.Uint64).Value(i)
+	}
+	return uint64(intAt(arr, i))
+}
+
+func floatAt(arr arrow.Array, i int) float64 {
+	if !isValid(arr, i) {
+		return 0
+	}
+	switch a, i := value(arr, i); a := a.(type) {
+	case *array.Float32:
+		return float64(a.Value(i))
+	case *array.Float64:
+		return a.Value(i)
+	}
+	return 0
+}
+
+func boolAt(arr arrow.Array, i int) bool {
+	if !isValid(arr, i) {
+		return false
+	}
+	a, i := value(arr, i)
+	b, ok := a.(*array.Boolean)
+	return ok && b.Value(i)
+}
+
+func strAt(arr arrow.Array, i int) string {
+	if !isValid(arr, i) {
+		return ""
+	}
+	switch a, i := value(arr, i); a := a.(type) {
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Binary:
+		return string(a.Value(i))
+	}
+	return ""
+}
+
+// bytesAt returns a binary or fixed size binary value. It is only valid as
+// long as the record is.
+func bytesAt(arr arrow.Array, i int) []byte {
+	if !isValid(arr, i) {
+		return nil
+	}
+	switch a, i := value(arr, i); a := a.(type) {
+	case *array.Binary:
+		return a.Value(i)
+	case *array.LargeBinary:
+		return a.Value(i)
+	case *array.FixedSizeBinary:
+		return a.Value(i)
+	case *array.String:
+		return []byte(a.Value(i))
+	}
+	return nil
+}
+
+// listAt returns the values of the list column arr at i, and their range.
+func listAt(arr arrow.Array, i int) (arrow.Array, int, int) {
+	if !isValid(arr, i) {
+		return nil, 0, 0
+	}
+	switch a := arr.(type) {
+	case *array.List:
+		start, end := a.ValueOffsets(i)
+		return a.ListValues(), int(start), int(end)
+	case *array.LargeList:
+		start, end := a.ValueOffsets(i)
+		return a.ListValues(), int(start), int(end)
+	}
+	return nil, 0, 0
+}
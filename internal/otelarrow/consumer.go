@@ -0,0 +1,205 @@
+package otelarrow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Consumer decodes the batches of one stream. It is not safe for concurrent
+// use.
+type Consumer struct {
+	streams map[PayloadType]*ipcStream
+	mem     *limitedAllocator
+}
+
+// ipcStream is the Arrow IPC stream of a payload type. Its reader keeps the
+// schema and dictionaries from one payload to the next, until the schema ID
+// changes.
+type ipcStream struct {
+	schemaID string
+	buf      *bytes.Reader
+	reader   *ipc.Reader
+}
+
+// NewConsumer returns a Consumer that holds at most maxMemory bytes of
+// decoded records at once. Compressed buffers are allocated the size their
+// prefix declares, a batch that needs more fails to decode.
+func NewConsumer(maxMemory int) *Consumer {
+	return &Consumer{
+		streams: map[PayloadType]*ipcStream{},
+		mem:     &limitedAllocator{limit: int64(maxMemory)},
+	}
+}
+
+// Release frees the Arrow memory of the consumer.
+func (c *Consumer) Release() {
+	for _, s := range c.streams {
+		if s.reader != nil {
+			s.reader.Release()
+		}
+	}
+	clear(c.streams)
+}
+
+// records reads the record of each payload of batch, by payload type. The
+// records are valid until the next batch.
+func (c *Consumer) records(batch BatchArrowRecords) (map[PayloadType]arrow.RecordBatch, error) {
+	records := make(map[PayloadType]arrow.RecordBatch, len(batch.Payloads))
+	for _, payload := range batch.Payloads {
+		s, ok := c.streams[payload.Type]
+		if !ok || s.schemaID != payload.SchemaID {
+			if ok && s.reader != nil {
+				s.reader.Release()
+			}
+			s = &ipcStream{schemaID: payload.SchemaID, buf: bytes.NewReader(nil)}
+			c.streams[payload.Type] = s
+		}
+
+		s.buf.Reset(payload.Record)
+		if s.reader == nil {
+			// The first payload of a schema ID starts with the schema.
+			reader, err := ipc.NewReader(s.buf, ipc.WithAllocator(c.mem))
+			if err != nil {
+				delete(c.streams, payload.Type)
+				return nil, fmt.Errorf("payload %d: %w", payload.Type, err)
+			}
+			s.reader = reader
+		}
+
+		if !s.reader.Next() {
+			err := s.reader.Err()
+			if err == nil {
+				err = errors.New("no record batch")
+			}
+			return nil, fmt.Errorf("payload %d: %w", payload.Type, err)
+		}
+		records[payload.Type] = s.reader.RecordBatch()
+	}
+	return records, nil
+}
+
+var errMemoryLimit = errors.New("decoded records exceed the memory limit")
+
+// limitedAllocator fails allocations past limit bytes in use. The allocator
+// interface has no errors, it panics, and the IPC reader returns the panic as
+// the error of the record.
+type limitedAllocator struct {
+	limit int64
+	inUse atomic.Int64
+}
+
+func (a *limitedAllocator) reserve(size int) {
+	if a.inUse.Add(int64(size)) > a.limit {
+		a.inUse.Add(-int64(size))
+		panic(fmt.Errorf("%w of %d bytes", errMemoryLimit, a.limit))
+	}
+}
+
+func (a *limitedAllocator) Allocate(size int) []byte {
+	a.reserve(size)
+	return memory.DefaultAllocator.Allocate(size)
+}
+
+func (a *limitedAllocator) Reallocate(size int, b []byte) []byte {
+	if size > len(b) {
+		a.reserve(size - len(b))
+	} else {
+		a.inUse.Add(int64(size - len(b)))
+	}
+	return memory.DefaultAllocator.Reallocate(size, b)
+}
+
+func (a *limitedAllocator) Free(b []byte) {
+	a.inUse.Add(-int64(len(b)))
+	memory.DefaultAllocator.Free(b)
+}
+
+// resourceScopes tracks the resource and scope of the rows of a main table,
+// the rows of a resource and scope are consecutive. The resource and scope
+// IDs are delta encoded by default.
+type resourceScopes struct {
+	resource, scope       arrow.Array
+	resourceIDs, scopeIDs *idDecoder
+	schemaURL             arrow.Array
+	resourceAttrs         attrsByID
+	scopeAttrs            attrsByID
+	resourceID, scopeID   uint32
+	hasResource, hasScope bool
+	started               bool
+}
+
+func newResourceScopes(main arrow.RecordBatch, resourceAttrs, scopeAttrs attrsByID) *resourceScopes {
+	rs := &resourceScopes{
+		resource:      column(main, "resource"),
+		scope:         column(main, "scope"),
+		schemaURL:     column(main, "schema_url"),
+		resourceAttrs: resourceAttrs,
+		scopeAttrs:    scopeAttrs,
+	}
+	field, ok := structFieldMeta(rs.resource, "id")
+	rs.resourceIDs = newIDDecoder(structField(rs.resource, "id"), field, ok, encodingDelta)
+	field, ok = structFieldMeta(rs.scope, "id")
+	rs.scopeIDs = newIDDecoder(structField(rs.scope, "id"), field, ok, encodingDelta)
+	return rs
+}
+
+// next advances to row i, and reports whether it starts a new resource, and
+// a new scope.
+func (rs *resourceScopes) next(i int) (newResource, newScope bool) {
+	resourceID, hasResource := rs.resourceIDs.next(i)
+	scopeID, hasScope := rs.scopeIDs.next(i)
+
+	newResource = !rs.started || resourceID != rs.resourceID || hasResource != rs.hasResource
+	newScope = newResource || scopeID != rs.scopeID || hasScope != rs.hasScope
+	rs.resourceID, rs.hasResource = resourceID, hasResource
+	rs.scopeID, rs.hasScope = scopeID, hasScope
+	rs.started = true
+	return newResource, newScope
+}
+
+// putResource sets the resource of row i, and returns its schema URL.
+func (rs *resourceScopes) putResource(res pcommon.Resource, i int) string {
+	rs.resourceAttrs.copyTo(res.Attributes(), rs.resourceID, rs.hasResource)
+	res.SetDroppedAttributesCount(uint32(uintAt(structField(rs.resource, "dropped_attributes_count"), i)))
+	return strAt(structField(rs.resource, "schema_url"), i)
+}
+
+// putScope sets the scope of row i, and returns its schema URL.
+func (rs *resourceScopes) putScope(scope pcommon.InstrumentationScope, i int) string {
+	rs.scopeAttrs.copyTo(scope.Attributes(), rs.scopeID, rs.hasScope)
+	scope.SetName(strAt(structField(rs.scope, "name"), i))
+	scope.SetVersion(strAt(structField(rs.scope, "version"), i))
+	scope.SetDroppedAttributesCount(uint32(uintAt(structField(rs.scope, "dropped_attributes_count"), i)))
+	return strAt(rs.schemaURL, i)
+}
+
+// decodeAttrTables decodes the attribute tables of types in records.
+func decodeAttrTables(records map[PayloadType]arrow.RecordBatch, types ...PayloadType) (map[PayloadType]attrsByID, error) {
+	tables := make(map[PayloadType]attrsByID, len(types))
+	for _, typ := range types {
+		attrs, err := decodeAttrs(records[typ])
+		if err != nil {
+			return nil, fmt.Errorf("payload %d: %w", typ, err)
+		}
+		tables[typ] = attrs
+	}
+	return tables, nil
+}
+
+// putID copies a trace or span ID of row i of arr to dest, if it has the
+// size of dest.
+func putID(dest []byte, arr arrow.Array, i int) bool {
+	b := bytesAt(arr, i)
+	if len(b) != len(dest) {
+		return false
+	}
+	copy(dest, b)
+	return true
+}
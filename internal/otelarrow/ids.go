@@ -0,0 +1,100 @@
+package otelarrow
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// encoding is how the values of an ID column are transmitted. The exporter
+// sorts the rows of a table so that most IDs are a small delta from the ID
+// of the previous row.
+type encoding int
+
+const (
+	// The IDs themselves.
+	encodingPlain encoding = iota
+	// Each non-null value is the delta from the previous ID.
+	encodingDelta
+	// A value is the delta from the previous ID if the row is in the same
+	// group as the previous row, such as an attribute with the same key and
+	// value, and the ID itself otherwise.
+	encodingQuasiDelta
+)
+
+// Field metadata naming the encoding of an ID column. Without it, which is
+// what the Go exporter sends, each column has the encoding its exporter
+// always uses.
+const encodingMetadataKey = "encoding"
+
+var encodingNames = map[string]encoding{
+	"plain":      encodingPlain,
+	"delta":      encodingDelta,
+	"quasidelta": encodingQuasiDelta,
+}
+
+// fieldEncoding returns the encoding of field, or def if it has none.
+func fieldEncoding(field arrow.Field, ok bool, def encoding) encoding {
+	if !ok {
+		return def
+	}
+	i := field.Metadata.FindKey(encodingMetadataKey)
+	if i < 0 {
+		return def
+	}
+	if enc, ok := encodingNames[field.Metadata.Values()[i]]; ok {
+		return enc
+	}
+	return def
+}
+
+// idDecoder decodes an ID column. next must be called for every row, in
+// order.
+type idDecoder struct {
+	arr  arrow.Array
+	enc  encoding
+	prev uint32
+	// sameGroup tells whether two rows are in the same group, for
+	// encodingQuasiDelta.
+	sameGroup func(i, j int) bool
+	prevRow   int
+}
+
+func newIDDecoder(arr arrow.Array, field arrow.Field, ok bool, def encoding) *idDecoder {
+	return &idDecoder{arr: arr, enc: fieldEncoding(field, ok, def), prevRow: -1}
+}
+
+// next returns the ID of row i, or false if it has none.
+func (d *idDecoder) next(i int) (uint32, bool) {
+	if !isValid(d.arr, i) {
+		return 0, false
+	}
+	v := uint32(uintAt(d.arr, i))
+
+	switch d.enc {
+	case encodingDelta:
+		d.prev += v
+		return d.prev, true
+	case encodingQuasiDelta:
+		if d.prevRow >= 0 && d.sameGroup != nil && d.sameGroup(d.prevRow, i) {
+			v += d.prev
+		}
+		d.prev, d.prevRow = v, i
+		return v, true
+	}
+	return v, true
+}
+
+// recordIDs returns the decoder of the column of rec named name, delta
+// encoded by default.
+func recordIDs(rec arrow.RecordBatch, name string) *idDecoder {
+	field, ok := columnField(rec, name)
+	return newIDDecoder(column(rec, name), field, ok, encodingDelta)
+}
+
+// parentIDs returns the decoder of the parent_id column of rec, encoded
+// with def unless its metadata says otherwise.
+func parentIDs(rec arrow.RecordBatch, def encoding, sameGroup func(i, j int) bool) *idDecoder {
+	field, ok := columnField(rec, "parent_id")
+	d := newIDDecoder(column(rec, "parent_id"), field, ok, def)
+	d.sameGroup = sameGroup
+	return d
+}
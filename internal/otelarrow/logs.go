@@ -0,0 +1,89 @@
+package otelarrow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+var errNoMainRecord = errors.New("batch has no main record")
+
+// Logs converts a batch of the logs stream.
+func (c *Consumer) Logs(batch BatchArrowRecords) (plog.Logs, error) {
+	ld := plog.NewLogs()
+	records, err := c.records(batch)
+	if err != nil {
+		return ld, err
+	}
+	main, ok := records[PayloadLogs]
+	if !ok {
+		if len(records) == 0 {
+			return ld, nil
+		}
+		return ld, errNoMainRecord
+	}
+	attrs, err := decodeAttrTables(records, PayloadResourceAttrs, PayloadScopeAttrs, PayloadLogAttrs)
+	if err != nil {
+		return ld, err
+	}
+
+	var (
+		ids            = recordIDs(main, "id")
+		timestamps     = column(main, "time_unix_nano")
+		observed       = column(main, "observed_time_unix_nano")
+		traceIDs       = column(main, "trace_id")
+		spanIDs        = column(main, "span_id")
+		severityNumber = column(main, "severity_number")
+		severityText   = column(main, "severity_text")
+		eventName      = column(main, "event_name")
+		dropped        = column(main, "dropped_attributes_count")
+		flags          = column(main, "flags")
+		body           = column(main, "body")
+		bodyValue      = anyValueOf(func(name string) arrow.Array { return structField(body, name) })
+	)
+
+	rs := newResourceScopes(main, attrs[PayloadResourceAttrs], attrs[PayloadScopeAttrs])
+	var (
+		resourceLogs plog.ResourceLogs
+		scopeLogs    plog.ScopeLogs
+	)
+	for i := range int(main.NumRows()) {
+		newResource, newScope := rs.next(i)
+		if newResource {
+			resourceLogs = ld.ResourceLogs().AppendEmpty()
+			resourceLogs.SetSchemaUrl(rs.putResource(resourceLogs.Resource(), i))
+		}
+		if newScope {
+			scopeLogs = resourceLogs.ScopeLogs().AppendEmpty()
+			scopeLogs.SetSchemaUrl(rs.putScope(scopeLogs.Scope(), i))
+		}
+
+		lr := scopeLogs.LogRecords().AppendEmpty()
+		lr.SetTimestamp(pcommon.Timestamp(intAt(timestamps, i)))
+		lr.SetObservedTimestamp(pcommon.Timestamp(intAt(observed, i)))
+		var traceID pcommon.TraceID
+		if putID(traceID[:], traceIDs, i) {
+			lr.SetTraceID(traceID)
+		}
+		var spanID pcommon.SpanID
+		if putID(spanID[:], spanIDs, i) {
+			lr.SetSpanID(spanID)
+		}
+		lr.SetSeverityNumber(plog.SeverityNumber(intAt(severityNumber, i)))
+		lr.SetSeverityText(strAt(severityText, i))
+		lr.SetEventName(strAt(eventName, i))
+		lr.SetDroppedAttributesCount(uint32(uintAt(dropped, i)))
+		lr.SetFlags(plog.LogRecordFlags(uintAt(flags, i)))
+		if isValid(body, i) {
+			if err := bodyValue.put(lr.Body(), i); err != nil {
+				return ld, fmt.Errorf("log body: %w", err)
+			}
+		}
+		id, ok := ids.next(i)
+		attrs[PayloadLogAttrs].copyTo(lr.Attributes(), id, ok)
+	}
+	return ld, nil
+}
@@ -0,0 +1,293 @@
+package otelarrow
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Metrics converts a batch of the metrics stream. Exemplars are not decoded,
+// as they are not stored.
+func (c *Consumer) Metrics(batch BatchArrowRecords) (pmetric.Metrics, error) {
+	md := pmetric.NewMetrics()
+	records, err := c.records(batch)
+	if err != nil {
+		return md, err
+	}
+	main, ok := records[PayloadUnivariateMetrics]
+	if !ok {
+		if len(records) == 0 {
+			return md, nil
+		}
+		return md, errNoMainRecord
+	}
+	attrs, err := decodeAttrTables(records,
+		PayloadResourceAttrs, PayloadScopeAttrs,
+		PayloadNumberDPAttrs, PayloadSummaryDPAttrs, PayloadHistogramDPAttrs, PayloadExpHistogramDPAttrs)
+	if err != nil {
+		return md, err
+	}
+
+	var (
+		ids         = recordIDs(main, "id")
+		metricType  = column(main, "metric_type")
+		name        = column(main, "name")
+		description = column(main, "description")
+		unit        = column(main, "unit")
+		temporality = column(main, "aggregation_temporality")
+		monotonic   = column(main, "is_monotonic")
+	)
+
+	rs := newResourceScopes(main, attrs[PayloadResourceAttrs], attrs[PayloadScopeAttrs])
+	var (
+		resourceMetrics pmetric.ResourceMetrics
+		scopeMetrics    pmetric.ScopeMetrics
+	)
+	metrics := map[uint32]pmetric.Metric{}
+	for i := range int(main.NumRows()) {
+		newResource, newScope := rs.next(i)
+		if newResource {
+			resourceMetrics = md.ResourceMetrics().AppendEmpty()
+			resourceMetrics.SetSchemaUrl(rs.putResource(resourceMetrics.Resource(), i))
+		}
+		if newScope {
+			scopeMetrics = resourceMetrics.ScopeMetrics().AppendEmpty()
+			scopeMetrics.SetSchemaUrl(rs.putScope(scopeMetrics.Scope(), i))
+		}
+
+		metric := scopeMetrics.Metrics().AppendEmpty()
+		metric.SetName(strAt(name, i))
+		metric.SetDescription(strAt(description, i))
+		metric.SetUnit(strAt(unit, i))
+		aggregation := pmetric.AggregationTemporality(intAt(temporality, i))
+		switch pmetric.MetricType(intAt(metricType, i)) {
+		case pmetric.MetricTypeGauge:
+			metric.SetEmptyGauge()
+		case pmetric.MetricTypeSum:
+			sum := metric.SetEmptySum()
+			sum.SetAggregationTemporality(aggregation)
+			sum.SetIsMonotonic(boolAt(monotonic, i))
+		case pmetric.MetricTypeHistogram:
+			metric.SetEmptyHistogram().SetAggregationTemporality(aggregation)
+		case pmetric.MetricTypeExponentialHistogram:
+			metric.SetEmptyExponentialHistogram().SetAggregationTemporality(aggregation)
+		case pmetric.MetricTypeSummary:
+			metric.SetEmptySummary()
+		}
+
+		if id, ok := ids.next(i); ok {
+			metrics[id] = metric
+		}
+	}
+
+	decodeNumberDataPoints(records[PayloadNumberDataPoints], attrs[PayloadNumberDPAttrs], metrics)
+	decodeSummaryDataPoints(records[PayloadSummaryDataPoints], attrs[PayloadSummaryDPAttrs], metrics)
+	decodeHistogramDataPoints(records[PayloadHistogramDataPoints], attrs[PayloadHistogramDPAttrs], metrics)
+	decodeExpHistogramDataPoints(records[PayloadExpHistogramDataPoints], attrs[PayloadExpHistogramDPAttrs], metrics)
+	return md, nil
+}
+
+// dataPoints iterates over the rows of a data points table. Its parent IDs
+// are delta encoded by default.
+type dataPoints struct {
+	rec         arrow.RecordBatch
+	ids         *idDecoder
+	parents     *idDecoder
+	attrs       attrsByID
+	start, time arrow.Array
+	flags       arrow.Array
+}
+
+func newDataPoints(rec arrow.RecordBatch, attrs attrsByID) *dataPoints {
+	return &dataPoints{
+		rec:     rec,
+		ids:     recordIDs(rec, "id"),
+		parents: parentIDs(rec, encodingDelta, nil),
+		attrs:   attrs,
+		start:   column(rec, "start_time_unix_nano"),
+		time:    column(rec, "time_unix_nano"),
+		flags:   column(rec, "flags"),
+	}
+}
+
+// dataPoint is the fields every kind of data point has.
+type dataPoint interface {
+	Attributes() pcommon.Map
+	SetStartTimestamp(pcommon.Timestamp)
+	SetTimestamp(pcommon.Timestamp)
+	SetFlags(pmetric.DataPointFlags)
+}
+
+// each calls fn with the metric of each row, skipping the data points of
+// unknown metrics.
+func (d *dataPoints) each(metrics map[uint32]pmetric.Metric, fn func(metric pmetric.Metric, i int) dataPoint) {
+	for i := range int(d.rec.NumRows()) {
+		id, hasID := d.ids.next(i)
+		parent, ok := d.parents.next(i)
+		if !ok {
+			continue
+		}
+		metric, ok := metrics[parent]
+		if !ok {
+			continue
+		}
+		dp := fn(metric, i)
+		if dp == nil {
+			continue
+		}
+		dp.SetStartTimestamp(pcommon.Timestamp(intAt(d.start, i)))
+		dp.SetTimestamp(pcommon.Timestamp(intAt(d.time, i)))
+		dp.SetFlags(pmetric.DataPointFlags(uintAt(d.flags, i)))
+		d.attrs.copyTo(dp.Attributes(), id, hasID)
+	}
+}
+
+func decodeNumberDataPoints(rec arrow.RecordBatch, attrs attrsByID, metrics map[uint32]pmetric.Metric) {
+	if rec == nil {
+		return
+	}
+	intValue := column(rec, "int_value")
+	doubleValue := column(rec, "double_value")
+
+	newDataPoints(rec, attrs).each(metrics, func(metric pmetric.Metric, i int) dataPoint {
+		var dp pmetric.NumberDataPoint
+		switch metric.Type() {
+		case pmetric.MetricTypeGauge:
+			dp = metric.Gauge().DataPoints().AppendEmpty()
+		case pmetric.MetricTypeSum:
+			dp = metric.Sum().DataPoints().AppendEmpty()
+		default:
+			return nil
+		}
+		if isValid(doubleValue, i) {
+			dp.SetDoubleValue(floatAt(doubleValue, i))
+		} else if isValid(intValue, i) {
+			dp.SetIntValue(intAt(intValue, i))
+		}
+		return dp
+	})
+}
+
+func decodeSummaryDataPoints(rec arrow.RecordBatch, attrs attrsByID, metrics map[uint32]pmetric.Metric) {
+	if rec == nil {
+		return
+	}
+	count := column(rec, "count")
+	sum := column(rec, "sum")
+	quantiles := column(rec, "quantile")
+
+	newDataPoints(rec, attrs).each(metrics, func(metric pmetric.Metric, i int) dataPoint {
+		if metric.Type() != pmetric.MetricTypeSummary {
+			return nil
+		}
+		dp := metric.Summary().DataPoints().AppendEmpty()
+		dp.SetCount(uintAt(count, i))
+		dp.SetSum(floatAt(sum, i))
+
+		values, start, end := listAt(quantiles, i)
+		quantile, value := structField(values, "quantile"), structField(values, "value")
+		dp.QuantileValues().EnsureCapacity(end - start)
+		for j := start; j < end; j++ {
+			q := dp.QuantileValues().AppendEmpty()
+			q.SetQuantile(floatAt(quantile, j))
+			q.SetValue(floatAt(value, j))
+		}
+		return dp
+	})
+}
+
+func decodeHistogramDataPoints(rec arrow.RecordBatch, attrs attrsByID, metrics map[uint32]pmetric.Metric) {
+	if rec == nil {
+		return
+	}
+	var (
+		count          = column(rec, "count")
+		sum            = column(rec, "sum")
+		minValue       = column(rec, "min")
+		maxValue       = column(rec, "max")
+		bucketCounts   = column(rec, "bucket_counts")
+		explicitBounds = column(rec, "explicit_bounds")
+	)
+
+	newDataPoints(rec, attrs).each(metrics, func(metric pmetric.Metric, i int) dataPoint {
+		if metric.Type() != pmetric.MetricTypeHistogram {
+			return nil
+		}
+		dp := metric.Histogram().DataPoints().AppendEmpty()
+		dp.SetCount(uintAt(count, i))
+		if isValid(sum, i) {
+			dp.SetSum(floatAt(sum, i))
+		}
+		if isValid(minValue, i) {
+			dp.SetMin(floatAt(minValue, i))
+		}
+		if isValid(maxValue, i) {
+			dp.SetMax(floatAt(maxValue, i))
+		}
+		putUints(dp.BucketCounts(), bucketCounts, i)
+		values, start, end := listAt(explicitBounds, i)
+		dp.ExplicitBounds().EnsureCapacity(end - start)
+		for j := start; j < end; j++ {
+			dp.ExplicitBounds().Append(floatAt(values, j))
+		}
+		return dp
+	})
+}
+
+func decodeExpHistogramDataPoints(rec arrow.RecordBatch, attrs attrsByID, metrics map[uint32]pmetric.Metric) {
+	if rec == nil {
+		return
+	}
+	var (
+		count         = column(rec, "count")
+		sum           = column(rec, "sum")
+		minValue      = column(rec, "min")
+		maxValue      = column(rec, "max")
+		scale         = column(rec, "scale")
+		zeroCount     = column(rec, "zero_count")
+		zeroThreshold = column(rec, "zero_threshold")
+		positive      = column(rec, "positive")
+		negative      = column(rec, "negative")
+	)
+
+	newDataPoints(rec, attrs).each(metrics, func(metric pmetric.Metric, i int) dataPoint {
+		if metric.Type() != pmetric.MetricTypeExponentialHistogram {
+			return nil
+		}
+		dp := metric.ExponentialHistogram().DataPoints().AppendEmpty()
+		dp.SetCount(uintAt(count, i))
+		if isValid(sum, i) {
+			dp.SetSum(floatAt(sum, i))
+		}
+		if isValid(minValue, i) {
+			dp.SetMin(floatAt(minValue, i))
+		}
+		if isValid(maxValue, i) {
+			dp.SetMax(floatAt(maxValue, i))
+		}
+		dp.SetScale(int32(intAt(scale, i)))
+		dp.SetZeroCount(uintAt(zeroCount, i))
+		dp.SetZeroThreshold(floatAt(zeroThreshold, i))
+		putBuckets(dp.Positive(), positive, i)
+		putBuckets(dp.Negative(), negative, i)
+		return dp
+	})
+}
+
+// putBuckets sets dest to the buckets of row i of the struct column arr.
+func putBuckets(dest pmetric.ExponentialHistogramDataPointBuckets, arr arrow.Array, i int) {
+	if !isValid(arr, i) {
+		return
+	}
+	dest.SetOffset(int32(intAt(structField(arr, "offset"), i)))
+	putUints(dest.BucketCounts(), structField(arr, "bucket_counts"), i)
+}
+
+// putUints sets dest to the values of row i of the list column arr.
+func putUints(dest pcommon.UInt64Slice, arr arrow.Array, i int) {
+	values, start, end := listAt(arr, i)
+	dest.EnsureCapacity(end - start)
+	for j := start; j < end; j++ {
+		dest.Append(uintAt(values, j))
+	}
+}
@@ -0,0 +1,525 @@
+package otelarrow
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// producer writes records the way the exporter does: one IPC stream per
+// schema, its schema only sent in the first payload.
+type producer struct {
+	t       *testing.T
+	buf     bytes.Buffer
+	writers map[PayloadType]*ipc.Writer
+	opts    []ipc.Option
+	batchID int64
+}
+
+const testMaxMemory = 1 << 20
+
+func newProducer(t *testing.T) *producer {
+	p := &producer{t: t, writers: map[PayloadType]*ipc.Writer{}}
+	t.Cleanup(func() {
+		for _, w := range p.writers {
+			w.Close()
+		}
+	})
+	return p
+}
+
+type table struct {
+	typ    PayloadType
+	schema *arrow.Schema
+	rows   string
+}
+
+// batch encodes tables as a BatchArrowRecords message, and decodes it.
+func (p *producer) batch(tables ...table) BatchArrowRecords {
+	p.t.Helper()
+
+	p.batchID++
+	msg := protowire.AppendTag(nil, 1, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(p.batchID))
+	for _, tbl := range tables {
+		rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, tbl.schema, strings.NewReader(tbl.rows))
+		if err != nil {
+			p.t.Fatalf("payload %d: %v", tbl.typ, err)
+		}
+		w, ok := p.writers[tbl.typ]
+		if !ok {
+			w = ipc.NewWriter(&p.buf, append(p.opts, ipc.WithSchema(tbl.schema))...)
+			p.writers[tbl.typ] = w
+		}
+		if err := w.Write(rec); err != nil {
+			p.t.Fatal(err)
+		}
+		rec.Release()
+
+		var payload []byte
+		payload = protowire.AppendTag(payload, 1, protowire.BytesType)
+		payload = protowire.AppendString(payload, tbl.schema.String())
+		payload = protowire.AppendTag(payload, 2, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, uint64(tbl.typ))
+		payload = protowire.AppendTag(payload, 3, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, p.buf.Bytes())
+		p.buf.Reset()
+
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, payload)
+	}
+
+	batch, err := DecodeBatchArrowRecords(msg)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if batch.BatchID != p.batchID || len(batch.Payloads) != len(tables) {
+		p.t.Fatalf("batch = %+v", batch)
+	}
+	return batch
+}
+
+var (
+	dictString = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Uint8, ValueType: arrow.BinaryTypes.String}
+	timestamp  = arrow.FixedWidthTypes.Timestamp_ns
+
+	resourceType = arrow.StructOf(
+		arrow.Field{Name: "id", Type: arrow.PrimitiveTypes.Uint16, Nullable: true},
+		arrow.Field{Name: "schema_url", Type: dictString, Nullable: true},
+	)
+	scopeType = arrow.StructOf(
+		arrow.Field{Name: "id", Type: arrow.PrimitiveTypes.Uint16, Nullable: true},
+		arrow.Field{Name: "name", Type: dictString, Nullable: true},
+		arrow.Field{Name: "version", Type: arrow.BinaryTypes.String, Nullable: true},
+	)
+
+	attrsSchema = arrow.NewSchema([]arrow.Field{
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "key", Type: dictString},
+		{Name: "type", Type: arrow.PrimitiveTypes.Uint8},
+		{Name: "str", Type: dictString, Nullable: true},
+		{Name: "int", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "ser", Type: arrow.BinaryTypes.Binary, Nullable: true},
+	}, nil)
+)
+
+func TestLogs(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint16, Nullable: true},
+		{Name: "resource", Type: resourceType},
+		{Name: "scope", Type: scopeType},
+		{Name: "schema_url", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "time_unix_nano", Type: timestamp},
+		{Name: "severity_number", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "severity_text", Type: dictString, Nullable: true},
+		{Name: "trace_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 16}, Nullable: true},
+		{Name: "body", Type: arrow.StructOf(
+			arrow.Field{Name: "type", Type: arrow.PrimitiveTypes.Uint8},
+			arrow.Field{Name: "str", Type: dictString, Nullable: true},
+			arrow.Field{Name: "int", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+			arrow.Field{Name: "ser", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		), Nullable: true},
+	}, nil)
+
+	// {"a": [1, -2, true]}
+	ser := []byte{0xa1, 0x61, 'a', 0x83, 0x01, 0x21, 0xf5}
+
+	p := newProducer(t)
+	c := NewConsumer(testMaxMemory)
+	defer c.Release()
+
+	// Two resources, the ids of the logs and their resources are deltas.
+	// The attributes are sorted by key and value, the parent ID of the same
+	// key and value as the previous row is a delta.
+	ld, err := c.Logs(p.batch(
+		table{PayloadLogs, schema, `[
+			{"id": 0, "resource": {"id": 0, "schema_url": "https://r"}, "scope": {"id": 0, "name": "app", "version": "1.0"},
+			 "schema_url": "https://s", "time_unix_nano": 1000, "severity_number": 9, "severity_text": "INFO",
+			 "trace_id": "AAECAwQFBgcICQoLDA0ODw==", "body": {"type": 1, "str": "hello"}},
+			{"id": 1, "resource": {"id": 0, "schema_url": "https://r"}, "scope": {"id": 0, "name": "app", "version": "1.0"},
+			 "schema_url": "https://s", "time_unix_nano": 2000, "severity_number": 17, "severity_text": "ERROR",
+			 "body": {"type": 2, "int": 42}},
+			{"id": 1, "resource": {"id": 1}, "scope": {"id": 1, "name": "lib"},
+			 "time_unix_nano": 3000, "body": {"type": 5, "ser": "` + b64(ser) + `"}}
+		]`},
+		table{PayloadLogAttrs, attrsSchema, `[
+			{"parent_id": 0, "key": "k", "type": 1, "str": "a"},
+			{"parent_id": 2, "key": "k", "type": 1, "str": "a"},
+			{"parent_id": 1, "key": "n", "type": 2, "int": 7}
+		]`},
+		table{PayloadResourceAttrs, attrsSchema, `[
+			{"parent_id": 0, "key": "service.name", "type": 1, "str": "api"},
+			{"parent_id": 1, "key": "service.name", "type": 1, "str": "worker"}
+		]`},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := plog.NewLogs()
+	rl := want.ResourceLogs().AppendEmpty()
+	rl.SetSchemaUrl("https://r")
+	rl.Resource().Attributes().PutStr("service.name", "api")
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.SetSchemaUrl("https://s")
+	sl.Scope().SetName("app")
+	sl.Scope().SetVersion("1.0")
+	lr := sl.LogRecords().AppendEmpty()
+	lr.SetTimestamp(1000)
+	lr.SetSeverityNumber(plog.SeverityNumberInfo)
+	lr.SetSeverityText("INFO")
+	lr.SetTraceID(pcommon.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	lr.Body().SetStr("hello")
+	lr.Attributes().PutStr("k", "a")
+	lr = sl.LogRecords().AppendEmpty()
+	lr.SetTimestamp(2000)
+	lr.SetSeverityNumber(plog.SeverityNumberError)
+	lr.SetSeverityText("ERROR")
+	lr.Body().SetInt(42)
+	lr.Attributes().PutInt("n", 7)
+	rl = want.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "worker")
+	sl = rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName("lib")
+	lr = sl.LogRecords().AppendEmpty()
+	lr.SetTimestamp(3000)
+	s := lr.Body().SetEmptyMap().PutEmptySlice("a")
+	s.AppendEmpty().SetInt(1)
+	s.AppendEmpty().SetInt(-2)
+	s.AppendEmpty().SetBool(true)
+	lr.Attributes().PutStr("k", "a")
+
+	if !reflect.DeepEqual(ld, want) {
+		t.Errorf("logs = %v, want %v", logsJSON(t, ld), logsJSON(t, want))
+	}
+
+	// The next batch continues the IPC streams, without their schemas.
+	ld, err = c.Logs(p.batch(
+		table{PayloadLogs, schema, `[
+			{"id": 0, "resource": {"id": 0}, "scope": {"id": 0}, "time_unix_nano": 4000, "severity_text": "WARN"}
+		]`},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ld.LogRecordCount() != 1 {
+		t.Fatalf("log count = %d, want 1", ld.LogRecordCount())
+	}
+	lr = ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	if lr.Timestamp() != 4000 || lr.SeverityText() != "WARN" || lr.Attributes().Len() != 0 {
+		t.Errorf("log = %v %q %v", lr.Timestamp(), lr.SeverityText(), lr.Attributes().AsRaw())
+	}
+
+	if _, err := c.Logs(p.batch(table{PayloadLogAttrs, attrsSchema, `[]`})); err != errNoMainRecord {
+		t.Errorf("batch without logs error = %v, want %v", err, errNoMainRecord)
+	}
+}
+
+func TestTraces(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint16, Nullable: true},
+		{Name: "resource", Type: resourceType},
+		{Name: "scope", Type: scopeType},
+		{Name: "start_time_unix_nano", Type: timestamp},
+		{Name: "duration_time_unix_nano", Type: arrow.FixedWidthTypes.Duration_ns},
+		{Name: "trace_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 16}},
+		{Name: "span_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 8}},
+		{Name: "parent_span_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 8}, Nullable: true},
+		{Name: "name", Type: dictString},
+		{Name: "kind", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "status", Type: arrow.StructOf(
+			arrow.Field{Name: "code", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+			arrow.Field{Name: "status_message", Type: arrow.BinaryTypes.String, Nullable: true},
+		), Nullable: true},
+	}, nil)
+	eventsSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint32, Nullable: true},
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "time_unix_nano", Type: timestamp, Nullable: true},
+		{Name: "name", Type: dictString},
+	}, nil)
+	linksSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint32, Nullable: true},
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "trace_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 16}, Nullable: true},
+		{Name: "span_id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 8}, Nullable: true},
+	}, nil)
+
+	traceID := "AAECAwQFBgcICQoLDA0ODw=="
+	p := newProducer(t)
+	c := NewConsumer(testMaxMemory)
+	defer c.Release()
+
+	// The events are grouped by name, the parent ID of an event with the
+	// same name as the previous one is a delta.
+	td, err := c.Traces(p.batch(
+		table{PayloadSpans, schema, `[
+			{"id": 0, "resource": {"id": 0}, "scope": {"id": 0}, "start_time_unix_nano": 1000, "duration_time_unix_nano": 500,
+			 "trace_id": "` + traceID + `", "span_id": "AQEBAQEBAQE=", "name": "GET /", "kind": 2,
+			 "status": {"code": 2, "status_message": "boom"}},
+			{"id": 1, "resource": {"id": 0}, "scope": {"id": 0}, "start_time_unix_nano": 1100, "duration_time_unix_nano": 100,
+			 "trace_id": "` + traceID + `", "span_id": "AgICAgICAgI=", "parent_span_id": "AQEBAQEBAQE=", "name": "query"}
+		]`},
+		table{PayloadSpanEvents, eventsSchema, `[
+			{"id": 0, "parent_id": 0, "time_unix_nano": 1200, "name": "exception"},
+			{"id": 1, "parent_id": 1, "time_unix_nano": 1300, "name": "exception"},
+			{"id": 1, "parent_id": 0, "time_unix_nano": 1400, "name": "retry"}
+		]`},
+		table{PayloadSpanEventAttrs, attrsSchema, `[
+			{"parent_id": 1, "key": "attempt", "type": 2, "int": 2}
+		]`},
+		table{PayloadSpanLinks, linksSchema, `[
+			{"id": 0, "parent_id": 1, "trace_id": "` + traceID + `", "span_id": "AwMDAwMDAwM="}
+		]`},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := td.ResourceSpans().At(0).ScopeSpans().At(0).Spans()
+	if td.ResourceSpans().Len() != 1 || spans.Len() != 2 {
+		t.Fatalf("span count = %d", td.SpanCount())
+	}
+	root, child := spans.At(0), spans.At(1)
+	if root.EndTimestamp() != 1500 || root.Kind() != ptrace.SpanKindServer ||
+		root.Status().Code() != ptrace.StatusCodeError || root.Status().Message() != "boom" {
+		t.Errorf("root span = %v %v %v", root.EndTimestamp(), root.Kind(), root.Status().Message())
+	}
+	if root.Events().Len() != 2 || root.Events().At(0).Name() != "exception" || root.Events().At(1).Name() != "retry" {
+		t.Errorf("root span events = %d", root.Events().Len())
+	}
+	if child.ParentSpanID() != root.SpanID() || child.EndTimestamp() != 1200 {
+		t.Errorf("child span = %v %v", child.ParentSpanID(), child.EndTimestamp())
+	}
+	if child.Events().Len() != 1 || child.Events().At(0).Timestamp() != 1300 {
+		t.Fatalf("child span events = %d", child.Events().Len())
+	}
+	if got := child.Events().At(0).Attributes().AsRaw(); !reflect.DeepEqual(got, map[string]any{"attempt": int64(2)}) {
+		t.Errorf("child span event attributes = %v", got)
+	}
+	if child.Links().Len() != 1 || child.Links().At(0).SpanID() != (pcommon.SpanID{3, 3, 3, 3, 3, 3, 3, 3}) {
+		t.Errorf("child span links = %d", child.Links().Len())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "resource", Type: resourceType},
+		{Name: "scope", Type: scopeType},
+		{Name: "metric_type", Type: arrow.PrimitiveTypes.Uint8},
+		{Name: "name", Type: dictString},
+		{Name: "unit", Type: dictString, Nullable: true},
+		{Name: "aggregation_temporality", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "is_monotonic", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+	}, nil)
+	numbersSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint32},
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "time_unix_nano", Type: timestamp},
+		{Name: "int_value", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "double_value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	histogramsSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint32},
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint16},
+		{Name: "time_unix_nano", Type: timestamp},
+		{Name: "count", Type: arrow.PrimitiveTypes.Uint64},
+		{Name: "sum", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "bucket_counts", Type: arrow.ListOf(arrow.PrimitiveTypes.Uint64), Nullable: true},
+		{Name: "explicit_bounds", Type: arrow.ListOf(arrow.PrimitiveTypes.Float64), Nullable: true},
+	}, nil)
+	dpAttrsSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "parent_id", Type: arrow.PrimitiveTypes.Uint32},
+		{Name: "key", Type: dictString},
+		{Name: "type", Type: arrow.PrimitiveTypes.Uint8},
+		{Name: "str", Type: dictString, Nullable: true},
+	}, nil)
+
+	p := newProducer(t)
+	c := NewConsumer(testMaxMemory)
+	defer c.Release()
+
+	md, err := c.Metrics(p.batch(
+		table{PayloadUnivariateMetrics, schema, `[
+			{"id": 0, "resource": {"id": 0}, "scope": {"id": 0}, "metric_type": 2, "name": "requests",
+			 "unit": "1", "aggregation_temporality": 2, "is_monotonic": true},
+			{"id": 1, "resource": {"id": 0}, "scope": {"id": 0}, "metric_type": 3, "name": "latency",
+			 "unit": "ms", "aggregation_temporality": 1}
+		]`},
+		table{PayloadNumberDataPoints, numbersSchema, `[
+			{"id": 0, "parent_id": 0, "time_unix_nano": 1000, "int_value": 3},
+			{"id": 1, "parent_id": 0, "time_unix_nano": 1000, "double_value": 1.5},
+			{"id": 1, "parent_id": 7, "time_unix_nano": 1000, "int_value": 1}
+		]`},
+		table{PayloadNumberDPAttrs, dpAttrsSchema, `[
+			{"parent_id": 0, "key": "method", "type": 1, "str": "GET"},
+			{"parent_id": 1, "key": "method", "type": 1, "str": "GET"}
+		]`},
+		table{PayloadHistogramDataPoints, histogramsSchema, `[
+			{"id": 0, "parent_id": 1, "time_unix_nano": 1000, "count": 4, "sum": 10,
+			 "bucket_counts": [1, 3], "explicit_bounds": [5]}
+		]`},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	if metrics.Len() != 2 {
+		t.Fatalf("metric count = %d, want 2", metrics.Len())
+	}
+	sum := metrics.At(0)
+	if sum.Name() != "requests" || sum.Type() != pmetric.MetricTypeSum || !sum.Sum().IsMonotonic() ||
+		sum.Sum().AggregationTemporality() != pmetric.AggregationTemporalityCumulative {
+		t.Errorf("sum = %s %v", sum.Name(), sum.Type())
+	}
+	// The last data point belongs to no metric.
+	if dps := sum.Sum().DataPoints(); dps.Len() != 2 || dps.At(0).IntValue() != 3 || dps.At(1).DoubleValue() != 1.5 {
+		t.Fatalf("sum data points = %d", dps.Len())
+	}
+	for i := range 2 {
+		if got := sum.Sum().DataPoints().At(i).Attributes().AsRaw(); !reflect.DeepEqual(got, map[string]any{"method": "GET"}) {
+			t.Errorf("sum data point %d attributes = %v", i, got)
+		}
+	}
+
+	histogram := metrics.At(1)
+	if histogram.Type() != pmetric.MetricTypeHistogram {
+		t.Fatalf("histogram type = %v", histogram.Type())
+	}
+	dp := histogram.Histogram().DataPoints().At(0)
+	if dp.Count() != 4 || dp.Sum() != 10 || dp.HasMin() ||
+		!reflect.DeepEqual(dp.BucketCounts().AsRaw(), []uint64{1, 3}) ||
+		!reflect.DeepEqual(dp.ExplicitBounds().AsRaw(), []float64{5}) {
+		t.Errorf("histogram data point = %d %v %v %v", dp.Count(), dp.Sum(), dp.BucketCounts().AsRaw(), dp.ExplicitBounds().AsRaw())
+	}
+}
+
+func TestCompressedMemoryLimit(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Uint16, Nullable: true},
+		{Name: "body", Type: arrow.StructOf(
+			arrow.Field{Name: "type", Type: arrow.PrimitiveTypes.Uint8},
+			arrow.Field{Name: "str", Type: arrow.BinaryTypes.String, Nullable: true},
+		), Nullable: true},
+	}, nil)
+	// Compresses to a few hundred bytes, and declares its decoded size.
+	body := strings.Repeat("a", 4*testMaxMemory)
+	rows := `[{"id": 0, "body": {"type": 1, "str": "` + body + `"}}]`
+
+	p := newProducer(t)
+	p.opts = []ipc.Option{ipc.WithZstd()}
+	batch := p.batch(table{PayloadLogs, schema, rows})
+	if len(batch.Payloads[0].Record) > testMaxMemory/10 {
+		t.Fatalf("payload of %d bytes", len(batch.Payloads[0].Record))
+	}
+
+	c := NewConsumer(testMaxMemory)
+	defer c.Release()
+	if _, err := c.Logs(batch); !errors.Is(err, errMemoryLimit) {
+		t.Errorf("Logs() error = %v, want %v", err, errMemoryLimit)
+	}
+
+	c = NewConsumer(8 * testMaxMemory)
+	defer c.Release()
+	ld, err := c.Logs(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().Str(); got != body {
+		t.Errorf("body of %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestIDEncoding(t *testing.T) {
+	field := func(enc string) arrow.Field {
+		return arrow.Field{Metadata: arrow.NewMetadata([]string{encodingMetadataKey}, []string{enc})}
+	}
+	for _, tt := range []struct {
+		field arrow.Field
+		ok    bool
+		want  encoding
+	}{
+		{arrow.Field{}, false, encodingDelta},
+		{arrow.Field{}, true, encodingDelta},
+		{field("plain"), true, encodingPlain},
+		{field("quasidelta"), true, encodingQuasiDelta},
+		{field("unknown"), true, encodingDelta},
+	} {
+		if got := fieldEncoding(tt.field, tt.ok, encodingDelta); got != tt.want {
+			t.Errorf("fieldEncoding(%v) = %v, want %v", tt.field.Metadata, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	for _, tt := range []struct {
+		in   []byte
+		want any
+	}{
+		{[]byte{0x17}, int64(23)},
+		{[]byte{0x19, 0x01, 0x00}, int64(256)},
+		{[]byte{0x38, 0x63}, int64(-100)},
+		{[]byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, float64(math.MaxUint64)},
+		{[]byte{0xf9, 0x3e, 0x00}, 1.5},
+		{[]byte{0xfa, 0x47, 0xc3, 0x50, 0x00}, 100000.0},
+		{append([]byte{0xfb}, binary.BigEndian.AppendUint64(nil, math.Float64bits(-4.1))...), -4.1},
+		{[]byte{0x43, 1, 2, 3}, []byte{1, 2, 3}},
+		{[]byte{0xf4}, false},
+		{[]byte{0xf6}, nil},
+		{[]byte{0x82, 0x61, 'x', 0xa1, 0x61, 'y', 0x80}, []any{"x", map[string]any{"y": []any{}}}},
+		// Tagged date time string.
+		{[]byte{0xc0, 0x61, 't'}, "t"},
+	} {
+		v := pcommon.NewValueEmpty()
+		if err := decodeCBOR(v, tt.in); err != nil {
+			t.Errorf("decodeCBOR(%x) error = %v", tt.in, err)
+			continue
+		}
+		if got := v.AsRaw(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%x) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range [][]byte{
+		{},
+		{0x18},
+		{0x62, 'a'},
+		{0x82, 0x01},
+		{0x9f, 0x01, 0xff},
+		{0x01, 0x02},
+		bytes.Repeat([]byte{0x81}, maxCBORDepth+2),
+	} {
+		if err := decodeCBOR(pcommon.NewValueEmpty(), in); err != errInvalidCBOR {
+			t.Errorf("decodeCBOR(%x) error = %v, want %v", in, err, errInvalidCBOR)
+		}
+	}
+}
+
+func b64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func logsJSON(t *testing.T, ld plog.Logs) string {
+	b, err := (&plog.JSONMarshaler{}).MarshalLogs(ld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
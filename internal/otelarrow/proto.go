@@ -0,0 +1,131 @@
+// Package otelarrow decodes the OpenTelemetry Protocol with Apache Arrow
+// (OTAP), as sent by the OTel Arrow exporter, to OTLP logs, traces and
+// metrics.
+//
+// A batch carries one Arrow record per table of the signal: the main table
+// of log records, spans or metrics, and the tables of attributes, span
+// events and links, and data points that refer to its rows by ID. The
+// records of a table are an Arrow IPC stream that continues from one batch
+// to the next, so a Consumer decodes the batches of one gRPC stream, in
+// order.
+//
+// The messages and schemas are decoded by hand so that the otel-arrow module
+// and its dependencies are not needed.
+// Ref: https://github.com/open-telemetry/otel-arrow/blob/main/proto/opentelemetry/proto/experimental/arrow/v1/arrow_service.proto
+// Ref: https://github.com/open-telemetry/otel-arrow/blob/main/docs/data_model.md
+package otelarrow
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire"
+)
+
+// PayloadType is the table an Arrow payload holds records of.
+type PayloadType int32
+
+const (
+	PayloadUnknown                PayloadType = 0
+	PayloadResourceAttrs          PayloadType = 1
+	PayloadScopeAttrs             PayloadType = 2
+	PayloadUnivariateMetrics      PayloadType = 10
+	PayloadNumberDataPoints       PayloadType = 11
+	PayloadSummaryDataPoints      PayloadType = 12
+	PayloadHistogramDataPoints    PayloadType = 13
+	PayloadExpHistogramDataPoints PayloadType = 14
+	PayloadNumberDPAttrs          PayloadType = 15
+	PayloadSummaryDPAttrs         PayloadType = 16
+	PayloadHistogramDPAttrs       PayloadType = 17
+	PayloadExpHistogramDPAttrs    PayloadType = 18
+	PayloadLogs                   PayloadType = 30
+	PayloadLogAttrs               PayloadType = 31
+	PayloadSpans                  PayloadType = 40
+	PayloadSpanAttrs              PayloadType = 41
+	PayloadSpanEvents             PayloadType = 42
+	PayloadSpanLinks              PayloadType = 43
+	PayloadSpanEventAttrs         PayloadType = 44
+	PayloadSpanLinkAttrs          PayloadType = 45
+)
+
+// BatchArrowRecords is a batch of a stream, the Arrow payloads of one
+// request.
+type BatchArrowRecords struct {
+	BatchID  int64
+	Payloads []ArrowPayload
+	// Headers is the HPACK encoded metadata of the request. The HPACK
+	// dynamic table is shared by the batches of a stream.
+	Headers []byte
+}
+
+type ArrowPayload struct {
+	// SchemaID identifies the Arrow IPC stream the record continues.
+	SchemaID string
+	Type     PayloadType
+	// Record is the IPC messages of one record batch, preceded by the
+	// schema in the first payload of a stream, and by dictionary batches.
+	Record []byte
+}
+
+// DecodeBatchArrowRecords decodes a BatchArrowRecords message.
+func DecodeBatchArrowRecords(buf []byte) (BatchArrowRecords, error) {
+	var batch BatchArrowRecords
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			batch.BatchID = int64(f.Num)
+		case 2:
+			payload, err := decodeArrowPayload(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("arrow payload: %w", err)
+			}
+			batch.Payloads = append(batch.Payloads, payload)
+		case 3:
+			batch.Headers = f.Bytes
+		}
+		return nil
+	})
+	return batch, err
+}
+
+func decodeArrowPayload(buf []byte) (ArrowPayload, error) {
+	var payload ArrowPayload
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			payload.SchemaID = f.String()
+		case 2:
+			payload.Type = PayloadType(f.Num)
+		case 3:
+			payload.Record = f.Bytes
+		}
+		return nil
+	})
+	return payload, err
+}
+
+// BatchStatus acknowledges a batch. StatusCode is a gRPC status code, OK
+// or the error the batch failed with.
+type BatchStatus struct {
+	BatchID       int64
+	StatusCode    int32
+	StatusMessage string
+}
+
+// AppendProto appends the BatchStatus message to b.
+func (s BatchStatus) AppendProto(b []byte) []byte {
+	if s.BatchID != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s.BatchID))
+	}
+	if s.StatusCode != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s.StatusCode))
+	}
+	if s.StatusMessage != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, s.StatusMessage)
+	}
+	return b
+}
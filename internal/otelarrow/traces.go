@@ -0,0 +1,193 @@
+package otelarrow
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Traces converts a batch of the traces stream.
+func (c *Consumer) Traces(batch BatchArrowRecords) (ptrace.Traces, error) {
+	td := ptrace.NewTraces()
+	records, err := c.records(batch)
+	if err != nil {
+		return td, err
+	}
+	main, ok := records[PayloadSpans]
+	if !ok {
+		if len(records) == 0 {
+			return td, nil
+		}
+		return td, errNoMainRecord
+	}
+	attrs, err := decodeAttrTables(records,
+		PayloadResourceAttrs, PayloadScopeAttrs, PayloadSpanAttrs, PayloadSpanEventAttrs, PayloadSpanLinkAttrs)
+	if err != nil {
+		return td, err
+	}
+	events := decodeSpanEvents(records[PayloadSpanEvents], attrs[PayloadSpanEventAttrs])
+	links := decodeSpanLinks(records[PayloadSpanLinks], attrs[PayloadSpanLinkAttrs])
+
+	var (
+		ids           = recordIDs(main, "id")
+		start         = column(main, "start_time_unix_nano")
+		duration      = column(main, "duration_time_unix_nano")
+		traceIDs      = column(main, "trace_id")
+		spanIDs       = column(main, "span_id")
+		traceState    = column(main, "trace_state")
+		parentSpanIDs = column(main, "parent_span_id")
+		name          = column(main, "name")
+		kind          = column(main, "kind")
+		flags         = column(main, "flags")
+		dropped       = column(main, "dropped_attributes_count")
+		droppedEvents = column(main, "dropped_events_count")
+		droppedLinks  = column(main, "dropped_links_count")
+		status        = column(main, "status")
+		statusCode    = structField(status, "code")
+		statusMessage = structField(status, "status_message")
+	)
+
+	rs := newResourceScopes(main, attrs[PayloadResourceAttrs], attrs[PayloadScopeAttrs])
+	var (
+		resourceSpans ptrace.ResourceSpans
+		scopeSpans    ptrace.ScopeSpans
+	)
+	for i := range int(main.NumRows()) {
+		newResource, newScope := rs.next(i)
+		if newResource {
+			resourceSpans = td.ResourceSpans().AppendEmpty()
+			resourceSpans.SetSchemaUrl(rs.putResource(resourceSpans.Resource(), i))
+		}
+		if newScope {
+			scopeSpans = resourceSpans.ScopeSpans().AppendEmpty()
+			scopeSpans.SetSchemaUrl(rs.putScope(scopeSpans.Scope(), i))
+		}
+
+		span := scopeSpans.Spans().AppendEmpty()
+		startTime := intAt(start, i)
+		span.SetStartTimestamp(pcommon.Timestamp(startTime))
+		span.SetEndTimestamp(pcommon.Timestamp(startTime + intAt(duration, i)))
+		var traceID pcommon.TraceID
+		if putID(traceID[:], traceIDs, i) {
+			span.SetTraceID(traceID)
+		}
+		var spanID pcommon.SpanID
+		if putID(spanID[:], spanIDs, i) {
+			span.SetSpanID(spanID)
+		}
+		var parentSpanID pcommon.SpanID
+		if putID(parentSpanID[:], parentSpanIDs, i) {
+			span.SetParentSpanID(parentSpanID)
+		}
+		span.TraceState().FromRaw(strAt(traceState, i))
+		span.SetName(strAt(name, i))
+		span.SetKind(ptrace.SpanKind(intAt(kind, i)))
+		span.SetFlags(uint32(uintAt(flags, i)))
+		span.SetDroppedAttributesCount(uint32(uintAt(dropped, i)))
+		span.SetDroppedEventsCount(uint32(uintAt(droppedEvents, i)))
+		span.SetDroppedLinksCount(uint32(uintAt(droppedLinks, i)))
+		span.Status().SetCode(ptrace.StatusCode(intAt(statusCode, i)))
+		span.Status().SetMessage(strAt(statusMessage, i))
+
+		id, ok := ids.next(i)
+		if !ok {
+			continue
+		}
+		attrs[PayloadSpanAttrs].copyTo(span.Attributes(), id, true)
+		if e, found := events[id]; found {
+			e.MoveAndAppendTo(span.Events())
+		}
+		if l, found := links[id]; found {
+			l.MoveAndAppendTo(span.Links())
+		}
+	}
+	return td, nil
+}
+
+// decodeSpanEvents decodes the span events table, by span ID. Its parent IDs
+// are quasi-delta encoded by default, grouped by event name.
+func decodeSpanEvents(rec arrow.RecordBatch, attrs attrsByID) map[uint32]ptrace.SpanEventSlice {
+	if rec == nil {
+		return nil
+	}
+
+	var (
+		ids       = recordIDs(rec, "id")
+		timestamp = column(rec, "time_unix_nano")
+		name      = column(rec, "name")
+		dropped   = column(rec, "dropped_attributes_count")
+		parents   = parentIDs(rec, encodingQuasiDelta, func(i, j int) bool {
+			return strAt(name, i) == strAt(name, j)
+		})
+	)
+
+	events := map[uint32]ptrace.SpanEventSlice{}
+	for i := range int(rec.NumRows()) {
+		id, hasID := ids.next(i)
+		parent, ok := parents.next(i)
+		if !ok {
+			continue
+		}
+		s, found := events[parent]
+		if !found {
+			s = ptrace.NewSpanEventSlice()
+			events[parent] = s
+		}
+
+		event := s.AppendEmpty()
+		event.SetTimestamp(pcommon.Timestamp(intAt(timestamp, i)))
+		event.SetName(strAt(name, i))
+		event.SetDroppedAttributesCount(uint32(uintAt(dropped, i)))
+		attrs.copyTo(event.Attributes(), id, hasID)
+	}
+	return events
+}
+
+// decodeSpanLinks decodes the span links table, by span ID. Its parent IDs
+// are quasi-delta encoded by default, grouped by linked trace ID.
+func decodeSpanLinks(rec arrow.RecordBatch, attrs attrsByID) map[uint32]ptrace.SpanLinkSlice {
+	if rec == nil {
+		return nil
+	}
+
+	var (
+		ids        = recordIDs(rec, "id")
+		traceIDs   = column(rec, "trace_id")
+		spanIDs    = column(rec, "span_id")
+		traceState = column(rec, "trace_state")
+		dropped    = column(rec, "dropped_attributes_count")
+		flags      = column(rec, "flags")
+		parents    = parentIDs(rec, encodingQuasiDelta, func(i, j int) bool {
+			return string(bytesAt(traceIDs, i)) == string(bytesAt(traceIDs, j))
+		})
+	)
+
+	links := map[uint32]ptrace.SpanLinkSlice{}
+	for i := range int(rec.NumRows()) {
+		id, hasID := ids.next(i)
+		parent, ok := parents.next(i)
+		if !ok {
+			continue
+		}
+		s, found := links[parent]
+		if !found {
+			s = ptrace.NewSpanLinkSlice()
+			links[parent] = s
+		}
+
+		link := s.AppendEmpty()
+		var traceID pcommon.TraceID
+		if putID(traceID[:], traceIDs, i) {
+			link.SetTraceID(traceID)
+		}
+		var spanID pcommon.SpanID
+		if putID(spanID[:], spanIDs, i) {
+			link.SetSpanID(spanID)
+		}
+		link.TraceState().FromRaw(strAt(traceState, i))
+		link.SetDroppedAttributesCount(uint32(uintAt(dropped, i)))
+		link.SetFlags(uint32(uintAt(flags, i)))
+		attrs.copyTo(link.Attributes(), id, hasID)
+	}
+	return links
+}
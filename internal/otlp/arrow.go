@@ -0,0 +1,217 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/otelarrow"
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/ratelimit"
+)
+
+type batchArrowRecords struct {
+	batch otelarrow.BatchArrowRecords
+}
+
+func (r *batchArrowRecords) unmarshalProto(buf []byte) error {
+	var err error
+	r.batch, err = otelarrow.DecodeBatchArrowRecords(buf)
+	return err
+}
+
+type batchStatus struct {
+	status otelarrow.BatchStatus
+}
+
+func (s *batchStatus) marshalProto() []byte {
+	return s.status.AppendProto(nil)
+}
+
+// ArrowService is the OTel Arrow traces, logs and metrics services, which
+// the OTel Arrow exporter streams batches of Arrow records to. The records
+// are converted to pdata and queued like OTLP requests, so that they are
+// batched, attributed to a tenant and counted the same way. The headers the
+// exporter adds to a batch are not read, the metadata of the stream applies
+// to all its batches.
+// Ref: https://github.com/open-telemetry/otel-arrow/blob/main/proto/opentelemetry/proto/experimental/arrow/v1/arrow_service.proto
+type ArrowService struct {
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+	// Bytes of decoded records a stream may hold at once.
+	maxMemory int
+}
+
+// NewArrowService returns the Arrow services of pipeline. The records of a
+// stream are decoded in at most maxMemory bytes, so that compressed records
+// are no larger once decoded than the messages accepted.
+func NewArrowService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter, maxMemory int) *ArrowService {
+	return &ArrowService{
+		pipeline:  pl,
+		limiter:   limiter,
+		maxMemory: maxMemory,
+	}
+}
+
+// consumeFunc converts a batch and queues it. A conversion error ends the
+// stream.
+type consumeFunc func(ctx context.Context, c *otelarrow.Consumer, batch otelarrow.BatchArrowRecords) (queue func() error, err error)
+
+// serve answers each batch of stream with its status. The Arrow streams have
+// no partial success, records that cannot be stored are only counted in the
+// pipeline stats.
+func (r *ArrowService) serve(stream grpc.ServerStream, consume consumeFunc) error {
+	// The schemas and dictionaries of the records are only sent once per
+	// stream.
+	c := otelarrow.NewConsumer(r.maxMemory)
+	defer c.Release()
+
+	ctx := stream.Context()
+	for {
+		req := new(batchArrowRecords)
+		if err := stream.RecvMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		queue, err := consume(ctx, c, req.batch)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		resp := &batchStatus{status: otelarrow.BatchStatus{BatchID: req.batch.BatchID}}
+		if err := queue(); err != nil {
+			s := status.Convert(GetStatusFromError(err))
+			resp.status.StatusCode = int32(s.Code())
+			resp.status.StatusMessage = s.Message()
+		}
+		if err := stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *ArrowService) ArrowTraces(stream grpc.ServerStream) error {
+	return r.serve(stream, func(ctx context.Context, c *otelarrow.Consumer, batch otelarrow.BatchArrowRecords) (func() error, error) {
+		td, err := c.Traces(batch)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			if td.SpanCount() == 0 {
+				return nil
+			}
+			if err := r.limiter.AllowTraces(ctx, td); err != nil {
+				return err
+			}
+			_, err := r.pipeline.ConsumeTraces(ctx, td)
+			return err
+		}, nil
+	})
+}
+
+func (r *ArrowService) ArrowLogs(stream grpc.ServerStream) error {
+	return r.serve(stream, func(ctx context.Context, c *otelarrow.Consumer, batch otelarrow.BatchArrowRecords) (func() error, error) {
+		ld, err := c.Logs(batch)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			if ld.LogRecordCount() == 0 {
+				return nil
+			}
+			if err := r.limiter.AllowLogs(ctx, ld); err != nil {
+				return err
+			}
+			_, err := r.pipeline.ConsumeLogs(ctx, ld)
+			return err
+		}, nil
+	})
+}
+
+func (r *ArrowService) ArrowMetrics(stream grpc.ServerStream) error {
+	return r.serve(stream, func(ctx context.Context, c *otelarrow.Consumer, batch otelarrow.BatchArrowRecords) (func() error, error) {
+		md, err := c.Metrics(batch)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			if md.DataPointCount() == 0 {
+				return nil
+			}
+			if err := r.limiter.AllowMetrics(ctx, md); err != nil {
+				return err
+			}
+			_, err := r.pipeline.ConsumeMetrics(ctx, md)
+			return err
+		}, nil
+	})
+}
+
+type (
+	arrowTracesServer interface {
+		ArrowTraces(grpc.ServerStream) error
+	}
+	arrowLogsServer interface {
+		ArrowLogs(grpc.ServerStream) error
+	}
+	arrowMetricsServer interface {
+		ArrowMetrics(grpc.ServerStream) error
+	}
+)
+
+const arrowServiceMetadata = "opentelemetry/proto/experimental/arrow/v1/arrow_service.proto"
+
+var arrowTracesServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.experimental.arrow.v1.ArrowTracesService",
+	HandlerType: (*arrowTracesServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ArrowTraces",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(arrowTracesServer).ArrowTraces(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: arrowServiceMetadata,
+}
+
+var arrowLogsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.experimental.arrow.v1.ArrowLogsService",
+	HandlerType: (*arrowLogsServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ArrowLogs",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(arrowLogsServer).ArrowLogs(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: arrowServiceMetadata,
+}
+
+var arrowMetricsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.experimental.arrow.v1.ArrowMetricsService",
+	HandlerType: (*arrowMetricsServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ArrowMetrics",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(arrowMetricsServer).ArrowMetrics(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: arrowServiceMetadata,
+}
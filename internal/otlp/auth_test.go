@@ -0,0 +1,98 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+)
+
+// rawMessage is sent and received as is by the wire codec.
+type rawMessage []byte
+
+func (m *rawMessage) marshalProto() []byte {
+	return *m
+}
+
+func (m *rawMessage) unmarshalProto(buf []byte) error {
+	*m = buf
+	return nil
+}
+
+func newTestAuthenticator(t *testing.T) auth.Authenticator {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("team-a:token-a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := auth.New(auth.Config{TokenFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	// Requests without records, and streams without batches, are answered
+	// before they reach the pipeline.
+	conn := startTestServer(t, nil, ServerConfig{Auth: newTestAuthenticator(t)})
+	codec := grpc.ForceCodecV2(newWireCodec())
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		want          codes.Code
+	}{
+		{"missing", "", codes.Unauthenticated},
+		{"wrong token", "Bearer token-b", codes.Unauthenticated},
+		{"wrong scheme", "Basic token-a", codes.Unauthenticated},
+		{"valid", "Bearer token-a", codes.OK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+			}
+
+			_, err := plogotlp.NewGRPCClient(conn).Export(ctx, plogotlp.NewExportRequest())
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("OTLP export: %v, want %v", err, tt.want)
+			}
+
+			var resp rawMessage
+			err = conn.Invoke(ctx, "/jaeger.api_v2.CollectorService/PostSpans", &rawMessage{}, &resp, codec)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Jaeger PostSpans: %v, want %v", err, tt.want)
+			}
+
+			// The credentials of a stream are checked when it starts, the
+			// Arrow streams end without error once the client closes them.
+			stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true},
+				"/opentelemetry.proto.experimental.arrow.v1.ArrowLogsService/ArrowLogs", codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := stream.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			err = stream.RecvMsg(&resp)
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Arrow stream: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
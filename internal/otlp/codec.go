@@ -0,0 +1,50 @@
+package otlp
+
+import (
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/mem"
+)
+
+// The services receive requests and send responses, only one direction is
+// implemented for each message.
+type (
+	protoUnmarshaler interface {
+		unmarshalProto(buf []byte) error
+	}
+	protoMarshaler interface {
+		marshalProto() []byte
+	}
+)
+
+// wireCodec is the codec of the gRPC server. The messages of the Jaeger
+// collector and OTel Arrow services have no generated code, it decodes them
+// by hand and leaves other messages to the proto codec. It is only set on
+// the server, the proto codec registered for other gRPC clients and servers
+// of the process is left as is.
+type wireCodec struct {
+	delegate encoding.CodecV2
+}
+
+// newWireCodec wraps the registered proto codec, the one of pdata, as
+// importing pdata registers it.
+func newWireCodec() wireCodec {
+	return wireCodec{delegate: encoding.GetCodecV2("proto")}
+}
+
+func (c wireCodec) Marshal(v any) (mem.BufferSlice, error) {
+	if m, ok := v.(protoMarshaler); ok {
+		return mem.BufferSlice{mem.SliceBuffer(m.marshalProto())}, nil
+	}
+	return c.delegate.Marshal(v)
+}
+
+func (c wireCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	if m, ok := v.(protoUnmarshaler); ok {
+		return m.unmarshalProto(data.Materialize())
+	}
+	return c.delegate.Unmarshal(data, v)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+
+	// Registers the gzip compressor with gRPC.
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// Compressors registered in addition to gzip, matching the ones supported by
+// the OpenTelemetry Collector's OTLP exporter.
+//
+// gRPC reads at most ServerConfig.MaxRecvMsgSize bytes from a decompressor
+// and fails the call with ResourceExhausted beyond that, which caps the
+// decompressed size.
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+	encoding.RegisterCompressor(snappyCompressor{})
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{dec: dec}, nil
+}
+
+// zstdReader releases the decoder once the message has been read, gRPC does
+// not close the reader returned by Decompress.
+type zstdReader struct {
+	dec *zstd.Decoder
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+
+	n, err := r.dec.Read(p)
+	if err != nil {
+		r.dec.Close()
+		r.dec = nil
+		if errors.Is(err, zstd.ErrDecoderClosed) {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
@@ -0,0 +1,94 @@
+package otlp
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/jaeger"
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/ratelimit"
+)
+
+type postSpansRequest struct {
+	batch jaeger.Batch
+}
+
+func (r *postSpansRequest) unmarshalProto(buf []byte) error {
+	var err error
+	r.batch, err = jaeger.DecodePostSpansRequest(buf)
+	return err
+}
+
+// postSpansResponse is empty.
+type postSpansResponse struct{}
+
+func (*postSpansResponse) marshalProto() []byte {
+	return nil
+}
+
+// JaegerCollectorService is jaeger.api_v2.CollectorService, which Jaeger
+// clients and agents post spans to.
+// Ref: https://github.com/jaegertracing/jaeger-idl/blob/main/proto/api_v2/collector.proto
+type JaegerCollectorService struct {
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+}
+
+func NewJaegerCollectorService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter) *JaegerCollectorService {
+	return &JaegerCollectorService{
+		pipeline: pl,
+		limiter:  limiter,
+	}
+}
+
+// PostSpans queues the spans of req. Jaeger has no partial success, spans
+// that cannot be stored are only counted in the pipeline stats.
+func (r *JaegerCollectorService) PostSpans(ctx context.Context, req *postSpansRequest) (*postSpansResponse, error) {
+	td := jaeger.ToTraces(req.batch)
+	if td.SpanCount() == 0 {
+		return &postSpansResponse{}, nil
+	}
+
+	if err := r.limiter.AllowTraces(ctx, td); err != nil {
+		return nil, err
+	}
+	if _, err := r.pipeline.ConsumeTraces(ctx, td); err != nil {
+		return nil, GetStatusFromError(err)
+	}
+	return &postSpansResponse{}, nil
+}
+
+type jaegerCollectorServer interface {
+	PostSpans(context.Context, *postSpansRequest) (*postSpansResponse, error)
+}
+
+var jaegerCollectorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jaeger.api_v2.CollectorService",
+	HandlerType: (*jaegerCollectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PostSpans",
+			Handler:    postSpansHandler,
+		},
+	},
+	Metadata: "api_v2/collector.proto",
+}
+
+func postSpansHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	req := new(postSpansRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/jaeger.api_v2.CollectorService/PostSpans",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, req.(*postSpansRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
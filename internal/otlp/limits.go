@@ -0,0 +1,49 @@
+package otlp
+
+import (
+	"context"
+	"expvar"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// Default upper bound for a received message, compressed or not. It is the
+// default of gRPC.
+const DefaultMaxRecvMsgSize = 4 << 20 // 4 MiB
+
+// Calls rejected for a message over MaxRecvMsgSize, by method.
+var tooLargeStats = expvar.NewMap("grpc_messages_too_large")
+
+// tooLargeHandler counts the calls gRPC rejects for a message over
+// MaxRecvMsgSize. The message is rejected before it reaches the handler and
+// interceptors, only its status tells why the call ended.
+type tooLargeHandler struct{}
+
+type methodKey struct{}
+
+func (tooLargeHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodKey{}, info.FullMethodName)
+}
+
+func (tooLargeHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	end, ok := s.(*stats.End)
+	if !ok || end.Error == nil {
+		return
+	}
+	st := status.Convert(end.Error)
+	// As in "grpc: received message larger than max (N vs. M)" and its
+	// variant after decompression.
+	if st.Code() == codes.ResourceExhausted && strings.Contains(st.Message(), "larger than max") {
+		method, _ := ctx.Value(methodKey{}).(string)
+		tooLargeStats.Add(method, 1)
+	}
+}
+
+func (tooLargeHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (tooLargeHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -2,19 +2,28 @@ package otlp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
-	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/ratelimit"
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 //
@@ -23,6 +32,13 @@ import (
 
 // yoinked from "go.opentelemetry.io/collector/receiver/otlpreceiver/internal/errors"
 func GetStatusFromError(err error) error {
+	switch {
+	case errors.Is(err, tenant.ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, tenant.ErrMismatch):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
 	s, ok := status.FromError(err)
 	if !ok {
 		// Default to a retryable error
@@ -43,24 +59,45 @@ func GetStatusFromError(err error) error {
 
 type LogsGRPCService struct {
 	plogotlp.UnimplementedGRPCServer
-	ctx     context.Context
-	storage *storage.Storage
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+}
+
+func NewLogsGRPCService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter) *LogsGRPCService {
+	return &LogsGRPCService{
+		pipeline: pl,
+		limiter:  limiter,
+	}
 }
 
+// Export queues the log records of req. Records that cannot be stored are
+// dropped and reported in the response's partial success.
 func (r *LogsGRPCService) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	resp := plogotlp.NewExportResponse()
+
 	ld := req.Logs()
-	numSpans := ld.LogRecordCount()
-	if numSpans == 0 {
-		return plogotlp.NewExportResponse(), nil
+	numLogs := ld.LogRecordCount()
+	if numLogs == 0 {
+		return resp, nil
+	}
+
+	// Records are charged before the pipeline validates them, so that
+	// invalid records are throttled too: rejected ones count against the
+	// client's limits.
+	if err := r.limiter.AllowLogs(ctx, ld); err != nil {
+		return resp, err
 	}
 
-	err := storage.InsertLogsData(r.ctx, r.storage.DB, r.storage.InsertLogsSQL, ld)
+	rejected, err := r.pipeline.ConsumeLogs(ctx, ld)
 	if err != nil {
-		log.Fatalf("Failed to write logs to db: %v", err)
-		return plogotlp.NewExportResponse(), GetStatusFromError(err)
+		return resp, GetStatusFromError(err)
 	}
 
-	return plogotlp.NewExportResponse(), nil
+	if rejected.Count > 0 {
+		resp.PartialSuccess().SetRejectedLogRecords(rejected.Count)
+		resp.PartialSuccess().SetErrorMessage(rejected.Message)
+	}
+	return resp, nil
 }
 
 //
@@ -69,24 +106,42 @@ func (r *LogsGRPCService) Export(ctx context.Context, req plogotlp.ExportRequest
 
 type TracesGRPCService struct {
 	ptraceotlp.UnimplementedGRPCServer
-	ctx     context.Context
-	storage *storage.Storage
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+}
+
+func NewTracesGRPCService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter) *TracesGRPCService {
+	return &TracesGRPCService{
+		pipeline: pl,
+		limiter:  limiter,
+	}
 }
 
+// Export queues the spans of req. Spans that cannot be stored are dropped
+// and reported in the response's partial success.
 func (r *TracesGRPCService) Export(ctx context.Context, req ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	resp := ptraceotlp.NewExportResponse()
+
 	td := req.Traces()
 	numSpans := td.SpanCount()
 	if numSpans == 0 {
-		return ptraceotlp.NewExportResponse(), nil
+		return resp, nil
+	}
+
+	if err := r.limiter.AllowTraces(ctx, td); err != nil {
+		return resp, err
 	}
 
-	err := storage.InsertTracesData(r.ctx, r.storage.DB, r.storage.InsertTracesSQL, td)
+	rejected, err := r.pipeline.ConsumeTraces(ctx, td)
 	if err != nil {
-		log.Fatalf("Failed to write traces to db: %v", err)
-		return ptraceotlp.NewExportResponse(), GetStatusFromError(err)
+		return resp, GetStatusFromError(err)
 	}
 
-	return ptraceotlp.NewExportResponse(), nil
+	if rejected.Count > 0 {
+		resp.PartialSuccess().SetRejectedSpans(rejected.Count)
+		resp.PartialSuccess().SetErrorMessage(rejected.Message)
+	}
+	return resp, nil
 }
 
 //
@@ -95,57 +150,186 @@ func (r *TracesGRPCService) Export(ctx context.Context, req ptraceotlp.ExportReq
 
 type MetricsGRPCService struct {
 	pmetricotlp.UnimplementedGRPCServer
-	ctx     context.Context
-	storage *storage.Storage
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+}
+
+func NewMetricsGRPCService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter) *MetricsGRPCService {
+	return &MetricsGRPCService{
+		pipeline: pl,
+		limiter:  limiter,
+	}
 }
 
+// Export queues the data points of req. Metrics and data points that cannot
+// be stored are dropped and reported in the response's partial success.
 func (r *MetricsGRPCService) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	resp := pmetricotlp.NewExportResponse()
+
 	md := req.Metrics()
-	dataPointCount := md.DataPointCount()
-	if dataPointCount == 0 {
-		return pmetricotlp.NewExportResponse(), nil
+	// Metrics without a type have no data points but are still rejected.
+	if md.MetricCount() == 0 {
+		return resp, nil
+	}
+
+	if err := r.limiter.AllowMetrics(ctx, md); err != nil {
+		return resp, err
 	}
 
-	err := storage.IngestMetricsData(r.ctx, r.storage, md)
+	rejected, err := r.pipeline.ConsumeMetrics(ctx, md)
 	if err != nil {
-		log.Fatalf("Failed to write metrics to db: %v", err)
-		return pmetricotlp.NewExportResponse(), GetStatusFromError(err)
+		return resp, GetStatusFromError(err)
 	}
 
-	return pmetricotlp.NewExportResponse(), nil
+	if rejected.Count > 0 {
+		resp.PartialSuccess().SetRejectedDataPoints(rejected.Count)
+		resp.PartialSuccess().SetErrorMessage(rejected.Message)
+	}
+	return resp, nil
 }
 
 //
-// Main
+// Profiles
 //
 
-func StartGRPCServer(ctx context.Context, storage *storage.Storage, addr string) error {
-	logsService := &LogsGRPCService{
-		ctx:     ctx,
-		storage: storage,
+type ProfilesGRPCService struct {
+	pprofileotlp.UnimplementedGRPCServer
+	pipeline *pipeline.Pipeline
+	limiter  *ratelimit.Limiter
+}
+
+func NewProfilesGRPCService(pl *pipeline.Pipeline, limiter *ratelimit.Limiter) *ProfilesGRPCService {
+	return &ProfilesGRPCService{
+		pipeline: pl,
+		limiter:  limiter,
 	}
-	tracesService := &TracesGRPCService{
-		ctx:     ctx,
-		storage: storage,
+}
+
+// Export queues the samples of req. Profiles that cannot be stored are
+// dropped and reported in the response's partial success.
+func (r *ProfilesGRPCService) Export(ctx context.Context, req pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
+	resp := pprofileotlp.NewExportResponse()
+
+	pd := req.Profiles()
+	if pd.ProfileCount() == 0 {
+		return resp, nil
 	}
-	metricsService := &MetricsGRPCService{
-		ctx:     ctx,
-		storage: storage,
+
+	if err := r.limiter.AllowProfiles(ctx, pd); err != nil {
+		return resp, err
 	}
 
-	lis, err := net.Listen("tcp", addr)
+	rejected, err := r.pipeline.ConsumeProfiles(ctx, pd)
+	if err != nil {
+		return resp, GetStatusFromError(err)
+	}
+
+	if rejected.Count > 0 {
+		resp.PartialSuccess().SetRejectedProfiles(rejected.Count)
+		resp.PartialSuccess().SetErrorMessage(rejected.Message)
+	}
+	return resp, nil
+}
+
+//
+// Main
+//
+
+// Time calls in flight have to finish once the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
+type ServerConfig struct {
+	Addr string
+	// TLS, if set, is used to serve gRPC over TLS.
+	TLS *tls.Config
+	// Auth, if set, is required to accept the credentials of every request.
+	Auth auth.Authenticator
+	// RateLimiter, if set, throttles the records of every request.
+	RateLimiter *ratelimit.Limiter
+	// Calls with a larger message, as sent or once decompressed, fail with
+	// ResourceExhausted.
+	MaxRecvMsgSize int
+}
+
+func StartGRPCServer(ctx context.Context, pl *pipeline.Pipeline, cfg ServerConfig) error {
+	server, err := newGRPCServer(pl, cfg)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", cfg.Addr)
 	if err != nil {
 		return err
 	}
 
-	server := grpc.NewServer()
+	// Calls in flight are finished on shutdown, so that their records are
+	// queued before the pipeline is drained. Streams, such as those of
+	// Arrow clients, stay open until clients close them: they are cut after
+	// shutdownTimeout.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		timer := time.AfterFunc(shutdownTimeout, server.Stop)
+		defer timer.Stop()
+		server.GracefulStop()
+	}()
+
+	log.Printf("GRPC server listening on %s (tls=%t, auth=%t)", lis.Addr(), cfg.TLS != nil, cfg.Auth != nil)
+	if err := server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// newGRPCServer returns the server of every service, with the options and
+// interceptors of cfg.
+func newGRPCServer(pl *pipeline.Pipeline, cfg ServerConfig) (*grpc.Server, error) {
+	if cfg.MaxRecvMsgSize < 1 {
+		return nil, fmt.Errorf("invalid gRPC server config: %+v", cfg)
+	}
+
+	logsService := NewLogsGRPCService(pl, cfg.RateLimiter)
+	tracesService := NewTracesGRPCService(pl, cfg.RateLimiter)
+	metricsService := NewMetricsGRPCService(pl, cfg.RateLimiter)
+	profilesService := NewProfilesGRPCService(pl, cfg.RateLimiter)
+	jaegerService := NewJaegerCollectorService(pl, cfg.RateLimiter)
+	arrowService := NewArrowService(pl, cfg.RateLimiter, cfg.MaxRecvMsgSize)
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize),
+		grpc.StatsHandler(tooLargeHandler{}),
+		grpc.ForceServerCodecV2(newWireCodec()),
+	}
+	if cfg.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cfg.TLS)))
+	}
+
+	var (
+		interceptors       []grpc.UnaryServerInterceptor
+		streamInterceptors []grpc.StreamServerInterceptor
+	)
+	if cfg.Auth != nil {
+		interceptors = append(interceptors, authInterceptor(cfg.Auth))
+		streamInterceptors = append(streamInterceptors, authStreamInterceptor(cfg.Auth))
+	}
+	interceptors = append(interceptors, tenantInterceptor)
+	streamInterceptors = append(streamInterceptors, tenantStreamInterceptor)
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+
+	server := grpc.NewServer(opts...)
 	plogotlp.RegisterGRPCServer(server, logsService)
 	ptraceotlp.RegisterGRPCServer(server, tracesService)
 	pmetricotlp.RegisterGRPCServer(server, metricsService)
+	pprofileotlp.RegisterGRPCServer(server, profilesService)
+	server.RegisterService(&jaegerCollectorServiceDesc, jaegerService)
+	server.RegisterService(&arrowTracesServiceDesc, arrowService)
+	server.RegisterService(&arrowLogsServiceDesc, arrowService)
+	server.RegisterService(&arrowMetricsServiceDesc, arrowService)
 	reflection.Register(server)
-
-	log.Printf("GRPC server listening on %s", lis.Addr())
-	err = server.Serve(lis)
-
-	return err
+	return server, nil
 }
@@ -0,0 +1,107 @@
+package otlp
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+)
+
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	s, err := storage.NewStorage(context.Background(), storage.StorageConfig{
+		StorageType:                      storage.DuckDB,
+		DataDir:                          t.TempDir(),
+		LogsTable:                        storage.DefaultLogsTableName,
+		TracesTable:                      storage.DefaultTracesTableName,
+		MetricsSumTable:                  storage.DefaultMetricsSumTableName,
+		MetricsGaugeTable:                storage.DefaultMetricsGaugeTableName,
+		MetricsHistogramTable:            storage.DefaultMetricsHistogramTableName,
+		MetricsExponentialHistogramTable: storage.DefaultMetricsExponentialHistogramTableName,
+		MetricsSummaryTable:              storage.DefaultMetricsSummaryTableName,
+		ProfilesSamplesTable:             storage.DefaultProfilesSamplesTableName,
+		ProfilesStacksTable:              storage.DefaultProfilesStacksTableName,
+		ProfilesLocationsTable:           storage.DefaultProfilesLocationsTableName,
+		ProfilesFunctionsTable:           storage.DefaultProfilesFunctionsTableName,
+		ProfilesMappingsTable:            storage.DefaultProfilesMappingsTableName,
+	})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// startTestServer serves cfg on a local port, and returns a client
+// connection to it.
+func startTestServer(t *testing.T, p *pipeline.Pipeline, cfg ServerConfig) *grpc.ClientConn {
+	t.Helper()
+
+	if cfg.MaxRecvMsgSize == 0 {
+		cfg.MaxRecvMsgSize = DefaultMaxRecvMsgSize
+	}
+	server, err := newGRPCServer(p, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestExportCompressed(t *testing.T) {
+	s := newTestStorage(t)
+	p, err := pipeline.New(s, pipeline.Config{QueueSize: 10, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+	conn := startTestServer(t, p, ServerConfig{})
+
+	// The compressors of the collector's OTLP exporter.
+	compressors := []string{"gzip", "snappy", "zstd"}
+	client := plogotlp.NewGRPCClient(conn)
+	for _, name := range compressors {
+		ld := plog.NewLogs()
+		ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr(name)
+		if _, err := client.Export(context.Background(), plogotlp.NewExportRequestFromLogs(ld), grpc.UseCompressor(name)); err != nil {
+			t.Fatalf("Export with %s: %v", name, err)
+		}
+	}
+	p.Shutdown()
+
+	logs, err := storage.QueryLogs(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for _, l := range logs {
+		bodies = append(bodies, l.Body)
+	}
+	slices.Sort(bodies)
+	if !slices.Equal(bodies, compressors) {
+		t.Errorf("stored bodies = %v, want %v", bodies, compressors)
+	}
+}
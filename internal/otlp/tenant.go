@@ -0,0 +1,47 @@
+package otlp
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// tenantInterceptor adds the tenant of a request to its context. It runs
+// after authInterceptor, the authenticated principal takes precedence over
+// the tenant metadata.
+func tenantInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// tenantStreamInterceptor is tenantInterceptor for streams, every message of
+// a stream belongs to the tenant it started with.
+func tenantStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := resolveTenant(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func resolveTenant(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(tenant.Header)); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	tenantID, err := tenant.Resolve(ctx, header)
+	if err != nil {
+		return nil, GetStatusFromError(err)
+	}
+	return tenant.NewContext(ctx, tenantID), nil
+}
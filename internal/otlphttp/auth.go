@@ -0,0 +1,38 @@
+package otlphttp
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+)
+
+// authenticate wraps next so that it only runs for requests with valid
+// credentials in their Authorization header. The principal is added to the
+// request context.
+func (s HTTPService) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	if s.auth == nil {
+		return next
+	}
+
+	return func(resp http.ResponseWriter, req *http.Request) {
+		principal, err := s.auth.Authenticate(req.Header.Get("Authorization"))
+		if err != nil {
+			writeError(resp, requestEncoder(req), status.Error(codes.Unauthenticated, err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		next(resp, req.WithContext(auth.NewContext(req.Context(), principal)))
+	}
+}
+
+// requestEncoder returns the encoder matching the Content-Type of req, for
+// errors written before the body is read. It defaults to JSON.
+func requestEncoder(req *http.Request) encoder {
+	if getMimeTypeFromContentType(req.Header.Get("Content-Type")) == pbContentType {
+		return pbEncoder
+	}
+	return jsEncoder
+}
@@ -0,0 +1,61 @@
+package otlphttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("team-a:token-a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := auth.New(auth.Config{TokenFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var principal string
+	handler := HTTPService{auth: a}.authenticate(func(resp http.ResponseWriter, req *http.Request) {
+		principal, _ = auth.FromContext(req.Context())
+		resp.WriteHeader(http.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer token-b", http.StatusUnauthorized},
+		{"wrong scheme", "Basic token-a", http.StatusUnauthorized},
+		{"valid", "Bearer token-a", http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = ""
+			req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader("{}"))
+			req.Header.Set("Content-Type", jsonContentType)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && principal != "team-a" {
+				t.Errorf("principal = %q, want team-a", principal)
+			}
+			if tt.want == http.StatusUnauthorized && !strings.Contains(rec.Body.String(), `"code":16`) {
+				t.Errorf("body = %s, want an Unauthenticated status", rec.Body)
+			}
+		})
+	}
+}
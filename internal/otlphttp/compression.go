@@ -0,0 +1,143 @@
+package otlphttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Upper bound for a request body as sent, before decompression.
+	DefaultMaxRequestBodySize = 20 << 20 // 20 MiB
+	// Upper bound for a request body after decompression. A few kilobytes
+	// of gzip can expand to gigabytes, so the decoded body is capped as well
+	// as the size on the wire.
+	DefaultMaxDecompressedBodySize = 64 << 20 // 64 MiB
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// Requests rejected for a body over a limit, by route pattern.
+var tooLargeStats = expvar.NewMap("http_requests_too_large")
+
+type errUnsupportedEncoding string
+
+func (e errUnsupportedEncoding) Error() string {
+	return fmt.Sprintf("unsupported Content-Encoding %q, supported: [gzip, zstd, deflate]", string(e))
+}
+
+// decompressBody wraps body in a decoder for the given Content-Encoding.
+// maxSize bounds the memory of decoders that allocate up front.
+func decompressBody(body io.Reader, contentEncoding string, maxSize int64) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "zstd":
+		dec, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case "deflate", "zlib":
+		// "deflate" is the zlib format (RFC 1950) in HTTP.
+		return zlib.NewReader(body)
+	default:
+		return nil, errUnsupportedEncoding(contentEncoding)
+	}
+}
+
+// readLimited reads r up to limit bytes and fails with errBodyTooLarge if
+// there is more.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", errBodyTooLarge, limit)
+	}
+	return body, nil
+}
+
+func isBodyTooLarge(err error) bool {
+	return errors.Is(err, errBodyTooLarge)
+}
+
+// readBody reads and closes the request body, decoding it according to its
+// Content-Encoding. On error, it also returns the HTTP status code to
+// respond with.
+//
+// The body is read whole before it is decoded, so that the limit on the size
+// on the wire does not depend on how decoders report the errors of their
+// source.
+func (s HTTPService) readBody(req *http.Request) ([]byte, int, error) {
+	defer req.Body.Close()
+
+	raw, err := readLimited(req.Body, s.maxRequestBodySize)
+	if isBodyTooLarge(err) {
+		tooLargeStats.Add(req.Pattern, 1)
+		return nil, http.StatusRequestEntityTooLarge, err
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	reader, err := decompressBody(bytes.NewReader(raw), req.Header.Get("Content-Encoding"), s.maxDecompressedBodySize)
+	if err != nil {
+		var unsupported errUnsupportedEncoding
+		if errors.As(err, &unsupported) {
+			return nil, http.StatusUnsupportedMediaType, err
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	defer reader.Close()
+
+	body, err := readLimited(reader, s.maxDecompressedBodySize)
+	if isBodyTooLarge(err) {
+		tooLargeStats.Add(req.Pattern, 1)
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("decompressed %w", err)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return body, http.StatusOK, nil
+}
+
+// readSnappyBody reads a snappy block compressed request body. Unlike the
+// streaming encodings, the decoded size is known before decoding.
+func (s HTTPService) readSnappyBody(req *http.Request) ([]byte, error) {
+	defer req.Body.Close()
+
+	compressed, err := readLimited(req.Body, s.maxRequestBodySize)
+	if isBodyTooLarge(err) {
+		tooLargeStats.Add(req.Pattern, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if int64(size) > s.maxDecompressedBodySize {
+		tooLargeStats.Add(req.Pattern, 1)
+		return nil, fmt.Errorf("decompressed %w: exceeds %d bytes", errBodyTooLarge, s.maxDecompressedBodySize)
+	}
+
+	return snappy.Decode(nil, compressed)
+}
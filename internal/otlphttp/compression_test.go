@@ -0,0 +1,129 @@
+package otlphttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, contentEncoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch contentEncoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		return data
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressBody(t *testing.T) {
+	want := []byte(`{"resourceLogs":[]}`)
+
+	for _, contentEncoding := range []string{"", "gzip", "zstd", "deflate"} {
+		t.Run(contentEncoding, func(t *testing.T) {
+			r, err := decompressBody(bytes.NewReader(compress(t, contentEncoding, want)), contentEncoding, DefaultMaxDecompressedBodySize)
+			if err != nil {
+				t.Fatalf("decompressBody failed: %v", err)
+			}
+			defer r.Close()
+
+			got, err := readLimited(r, DefaultMaxDecompressedBodySize)
+			if err != nil {
+				t.Fatalf("readLimited failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestDecompressBodyUnsupported(t *testing.T) {
+	_, err := decompressBody(bytes.NewReader(nil), "br", DefaultMaxDecompressedBodySize)
+	if _, ok := err.(errUnsupportedEncoding); !ok {
+		t.Fatalf("Expected errUnsupportedEncoding, got %v", err)
+	}
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	// 1 MiB of zeros compresses to about a kilobyte.
+	bomb := compress(t, "gzip", make([]byte, 1<<20))
+
+	r, err := decompressBody(bytes.NewReader(bomb), "gzip", DefaultMaxDecompressedBodySize)
+	if err != nil {
+		t.Fatalf("decompressBody failed: %v", err)
+	}
+	defer r.Close()
+
+	if _, err := readLimited(r, 1<<10); !isBodyTooLarge(err) {
+		t.Fatalf("Expected errBodyTooLarge, got %v", err)
+	}
+}
+
+func TestReadBodyLimits(t *testing.T) {
+	svc := HTTPService{maxRequestBodySize: 1 << 10, maxDecompressedBodySize: 1 << 12}
+	small := make([]byte, 1<<11)
+
+	for _, tt := range []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		statusCode      int
+	}{
+		{"within limits", "gzip", compress(t, "gzip", small), http.StatusOK},
+		{"over request limit", "", small, http.StatusRequestEntityTooLarge},
+		{"over decompressed limit", "gzip", compress(t, "gzip", make([]byte, 1<<20)), http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.contentEncoding)
+			req.Pattern = "POST /v1/logs"
+			before := tooLargeCount(req.Pattern)
+
+			_, statusCode, err := svc.readBody(req)
+			if statusCode != tt.statusCode {
+				t.Fatalf("status code = %d (%v), want %d", statusCode, err, tt.statusCode)
+			}
+			want := int64(0)
+			if tt.statusCode == http.StatusRequestEntityTooLarge {
+				want = 1
+			}
+			if rejected := tooLargeCount(req.Pattern) - before; rejected != want {
+				t.Errorf("rejected requests = %d, want %d", rejected, want)
+			}
+		})
+	}
+}
+
+func tooLargeCount(pattern string) int64 {
+	if v, ok := tooLargeStats.Get(pattern).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
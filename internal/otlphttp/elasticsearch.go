@@ -0,0 +1,138 @@
+package otlphttp
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/elasticsearch"
+)
+
+// Version reported to Elasticsearch clients, which pick their API by its
+// major version and refuse to talk to older servers.
+const elasticsearchVersion = "8.17.0"
+
+type bulkResponse struct {
+	Took   int64                       `json:"took"`
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Index   string            `json:"_index"`
+	ID      string            `json:"_id,omitempty"`
+	Version int               `json:"_version,omitempty"`
+	Result  string            `json:"result,omitempty"`
+	Status  int               `json:"status"`
+	Error   *elasticsearchErr `json:"error,omitempty"`
+}
+
+type elasticsearchErr struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// handleElasticsearchBulk receives bulk requests and writes the documents of
+// their index and create actions to the logs table. Other actions, and
+// malformed documents, are rejected in the response items.
+func (s HTTPService) handleElasticsearchBulk(resp http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	items, err := elasticsearch.ParseBulk(body, req.PathValue("index"))
+	if err != nil {
+		writeElasticsearchResponse(resp, http.StatusBadRequest, map[string]any{
+			"error":  elasticsearchErr{Type: "illegal_argument_exception", Reason: err.Error()},
+			"status": http.StatusBadRequest,
+		})
+		return
+	}
+
+	// Elasticsearch has no partial success for rejected documents, they are
+	// only counted in the pipeline stats.
+	ld := elasticsearch.ToLogs(items, s.elasticsearch, pcommon.NewTimestampFromTime(time.Now()))
+	if ld.LogRecordCount() > 0 {
+		if _, err := s.logs.Export(req.Context(), plogotlp.NewExportRequestFromLogs(ld)); err != nil {
+			writePlainError(resp, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	bulkResp := bulkResponse{Items: make([]map[string]bulkItemResult, 0, len(items))}
+	for _, item := range items {
+		result := bulkItemResult{Index: item.Index, ID: item.ID}
+		if item.Err != nil {
+			bulkResp.Errors = true
+			result.Status = http.StatusBadRequest
+			result.Error = &elasticsearchErr{Type: "illegal_argument_exception", Reason: item.Err.Error()}
+		} else {
+			if result.ID == "" {
+				result.ID = rand.Text()
+			}
+			result.Version = 1
+			result.Result = "created"
+			result.Status = http.StatusCreated
+		}
+		bulkResp.Items = append(bulkResp.Items, map[string]bulkItemResult{item.Action: result})
+	}
+	bulkResp.Took = time.Since(start).Milliseconds()
+
+	writeElasticsearchResponse(resp, http.StatusOK, bulkResp)
+}
+
+// handleElasticsearchInfo answers the cluster info request clients send to
+// check the version of the server.
+func (s HTTPService) handleElasticsearchInfo(resp http.ResponseWriter, req *http.Request) {
+	writeElasticsearchResponse(resp, http.StatusOK, map[string]any{
+		"name":         "sweetcorn",
+		"cluster_name": "sweetcorn",
+		"cluster_uuid": "sweetcorn",
+		"version": map[string]any{
+			"number":                              elasticsearchVersion,
+			"build_flavor":                        "default",
+			"lucene_version":                      "9.12.0",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// handleElasticsearchLicense answers the license check of Logstash and
+// Beats.
+func (s HTTPService) handleElasticsearchLicense(resp http.ResponseWriter, req *http.Request) {
+	writeElasticsearchResponse(resp, http.StatusOK, map[string]any{
+		"license": map[string]any{"status": "active", "type": "basic", "mode": "basic"},
+	})
+}
+
+// handleElasticsearchHealth answers the health check of Vector.
+func (s HTTPService) handleElasticsearchHealth(resp http.ResponseWriter, req *http.Request) {
+	writeElasticsearchResponse(resp, http.StatusOK, map[string]any{
+		"cluster_name":    "sweetcorn",
+		"status":          "green",
+		"timed_out":       false,
+		"number_of_nodes": 1,
+	})
+}
+
+// writeElasticsearchResponse writes v as JSON. Elasticsearch clients check
+// the product header before they read the body.
+func writeElasticsearchResponse(w http.ResponseWriter, statusCode int, v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		writePlainError(w, fmt.Errorf("failed to marshal response: %w", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	writeResponse(w, jsonContentType, statusCode, msg)
+}
@@ -0,0 +1,100 @@
+package otlphttp
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/influx"
+)
+
+// Version reported to InfluxDB clients, which some check on ping.
+const influxVersion = "2.7.11"
+
+// Rejected lines and skipped string fields of writes, served on
+// /debug/vars.
+var influxStats = expvar.NewMap("influx")
+
+// handleInfluxWriteV2 receives InfluxDB 2.x line protocol writes and writes
+// them to the gauge table. The org and bucket are ignored.
+// Ref: https://docs.influxdata.com/influxdb/v2/api/#operation/PostWrite
+func (s HTTPService) handleInfluxWriteV2(resp http.ResponseWriter, req *http.Request) {
+	s.influxWrite(resp, req, func(statusCode int, msg string) {
+		writeInfluxResponse(resp, statusCode, map[string]string{"code": "invalid", "message": msg})
+	})
+}
+
+// handleInfluxWriteV1 is handleInfluxWriteV2 for the InfluxDB 1.x write
+// endpoint. The database and retention policy are ignored.
+// Ref: https://docs.influxdata.com/influxdb/v1/tools/api/#write-http-endpoint
+func (s HTTPService) handleInfluxWriteV1(resp http.ResponseWriter, req *http.Request) {
+	s.influxWrite(resp, req, func(statusCode int, msg string) {
+		writeInfluxResponse(resp, statusCode, map[string]string{"error": msg})
+	})
+}
+
+func (s HTTPService) influxWrite(resp http.ResponseWriter, req *http.Request, writeError func(statusCode int, msg string)) {
+	precision, err := influx.ParsePrecision(req.URL.Query().Get("precision"))
+	if err != nil {
+		writeError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	points, errs := influx.ParseLines(body, precision)
+	md, skipped := influx.ToMetrics(points, time.Now())
+	influxStats.Add("rejected_lines", int64(len(errs)))
+	influxStats.Add("skipped_string_fields", int64(skipped))
+
+	// As InfluxDB, the valid lines are written even if others are not. The
+	// line protocol has no partial success, rejected data points are only
+	// counted in the pipeline stats.
+	if md.DataPointCount() > 0 {
+		if _, err := s.metrics.Export(req.Context(), pmetricotlp.NewExportRequestFromMetrics(md)); err != nil {
+			writePlainError(resp, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// What was not written is reported as InfluxDB reports a partial write,
+	// dropped counts the rejected lines and skipped fields.
+	if len(errs) > 0 || skipped > 0 {
+		msg := "string fields are not supported"
+		if len(errs) > 0 {
+			msg = errs[0].Error()
+		}
+		if md.DataPointCount() > 0 {
+			msg = fmt.Sprintf("partial write: %s dropped=%d", msg, len(errs)+skipped)
+		}
+		writeError(http.StatusBadRequest, msg)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// handleInfluxPing answers the ping of InfluxDB clients checking that the
+// server is up.
+func (s HTTPService) handleInfluxPing(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("X-Influxdb-Version", influxVersion)
+	resp.Header().Set("X-Influxdb-Build", "OSS")
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func writeInfluxResponse(w http.ResponseWriter, statusCode int, v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		writePlainError(w, fmt.Errorf("failed to marshal response: %w", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Influxdb-Version", influxVersion)
+	writeResponse(w, jsonContentType, statusCode, msg)
+}
@@ -0,0 +1,48 @@
+package otlphttp
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/jaeger"
+)
+
+// Content types of Thrift binary batches, as accepted by the Jaeger
+// collector.
+var thriftContentTypes = []string{"application/x-thrift", "application/vnd.apache.thrift.binary"}
+
+// handleJaegerThrift receives Jaeger Thrift binary batches and writes them
+// to the traces table.
+// Ref: https://www.jaegertracing.io/docs/latest/apis/#thrift-over-http-stable
+func (s HTTPService) handleJaegerThrift(resp http.ResponseWriter, req *http.Request) {
+	contentType := getMimeTypeFromContentType(req.Header.Get("Content-Type"))
+	if !slices.Contains(thriftContentTypes, contentType) {
+		writePlainError(resp, fmt.Errorf("unsupported Content-Type %q, supported: %v", contentType, thriftContentTypes), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	batch, err := jaeger.DecodeThriftBatch(body)
+	if err != nil {
+		writePlainError(resp, fmt.Errorf("failed to decode batch: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// Jaeger has no partial success, rejected spans are only counted in the
+	// pipeline stats.
+	td := jaeger.ToTraces(batch)
+	if _, err := s.traces.Export(req.Context(), ptraceotlp.NewExportRequestFromTraces(td)); err != nil {
+		writePlainError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,53 @@
+package otlphttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/loki"
+)
+
+// handleLokiPush receives Loki push requests and writes them to the logs
+// table. As in Loki, JSON bodies may use any Content-Encoding, every other
+// Content-Type is snappy compressed protobuf.
+// Ref: https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+func (s HTTPService) handleLokiPush(resp http.ResponseWriter, req *http.Request) {
+	var pushReq loki.PushRequest
+	if getMimeTypeFromContentType(req.Header.Get("Content-Type")) == jsonContentType {
+		body, statusCode, err := s.readBody(req)
+		if err != nil {
+			writePlainError(resp, err, statusCode)
+			return
+		}
+		if pushReq, err = loki.DecodeJSON(body); err != nil {
+			writePlainError(resp, fmt.Errorf("failed to decode push request: %w", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		body, err := s.readSnappyBody(req)
+		if err != nil {
+			statusCode := http.StatusBadRequest
+			if isBodyTooLarge(err) {
+				statusCode = http.StatusRequestEntityTooLarge
+			}
+			writePlainError(resp, err, statusCode)
+			return
+		}
+		if pushReq, err = loki.DecodeProto(body); err != nil {
+			writePlainError(resp, fmt.Errorf("failed to decode push request: %w", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Loki has no partial success, rejected entries are only counted in the
+	// pipeline stats.
+	ld := loki.ToLogs(pushReq)
+	if _, err := s.logs.Export(req.Context(), plogotlp.NewExportRequestFromLogs(ld)); err != nil {
+		writePlainError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
@@ -3,10 +3,12 @@ package otlphttp
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"mime"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,17 +17,36 @@ import (
 	"github.com/rs/cors"
 	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
-	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+	"github.com/alkmst-xyz/sweetcorn/internal/elasticsearch"
+	"github.com/alkmst-xyz/sweetcorn/internal/otlp"
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/ratelimit"
 )
 
 type HTTPService struct {
-	ctx     context.Context
-	storage *storage.Storage
+	auth auth.Authenticator
+
+	// Requests are handled by the gRPC services, so that both transports
+	// respond the same way.
+	logs     *otlp.LogsGRPCService
+	traces   *otlp.TracesGRPCService
+	metrics  *otlp.MetricsGRPCService
+	profiles *otlp.ProfilesGRPCService
+
+	// Fields of bulk request documents that become log record fields.
+	elasticsearch elasticsearch.Mapping
+
+	maxRequestBodySize      int64
+	maxDecompressedBodySize int64
 }
 
 //
@@ -37,6 +58,9 @@ var fallbackMsg = []byte(`{"code": 13, "message": "failed to marshal error messa
 
 const fallbackContentType = "application/json"
 
+// Time requests in flight have to finish once the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
 // yoinked from https://github.com/open-telemetry/opentelemetry-collector/blob/main/receiver/otlpreceiver/encoder.go
 const (
 	pbContentType   = "application/x-protobuf"
@@ -53,10 +77,12 @@ type encoder interface {
 	unmarshalTracesRequest(buf []byte) (ptraceotlp.ExportRequest, error)
 	unmarshalLogsRequest(buf []byte) (plogotlp.ExportRequest, error)
 	unmarshalMetricsRequest(buf []byte) (pmetricotlp.ExportRequest, error)
+	unmarshalProfilesRequest(buf []byte) (pprofileotlp.ExportRequest, error)
 
 	marshalTracesResponse(ptraceotlp.ExportResponse) ([]byte, error)
 	marshalLogsResponse(plogotlp.ExportResponse) ([]byte, error)
 	marshalMetricsResponse(pmetricotlp.ExportResponse) ([]byte, error)
+	marshalProfilesResponse(pprofileotlp.ExportResponse) ([]byte, error)
 
 	marshalStatus(rsp *spb.Status) ([]byte, error)
 
@@ -83,6 +109,12 @@ func (protoEncoder) unmarshalMetricsRequest(buf []byte) (pmetricotlp.ExportReque
 	return req, err
 }
 
+func (protoEncoder) unmarshalProfilesRequest(buf []byte) (pprofileotlp.ExportRequest, error) {
+	req := pprofileotlp.NewExportRequest()
+	err := req.UnmarshalProto(buf)
+	return req, err
+}
+
 func (protoEncoder) marshalTracesResponse(resp ptraceotlp.ExportResponse) ([]byte, error) {
 	return resp.MarshalProto()
 }
@@ -95,6 +127,10 @@ func (protoEncoder) marshalMetricsResponse(resp pmetricotlp.ExportResponse) ([]b
 	return resp.MarshalProto()
 }
 
+func (protoEncoder) marshalProfilesResponse(resp pprofileotlp.ExportResponse) ([]byte, error) {
+	return resp.MarshalProto()
+}
+
 func (protoEncoder) marshalStatus(resp *spb.Status) ([]byte, error) {
 	return proto.Marshal(resp)
 }
@@ -123,6 +159,12 @@ func (jsonEncoder) unmarshalMetricsRequest(buf []byte) (pmetricotlp.ExportReques
 	return req, err
 }
 
+func (jsonEncoder) unmarshalProfilesRequest(buf []byte) (pprofileotlp.ExportRequest, error) {
+	req := pprofileotlp.NewExportRequest()
+	err := req.UnmarshalJSON(buf)
+	return req, err
+}
+
 func (jsonEncoder) marshalTracesResponse(resp ptraceotlp.ExportResponse) ([]byte, error) {
 	return resp.MarshalJSON()
 }
@@ -135,6 +177,10 @@ func (jsonEncoder) marshalMetricsResponse(resp pmetricotlp.ExportResponse) ([]by
 	return resp.MarshalJSON()
 }
 
+func (jsonEncoder) marshalProfilesResponse(resp pprofileotlp.ExportResponse) ([]byte, error) {
+	return resp.MarshalJSON()
+}
+
 func (jsonEncoder) marshalStatus(resp *spb.Status) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	err := jsonPbMarshaler.Marshal(buf, resp)
@@ -210,19 +256,36 @@ func writeError(w http.ResponseWriter, encoder encoder, err error, statusCode in
 	writeStatusResponse(w, encoder, statusCode, s)
 }
 
-func readAndCloseBody(resp http.ResponseWriter, req *http.Request, enc encoder) ([]byte, bool) {
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		writeError(resp, enc, err, http.StatusBadRequest)
+// readAndCloseBody reads the request body, decoding it according to its
+// Content-Encoding.
+func (s HTTPService) readAndCloseBody(resp http.ResponseWriter, req *http.Request, enc encoder) ([]byte, bool) {
+	body, statusCode, err := s.readBody(req)
+	if statusCode == http.StatusRequestEntityTooLarge {
+		writeStatusResponse(resp, enc, statusCode, status.New(codes.ResourceExhausted, err.Error()))
 		return nil, false
 	}
-	if err = req.Body.Close(); err != nil {
-		writeError(resp, enc, err, http.StatusBadRequest)
+	if err != nil {
+		writeError(resp, enc, err, statusCode)
 		return nil, false
 	}
 	return body, true
 }
 
+// writePlainError writes err as plain text, for receivers of other formats
+// than OTLP. A gRPC status error sets the status code, and a Retry-After
+// header if it asks the client to back off.
+func writePlainError(w http.ResponseWriter, err error, statusCode int) {
+	msg := err.Error()
+	if st, ok := status.FromError(err); ok {
+		statusCode = GetHTTPStatusCodeFromStatus(st)
+		if retryInfo := GetRetryInfo(st); retryInfo != nil {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(retryInfo.GetRetryDelay().AsDuration()/time.Second), 10))
+		}
+		msg = st.Message()
+	}
+	http.Error(w, msg, statusCode)
+}
+
 func readContentType(w http.ResponseWriter, r *http.Request) (encoder, bool) {
 	if r.Method != http.MethodPost {
 		handleUnmatchedMethod(w)
@@ -244,7 +307,6 @@ func readContentType(w http.ResponseWriter, r *http.Request) (encoder, bool) {
 // Logs
 //
 
-// TODO: return appropriate status errors
 // Ref: https://github.com/open-telemetry/opentelemetry-collector/blob/main/receiver/otlpreceiver/internal/logs/otlp.go
 func (s HTTPService) handleLogs(resp http.ResponseWriter, req *http.Request) {
 	enc, ok := readContentType(resp, req)
@@ -252,7 +314,7 @@ func (s HTTPService) handleLogs(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	body, ok := readAndCloseBody(resp, req, enc)
+	body, ok := s.readAndCloseBody(resp, req, enc)
 	if !ok {
 		return
 	}
@@ -263,13 +325,13 @@ func (s HTTPService) handleLogs(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = storage.InsertLogsData(s.ctx, s.storage.DB, s.storage.InsertLogsSQL, otlpReq.Logs())
+	otlpResp, err := s.logs.Export(req.Context(), otlpReq)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
 	}
 
-	msg, err := enc.marshalLogsResponse(plogotlp.NewExportResponse())
+	msg, err := enc.marshalLogsResponse(otlpResp)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
@@ -287,7 +349,7 @@ func (s HTTPService) handleTraces(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	body, ok := readAndCloseBody(resp, req, enc)
+	body, ok := s.readAndCloseBody(resp, req, enc)
 	if !ok {
 		return
 	}
@@ -298,13 +360,13 @@ func (s HTTPService) handleTraces(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = storage.InsertTracesData(s.ctx, s.storage.DB, s.storage.InsertTracesSQL, otlpReq.Traces())
+	otlpResp, err := s.traces.Export(req.Context(), otlpReq)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
 	}
 
-	msg, err := enc.marshalTracesResponse(ptraceotlp.NewExportResponse())
+	msg, err := enc.marshalTracesResponse(otlpResp)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
@@ -322,7 +384,7 @@ func (s HTTPService) handleMetrics(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	body, ok := readAndCloseBody(resp, req, enc)
+	body, ok := s.readAndCloseBody(resp, req, enc)
 	if !ok {
 		return
 	}
@@ -333,13 +395,48 @@ func (s HTTPService) handleMetrics(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	err = storage.IngestMetricsData(s.ctx, s.storage, otlpReq.Metrics())
+	otlpResp, err := s.metrics.Export(req.Context(), otlpReq)
+	if err != nil {
+		writeError(resp, enc, err, http.StatusInternalServerError)
+		return
+	}
+
+	msg, err := enc.marshalMetricsResponse(otlpResp)
+	if err != nil {
+		writeError(resp, enc, err, http.StatusInternalServerError)
+		return
+	}
+	writeResponse(resp, enc.contentType(), http.StatusOK, msg)
+}
+
+//
+// Profiles
+//
+
+func (s HTTPService) handleProfiles(resp http.ResponseWriter, req *http.Request) {
+	enc, ok := readContentType(resp, req)
+	if !ok {
+		return
+	}
+
+	body, ok := s.readAndCloseBody(resp, req, enc)
+	if !ok {
+		return
+	}
+
+	otlpReq, err := enc.unmarshalProfilesRequest(body)
+	if err != nil {
+		writeError(resp, enc, err, http.StatusBadRequest)
+		return
+	}
+
+	otlpResp, err := s.profiles.Export(req.Context(), otlpReq)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
 	}
 
-	msg, err := enc.marshalMetricsResponse(pmetricotlp.NewExportResponse())
+	msg, err := enc.marshalProfilesResponse(otlpResp)
 	if err != nil {
 		writeError(resp, enc, err, http.StatusInternalServerError)
 		return
@@ -351,24 +448,95 @@ func (s HTTPService) handleMetrics(resp http.ResponseWriter, req *http.Request)
 // Main
 //
 
-func StartHTTPServer(ctx context.Context, storage *storage.Storage, addr string) error {
+type ServerConfig struct {
+	Addr string
+	// TLS, if set, is used to serve HTTPS.
+	TLS *tls.Config
+	// Auth, if set, is required to accept the credentials of every request.
+	Auth auth.Authenticator
+	// Elasticsearch maps the fields of documents in bulk requests.
+	Elasticsearch elasticsearch.Mapping
+	// RateLimiter, if set, throttles the records of every request.
+	RateLimiter *ratelimit.Limiter
+	// Requests with a larger body, as sent or once decompressed, are
+	// rejected with 413.
+	MaxRequestBodySize      int64
+	MaxDecompressedBodySize int64
+}
+
+func StartHTTPServer(ctx context.Context, pl *pipeline.Pipeline, cfg ServerConfig) error {
+	if cfg.MaxRequestBodySize < 1 || cfg.MaxDecompressedBodySize < 1 {
+		return fmt.Errorf("invalid HTTP server config: %+v", cfg)
+	}
+
 	svc := &HTTPService{
-		ctx:     ctx,
-		storage: storage,
+		auth:     cfg.Auth,
+		logs:     otlp.NewLogsGRPCService(pl, cfg.RateLimiter),
+		traces:   otlp.NewTracesGRPCService(pl, cfg.RateLimiter),
+		metrics:  otlp.NewMetricsGRPCService(pl, cfg.RateLimiter),
+		profiles: otlp.NewProfilesGRPCService(pl, cfg.RateLimiter),
+
+		elasticsearch: cfg.Elasticsearch,
+
+		maxRequestBodySize:      cfg.MaxRequestBodySize,
+		maxDecompressedBodySize: cfg.MaxDecompressedBodySize,
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /v1/logs", svc.handleLogs)
-	mux.HandleFunc("POST /v1/traces", svc.handleTraces)
-	mux.HandleFunc("POST /v1/metrics", svc.handleMetrics)
+	mux.HandleFunc("POST /v1/logs", svc.authenticate(withTenant(svc.handleLogs)))
+	mux.HandleFunc("POST /v1/traces", svc.authenticate(withTenant(svc.handleTraces)))
+	mux.HandleFunc("POST /v1/metrics", svc.authenticate(withTenant(svc.handleMetrics)))
+	// The profiles signal is still in development, its path says so.
+	mux.HandleFunc("POST /v1development/profiles", svc.authenticate(withTenant(svc.handleProfiles)))
+	mux.HandleFunc("POST /api/v1/write", svc.authenticate(withTenant(svc.handlePrometheusWrite)))
+	mux.HandleFunc("POST /api/v2/spans", svc.authenticate(withTenant(svc.handleZipkinSpans)))
+	mux.HandleFunc("POST /api/traces", svc.authenticate(withTenant(svc.handleJaegerThrift)))
+	mux.HandleFunc("POST /loki/api/v1/push", svc.authenticate(withTenant(svc.handleLokiPush)))
+	mux.HandleFunc("POST /services/collector", svc.authenticate(withTenant(svc.handleSplunkEvent)))
+	mux.HandleFunc("POST /services/collector/event", svc.authenticate(withTenant(svc.handleSplunkEvent)))
+	mux.HandleFunc("POST /services/collector/raw", svc.authenticate(withTenant(svc.handleSplunkRaw)))
+	mux.HandleFunc("POST /_bulk", svc.authenticate(withTenant(svc.handleElasticsearchBulk)))
+	mux.HandleFunc("POST /{index}/_bulk", svc.authenticate(withTenant(svc.handleElasticsearchBulk)))
+	// Requests Elasticsearch clients send before their first bulk request.
+	mux.HandleFunc("GET /{$}", svc.authenticate(svc.handleElasticsearchInfo))
+	mux.HandleFunc("GET /_license", svc.authenticate(svc.handleElasticsearchLicense))
+	mux.HandleFunc("GET /_cluster/health", svc.authenticate(svc.handleElasticsearchHealth))
+	mux.HandleFunc("POST /api/v2/write", svc.authenticate(withTenant(svc.handleInfluxWriteV2)))
+	mux.HandleFunc("POST /write", svc.authenticate(withTenant(svc.handleInfluxWriteV1)))
+	// InfluxDB answers pings without credentials, GET also matches HEAD.
+	mux.HandleFunc("GET /ping", svc.handleInfluxPing)
 
 	server := &http.Server{
-		Addr:    addr,
-		Handler: cors.Default().Handler(mux),
+		Addr:      cfg.Addr,
+		Handler:   cors.Default().Handler(mux),
+		TLSConfig: cfg.TLS,
+		// Requests carry the client address as gRPC calls do, for rate
+		// limits by client.
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return peer.NewContext(ctx, &peer.Peer{Addr: c.RemoteAddr()})
+		},
 	}
 
-	log.Printf("HTTP server listening on %s", addr)
-	err := server.ListenAndServe()
-
+	// Requests in flight are finished on shutdown, so that their records are
+	// queued before the pipeline is drained.
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	log.Printf("HTTP server listening on %s (tls=%t, auth=%t)", cfg.Addr, cfg.TLS != nil, cfg.Auth != nil)
+	var err error
+	if cfg.TLS != nil {
+		// The certificate comes from TLSConfig.
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return <-shutdown
+	}
 	return err
 }
@@ -0,0 +1,61 @@
+package otlphttp
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/prometheus"
+)
+
+// Protobuf message of remote write 2.0, in the proto parameter of the
+// Content-Type. It is not supported, senders fall back to 1.0 on a 415.
+const remoteWriteV2Proto = "io.prometheus.write.v2.Request"
+
+// handlePrometheusWrite receives Prometheus remote write 1.0 requests and
+// writes them to the metrics tables.
+// Ref: https://prometheus.io/docs/specs/prw/remote_write_spec/
+func (s HTTPService) handlePrometheusWrite(resp http.ResponseWriter, req *http.Request) {
+	if _, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); params["proto"] == remoteWriteV2Proto {
+		writePlainError(resp, errors.New("remote write 2.0 is not supported"), http.StatusUnsupportedMediaType)
+		return
+	}
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "snappy" {
+		writePlainError(resp, fmt.Errorf("unsupported Content-Encoding %q, supported: [snappy]", encoding), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := s.readSnappyBody(req)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if isBodyTooLarge(err) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	writeReq, err := prometheus.DecodeWriteRequest(body)
+	if err != nil {
+		writePlainError(resp, fmt.Errorf("failed to decode remote write request: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	md, err := prometheus.ToMetrics(writeReq)
+	if err != nil {
+		writePlainError(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	// Remote write has no partial success, rejected data points are only
+	// counted in the pipeline stats.
+	if _, err := s.metrics.Export(req.Context(), pmetricotlp.NewExportRequestFromMetrics(md)); err != nil {
+		writePlainError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
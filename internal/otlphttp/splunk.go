@@ -0,0 +1,86 @@
+package otlphttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/splunk"
+)
+
+// handleSplunkEvent receives JSON events on the Splunk HEC event endpoint
+// and writes them to the logs table.
+func (s HTTPService) handleSplunkEvent(resp http.ResponseWriter, req *http.Request) {
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	events, err := splunk.DecodeEvents(body)
+	if err != nil {
+		writeHECError(resp, err)
+		return
+	}
+	s.exportSplunkEvents(resp, req, events)
+}
+
+// handleSplunkRaw receives newline separated events on the Splunk HEC raw
+// endpoint and writes them to the logs table. Their metadata is in the query
+// parameters.
+func (s HTTPService) handleSplunkRaw(resp http.ResponseWriter, req *http.Request) {
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	query := req.URL.Query()
+	events, err := splunk.DecodeRaw(body, splunk.Event{
+		Host:       query.Get("host"),
+		Source:     query.Get("source"),
+		SourceType: query.Get("sourcetype"),
+		Index:      query.Get("index"),
+	})
+	if err != nil {
+		writeHECError(resp, err)
+		return
+	}
+	s.exportSplunkEvents(resp, req, events)
+}
+
+func (s HTTPService) exportSplunkEvents(resp http.ResponseWriter, req *http.Request, events []splunk.Event) {
+	// HEC has no partial success, rejected events are only counted in the
+	// pipeline stats.
+	ld := splunk.ToLogs(events, pcommon.NewTimestampFromTime(time.Now()))
+	if _, err := s.logs.Export(req.Context(), plogotlp.NewExportRequestFromLogs(ld)); err != nil {
+		writePlainError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeHECResponse(resp, http.StatusOK, 0, "Success")
+}
+
+// writeHECError writes a request error in the JSON body HEC clients expect.
+func writeHECError(w http.ResponseWriter, err error) {
+	var hecErr *splunk.Error
+	if !errors.As(err, &hecErr) {
+		writePlainError(w, err, http.StatusBadRequest)
+		return
+	}
+	writeHECResponse(w, http.StatusBadRequest, hecErr.Code, hecErr.Text)
+}
+
+// writeHECResponse writes the JSON body of HEC responses, code is the HEC
+// status code.
+func writeHECResponse(w http.ResponseWriter, statusCode int, code int, text string) {
+	msg, _ := json.Marshal(struct {
+		Text string `json:"text"`
+		Code int    `json:"code"`
+	}{text, code})
+	writeResponse(w, jsonContentType, statusCode, msg)
+}
@@ -0,0 +1,23 @@
+package otlphttp
+
+import (
+	"net/http"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/otlp"
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// withTenant wraps next so that the tenant of the request is in its context.
+// It runs after authenticate, the authenticated principal takes precedence
+// over the tenant header.
+func withTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		tenantID, err := tenant.Resolve(req.Context(), req.Header.Get(tenant.Header))
+		if err != nil {
+			writeError(resp, requestEncoder(req), otlp.GetStatusFromError(err), http.StatusBadRequest)
+			return
+		}
+
+		next(resp, req.WithContext(tenant.NewContext(req.Context(), tenantID)))
+	}
+}
@@ -0,0 +1,46 @@
+package otlphttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/zipkin"
+)
+
+// handleZipkinSpans receives Zipkin v2 spans, JSON or protobuf, and writes
+// them to the traces table.
+// Ref: https://zipkin.io/zipkin-api/#/default/post_spans
+func (s HTTPService) handleZipkinSpans(resp http.ResponseWriter, req *http.Request) {
+	body, statusCode, err := s.readBody(req)
+	if err != nil {
+		writePlainError(resp, err, statusCode)
+		return
+	}
+
+	decode := zipkin.DecodeJSON
+	if getMimeTypeFromContentType(req.Header.Get("Content-Type")) == pbContentType {
+		decode = zipkin.DecodeProto
+	}
+	spans, err := decode(body)
+	if err != nil {
+		writePlainError(resp, fmt.Errorf("failed to decode spans: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	td, err := zipkin.ToTraces(spans)
+	if err != nil {
+		writePlainError(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	// Zipkin has no partial success, rejected spans are only counted in the
+	// pipeline stats.
+	if _, err := s.traces.Export(req.Context(), ptraceotlp.NewExportRequestFromTraces(td)); err != nil {
+		writePlainError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusAccepted)
+}
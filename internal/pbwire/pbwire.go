@@ -0,0 +1,113 @@
+// Package pbwire decodes protobuf messages field by field. Receivers of
+// formats with a small protobuf schema use it instead of depending on the
+// generated code of another project.
+package pbwire
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// Field is the value of a decoded field: Num for varint and fixed size
+// fields, Bytes for length delimited ones.
+type Field struct {
+	Type  protowire.Type
+	Num   uint64
+	Bytes []byte
+}
+
+// Decode calls fn for each field of the message in buf. Groups are skipped.
+func Decode(buf []byte, fn func(num protowire.Number, f Field) error) error {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+
+		f := Field{Type: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.Num, n = protowire.ConsumeVarint(buf)
+		case protowire.Fixed64Type:
+			f.Num, n = protowire.ConsumeFixed64(buf)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(buf)
+			f.Num = uint64(v)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(buf)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, buf)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+
+		if err := fn(num, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns a string field.
+func (f Field) String() string {
+	return string(f.Bytes)
+}
+
+// Double returns a double field.
+func (f Field) Double() float64 {
+	return math.Float64frombits(f.Num)
+}
+
+// Sint64 returns a sint32 or sint64 field.
+func (f Field) Sint64() int64 {
+	return protowire.DecodeZigZag(f.Num)
+}
+
+// Bool returns a bool field.
+func (f Field) Bool() bool {
+	return f.Num != 0
+}
+
+// AppendSint64s appends a repeated sint64 field, packed or not.
+func (f Field) AppendSint64s(dst []int64) ([]int64, error) {
+	if f.Type == protowire.VarintType {
+		return append(dst, f.Sint64()), nil
+	}
+
+	buf := f.Bytes
+	for len(buf) > 0 {
+		v, n := protowire.ConsumeVarint(buf)
+		if n < 0 {
+			return nil, errTruncated
+		}
+		dst = append(dst, protowire.DecodeZigZag(v))
+		buf = buf[n:]
+	}
+	return dst, nil
+}
+
+// AppendDoubles appends a repeated double field, packed or not.
+func (f Field) AppendDoubles(dst []float64) ([]float64, error) {
+	if f.Type == protowire.Fixed64Type {
+		return append(dst, f.Double()), nil
+	}
+
+	buf := f.Bytes
+	for len(buf) > 0 {
+		v, n := protowire.ConsumeFixed64(buf)
+		if n < 0 {
+			return nil, errTruncated
+		}
+		dst = append(dst, math.Float64frombits(v))
+		buf = buf[n:]
+	}
+	return dst, nil
+}
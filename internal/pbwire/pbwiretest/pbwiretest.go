@@ -0,0 +1,28 @@
+// Package pbwiretest encodes protobuf fields, to build the messages the
+// tests of the receivers decode with pbwire.
+package pbwiretest
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// AppendBytes appends a length delimited field: bytes, a string or a
+// message.
+func AppendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// AppendVarint appends a varint field.
+func AppendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// AppendDouble appends a double field.
+func AppendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
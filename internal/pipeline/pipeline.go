@@ -0,0 +1,209 @@
+// Package pipeline buffers ingested telemetry in memory and writes it to
+// storage in batches, so that receivers do not wait on DuckDB.
+//
+// Requests are acknowledged once queued, so delivery is at most once: a
+// batch that still cannot be written after retries is dropped, and only
+// counted in the stats. With a QueueSize of 0, each request is written
+// before it is acknowledged instead, and the storage error, retryable or
+// permanent, is returned to the client.
+package pipeline
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/redact"
+	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+)
+
+// Queue depth, throughput and flush latency per signal, served on
+// /debug/vars.
+var pipelineStats = expvar.NewMap("pipeline")
+
+type Config struct {
+	// Maximum number of requests waiting to be written, per signal. 0
+	// writes each request in its own transaction before returning.
+	QueueSize int
+	// Number of records after which a batch is written.
+	BatchSize int
+	// Maximum time a record waits in a batch before it is written.
+	FlushInterval time.Duration
+	// Number of workers writing batches, per signal.
+	Workers int
+	// Redactor, if set, redacts logs, traces and metrics before they are
+	// queued.
+	Redactor *redact.Redactor
+}
+
+const (
+	DefaultQueueSize     = 1000
+	DefaultBatchSize     = 10_000
+	DefaultFlushInterval = time.Second
+	DefaultWorkers       = 2
+)
+
+type Pipeline struct {
+	logs     *queue[plog.Logs]
+	traces   *queue[ptrace.Traces]
+	metrics  *queue[pmetric.Metrics]
+	profiles *queue[*profilesBatch]
+
+	redactor *redact.Redactor
+}
+
+// profilesBatch holds queued profiles requests. Unlike the other signals,
+// requests are not merged into one: each carries its own dictionary, and
+// merging would have to rewrite every index.
+type profilesBatch struct {
+	requests []pprofile.Profiles
+}
+
+func New(s *storage.Storage, cfg Config) (*Pipeline, error) {
+	if cfg.QueueSize < 0 || cfg.BatchSize < 1 || cfg.FlushInterval <= 0 || cfg.Workers < 1 {
+		return nil, fmt.Errorf("invalid pipeline config: %+v", cfg)
+	}
+
+	logs := newQueue[plog.Logs]("logs", cfg)
+	logs.count = func(ld plog.Logs) int { return ld.LogRecordCount() }
+	logs.newBatch = plog.NewLogs
+	logs.moveTo = func(src, dst plog.Logs) { src.ResourceLogs().MoveAndAppendTo(dst.ResourceLogs()) }
+	logs.resources = func(ld plog.Logs) int { return ld.ResourceLogs().Len() }
+	logs.moveResources = func(src, dst plog.Logs, from, to int) {
+		for i := from; i < to; i++ {
+			src.ResourceLogs().At(i).MoveTo(dst.ResourceLogs().AppendEmpty())
+		}
+	}
+	logs.flush = func(ctx context.Context, ld plog.Logs) error { return storage.InsertLogsData(ctx, s, ld) }
+
+	traces := newQueue[ptrace.Traces]("traces", cfg)
+	traces.count = func(td ptrace.Traces) int { return td.SpanCount() }
+	traces.newBatch = ptrace.NewTraces
+	traces.moveTo = func(src, dst ptrace.Traces) { src.ResourceSpans().MoveAndAppendTo(dst.ResourceSpans()) }
+	traces.resources = func(td ptrace.Traces) int { return td.ResourceSpans().Len() }
+	traces.moveResources = func(src, dst ptrace.Traces, from, to int) {
+		for i := from; i < to; i++ {
+			src.ResourceSpans().At(i).MoveTo(dst.ResourceSpans().AppendEmpty())
+		}
+	}
+	traces.flush = func(ctx context.Context, td ptrace.Traces) error { return storage.InsertTracesData(ctx, s, td) }
+
+	metrics := newQueue[pmetric.Metrics]("metrics", cfg)
+	metrics.count = func(md pmetric.Metrics) int { return md.DataPointCount() }
+	metrics.newBatch = pmetric.NewMetrics
+	metrics.moveTo = func(src, dst pmetric.Metrics) { src.ResourceMetrics().MoveAndAppendTo(dst.ResourceMetrics()) }
+	metrics.resources = func(md pmetric.Metrics) int { return md.ResourceMetrics().Len() }
+	metrics.moveResources = func(src, dst pmetric.Metrics, from, to int) {
+		for i := from; i < to; i++ {
+			src.ResourceMetrics().At(i).MoveTo(dst.ResourceMetrics().AppendEmpty())
+		}
+	}
+	metrics.flush = func(ctx context.Context, md pmetric.Metrics) error { return storage.IngestMetricsData(ctx, s, md) }
+
+	// Profiles are counted in samples, the rows they are written as. Only
+	// invalid_records counts whole profiles, as they are reported to clients.
+	profiles := newQueue[*profilesBatch]("profiles", cfg)
+	profiles.count = func(b *profilesBatch) int {
+		count := 0
+		for _, pd := range b.requests {
+			count += pd.SampleCount()
+		}
+		return count
+	}
+	profiles.newBatch = func() *profilesBatch { return &profilesBatch{} }
+	profiles.moveTo = func(src, dst *profilesBatch) { dst.requests = append(dst.requests, src.requests...) }
+	profiles.resources = func(b *profilesBatch) int { return len(b.requests) }
+	profiles.moveResources = func(src, dst *profilesBatch, from, to int) {
+		dst.requests = append(dst.requests, src.requests[from:to]...)
+	}
+	profiles.flush = func(ctx context.Context, b *profilesBatch) error {
+		return storage.InsertProfilesData(ctx, s, b.requests...)
+	}
+
+	return &Pipeline{
+		logs:     logs,
+		traces:   traces,
+		metrics:  metrics,
+		profiles: profiles,
+
+		redactor: cfg.Redactor,
+	}, nil
+}
+
+// Start the flush workers. Batches are written with a context that is not
+// canceled with ctx, so that Shutdown can still drain the queues.
+func (p *Pipeline) Start(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	p.logs.start(ctx)
+	p.traces.start(ctx)
+	p.metrics.start(ctx)
+	p.profiles.start(ctx)
+}
+
+// Shutdown stops accepting data and writes everything still queued.
+func (p *Pipeline) Shutdown() {
+	p.logs.close()
+	p.traces.close()
+	p.metrics.close()
+	p.profiles.close()
+}
+
+// ConsumeLogs removes the log records of ld that cannot be stored, redacts
+// and queues the rest to be written for the tenant of ctx, or writes them
+// if the queue size is 0. The caller must not use ld afterwards.
+func (p *Pipeline) ConsumeLogs(ctx context.Context, ld plog.Logs) (storage.Rejected, error) {
+	rejected := storage.ValidateLogs(ld)
+	p.logs.stats.Add("invalid_records", rejected.Count)
+	if ld.LogRecordCount() == 0 {
+		return rejected, nil
+	}
+	// Redacted once here rather than on flush, which is retried and would
+	// hash values twice.
+	p.redactor.Logs(ld)
+	return rejected, p.logs.enqueue(ctx, ld)
+}
+
+// ConsumeTraces removes the spans of td that cannot be stored, redacts and
+// queues the rest to be written for the tenant of ctx, or writes them if
+// the queue size is 0. The caller must not use td afterwards.
+func (p *Pipeline) ConsumeTraces(ctx context.Context, td ptrace.Traces) (storage.Rejected, error) {
+	rejected := storage.ValidateTraces(td)
+	p.traces.stats.Add("invalid_records", rejected.Count)
+	if td.SpanCount() == 0 {
+		return rejected, nil
+	}
+	p.redactor.Traces(td)
+	return rejected, p.traces.enqueue(ctx, td)
+}
+
+// ConsumeMetrics removes the data points of md that cannot be stored, redacts
+// and queues the rest to be written for the tenant of ctx, or writes them
+// if the queue size is 0. The caller must not use md afterwards.
+func (p *Pipeline) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) (storage.Rejected, error) {
+	rejected := storage.ValidateMetrics(md)
+	p.metrics.stats.Add("invalid_records", rejected.Count)
+	if md.DataPointCount() == 0 {
+		return rejected, nil
+	}
+	p.redactor.Metrics(md)
+	return rejected, p.metrics.enqueue(ctx, md)
+}
+
+// ConsumeProfiles removes the profiles of pd that cannot be stored and
+// queues the rest to be written for the tenant of ctx, or writes them if
+// the queue size is 0. The caller must not use pd afterwards.
+func (p *Pipeline) ConsumeProfiles(ctx context.Context, pd pprofile.Profiles) (storage.Rejected, error) {
+	rejected := storage.ValidateProfiles(pd)
+	p.profiles.stats.Add("invalid_records", rejected.Count)
+	if pd.SampleCount() == 0 {
+		return rejected, nil
+	}
+	return rejected, p.profiles.enqueue(ctx, &profilesBatch{requests: []pprofile.Profiles{pd}})
+}
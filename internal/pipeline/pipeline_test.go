@@ -0,0 +1,276 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+func newTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	s, err := storage.NewStorage(context.Background(), storage.StorageConfig{
+		StorageType:                      storage.DuckDB,
+		DataDir:                          t.TempDir(),
+		LogsTable:                        storage.DefaultLogsTableName,
+		TracesTable:                      storage.DefaultTracesTableName,
+		MetricsSumTable:                  storage.DefaultMetricsSumTableName,
+		MetricsGaugeTable:                storage.DefaultMetricsGaugeTableName,
+		MetricsHistogramTable:            storage.DefaultMetricsHistogramTableName,
+		MetricsExponentialHistogramTable: storage.DefaultMetricsExponentialHistogramTableName,
+		MetricsSummaryTable:              storage.DefaultMetricsSummaryTableName,
+		ProfilesSamplesTable:             storage.DefaultProfilesSamplesTableName,
+		ProfilesStacksTable:              storage.DefaultProfilesStacksTableName,
+		ProfilesLocationsTable:           storage.DefaultProfilesLocationsTableName,
+		ProfilesFunctionsTable:           storage.DefaultProfilesFunctionsTableName,
+		ProfilesMappingsTable:            storage.DefaultProfilesMappingsTableName,
+	})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func newTestLogs(count int) plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for range count {
+		records.AppendEmpty().Body().SetStr("message")
+	}
+	return ld
+}
+
+// newTestProfiles returns a profile with one sample in function.
+func newTestProfiles(function string) pprofile.Profiles {
+	pd := pprofile.NewProfiles()
+	dic := pd.Dictionary()
+	dic.StringTable().FromRaw([]string{"", function})
+	dic.FunctionTable().AppendEmpty()
+	dic.FunctionTable().AppendEmpty().SetNameStrindex(1)
+	dic.LocationTable().AppendEmpty()
+	dic.LocationTable().AppendEmpty().Lines().AppendEmpty().SetFunctionIndex(1)
+	dic.StackTable().AppendEmpty()
+	dic.StackTable().AppendEmpty().LocationIndices().Append(1)
+
+	sample := pd.ResourceProfiles().AppendEmpty().ScopeProfiles().AppendEmpty().Profiles().AppendEmpty().Samples().AppendEmpty()
+	sample.SetStackIndex(1)
+	sample.Values().Append(1)
+	return pd
+}
+
+func TestPipelineFlushesOnShutdown(t *testing.T) {
+	s := newTestStorage(t)
+
+	p, err := New(s, Config{QueueSize: 10, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	for range 3 {
+		if _, err := p.ConsumeLogs(context.Background(), newTestLogs(2)); err != nil {
+			t.Fatalf("ConsumeLogs failed: %v", err)
+		}
+	}
+	p.Shutdown()
+
+	results, err := storage.QueryLogs(context.Background(), s)
+	if err != nil {
+		t.Fatalf("QueryLogs failed: %v", err)
+	}
+	if len(results) != 6 {
+		t.Errorf("Expected 6 logs, got %d", len(results))
+	}
+
+	if _, err := p.ConsumeLogs(context.Background(), newTestLogs(1)); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable after shutdown, got %v", err)
+	}
+}
+
+func TestPipelineQueueFull(t *testing.T) {
+	s := newTestStorage(t)
+
+	// Workers are not started, so nothing is taken off the queue.
+	p, err := New(s, Config{QueueSize: 1, BatchSize: 100, FlushInterval: 2 * time.Second, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.ConsumeLogs(context.Background(), newTestLogs(1)); err != nil {
+		t.Fatalf("ConsumeLogs failed: %v", err)
+	}
+
+	_, err = p.ConsumeLogs(context.Background(), newTestLogs(1))
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range st.Details() {
+		if ri, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = ri
+		}
+	}
+	if retryInfo == nil || retryInfo.GetRetryDelay().AsDuration() != 2*time.Second {
+		t.Errorf("Expected RetryInfo with a 2s delay, got %v", st.Details())
+	}
+}
+
+func TestPipelineWithoutQueue(t *testing.T) {
+	s := newTestStorage(t)
+
+	p, err := New(s, Config{QueueSize: 0, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+	defer p.Shutdown()
+
+	// Written before ConsumeLogs returns.
+	if _, err := p.ConsumeLogs(tenant.NewContext(context.Background(), "team-a"), newTestLogs(2)); err != nil {
+		t.Fatalf("ConsumeLogs failed: %v", err)
+	}
+	results, err := storage.QueryLogs(tenant.NewContext(context.Background(), "team-a"), s)
+	if err != nil {
+		t.Fatalf("QueryLogs failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 logs, got %d", len(results))
+	}
+
+	// The storage error reaches the client instead of being dropped.
+	if _, err := s.DB.Exec("DROP TABLE " + storage.DefaultLogsTableName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ConsumeLogs(context.Background(), newTestLogs(1)); !consumererror.IsPermanent(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+	for key, want := range map[string]int64{"flushed_records": 2, "flush_errors": 1, "dropped_records": 0} {
+		if got := p.logs.stats.Get(key).(*expvar.Int).Value(); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestPipelineBatchesPerTenant(t *testing.T) {
+	s := newTestStorage(t)
+
+	p, err := New(s, Config{QueueSize: 10, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	for id, count := range map[string]int{"team-a": 1, "team-b": 2, tenant.Default: 3} {
+		if _, err := p.ConsumeLogs(tenant.NewContext(context.Background(), id), newTestLogs(count)); err != nil {
+			t.Fatalf("ConsumeLogs failed: %v", err)
+		}
+	}
+	p.Shutdown()
+
+	for id, count := range map[string]int{"team-a": 1, "team-b": 2, tenant.Default: 3} {
+		results, err := storage.QueryLogs(tenant.NewContext(context.Background(), id), s)
+		if err != nil {
+			t.Fatalf("QueryLogs failed: %v", err)
+		}
+		if len(results) != count {
+			t.Errorf("Expected %d logs for tenant %q, got %d", count, id, len(results))
+		}
+	}
+}
+
+func TestPipelineProfiles(t *testing.T) {
+	s := newTestStorage(t)
+
+	p, err := New(s, Config{QueueSize: 10, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+
+	// Both requests use the same indices for different functions, they end
+	// up in one batch but keep their own dictionaries.
+	for _, function := range []string{"alpha", "beta"} {
+		if _, err := p.ConsumeProfiles(context.Background(), newTestProfiles(function)); err != nil {
+			t.Fatalf("ConsumeProfiles failed: %v", err)
+		}
+	}
+	p.Shutdown()
+
+	samples, err := storage.QueryProfileSamples(context.Background(), s)
+	if err != nil {
+		t.Fatalf("QueryProfileSamples failed: %v", err)
+	}
+
+	var functions []string
+	for _, sample := range samples {
+		functions = append(functions, sample.Frames...)
+	}
+	slices.Sort(functions)
+	if !slices.Equal(functions, []string{"alpha", "beta"}) {
+		t.Errorf("Expected one sample in alpha and one in beta, got %v", functions)
+	}
+}
+
+func TestPipelineSplitsBatchOnPermanentError(t *testing.T) {
+	s := newTestStorage(t)
+
+	p, err := New(s, Config{QueueSize: 10, BatchSize: 100, FlushInterval: time.Hour, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Batches holding the bad record fail as data a database would refuse.
+	flush := p.logs.flush
+	p.logs.flush = func(ctx context.Context, ld plog.Logs) error {
+		for _, rl := range ld.ResourceLogs().All() {
+			for _, sl := range rl.ScopeLogs().All() {
+				for _, lr := range sl.LogRecords().All() {
+					if lr.Body().Str() == "bad" {
+						return consumererror.NewPermanent(errors.New("bad record"))
+					}
+				}
+			}
+		}
+		return flush(ctx, ld)
+	}
+	p.Start(context.Background())
+
+	bad := plog.NewLogs()
+	bad.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("bad")
+	for _, ld := range []plog.Logs{newTestLogs(2), bad, newTestLogs(3)} {
+		if _, err := p.ConsumeLogs(context.Background(), ld); err != nil {
+			t.Fatalf("ConsumeLogs failed: %v", err)
+		}
+	}
+	p.Shutdown()
+
+	results, err := storage.QueryLogs(context.Background(), s)
+	if err != nil {
+		t.Fatalf("QueryLogs failed: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("Expected the 5 logs of the other requests, got %d", len(results))
+	}
+	for key, want := range map[string]int64{"split_batches": 1, "dropped_records": 1, "flushed_records": 5} {
+		if got := p.logs.stats.Get(key).(*expvar.Int).Value(); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package pipeline
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// Number of attempts for a batch whose write failed with a retryable error.
+const flushAttempts = 3
+
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+// queue buffers requests of one signal and writes them in batches. Requests
+// of different tenants are never merged into the same batch.
+type queue[T any] struct {
+	name  string
+	cfg   Config
+	items chan item[T]
+
+	// count returns the number of records in a request or batch.
+	count func(T) int
+	// newBatch returns an empty batch.
+	newBatch func() T
+	// moveTo moves all records of a request into a batch.
+	moveTo func(src, dst T)
+	// resources returns the number of top-level entries, such as resource
+	// logs, of a request. moveTo appends them to the batch in order.
+	resources func(T) int
+	// moveResources moves the top-level entries [from, to) of a batch into
+	// an empty one, to split the batch back into its requests.
+	moveResources func(src, dst T, from, to int)
+	// flush writes a batch to storage, for the tenant in ctx.
+	flush func(ctx context.Context, batch T) error
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	stats *expvar.Map
+}
+
+func newQueue[T any](name string, cfg Config) *queue[T] {
+	q := &queue[T]{
+		name:  name,
+		cfg:   cfg,
+		items: make(chan item[T], cfg.QueueSize),
+		stats: new(expvar.Map).Init(),
+	}
+
+	q.stats.Set("queue_depth", expvar.Func(func() any { return len(q.items) }))
+	q.stats.Set("queue_capacity", expvar.Func(func() any { return cap(q.items) }))
+	for _, key := range []string{"enqueued_records", "invalid_records", "rejected_requests", "flushed_batches", "flushed_records", "dropped_records", "flush_errors", "split_batches"} {
+		q.stats.Set(key, new(expvar.Int))
+	}
+	q.stats.Set("last_flush_latency_seconds", new(expvar.Float))
+	q.stats.Set("flush_latency_seconds_total", new(expvar.Float))
+	pipelineStats.Set(name, q.stats)
+
+	return q
+}
+
+// item is a queued request and the tenant it was received for.
+type item[T any] struct {
+	tenant string
+	data   T
+}
+
+// enqueue adds a request of the tenant in ctx to the queue without blocking.
+// It fails with a ResourceExhausted status if the queue is full. With a
+// queue size of 0, the request is written instead.
+func (q *queue[T]) enqueue(ctx context.Context, data T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return errShuttingDown
+	}
+
+	// Count before sending, a worker may empty data right after.
+	size := q.count(data)
+	if q.cfg.QueueSize == 0 {
+		return q.writeNow(ctx, data, size)
+	}
+
+	select {
+	case q.items <- item[T]{tenant: tenant.FromContext(ctx), data: data}:
+		q.stats.Add("enqueued_records", int64(size))
+		return nil
+	default:
+		q.stats.Add("rejected_requests", 1)
+		return q.errQueueFull()
+	}
+}
+
+// errQueueFull is a ResourceExhausted status with a RetryInfo detail, telling
+// the client to back off for about one flush interval.
+// Ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#otlpgrpc-throttling
+func (q *queue[T]) errQueueFull() error {
+	retryDelay := max(q.cfg.FlushInterval, time.Second)
+
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("%s queue is full, retry later", q.name))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// start runs the flush workers until the queue is closed. Without a queue,
+// requests are written by enqueue and there are none.
+func (q *queue[T]) start(ctx context.Context) {
+	if q.cfg.QueueSize == 0 {
+		return
+	}
+	for range q.cfg.Workers {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.run(ctx)
+		}()
+	}
+}
+
+// close stops accepting requests and waits until the workers have written
+// everything that was queued.
+func (q *queue[T]) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// batch is the requests of one tenant merged to be written together.
+type batch[T any] struct {
+	data T
+	// The merged requests, in the order of their entries in data.
+	requests []batchRequest
+	size     int
+}
+
+type batchRequest struct {
+	resources, records int
+}
+
+// run collects requests into one batch per tenant and writes them once they
+// hold BatchSize records together or FlushInterval has passed.
+func (q *queue[T]) run(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make(map[string]*batch[T])
+	size := 0
+
+	flush := func() {
+		for tenantID, b := range batches {
+			q.write(tenant.NewContext(ctx, tenantID), b)
+		}
+		clear(batches)
+		size = 0
+	}
+
+	for {
+		select {
+		case it, ok := <-q.items:
+			if !ok {
+				flush()
+				return
+			}
+
+			b, ok := batches[it.tenant]
+			if !ok {
+				b = &batch[T]{data: q.newBatch()}
+				batches[it.tenant] = b
+			}
+			n := q.count(it.data)
+			b.requests = append(b.requests, batchRequest{resources: q.resources(it.data), records: n})
+			b.size += n
+			q.moveTo(it.data, b.data)
+			size += n
+
+			if size >= q.cfg.BatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write writes a batch. Requests were acknowledged once queued, records that
+// cannot be written are dropped and counted.
+//
+// A permanent error comes from the data of a request rather than from the
+// database. The requests of the batch are then written one by one, so that
+// the others are not dropped with it.
+func (q *queue[T]) write(ctx context.Context, b *batch[T]) {
+	defer q.observeLatency(time.Now())
+
+	err := q.flushWithRetries(ctx, b.data)
+	if err == nil {
+		q.stats.Add("flushed_batches", 1)
+		q.stats.Add("flushed_records", int64(b.size))
+		return
+	}
+	if !consumererror.IsPermanent(err) || len(b.requests) == 1 {
+		q.drop(b.size, err)
+		return
+	}
+
+	q.stats.Add("split_batches", 1)
+	from := 0
+	for _, r := range b.requests {
+		data := q.newBatch()
+		q.moveResources(b.data, data, from, from+r.resources)
+		from += r.resources
+
+		if err := q.flushWithRetries(ctx, data); err != nil {
+			q.drop(r.records, err)
+			continue
+		}
+		q.stats.Add("flushed_records", int64(r.records))
+	}
+}
+
+// writeNow writes a request of the tenant in ctx without queuing it. The
+// error is not retried but returned, the client knows from it whether to
+// send the request again.
+func (q *queue[T]) writeNow(ctx context.Context, data T, records int) error {
+	defer q.observeLatency(time.Now())
+
+	if err := q.flush(ctx, data); err != nil {
+		q.stats.Add("flush_errors", 1)
+		return err
+	}
+	q.stats.Add("flushed_batches", 1)
+	q.stats.Add("flushed_records", int64(records))
+	return nil
+}
+
+func (q *queue[T]) observeLatency(start time.Time) {
+	latency := time.Since(start).Seconds()
+	q.stats.Get("last_flush_latency_seconds").(*expvar.Float).Set(latency)
+	q.stats.AddFloat("flush_latency_seconds_total", latency)
+}
+
+// flushWithRetries writes data, trying again after a retryable error.
+func (q *queue[T]) flushWithRetries(ctx context.Context, data T) error {
+	var err error
+	for attempt := 1; attempt <= flushAttempts; attempt++ {
+		err = q.flush(ctx, data)
+		if err == nil || consumererror.IsPermanent(err) || attempt == flushAttempts {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+func (q *queue[T]) drop(records int, err error) {
+	log.Printf("Failed to write %d %s to db, dropping them: %v", records, q.name, err)
+	q.stats.Add("flush_errors", 1)
+	q.stats.Add("dropped_records", int64(records))
+}
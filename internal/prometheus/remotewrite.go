@@ -0,0 +1,252 @@
+// Package prometheus translates Prometheus remote write requests to OTLP
+// metrics.
+//
+// Only the messages of remote write 1.0 are decoded, with native histograms.
+// The protobuf is decoded by hand so that the Prometheus module is not
+// needed for a handful of messages.
+// Ref: https://prometheus.io/docs/specs/prw/remote_write_spec/
+package prometheus
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire"
+)
+
+// WriteRequest is prometheus.WriteRequest.
+type WriteRequest struct {
+	Timeseries []TimeSeries
+	Metadata   []MetricMetadata
+}
+
+// TimeSeries is prometheus.TimeSeries. Exemplars are not decoded.
+type TimeSeries struct {
+	Labels     []Label
+	Samples    []Sample
+	Histograms []Histogram
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value float64
+	// Milliseconds since the epoch.
+	Timestamp int64
+}
+
+// MetricType is prometheus.MetricMetadata.MetricType.
+type MetricType int32
+
+const (
+	MetricTypeUnknown        MetricType = 0
+	MetricTypeCounter        MetricType = 1
+	MetricTypeGauge          MetricType = 2
+	MetricTypeHistogram      MetricType = 3
+	MetricTypeGaugeHistogram MetricType = 4
+	MetricTypeSummary        MetricType = 5
+	MetricTypeInfo           MetricType = 6
+	MetricTypeStateset       MetricType = 7
+)
+
+type MetricMetadata struct {
+	Type             MetricType
+	MetricFamilyName string
+	Help             string
+	Unit             string
+}
+
+// Histogram is a native histogram, prometheus.Histogram. Integer histograms
+// set the *Int fields and Deltas, float histograms set the *Float fields and
+// Counts.
+type Histogram struct {
+	CountInt       uint64
+	CountFloat     float64
+	Sum            float64
+	Schema         int32
+	ZeroThreshold  float64
+	ZeroCountInt   uint64
+	ZeroCountFloat float64
+	NegativeSpans  []BucketSpan
+	NegativeDeltas []int64
+	NegativeCounts []float64
+	PositiveSpans  []BucketSpan
+	PositiveDeltas []int64
+	PositiveCounts []float64
+	ResetHint      int32
+	// Milliseconds since the epoch.
+	Timestamp int64
+}
+
+// IsFloat reports whether h is a float histogram.
+func (h Histogram) IsFloat() bool {
+	return h.CountFloat != 0 || h.ZeroCountFloat != 0 || len(h.NegativeCounts) > 0 || len(h.PositiveCounts) > 0
+}
+
+// BucketSpan is a run of consecutive buckets. The offset of the first span
+// is the index of its first bucket, the offset of later spans is the gap to
+// the previous span.
+type BucketSpan struct {
+	Offset int32
+	Length uint32
+}
+
+// DecodeWriteRequest decodes an uncompressed remote write request.
+func DecodeWriteRequest(buf []byte) (WriteRequest, error) {
+	var req WriteRequest
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			ts, err := decodeTimeSeries(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("timeseries: %w", err)
+			}
+			req.Timeseries = append(req.Timeseries, ts)
+		case 3:
+			md, err := decodeMetricMetadata(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("metadata: %w", err)
+			}
+			req.Metadata = append(req.Metadata, md)
+		}
+		return nil
+	})
+	return req, err
+}
+
+func decodeTimeSeries(buf []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			l, err := decodeLabel(f.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			s, err := decodeSample(f.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		case 4:
+			h, err := decodeHistogram(f.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Histograms = append(ts.Histograms, h)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(buf []byte) (Label, error) {
+	var l Label
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			l.Name = f.String()
+		case 2:
+			l.Value = f.String()
+		}
+		return nil
+	})
+	return l, err
+}
+
+func decodeSample(buf []byte) (Sample, error) {
+	var s Sample
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			s.Value = f.Double()
+		case 2:
+			s.Timestamp = int64(f.Num)
+		}
+		return nil
+	})
+	return s, err
+}
+
+func decodeMetricMetadata(buf []byte) (MetricMetadata, error) {
+	var md MetricMetadata
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			md.Type = MetricType(f.Num)
+		case 2:
+			md.MetricFamilyName = f.String()
+		case 4:
+			md.Help = f.String()
+		case 5:
+			md.Unit = f.String()
+		}
+		return nil
+	})
+	return md, err
+}
+
+func decodeHistogram(buf []byte) (Histogram, error) {
+	var h Histogram
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		var err error
+		switch num {
+		case 1:
+			h.CountInt = f.Num
+		case 2:
+			h.CountFloat = f.Double()
+		case 3:
+			h.Sum = f.Double()
+		case 4:
+			h.Schema = int32(f.Sint64())
+		case 5:
+			h.ZeroThreshold = f.Double()
+		case 6:
+			h.ZeroCountInt = f.Num
+		case 7:
+			h.ZeroCountFloat = f.Double()
+		case 8:
+			var span BucketSpan
+			span, err = decodeBucketSpan(f.Bytes)
+			h.NegativeSpans = append(h.NegativeSpans, span)
+		case 9:
+			h.NegativeDeltas, err = f.AppendSint64s(h.NegativeDeltas)
+		case 10:
+			h.NegativeCounts, err = f.AppendDoubles(h.NegativeCounts)
+		case 11:
+			var span BucketSpan
+			span, err = decodeBucketSpan(f.Bytes)
+			h.PositiveSpans = append(h.PositiveSpans, span)
+		case 12:
+			h.PositiveDeltas, err = f.AppendSint64s(h.PositiveDeltas)
+		case 13:
+			h.PositiveCounts, err = f.AppendDoubles(h.PositiveCounts)
+		case 14:
+			h.ResetHint = int32(f.Num)
+		case 15:
+			h.Timestamp = int64(f.Num)
+		}
+		return err
+	})
+	return h, err
+}
+
+func decodeBucketSpan(buf []byte) (BucketSpan, error) {
+	var span BucketSpan
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			span.Offset = int32(f.Sint64())
+		case 2:
+			span.Length = uint32(f.Num)
+		}
+		return nil
+	})
+	return span, err
+}
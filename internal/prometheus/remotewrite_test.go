@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire/pbwiretest"
+)
+
+// The encode functions write the messages the way Prometheus does, with
+// packed repeated fields.
+
+func encodeSpans(b []byte, num protowire.Number, spans []BucketSpan) []byte {
+	for _, span := range spans {
+		var msg []byte
+		msg = pbwiretest.AppendVarint(msg, 1, protowire.EncodeZigZag(int64(span.Offset)))
+		msg = pbwiretest.AppendVarint(msg, 2, uint64(span.Length))
+		b = pbwiretest.AppendBytes(b, num, msg)
+	}
+	return b
+}
+
+func encodeWriteRequest(req WriteRequest) []byte {
+	var b []byte
+	for _, ts := range req.Timeseries {
+		var series []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = pbwiretest.AppendBytes(label, 1, []byte(l.Name))
+			label = pbwiretest.AppendBytes(label, 2, []byte(l.Value))
+			series = pbwiretest.AppendBytes(series, 1, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = pbwiretest.AppendDouble(sample, 1, s.Value)
+			sample = pbwiretest.AppendVarint(sample, 2, uint64(s.Timestamp))
+			series = pbwiretest.AppendBytes(series, 2, sample)
+		}
+		for _, h := range ts.Histograms {
+			var hist []byte
+			hist = pbwiretest.AppendVarint(hist, 1, h.CountInt)
+			hist = pbwiretest.AppendDouble(hist, 3, h.Sum)
+			hist = pbwiretest.AppendVarint(hist, 4, protowire.EncodeZigZag(int64(h.Schema)))
+			hist = pbwiretest.AppendDouble(hist, 5, h.ZeroThreshold)
+			hist = pbwiretest.AppendVarint(hist, 6, h.ZeroCountInt)
+			hist = encodeSpans(hist, 11, h.PositiveSpans)
+			var deltas []byte
+			for _, d := range h.PositiveDeltas {
+				deltas = protowire.AppendVarint(deltas, protowire.EncodeZigZag(d))
+			}
+			hist = pbwiretest.AppendBytes(hist, 12, deltas)
+			hist = pbwiretest.AppendVarint(hist, 15, uint64(h.Timestamp))
+			series = pbwiretest.AppendBytes(series, 4, hist)
+		}
+		b = pbwiretest.AppendBytes(b, 1, series)
+	}
+	for _, md := range req.Metadata {
+		var msg []byte
+		msg = pbwiretest.AppendVarint(msg, 1, uint64(md.Type))
+		msg = pbwiretest.AppendBytes(msg, 2, []byte(md.MetricFamilyName))
+		msg = pbwiretest.AppendBytes(msg, 4, []byte(md.Help))
+		msg = pbwiretest.AppendBytes(msg, 5, []byte(md.Unit))
+		b = pbwiretest.AppendBytes(b, 3, msg)
+	}
+	return b
+}
+
+func TestDecodeWriteRequest(t *testing.T) {
+	want := WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels:  []Label{{"__name__", "up"}, {"job", "api"}},
+				Samples: []Sample{{Value: 1, Timestamp: 1700000000000}, {Value: 0, Timestamp: 1700000015000}},
+			},
+			{
+				Labels: []Label{{"__name__", "latency_seconds"}},
+				Histograms: []Histogram{{
+					CountInt:       6,
+					Sum:            1.5,
+					Schema:         -1,
+					ZeroThreshold:  0.001,
+					ZeroCountInt:   1,
+					PositiveSpans:  []BucketSpan{{Offset: -2, Length: 2}, {Offset: 1, Length: 1}},
+					PositiveDeltas: []int64{2, -1, 1},
+					Timestamp:      1700000000000,
+				}},
+			},
+		},
+		Metadata: []MetricMetadata{{Type: MetricTypeGauge, MetricFamilyName: "up", Help: "Target is up.", Unit: ""}},
+	}
+
+	got, err := DecodeWriteRequest(encodeWriteRequest(want))
+	if err != nil {
+		t.Fatalf("DecodeWriteRequest failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeWriteRequest() = %+v, expected %+v", got, want)
+	}
+}
+
+func TestDecodeWriteRequestTruncated(t *testing.T) {
+	buf := encodeWriteRequest(WriteRequest{Timeseries: []TimeSeries{{Labels: []Label{{"__name__", "up"}}}}})
+	if _, err := DecodeWriteRequest(buf[:len(buf)-2]); err == nil {
+		t.Error("Expected an error for a truncated request")
+	}
+}
@@ -0,0 +1,396 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Labels with a meaning in the OTel compatibility spec.
+// Ref: https://opentelemetry.io/docs/specs/otel/compatibility/prometheus_and_openmetrics/
+const (
+	labelMetricName   = "__name__"
+	labelJob          = "job"
+	labelInstance     = "instance"
+	labelScopeName    = "otel_scope_name"
+	labelScopeVersion = "otel_scope_version"
+
+	// Series of target_info hold the resource attributes of a target.
+	targetInfoMetric = "target_info"
+)
+
+// staleNaN marks a series as stale, it is not a sample.
+const staleNaN = 0x7ff0000000000002
+
+// Native histograms with more buckets, including the empty buckets between
+// spans, are rejected.
+const maxHistogramBuckets = 1 << 14
+
+// Schema of native histograms with custom bucket boundaries, which have no
+// exponential equivalent.
+const customBucketsSchema = -53
+
+var errMissingMetricName = errors.New("series without a metric name")
+
+// ToMetrics translates req to OTLP metrics:
+//
+//   - job and instance become the service.namespace, service.name and
+//     service.instance.id resource attributes, the labels of target_info
+//     series are added to the resource of the same job and instance.
+//   - otel_scope_name and otel_scope_version become the scope.
+//   - Counters, and the _total, _count, _sum and _bucket series of counters,
+//     histograms and summaries, become monotonic cumulative sums. Every other
+//     series becomes a gauge. Without metadata, only _total series are
+//     counters.
+//   - Native histograms become exponential histograms.
+//
+// Stale markers are dropped. The request fails if a series has no metric
+// name or a native histogram cannot be converted.
+func ToMetrics(req WriteRequest) (pmetric.Metrics, error) {
+	t := translator{
+		md:        pmetric.NewMetrics(),
+		metadata:  make(map[string]MetricMetadata, len(req.Metadata)),
+		resources: map[[2]string]pmetric.ResourceMetrics{},
+		scopes:    map[scopeKey]pmetric.ScopeMetrics{},
+		metrics:   map[metricKey]pmetric.Metric{},
+	}
+	for _, md := range req.Metadata {
+		t.metadata[md.MetricFamilyName] = md
+	}
+
+	for _, ts := range req.Timeseries {
+		if err := t.addSeries(ts); err != nil {
+			return pmetric.Metrics{}, err
+		}
+	}
+
+	// Drop what only held stale markers or target_info.
+	t.md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
+			sm.Metrics().RemoveIf(func(m pmetric.Metric) bool {
+				return isEmpty(m)
+			})
+			return sm.Metrics().Len() == 0
+		})
+		return rm.ScopeMetrics().Len() == 0
+	})
+
+	return t.md, nil
+}
+
+type scopeKey struct {
+	resource [2]string
+	name     string
+	version  string
+}
+
+type metricKey struct {
+	scope scopeKey
+	name  string
+	typ   pmetric.MetricType
+}
+
+type translator struct {
+	md       pmetric.Metrics
+	metadata map[string]MetricMetadata
+
+	// By job and instance.
+	resources map[[2]string]pmetric.ResourceMetrics
+	scopes    map[scopeKey]pmetric.ScopeMetrics
+	metrics   map[metricKey]pmetric.Metric
+}
+
+func (t *translator) addSeries(ts TimeSeries) error {
+	var name, job, instance, scopeName, scopeVersion string
+	attrs := pcommon.NewMap()
+	for _, l := range ts.Labels {
+		switch l.Name {
+		case labelMetricName:
+			name = l.Value
+		case labelJob:
+			job = l.Value
+		case labelInstance:
+			instance = l.Value
+		case labelScopeName:
+			scopeName = l.Value
+		case labelScopeVersion:
+			scopeVersion = l.Value
+		default:
+			attrs.PutStr(l.Name, l.Value)
+		}
+	}
+	if name == "" {
+		return errMissingMetricName
+	}
+
+	rm := t.resource(job, instance)
+	if name == targetInfoMetric {
+		attrs.Range(func(k string, v pcommon.Value) bool {
+			v.CopyTo(rm.Resource().Attributes().PutEmpty(k))
+			return true
+		})
+		return nil
+	}
+
+	scope := scopeKey{resource: [2]string{job, instance}, name: scopeName, version: scopeVersion}
+
+	if len(ts.Samples) > 0 {
+		family, known := t.family(name)
+		if isCounter(name, family, known) {
+			sum := t.metric(scope, name, pmetric.MetricTypeSum).Sum()
+			for _, s := range ts.Samples {
+				if math.Float64bits(s.Value) == staleNaN {
+					continue
+				}
+				newNumberDataPoint(sum.DataPoints(), s, attrs)
+			}
+		} else {
+			gauge := t.metric(scope, name, pmetric.MetricTypeGauge).Gauge()
+			for _, s := range ts.Samples {
+				if math.Float64bits(s.Value) == staleNaN {
+					continue
+				}
+				newNumberDataPoint(gauge.DataPoints(), s, attrs)
+			}
+		}
+	}
+
+	if len(ts.Histograms) > 0 {
+		histogram := t.metric(scope, name, pmetric.MetricTypeExponentialHistogram).ExponentialHistogram()
+		for _, h := range ts.Histograms {
+			if math.Float64bits(h.Sum) == staleNaN {
+				continue
+			}
+			if err := newExponentialHistogramDataPoint(histogram.DataPoints(), h, attrs); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resource returns the resource of job and instance, creating it on first
+// use. A job "namespace/name" is split into service.namespace and
+// service.name.
+func (t *translator) resource(job, instance string) pmetric.ResourceMetrics {
+	key := [2]string{job, instance}
+	if rm, ok := t.resources[key]; ok {
+		return rm
+	}
+
+	rm := t.md.ResourceMetrics().AppendEmpty()
+	attrs := rm.Resource().Attributes()
+	if namespace, name, ok := strings.Cut(job, "/"); ok {
+		attrs.PutStr("service.namespace", namespace)
+		attrs.PutStr("service.name", name)
+	} else if job != "" {
+		attrs.PutStr("service.name", job)
+	}
+	if instance != "" {
+		attrs.PutStr("service.instance.id", instance)
+	}
+
+	t.resources[key] = rm
+	return rm
+}
+
+func (t *translator) metric(scope scopeKey, name string, typ pmetric.MetricType) pmetric.Metric {
+	key := metricKey{scope: scope, name: name, typ: typ}
+	if m, ok := t.metrics[key]; ok {
+		return m
+	}
+
+	sm, ok := t.scopes[scope]
+	if !ok {
+		sm = t.resource(scope.resource[0], scope.resource[1]).ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(scope.name)
+		sm.Scope().SetVersion(scope.version)
+		t.scopes[scope] = sm
+	}
+
+	m := sm.Metrics().AppendEmpty()
+	m.SetName(name)
+	if family, ok := t.family(name); ok {
+		m.SetDescription(family.Help)
+		m.SetUnit(family.Unit)
+	}
+
+	switch typ {
+	case pmetric.MetricTypeSum:
+		sum := m.SetEmptySum()
+		sum.SetIsMonotonic(true)
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	case pmetric.MetricTypeGauge:
+		m.SetEmptyGauge()
+	case pmetric.MetricTypeExponentialHistogram:
+		// Gauge histograms (reset hint GAUGE) have no OTLP equivalent, they
+		// are stored as cumulative too.
+		m.SetEmptyExponentialHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	}
+
+	t.metrics[key] = m
+	return m
+}
+
+// Suffixes of the series of a metric family.
+var familySuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// family returns the metadata of the family of the series name.
+func (t *translator) family(name string) (MetricMetadata, bool) {
+	if md, ok := t.metadata[name]; ok {
+		return md, true
+	}
+	for _, suffix := range familySuffixes {
+		if family, ok := strings.CutSuffix(name, suffix); ok {
+			if md, ok := t.metadata[family]; ok {
+				return md, true
+			}
+		}
+	}
+	return MetricMetadata{}, false
+}
+
+func isCounter(name string, family MetricMetadata, known bool) bool {
+	if !known {
+		return strings.HasSuffix(name, "_total")
+	}
+
+	switch family.Type {
+	case MetricTypeCounter:
+		return true
+	case MetricTypeHistogram, MetricTypeSummary:
+		// The quantile series of a summary are gauges.
+		return name != family.MetricFamilyName
+	default:
+		return false
+	}
+}
+
+func isEmpty(m pmetric.Metric) bool {
+	switch m.Type() {
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints().Len() == 0
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints().Len() == 0
+	case pmetric.MetricTypeExponentialHistogram:
+		return m.ExponentialHistogram().DataPoints().Len() == 0
+	default:
+		return true
+	}
+}
+
+func newNumberDataPoint(dps pmetric.NumberDataPointSlice, s Sample, attrs pcommon.Map) {
+	dp := dps.AppendEmpty()
+	dp.SetTimestamp(millisToTimestamp(s.Timestamp))
+	dp.SetDoubleValue(s.Value)
+	attrs.CopyTo(dp.Attributes())
+}
+
+// newExponentialHistogramDataPoint converts a native histogram. Both use
+// base 2^(2^-schema) buckets, Prometheus bucket i holds (base^(i-1), base^i]
+// which is exponential bucket i-1.
+func newExponentialHistogramDataPoint(dps pmetric.ExponentialHistogramDataPointSlice, h Histogram, attrs pcommon.Map) error {
+	if h.Schema == customBucketsSchema {
+		return errors.New("native histograms with custom buckets are not supported")
+	}
+
+	dp := dps.AppendEmpty()
+	dp.SetTimestamp(millisToTimestamp(h.Timestamp))
+	dp.SetScale(h.Schema)
+	dp.SetSum(h.Sum)
+	dp.SetZeroThreshold(h.ZeroThreshold)
+	attrs.CopyTo(dp.Attributes())
+
+	if h.IsFloat() {
+		dp.SetCount(roundCount(h.CountFloat))
+		dp.SetZeroCount(roundCount(h.ZeroCountFloat))
+		if err := setFloatBuckets(dp.Positive(), h.PositiveSpans, h.PositiveCounts); err != nil {
+			return err
+		}
+		return setFloatBuckets(dp.Negative(), h.NegativeSpans, h.NegativeCounts)
+	}
+
+	dp.SetCount(h.CountInt)
+	dp.SetZeroCount(h.ZeroCountInt)
+	if err := setDeltaBuckets(dp.Positive(), h.PositiveSpans, h.PositiveDeltas); err != nil {
+		return err
+	}
+	return setDeltaBuckets(dp.Negative(), h.NegativeSpans, h.NegativeDeltas)
+}
+
+// setDeltaBuckets sets the buckets of an integer histogram, whose counts
+// are each encoded as the difference to the previous bucket.
+func setDeltaBuckets(buckets pmetric.ExponentialHistogramDataPointBuckets, spans []BucketSpan, deltas []int64) error {
+	var count int64
+	counts := make([]float64, len(deltas))
+	for i, delta := range deltas {
+		count += delta
+		counts[i] = float64(count)
+	}
+	return setFloatBuckets(buckets, spans, counts)
+}
+
+// setFloatBuckets expands the sparse buckets described by spans into the
+// dense buckets of an exponential histogram.
+func setFloatBuckets(buckets pmetric.ExponentialHistogramDataPointBuckets, spans []BucketSpan, counts []float64) error {
+	if len(spans) == 0 {
+		if len(counts) > 0 {
+			return errors.New("histogram buckets without spans")
+		}
+		return nil
+	}
+
+	dense := make([]uint64, 0, len(counts))
+	index := int64(spans[0].Offset)
+	first := index
+	next := 0
+	for i, span := range spans {
+		if i > 0 {
+			if span.Offset < 0 {
+				return errors.New("histogram spans out of order")
+			}
+			index += int64(span.Offset)
+		}
+		for range span.Length {
+			if next >= len(counts) {
+				return errors.New("histogram spans longer than bucket counts")
+			}
+			if index-first >= maxHistogramBuckets {
+				return fmt.Errorf("histogram with more than %d buckets", maxHistogramBuckets)
+			}
+			for int64(len(dense)) < index-first {
+				dense = append(dense, 0)
+			}
+			dense = append(dense, roundCount(counts[next]))
+			next++
+			index++
+		}
+	}
+	if next != len(counts) {
+		return errors.New("histogram bucket counts longer than spans")
+	}
+
+	// OTel buckets start one index below Prometheus buckets.
+	if first-1 < math.MinInt32 {
+		return fmt.Errorf("histogram bucket offset %d out of range", first)
+	}
+	buckets.SetOffset(int32(first - 1))
+	buckets.BucketCounts().FromRaw(dense)
+	return nil
+}
+
+func roundCount(count float64) uint64 {
+	if count <= 0 || math.IsNaN(count) {
+		return 0
+	}
+	return uint64(math.Round(count))
+}
+
+func millisToTimestamp(ms int64) pcommon.Timestamp {
+	return pcommon.Timestamp(ms * 1e6)
+}
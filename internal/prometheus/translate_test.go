@@ -0,0 +1,130 @@
+package prometheus
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestToMetrics(t *testing.T) {
+	req := WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels:  []Label{{"__name__", "http_requests_total"}, {"job", "shop/api"}, {"instance", "10.0.0.1:9090"}, {"code", "200"}},
+				Samples: []Sample{{Value: 10, Timestamp: 1000}, {Value: math.Float64frombits(staleNaN), Timestamp: 2000}},
+			},
+			{
+				Labels:  []Label{{"__name__", "memory_bytes"}, {"job", "shop/api"}, {"instance", "10.0.0.1:9090"}},
+				Samples: []Sample{{Value: 512, Timestamp: 1000}},
+			},
+			{
+				Labels:  []Label{{"__name__", "target_info"}, {"job", "shop/api"}, {"instance", "10.0.0.1:9090"}, {"region", "eu"}},
+				Samples: []Sample{{Value: 1, Timestamp: 1000}},
+			},
+			{
+				Labels:  []Label{{"__name__", "queue_wait_seconds_count"}, {"job", "worker"}},
+				Samples: []Sample{{Value: 3, Timestamp: 1000}},
+			},
+			{
+				Labels: []Label{{"__name__", "latency_seconds"}, {"job", "worker"}},
+				Histograms: []Histogram{{
+					CountInt:       6,
+					Sum:            1.5,
+					Schema:         0,
+					ZeroCountInt:   1,
+					PositiveSpans:  []BucketSpan{{Offset: -1, Length: 2}, {Offset: 1, Length: 1}},
+					PositiveDeltas: []int64{2, -1, 1},
+					Timestamp:      1000,
+				}},
+			},
+		},
+		Metadata: []MetricMetadata{
+			{Type: MetricTypeHistogram, MetricFamilyName: "queue_wait_seconds", Help: "Time spent queued.", Unit: "seconds"},
+		},
+	}
+
+	md, err := ToMetrics(req)
+	if err != nil {
+		t.Fatalf("ToMetrics failed: %v", err)
+	}
+	if md.ResourceMetrics().Len() != 2 {
+		t.Fatalf("Expected 2 resources, got %d", md.ResourceMetrics().Len())
+	}
+
+	api := md.ResourceMetrics().At(0)
+	wantAttrs := map[string]any{
+		"service.namespace":   "shop",
+		"service.name":        "api",
+		"service.instance.id": "10.0.0.1:9090",
+		"region":              "eu",
+	}
+	if got := api.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("Expected resource attributes %v, got %v", wantAttrs, got)
+	}
+
+	metrics := api.ScopeMetrics().At(0).Metrics()
+	if metrics.Len() != 2 {
+		t.Fatalf("Expected 2 metrics, target_info is not one, got %d", metrics.Len())
+	}
+	requests := metrics.At(0)
+	if requests.Type() != pmetric.MetricTypeSum || !requests.Sum().IsMonotonic() {
+		t.Errorf("Expected http_requests_total to be a monotonic sum, got %v", requests.Type())
+	}
+	if n := requests.Sum().DataPoints().Len(); n != 1 {
+		t.Errorf("Expected the stale marker to be dropped, got %d data points", n)
+	}
+	if code, _ := requests.Sum().DataPoints().At(0).Attributes().Get("code"); code.Str() != "200" {
+		t.Errorf("Expected code attribute, got %v", requests.Sum().DataPoints().At(0).Attributes().AsRaw())
+	}
+	if metrics.At(1).Type() != pmetric.MetricTypeGauge {
+		t.Errorf("Expected memory_bytes to be a gauge, got %v", metrics.At(1).Type())
+	}
+
+	worker := md.ResourceMetrics().At(1).ScopeMetrics().At(0).Metrics()
+	count := worker.At(0)
+	if count.Type() != pmetric.MetricTypeSum || count.Unit() != "seconds" || count.Description() != "Time spent queued." {
+		t.Errorf("Expected queue_wait_seconds_count to be a sum with the family metadata, got %v %q %q", count.Type(), count.Unit(), count.Description())
+	}
+
+	hist := worker.At(1)
+	if hist.Type() != pmetric.MetricTypeExponentialHistogram {
+		t.Fatalf("Expected an exponential histogram, got %v", hist.Type())
+	}
+	dp := hist.ExponentialHistogram().DataPoints().At(0)
+	if dp.Count() != 6 || dp.ZeroCount() != 1 || dp.Scale() != 0 {
+		t.Errorf("Unexpected data point: count %d zero count %d scale %d", dp.Count(), dp.ZeroCount(), dp.Scale())
+	}
+	// Prometheus buckets -1, 0 and 2 are exponential buckets -2, -1 and 1.
+	if offset := dp.Positive().Offset(); offset != -2 {
+		t.Errorf("Expected offset -2, got %d", offset)
+	}
+	if got := dp.Positive().BucketCounts().AsRaw(); !reflect.DeepEqual(got, []uint64{2, 1, 0, 2}) {
+		t.Errorf("Expected bucket counts [2 1 0 2], got %v", got)
+	}
+}
+
+func TestToMetricsErrors(t *testing.T) {
+	for name, ts := range map[string]TimeSeries{
+		"no metric name": {
+			Samples: []Sample{{Value: 1}},
+		},
+		"custom buckets": {
+			Labels:     []Label{{"__name__", "h"}},
+			Histograms: []Histogram{{Schema: customBucketsSchema}},
+		},
+		"spans longer than deltas": {
+			Labels:     []Label{{"__name__", "h"}},
+			Histograms: []Histogram{{PositiveSpans: []BucketSpan{{Length: 3}}, PositiveDeltas: []int64{1}}},
+		},
+		"offset out of range": {
+			Labels:     []Label{{"__name__", "h"}},
+			Histograms: []Histogram{{PositiveSpans: []BucketSpan{{Offset: math.MinInt32, Length: 1}}, PositiveDeltas: []int64{1}}},
+		},
+	} {
+		if _, err := ToMetrics(WriteRequest{Timeseries: []TimeSeries{ts}}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package ratelimit limits the records and bytes ingested per second for
+// each service, tenant or client, so that one of them cannot flood the
+// tables and starve the others.
+package ratelimit
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// Key is what requests are limited by.
+type Key string
+
+const (
+	// KeyService limits the records of each service.name resource
+	// attribute, requests mixing services are counted against each.
+	KeyService Key = "service.name"
+	// KeyTenant limits the requests of each tenant.
+	KeyTenant Key = "tenant"
+	// KeyClient limits the requests of each client IP address.
+	KeyClient Key = "client"
+)
+
+const DefaultKey = KeyService
+
+// Throttled requests, served on /debug/vars.
+var rateLimitStats = expvar.NewMap("ratelimit")
+
+type Config struct {
+	Key Key
+	// Records accepted per second and key, zero for no limit.
+	RecordsPerSecond float64
+	// Bytes accepted per second and key, as encoded in OTLP protobuf, zero
+	// for no limit.
+	BytesPerSecond float64
+}
+
+// Limiter keeps a token bucket for the records and one for the bytes of each
+// key. A nil Limiter accepts every request.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*keyBuckets
+	lastSweep time.Time
+}
+
+type keyBuckets struct {
+	records, bytes bucket
+}
+
+// Keys idle for longer than this have full buckets, they are forgotten.
+const sweepInterval = time.Minute
+
+// New returns the limiter of cfg, nil if no rate is set.
+func New(cfg Config) (*Limiter, error) {
+	switch cfg.Key {
+	case KeyService, KeyTenant, KeyClient:
+	default:
+		return nil, fmt.Errorf("invalid rate limit key %q, expected one of %s, %s, %s", cfg.Key, KeyService, KeyTenant, KeyClient)
+	}
+	if cfg.RecordsPerSecond < 0 || cfg.BytesPerSecond < 0 {
+		return nil, fmt.Errorf("invalid rate limit config: %+v", cfg)
+	}
+	if cfg.RecordsPerSecond == 0 && cfg.BytesPerSecond == 0 {
+		return nil, nil
+	}
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: map[string]*keyBuckets{},
+	}, nil
+}
+
+// usage is what a request takes from the buckets of a key.
+type usage struct {
+	records, bytes int
+}
+
+type usages map[string]usage
+
+// add counts the records and bytes of a resource against its service.
+func (u usages) add(resource pcommon.Resource, records, bytes int) {
+	key := serviceName(resource)
+	u[key] = usage{u[key].records + records, u[key].bytes + bytes}
+}
+
+// bucket holds up to one second of its rate. A request taking more than that
+// is accepted once the bucket is full and leaves it in debt, so that the
+// rate still holds on average.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, now time.Time) bucket {
+	return bucket{tokens: rate, last: now}
+}
+
+func (b *bucket) refill(rate float64, now time.Time) {
+	b.tokens = min(rate, b.tokens+rate*now.Sub(b.last).Seconds())
+	b.last = now
+}
+
+// wait returns how long until n tokens can be taken, zero if they can be
+// now. A zero rate never waits.
+func (b *bucket) wait(rate float64, n int) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	need := min(float64(n), rate)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *bucket) take(rate float64, n int) {
+	if rate > 0 {
+		b.tokens -= float64(n)
+	}
+}
+
+// allow takes the usage of each key from its buckets, or nothing if one of
+// them has not enough tokens left.
+func (l *Limiter) allow(byKey usages) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	var (
+		wait      time.Duration
+		throttled string
+	)
+	for key, u := range byKey {
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &keyBuckets{
+				records: newBucket(l.cfg.RecordsPerSecond, now),
+				bytes:   newBucket(l.cfg.BytesPerSecond, now),
+			}
+			l.buckets[key] = b
+		}
+		b.records.refill(l.cfg.RecordsPerSecond, now)
+		b.bytes.refill(l.cfg.BytesPerSecond, now)
+
+		if w := max(b.records.wait(l.cfg.RecordsPerSecond, u.records), b.bytes.wait(l.cfg.BytesPerSecond, u.bytes)); w > wait {
+			wait = w
+			throttled = key
+		}
+	}
+	if wait > 0 {
+		rateLimitStats.Add("throttled_requests", 1)
+		return l.errThrottled(throttled, wait)
+	}
+
+	for key, u := range byKey {
+		b := l.buckets[key]
+		b.records.take(l.cfg.RecordsPerSecond, u.records)
+		b.bytes.take(l.cfg.BytesPerSecond, u.bytes)
+	}
+	return nil
+}
+
+// sweep forgets the keys whose buckets are full again.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		b.records.refill(l.cfg.RecordsPerSecond, now)
+		b.bytes.refill(l.cfg.BytesPerSecond, now)
+		if b.records.tokens >= l.cfg.RecordsPerSecond && b.bytes.tokens >= l.cfg.BytesPerSecond {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// errThrottled is a ResourceExhausted status with a RetryInfo detail, telling
+// the client when its buckets will have enough tokens. The delay is rounded
+// up to whole seconds, the unit of the Retry-After header.
+// Ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#otlpgrpc-throttling
+func (l *Limiter) errThrottled(key string, wait time.Duration) error {
+	retryDelay := time.Duration(math.Ceil(wait.Seconds())) * time.Second
+
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded for %s %q, retry in %s", l.cfg.Key, key, retryDelay))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// requestKey returns the key of the whole request in ctx, for the keys
+// other than KeyService.
+func (l *Limiter) requestKey(ctx context.Context) string {
+	if l.cfg.Key == KeyTenant {
+		return tenant.FromContext(ctx)
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	// The port changes with every connection of a client.
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
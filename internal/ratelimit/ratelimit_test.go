@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// newLogs returns logs with the given number of records per service.
+func newLogs(records map[string]int) plog.Logs {
+	ld := plog.NewLogs()
+	for service, n := range records {
+		rl := ld.ResourceLogs().AppendEmpty()
+		rl.Resource().Attributes().PutStr("service.name", service)
+		lrs := rl.ScopeLogs().AppendEmpty().LogRecords()
+		for range n {
+			lrs.AppendEmpty().Body().SetStr("x")
+		}
+	}
+	return ld
+}
+
+func newTestLimiter(t *testing.T, cfg Config) (*Limiter, *time.Time) {
+	t.Helper()
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+// retryDelay returns the RetryInfo delay of a throttled error.
+func retryDelay(t *testing.T, err error) time.Duration {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("error = %v, want ResourceExhausted", err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	t.Fatalf("error %v has no RetryInfo", err)
+	return 0
+}
+
+func TestLimiterService(t *testing.T) {
+	l, now := newTestLimiter(t, Config{Key: KeyService, RecordsPerSecond: 10})
+	ctx := context.Background()
+
+	if err := l.AllowLogs(ctx, newLogs(map[string]int{"a": 6})); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	err := l.AllowLogs(ctx, newLogs(map[string]int{"a": 6, "b": 6}))
+	if got := retryDelay(t, err); got != time.Second {
+		t.Errorf("retry delay = %v, want 1s", got)
+	}
+	// Nothing was taken from b by the throttled request.
+	if err := l.AllowLogs(ctx, newLogs(map[string]int{"b": 10})); err != nil {
+		t.Errorf("other service: %v", err)
+	}
+
+	*now = now.Add(time.Second)
+	if err := l.AllowLogs(ctx, newLogs(map[string]int{"a": 6})); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+
+	// A request over the burst is accepted by a full bucket, and leaves it
+	// in debt.
+	*now = now.Add(time.Second)
+	if err := l.AllowLogs(ctx, newLogs(map[string]int{"a": 35})); err != nil {
+		t.Fatalf("large request: %v", err)
+	}
+	err = l.AllowLogs(ctx, newLogs(map[string]int{"a": 1}))
+	if got := retryDelay(t, err); got != 3*time.Second {
+		t.Errorf("retry delay = %v, want 3s", got)
+	}
+
+	// Idle keys are forgotten once their buckets are full.
+	*now = now.Add(sweepInterval)
+	if err := l.AllowLogs(ctx, newLogs(map[string]int{"c": 1})); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d, want 1", len(l.buckets))
+	}
+}
+
+func TestLimiterRequestKeys(t *testing.T) {
+	ld := newLogs(map[string]int{"a": 1})
+	size := logsSizer.LogsSize(ld)
+
+	l, _ := newTestLimiter(t, Config{Key: KeyTenant, BytesPerSecond: float64(size)})
+	teamA := tenant.NewContext(context.Background(), "team-a")
+	if err := l.AllowLogs(teamA, ld); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AllowLogs(teamA, ld); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("same tenant: %v, want ResourceExhausted", err)
+	}
+	if err := l.AllowLogs(tenant.NewContext(context.Background(), "team-b"), ld); err != nil {
+		t.Errorf("other tenant: %v", err)
+	}
+
+	l, _ = newTestLimiter(t, Config{Key: KeyClient, RecordsPerSecond: 1})
+	client := func(addr string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))})
+	}
+	if err := l.AllowLogs(client("10.0.0.1:1234"), ld); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AllowLogs(client("10.0.0.1:5678"), ld); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("same client: %v, want ResourceExhausted", err)
+	}
+	if err := l.AllowLogs(client("10.0.0.2:1234"), ld); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if l, err := New(Config{Key: KeyService}); l != nil || err != nil {
+		t.Errorf("New() without rates = %v, %v, want nil", l, err)
+	}
+	if err := (*Limiter)(nil).AllowLogs(context.Background(), newLogs(map[string]int{"a": 1})); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+	if _, err := New(Config{Key: "host", RecordsPerSecond: 1}); err == nil {
+		t.Error("New() with an invalid key succeeded")
+	}
+}
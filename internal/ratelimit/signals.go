@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var (
+	logsSizer     plog.ProtoMarshaler
+	tracesSizer   ptrace.ProtoMarshaler
+	metricsSizer  pmetric.ProtoMarshaler
+	profilesSizer pprofile.ProtoMarshaler
+)
+
+// AllowLogs takes the log records of ld from the buckets of their keys, or
+// returns a ResourceExhausted status if they are throttled. Records are
+// counted as received, including those validation rejects afterwards.
+func (l *Limiter) AllowLogs(ctx context.Context, ld plog.Logs) error {
+	if l == nil {
+		return nil
+	}
+	if l.cfg.Key != KeyService {
+		return l.allow(usages{l.requestKey(ctx): {ld.LogRecordCount(), logsSizer.LogsSize(ld)}})
+	}
+
+	u := usages{}
+	for _, rl := range ld.ResourceLogs().All() {
+		records := 0
+		for _, sl := range rl.ScopeLogs().All() {
+			records += sl.LogRecords().Len()
+		}
+		u.add(rl.Resource(), records, logsSizer.ResourceLogsSize(rl))
+	}
+	return l.allow(u)
+}
+
+// AllowTraces is AllowLogs for the spans of td.
+func (l *Limiter) AllowTraces(ctx context.Context, td ptrace.Traces) error {
+	if l == nil {
+		return nil
+	}
+	if l.cfg.Key != KeyService {
+		return l.allow(usages{l.requestKey(ctx): {td.SpanCount(), tracesSizer.TracesSize(td)}})
+	}
+
+	u := usages{}
+	for _, rs := range td.ResourceSpans().All() {
+		records := 0
+		for _, ss := range rs.ScopeSpans().All() {
+			records += ss.Spans().Len()
+		}
+		u.add(rs.Resource(), records, tracesSizer.ResourceSpansSize(rs))
+	}
+	return l.allow(u)
+}
+
+// AllowMetrics is AllowLogs for the data points of md.
+func (l *Limiter) AllowMetrics(ctx context.Context, md pmetric.Metrics) error {
+	if l == nil {
+		return nil
+	}
+	if l.cfg.Key != KeyService {
+		return l.allow(usages{l.requestKey(ctx): {md.DataPointCount(), metricsSizer.MetricsSize(md)}})
+	}
+
+	u := usages{}
+	for _, rm := range md.ResourceMetrics().All() {
+		records := 0
+		for _, sm := range rm.ScopeMetrics().All() {
+			for _, m := range sm.Metrics().All() {
+				records += dataPointCount(m)
+			}
+		}
+		u.add(rm.Resource(), records, metricsSizer.ResourceMetricsSize(rm))
+	}
+	return l.allow(u)
+}
+
+// AllowProfiles is AllowLogs for the samples of pd.
+func (l *Limiter) AllowProfiles(ctx context.Context, pd pprofile.Profiles) error {
+	if l == nil {
+		return nil
+	}
+	if l.cfg.Key != KeyService {
+		return l.allow(usages{l.requestKey(ctx): {pd.SampleCount(), profilesSizer.ProfilesSize(pd)}})
+	}
+
+	u := usages{}
+	for _, rp := range pd.ResourceProfiles().All() {
+		records := 0
+		for _, sp := range rp.ScopeProfiles().All() {
+			for _, p := range sp.Profiles().All() {
+				records += p.Samples().Len()
+			}
+		}
+		u.add(rp.Resource(), records, profilesSizer.ResourceProfilesSize(rp))
+	}
+	return l.allow(u)
+}
+
+func dataPointCount(m pmetric.Metric) int {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return m.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return m.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return m.Summary().DataPoints().Len()
+	}
+	return 0
+}
+
+// serviceName returns the service.name of resource, empty if it has none.
+func serviceName(resource pcommon.Resource) string {
+	if v, ok := resource.Attributes().Get(string(KeyService)); ok {
+		return v.AsString()
+	}
+	return ""
+}
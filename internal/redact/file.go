@@ -0,0 +1,27 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadFile returns the Redactor of the JSON Config in path, such as:
+//
+//	{
+//	  "denied_keys": ["password", "http.request.header.authorization"],
+//	  "hashed_keys": ["user.email"],
+//	  "masks": [{"name": "card", "pattern": "\\b\\d{12}(\\d{4})\\b", "replacement": "****$1"}]
+//	}
+func LoadFile(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return New(cfg)
+}
@@ -0,0 +1,168 @@
+// Package redact removes, hashes and masks sensitive attribute values and log
+// bodies before they are stored, as they are hard to remove from the tables
+// afterwards.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"regexp"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Rules that fired, by rule, served on /debug/vars: "deny:<key>" and
+// "hash:<key>" per key, "allow" for the keys not allowed and "mask:<name>"
+// per mask.
+var redactionStats = expvar.NewMap("redaction")
+
+const defaultReplacement = "****"
+
+type Config struct {
+	// AllowedKeys, if set, are the only attributes of records kept, with
+	// HashedKeys. Resource and scope attributes identify where data comes
+	// from, they are not limited.
+	AllowedKeys []string `json:"allowed_keys"`
+	// DeniedKeys are removed from all attributes.
+	DeniedKeys []string `json:"denied_keys"`
+	// HashedKeys have their values replaced by their SHA-256 digest in hex,
+	// so that they can still be grouped by.
+	HashedKeys []string `json:"hashed_keys"`
+	// HashKey, if set, makes the digest an HMAC-SHA256 keyed with it, so
+	// that small sets of values such as emails cannot be hashed to find
+	// them.
+	HashKey string `json:"hash_key"`
+	// Masks replace their matches in string attribute values and log bodies.
+	Masks []Mask `json:"masks"`
+}
+
+type Mask struct {
+	// Name of the mask in the stats.
+	Name string `json:"name"`
+	// Regular expression of the values to mask.
+	Pattern string `json:"pattern"`
+	// Replacement of the matches, "****" if empty. $1 refers to the first
+	// group of Pattern, as in regexp.Regexp.ReplaceAllString.
+	Replacement string `json:"replacement"`
+}
+
+// Redactor applies the rules of a Config. A nil Redactor leaves data as is.
+type Redactor struct {
+	allowed map[string]bool
+	denied  map[string]bool
+	hashed  map[string]bool
+	hashKey []byte
+	masks   []mask
+}
+
+type mask struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// New returns the Redactor of cfg, or nil if cfg has no rules.
+func New(cfg Config) (*Redactor, error) {
+	if len(cfg.AllowedKeys) == 0 && len(cfg.DeniedKeys) == 0 && len(cfg.HashedKeys) == 0 && len(cfg.Masks) == 0 {
+		return nil, nil
+	}
+
+	r := &Redactor{
+		denied: keySet(cfg.DeniedKeys),
+		hashed: keySet(cfg.HashedKeys),
+	}
+	if len(cfg.AllowedKeys) > 0 {
+		r.allowed = keySet(cfg.AllowedKeys)
+	}
+	if cfg.HashKey != "" {
+		r.hashKey = []byte(cfg.HashKey)
+	}
+
+	for _, m := range cfg.Masks {
+		if m.Name == "" {
+			return nil, fmt.Errorf("mask %q has no name", m.Pattern)
+		}
+		re, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mask %q: %w", m.Name, err)
+		}
+		replacement := m.Replacement
+		if replacement == "" {
+			replacement = defaultReplacement
+		}
+		r.masks = append(r.masks, mask{name: m.Name, re: re, replacement: replacement})
+	}
+	return r, nil
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// attributes redacts attrs. The allow list only applies to the attributes of
+// records, spans and data points.
+func (r *Redactor) attributes(attrs pcommon.Map, record bool) {
+	attrs.RemoveIf(func(k string, _ pcommon.Value) bool {
+		switch {
+		case r.denied[k]:
+			redactionStats.Add("deny:"+k, 1)
+			return true
+		case record && r.allowed != nil && !r.allowed[k] && !r.hashed[k]:
+			redactionStats.Add("allow", 1)
+			return true
+		}
+		return false
+	})
+
+	for k, v := range attrs.All() {
+		if r.hashed[k] {
+			redactionStats.Add("hash:"+k, 1)
+			v.SetStr(r.hash(v.AsString()))
+			continue
+		}
+		r.mask(v)
+	}
+}
+
+func (r *Redactor) hash(value string) string {
+	if r.hashKey == nil {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mask applies the masks to v, and to the values nested in it.
+func (r *Redactor) mask(v pcommon.Value) {
+	switch v.Type() {
+	case pcommon.ValueTypeStr:
+		s := v.Str()
+		masked := s
+		for _, m := range r.masks {
+			if m.re.MatchString(masked) {
+				redactionStats.Add("mask:"+m.name, 1)
+				masked = m.re.ReplaceAllString(masked, m.replacement)
+			}
+		}
+		if masked != s {
+			v.SetStr(masked)
+		}
+	case pcommon.ValueTypeMap:
+		for _, nested := range v.Map().All() {
+			r.mask(nested)
+		}
+	case pcommon.ValueTypeSlice:
+		for _, nested := range v.Slice().All() {
+			r.mask(nested)
+		}
+	}
+}
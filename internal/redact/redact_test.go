@@ -0,0 +1,114 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func firedCount(rule string) int64 {
+	if v, ok := redactionStats.Get(rule).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestLogs(t *testing.T) {
+	r, err := New(Config{
+		AllowedKeys: []string{"http.method", "password", "note"},
+		DeniedKeys:  []string{"password"},
+		HashedKeys:  []string{"user.email"},
+		Masks: []Mask{
+			{Name: "email", Pattern: `[\w.+-]+@[\w-]+\.[\w.]+`},
+			{Name: "card", Pattern: `\b\d{12}(\d{4})\b`, Replacement: "****$1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := firedCount("deny:password")
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "checkout")
+	rl.Resource().Attributes().PutStr("password", "hunter2")
+	lr := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	lr.Body().SetStr("paid with 4111111111111111 by jane@example.com")
+	attrs := lr.Attributes()
+	attrs.PutStr("http.method", "POST")
+	attrs.PutStr("password", "hunter2")
+	attrs.PutStr("user.email", "jane@example.com")
+	attrs.PutStr("session.id", "abc")
+	attrs.PutEmptyMap("note").PutStr("contact", "mail jane@example.com")
+
+	r.Logs(ld)
+
+	// The allow list does not apply to resource attributes.
+	if got, want := rl.Resource().Attributes().AsRaw(), map[string]any{"service.name": "checkout"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resource attributes = %v, want %v", got, want)
+	}
+	sum := sha256.Sum256([]byte("jane@example.com"))
+	want := map[string]any{
+		"http.method": "POST",
+		"user.email":  hex.EncodeToString(sum[:]),
+		"note":        map[string]any{"contact": "mail ****"},
+	}
+	if got := attrs.AsRaw(); !reflect.DeepEqual(got, want) {
+		t.Errorf("attributes = %v, want %v", got, want)
+	}
+	if got, want := lr.Body().Str(), "paid with ****1111 by ****"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if got := firedCount("deny:password") - denied; got != 2 {
+		t.Errorf("deny:password fired %d times, want 2", got)
+	}
+}
+
+func TestTracesHashKey(t *testing.T) {
+	r, err := New(Config{HashedKeys: []string{"user.id"}, HashKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td := ptrace.NewTraces()
+	span := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutInt("user.id", 42)
+	span.Events().AppendEmpty().Attributes().PutInt("user.id", 42)
+	r.Traces(td)
+
+	got, _ := span.Attributes().Get("user.id")
+	if got.Str() != r.hash("42") || got.Str() == (&Redactor{}).hash("42") {
+		t.Errorf("hashed value = %q", got.Str())
+	}
+	if event, _ := span.Events().At(0).Attributes().Get("user.id"); event.Str() != got.Str() {
+		t.Errorf("event value = %q, want %q", event.Str(), got.Str())
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	if err := os.WriteFile(path, []byte(`{"masks": [{"name": "token", "pattern": "Bearer \\S+"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.masks) != 1 || r.masks[0].replacement != defaultReplacement {
+		t.Errorf("masks = %+v", r.masks)
+	}
+
+	if r, err := New(Config{}); r != nil || err != nil {
+		t.Errorf("New() without rules = %v, %v, want nil", r, err)
+	}
+	if _, err := New(Config{Masks: []Mask{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Error("New() with an invalid pattern succeeded")
+	}
+}
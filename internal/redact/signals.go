@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Logs redacts the attributes and bodies of ld.
+func (r *Redactor) Logs(ld plog.Logs) {
+	if r == nil {
+		return
+	}
+	for _, rl := range ld.ResourceLogs().All() {
+		r.attributes(rl.Resource().Attributes(), false)
+		for _, sl := range rl.ScopeLogs().All() {
+			r.attributes(sl.Scope().Attributes(), false)
+			for _, lr := range sl.LogRecords().All() {
+				r.attributes(lr.Attributes(), true)
+				r.mask(lr.Body())
+			}
+		}
+	}
+}
+
+// Traces redacts the attributes of td, and of its span events and links.
+func (r *Redactor) Traces(td ptrace.Traces) {
+	if r == nil {
+		return
+	}
+	for _, rs := range td.ResourceSpans().All() {
+		r.attributes(rs.Resource().Attributes(), false)
+		for _, ss := range rs.ScopeSpans().All() {
+			r.attributes(ss.Scope().Attributes(), false)
+			for _, span := range ss.Spans().All() {
+				r.attributes(span.Attributes(), true)
+				for _, event := range span.Events().All() {
+					r.attributes(event.Attributes(), true)
+				}
+				for _, link := range span.Links().All() {
+					r.attributes(link.Attributes(), true)
+				}
+			}
+		}
+	}
+}
+
+// Metrics redacts the attributes of md and of its exemplars.
+func (r *Redactor) Metrics(md pmetric.Metrics) {
+	if r == nil {
+		return
+	}
+	for _, rm := range md.ResourceMetrics().All() {
+		r.attributes(rm.Resource().Attributes(), false)
+		for _, sm := range rm.ScopeMetrics().All() {
+			r.attributes(sm.Scope().Attributes(), false)
+			for _, m := range sm.Metrics().All() {
+				r.dataPoints(m)
+			}
+		}
+	}
+}
+
+func (r *Redactor) dataPoints(m pmetric.Metric) {
+	redact := func(attrs pcommon.Map, exemplars pmetric.ExemplarSlice) {
+		r.attributes(attrs, true)
+		for _, e := range exemplars.All() {
+			r.attributes(e.FilteredAttributes(), true)
+		}
+	}
+
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		for _, dp := range m.Gauge().DataPoints().All() {
+			redact(dp.Attributes(), dp.Exemplars())
+		}
+	case pmetric.MetricTypeSum:
+		for _, dp := range m.Sum().DataPoints().All() {
+			redact(dp.Attributes(), dp.Exemplars())
+		}
+	case pmetric.MetricTypeHistogram:
+		for _, dp := range m.Histogram().DataPoints().All() {
+			redact(dp.Attributes(), dp.Exemplars())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		for _, dp := range m.ExponentialHistogram().DataPoints().All() {
+			redact(dp.Attributes(), dp.Exemplars())
+		}
+	case pmetric.MetricTypeSummary:
+		for _, dp := range m.Summary().DataPoints().All() {
+			r.attributes(dp.Attributes(), true)
+		}
+	}
+}
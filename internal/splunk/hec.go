@@ -0,0 +1,154 @@
+// Package splunk decodes Splunk HTTP Event Collector (HEC) requests and
+// translates them to OTLP logs.
+// Ref: https://docs.splunk.com/Documentation/Splunk/latest/Data/FormateventsforHTTPEventCollector
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a HEC event. Fields absent from the request are empty.
+type Event struct {
+	Time       time.Time
+	Host       string
+	Source     string
+	SourceType string
+	Index      string
+	// Event is the decoded JSON event, a string for raw events. Numbers are
+	// json.Number.
+	Event  any
+	Fields map[string]any
+}
+
+// Error is a HEC error, Code is the status code in its response body.
+// Ref: https://docs.splunk.com/Documentation/Splunk/latest/Data/TroubleshootHTTPEventCollector#Possible_error_codes
+type Error struct {
+	Code int
+	Text string
+}
+
+func (e *Error) Error() string {
+	return e.Text
+}
+
+var (
+	ErrNoData        = &Error{Code: 5, Text: "No data"}
+	ErrInvalidFormat = &Error{Code: 6, Text: "Invalid data format"}
+	ErrEventRequired = &Error{Code: 12, Text: "Event field is required"}
+	ErrEventBlank    = &Error{Code: 13, Text: "Event field cannot be blank"}
+)
+
+type jsonEvent struct {
+	Time       any            `json:"time"`
+	Host       string         `json:"host"`
+	Source     string         `json:"source"`
+	SourceType string         `json:"sourcetype"`
+	Index      string         `json:"index"`
+	Event      any            `json:"event"`
+	Fields     map[string]any `json:"fields"`
+}
+
+// DecodeEvents decodes the body of /services/collector/event, JSON events
+// that are concatenated, or separated by whitespace.
+func DecodeEvents(buf []byte) ([]Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var events []Event
+	for {
+		var in jsonEvent
+		err := dec.Decode(&in)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidFormat
+		}
+
+		switch in.Event {
+		case nil:
+			return nil, ErrEventRequired
+		case "":
+			return nil, ErrEventBlank
+		}
+
+		event := Event{
+			Host:       in.Host,
+			Source:     in.Source,
+			SourceType: in.SourceType,
+			Index:      in.Index,
+			Event:      in.Event,
+			Fields:     in.Fields,
+		}
+		if event.Time, err = parseTime(in.Time); err != nil {
+			return nil, ErrInvalidFormat
+		}
+		events = append(events, event)
+	}
+
+	if len(events) == 0 {
+		return nil, ErrNoData
+	}
+	return events, nil
+}
+
+// DecodeRaw decodes the body of /services/collector/raw, one event per
+// line. The events have the metadata of defaults, which comes from the query
+// parameters of the request.
+func DecodeRaw(buf []byte, defaults Event) ([]Event, error) {
+	var events []Event
+	for line := range strings.Lines(string(buf)) {
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		event := defaults
+		event.Event = line
+		events = append(events, event)
+	}
+
+	if len(events) == 0 {
+		return nil, ErrNoData
+	}
+	return events, nil
+}
+
+// parseTime parses the time field of an event, seconds since the epoch with
+// an optional fraction, as a number or a string.
+func parseTime(v any) (time.Time, error) {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return time.Time{}, errors.New("invalid time")
+	}
+
+	// The fraction is parsed as an integer, as float64 cannot hold
+	// nanoseconds since the epoch.
+	secs, frac, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		if nsec, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil || nsec < 0 {
+			return time.Time{}, errors.New("invalid time")
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
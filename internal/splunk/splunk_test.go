@@ -0,0 +1,114 @@
+package splunk
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestDecodeEvents(t *testing.T) {
+	body := `{"time": 1426279439.123, "host": "web-1", "source": "app.log", "sourcetype": "json", "index": "main", "event": {"msg": "hello", "n": 2}, "fields": {"region": "eu"}}` +
+		`{"time": "1426279440", "event": "second"}
+		{"event": "third"}`
+
+	events, err := DecodeEvents([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{
+			Time: time.Unix(1426279439, 123e6),
+			Host: "web-1", Source: "app.log", SourceType: "json", Index: "main",
+			Event:  map[string]any{"msg": "hello", "n": json.Number("2")},
+			Fields: map[string]any{"region": "eu"},
+		},
+		{Time: time.Unix(1426279440, 0), Event: "second"},
+		{Event: "third"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	for _, tt := range []struct {
+		body string
+		err  error
+	}{
+		{"", ErrNoData},
+		{"  \n", ErrNoData},
+		{`{"event": "a"} not json`, ErrInvalidFormat},
+		{`{"event": "a", "host": 1}`, ErrInvalidFormat},
+		{`{"event": "a", "time": "yesterday"}`, ErrInvalidFormat},
+		{`{"host": "web-1"}`, ErrEventRequired},
+		{`{"event": ""}`, ErrEventBlank},
+	} {
+		if _, err := DecodeEvents([]byte(tt.body)); !errors.Is(err, tt.err) {
+			t.Errorf("DecodeEvents(%q) error = %v, want %v", tt.body, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	defaults := Event{Host: "web-1", SourceType: "syslog"}
+	events, err := DecodeRaw([]byte("first line\r\n\nsecond line"), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{Host: "web-1", SourceType: "syslog", Event: "first line"},
+		{Host: "web-1", SourceType: "syslog", Event: "second line"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	if _, err := DecodeRaw([]byte("\n"), defaults); !errors.Is(err, ErrNoData) {
+		t.Errorf("DecodeRaw of an empty body error = %v, want %v", err, ErrNoData)
+	}
+}
+
+func TestToLogs(t *testing.T) {
+	observed := pcommon.NewTimestampFromTime(time.Unix(1426279500, 0))
+	ld := ToLogs([]Event{
+		{
+			Time: time.Unix(1426279439, 123e6), Host: "web-1", Source: "app.log", SourceType: "json",
+			Event:  map[string]any{"msg": "hello", "n": json.Number("2"), "ratio": json.Number("0.5")},
+			Fields: map[string]any{"region": "eu"},
+		},
+		{Host: "web-1", Source: "app.log", SourceType: "json", Event: "second"},
+		{Host: "web-2", Index: "main", Event: "third"},
+	}, observed)
+
+	if ld.ResourceLogs().Len() != 2 || ld.LogRecordCount() != 3 {
+		t.Fatalf("got %d resources and %d log records, want 2 and 3", ld.ResourceLogs().Len(), ld.LogRecordCount())
+	}
+
+	rl := ld.ResourceLogs().At(0)
+	wantResource := map[string]any{"host.name": "web-1", "com.splunk.source": "app.log", "com.splunk.sourcetype": "json"}
+	if got := rl.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource = %v, want %v", got, wantResource)
+	}
+	records := rl.ScopeLogs().At(0).LogRecords()
+	lr := records.At(0)
+	if lr.Timestamp().AsTime() != time.Unix(1426279439, 123e6).UTC() || lr.ObservedTimestamp() != observed {
+		t.Errorf("timestamps = %v, observed %v", lr.Timestamp(), lr.ObservedTimestamp())
+	}
+	wantBody := map[string]any{"msg": "hello", "n": int64(2), "ratio": 0.5}
+	if got := lr.Body().Map().AsRaw(); !reflect.DeepEqual(got, wantBody) {
+		t.Errorf("body = %v, want %v", got, wantBody)
+	}
+	if got := lr.Attributes().AsRaw(); !reflect.DeepEqual(got, map[string]any{"region": "eu"}) {
+		t.Errorf("attributes = %v", got)
+	}
+	if lr := records.At(1); lr.Body().Str() != "second" || lr.Timestamp() != 0 {
+		t.Errorf("log record = %q at %v, want second without a timestamp", lr.Body().Str(), lr.Timestamp())
+	}
+
+	wantResource = map[string]any{"host.name": "web-2", "com.splunk.index": "main"}
+	if got := ld.ResourceLogs().At(1).Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource = %v, want %v", got, wantResource)
+	}
+}
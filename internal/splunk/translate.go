@@ -0,0 +1,103 @@
+package splunk
+
+import (
+	"encoding/json"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Resource attributes of the event metadata, as in the OTel Collector's
+// Splunk HEC receiver.
+const (
+	attrHostName   = "host.name"
+	attrSource     = "com.splunk.source"
+	attrSourceType = "com.splunk.sourcetype"
+	attrIndex      = "com.splunk.index"
+)
+
+type resourceKey struct {
+	host       string
+	source     string
+	sourceType string
+	index      string
+}
+
+// ToLogs translates events to OTLP logs:
+//
+//   - host, source, sourcetype and index become resource attributes, events
+//     with the same metadata share a resource.
+//   - The event becomes the body, a string or a structured value, and the
+//     fields become attributes.
+//
+// Events without a time only have the observed timestamp.
+func ToLogs(events []Event, observed pcommon.Timestamp) plog.Logs {
+	ld := plog.NewLogs()
+	scopes := map[resourceKey]plog.ScopeLogs{}
+
+	for _, event := range events {
+		key := resourceKey{host: event.Host, source: event.Source, sourceType: event.SourceType, index: event.Index}
+		sl, ok := scopes[key]
+		if !ok {
+			rl := ld.ResourceLogs().AppendEmpty()
+			putResource(rl.Resource().Attributes(), key)
+			sl = rl.ScopeLogs().AppendEmpty()
+			scopes[key] = sl
+		}
+
+		lr := sl.LogRecords().AppendEmpty()
+		if !event.Time.IsZero() {
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(event.Time))
+		}
+		lr.SetObservedTimestamp(observed)
+		putValue(lr.Body(), event.Event)
+		for k, v := range event.Fields {
+			putValue(lr.Attributes().PutEmpty(k), v)
+		}
+	}
+
+	return ld
+}
+
+func putResource(attrs pcommon.Map, key resourceKey) {
+	for _, attr := range [...]struct{ name, value string }{
+		{attrHostName, key.host},
+		{attrSource, key.source},
+		{attrSourceType, key.sourceType},
+		{attrIndex, key.index},
+	} {
+		if attr.value != "" {
+			attrs.PutStr(attr.name, attr.value)
+		}
+	}
+}
+
+// putValue sets dest to a decoded JSON value.
+func putValue(dest pcommon.Value, v any) {
+	switch v := v.(type) {
+	case bool:
+		dest.SetBool(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			dest.SetInt(i)
+		} else if f, err := v.Float64(); err == nil {
+			dest.SetDouble(f)
+		} else {
+			dest.SetStr(string(v))
+		}
+	case string:
+		dest.SetStr(v)
+	case []any:
+		s := dest.SetEmptySlice()
+		s.EnsureCapacity(len(v))
+		for _, e := range v {
+			putValue(s.AppendEmpty(), e)
+		}
+	case map[string]any:
+		m := dest.SetEmptyMap()
+		m.EnsureCapacity(len(v))
+		for k, e := range v {
+			putValue(m.PutEmpty(k), e)
+		}
+	}
+}
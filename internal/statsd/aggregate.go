@@ -0,0 +1,287 @@
+package statsd
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// TimerType selects the metric model of timers, histograms and
+// distributions.
+type TimerType string
+
+const (
+	TimerTypeSummary   TimerType = "summary"
+	TimerTypeHistogram TimerType = "histogram"
+)
+
+// Quantiles of timer summaries. 0 and 1 are the minimum and maximum.
+var summaryQuantiles = []float64{0, 0.5, 0.9, 0.95, 0.99, 1}
+
+// Bucket boundaries of timer histograms, in milliseconds for timers.
+var histogramBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const scopeName = "github.com/alkmst-xyz/sweetcorn/internal/statsd"
+
+// Gauges not updated for gaugeIdleFlushes flushes are forgotten, so that
+// series of past tags do not accumulate. A delta then applies to 0 again.
+const gaugeIdleFlushes = 60
+
+type seriesKey struct {
+	name string
+	typ  Type
+	tags string
+}
+
+type series struct {
+	tags []Tag
+	// Sum of counter values, scaled by their sample rates.
+	sum float64
+	// Timer values, and the number of values they stand for.
+	values []float64
+	count  float64
+	// Members of a set.
+	set map[string]struct{}
+}
+
+type gauge struct {
+	value float64
+	// Flush during which the gauge was last updated.
+	updated int
+}
+
+// Aggregator aggregates samples between flushes. It is safe for concurrent
+// use.
+type Aggregator struct {
+	timerType TimerType
+
+	mu    sync.Mutex
+	start time.Time
+	// Series updated since the last flush.
+	series map[seriesKey]*series
+	// Gauges keep their value across flushes, deltas apply to it.
+	gauges  map[seriesKey]*gauge
+	flushes int
+}
+
+func NewAggregator(timerType TimerType, now time.Time) *Aggregator {
+	return &Aggregator{
+		timerType: timerType,
+		start:     now,
+		series:    map[seriesKey]*series{},
+		gauges:    map[seriesKey]*gauge{},
+	}
+}
+
+// Add aggregates s into the current interval.
+func (a *Aggregator) Add(s Sample) {
+	key := seriesKey{name: s.Name, typ: s.Type, tags: tagsKey(s.Tags)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ser, ok := a.series[key]
+	if !ok {
+		ser = &series{tags: s.Tags}
+		a.series[key] = ser
+	}
+
+	switch s.Type {
+	case TypeCounter:
+		ser.sum += s.Value / s.SampleRate
+	case TypeGauge:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{}
+			a.gauges[key] = g
+		}
+		if s.GaugeDelta {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.updated = a.flushes
+	case TypeTimer, TypeHistogram, TypeDistribution:
+		ser.values = append(ser.values, s.Value)
+		ser.count += 1 / s.SampleRate
+		ser.sum += s.Value / s.SampleRate
+	case TypeSet:
+		if ser.set == nil {
+			ser.set = map[string]struct{}{}
+		}
+		ser.set[s.SetValue] = struct{}{}
+	}
+}
+
+// Flush returns the aggregates of the series updated since the last flush,
+// for the interval ending at now, and starts a new interval.
+func (a *Aggregator) Flush(now time.Time) pmetric.Metrics {
+	a.mu.Lock()
+	start := a.start
+	updated := a.series
+	a.start = now
+	a.series = map[seriesKey]*series{}
+	gauges := make(map[seriesKey]float64, len(updated))
+	for key := range updated {
+		if key.typ == TypeGauge {
+			gauges[key] = a.gauges[key].value
+		}
+	}
+	for key, g := range a.gauges {
+		if a.flushes-g.updated >= gaugeIdleFlushes {
+			delete(a.gauges, key)
+			statsdStats.Add("expired_gauges", 1)
+		}
+	}
+	a.flushes++
+	a.mu.Unlock()
+
+	md := pmetric.NewMetrics()
+	if len(updated) == 0 {
+		return md
+	}
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(scopeName)
+
+	// Series of the same name and type are data points of one metric.
+	keys := make([]seriesKey, 0, len(updated))
+	for key := range updated {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b seriesKey) int {
+		return cmp.Or(
+			strings.Compare(a.name, b.name),
+			strings.Compare(string(a.typ), string(b.typ)),
+			strings.Compare(a.tags, b.tags),
+		)
+	})
+
+	startTs := pcommon.NewTimestampFromTime(start)
+	ts := pcommon.NewTimestampFromTime(now)
+	var metric pmetric.Metric
+	for i, key := range keys {
+		ser := updated[key]
+		if i == 0 || key.name != keys[i-1].name || key.typ != keys[i-1].typ {
+			metric = sm.Metrics().AppendEmpty()
+			metric.SetName(key.name)
+			a.initMetric(metric, key.typ)
+		}
+
+		switch key.typ {
+		case TypeCounter:
+			dp := metric.Sum().DataPoints().AppendEmpty()
+			setPoint(dp, ser.tags, startTs, ts)
+			dp.SetDoubleValue(ser.sum)
+		case TypeGauge:
+			dp := metric.Gauge().DataPoints().AppendEmpty()
+			setPoint(dp, ser.tags, startTs, ts)
+			dp.SetDoubleValue(gauges[key])
+		case TypeSet:
+			dp := metric.Gauge().DataPoints().AppendEmpty()
+			setPoint(dp, ser.tags, startTs, ts)
+			dp.SetIntValue(int64(len(ser.set)))
+		default:
+			slices.Sort(ser.values)
+			if a.timerType == TimerTypeHistogram {
+				dp := metric.Histogram().DataPoints().AppendEmpty()
+				setPoint(dp, ser.tags, startTs, ts)
+				fillHistogram(dp, ser)
+			} else {
+				dp := metric.Summary().DataPoints().AppendEmpty()
+				setPoint(dp, ser.tags, startTs, ts)
+				fillSummary(dp, ser)
+			}
+		}
+	}
+
+	return md
+}
+
+func (a *Aggregator) initMetric(metric pmetric.Metric, typ Type) {
+	switch typ {
+	case TypeCounter:
+		// StatsD counters can be decremented, as in the OTel Collector's
+		// StatsD receiver they are not monotonic.
+		metric.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	case TypeGauge, TypeSet:
+		metric.SetEmptyGauge()
+	default:
+		if typ == TypeTimer {
+			metric.SetUnit("ms")
+		}
+		if a.timerType == TimerTypeHistogram {
+			metric.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		} else {
+			metric.SetEmptySummary()
+		}
+	}
+}
+
+// point is the common part of the data point types.
+type point interface {
+	Attributes() pcommon.Map
+	SetStartTimestamp(pcommon.Timestamp)
+	SetTimestamp(pcommon.Timestamp)
+}
+
+func setPoint(dp point, tags []Tag, start, ts pcommon.Timestamp) {
+	for _, tag := range tags {
+		dp.Attributes().PutStr(tag.Key, tag.Value)
+	}
+	dp.SetStartTimestamp(start)
+	dp.SetTimestamp(ts)
+}
+
+// fillHistogram sets the buckets of dp from the sorted values of ser. Each
+// value stands for count/len(values) values. Bucket counts are rounded and
+// the count is their total.
+func fillHistogram(dp pmetric.HistogramDataPoint, ser *series) {
+	weight := ser.count / float64(len(ser.values))
+	weights := make([]float64, len(histogramBounds)+1)
+	for _, v := range ser.values {
+		i, _ := slices.BinarySearch(histogramBounds, v)
+		weights[i] += weight
+	}
+
+	var count uint64
+	dp.ExplicitBounds().FromRaw(histogramBounds)
+	for _, w := range weights {
+		c := uint64(math.Round(w))
+		dp.BucketCounts().Append(c)
+		count += c
+	}
+	dp.SetCount(count)
+	dp.SetSum(ser.sum)
+	dp.SetMin(ser.values[0])
+	dp.SetMax(ser.values[len(ser.values)-1])
+}
+
+// fillSummary sets the quantiles of dp from the sorted values of ser, with
+// the nearest rank method.
+func fillSummary(dp pmetric.SummaryDataPoint, ser *series) {
+	dp.SetCount(uint64(math.Round(ser.count)))
+	dp.SetSum(ser.sum)
+	for _, q := range summaryQuantiles {
+		rank := max(int(math.Ceil(q*float64(len(ser.values))))-1, 0)
+		qv := dp.QuantileValues().AppendEmpty()
+		qv.SetQuantile(q)
+		qv.SetValue(ser.values[rank])
+	}
+}
+
+func tagsKey(tags []Tag) string {
+	var b strings.Builder
+	for _, tag := range tags {
+		b.WriteString(tag.Key)
+		b.WriteByte(':')
+		b.WriteString(tag.Value)
+		b.WriteByte(',')
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+// Package statsd receives StatsD metrics over UDP and TCP, aggregates them
+// over a flush interval and writes the aggregates to the metrics tables.
+//
+// The DogStatsD extensions for tags and multiple values per line are
+// supported. Other DogStatsD sections, and events and service checks, are
+// ignored.
+// Ref: https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// Ref: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of a StatsD metric.
+type Type string
+
+const (
+	TypeCounter      Type = "c"
+	TypeGauge        Type = "g"
+	TypeTimer        Type = "ms"
+	TypeHistogram    Type = "h"
+	TypeDistribution Type = "d"
+	TypeSet          Type = "s"
+)
+
+// Tag is a DogStatsD tag. Tags without a value have an empty Value.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Sample is one value of a line.
+type Sample struct {
+	Name string
+	Type Type
+	// Value of counters, gauges, timers, histograms and distributions.
+	Value float64
+	// GaugeDelta is set for gauges with a sign, which change the gauge
+	// instead of setting it.
+	GaugeDelta bool
+	// SetValue is the member of a set.
+	SetValue string
+	// SampleRate is in (0, 1], a counter or timer value stands for
+	// 1/SampleRate values.
+	SampleRate float64
+	// Tags sorted by key.
+	Tags []Tag
+}
+
+var (
+	errMalformedLine = errors.New("malformed statsd line")
+	errNotMetric     = errors.New("not a metric")
+)
+
+// ParseLine parses a line with one or more values of a metric,
+// name:value[:value...]|type[|@rate][|#tag:value,...].
+func ParseLine(line string) ([]Sample, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, errNotMetric
+	}
+
+	sections := strings.Split(line, "|")
+	if len(sections) < 2 {
+		return nil, fmt.Errorf("%w %q: no type", errMalformedLine, line)
+	}
+
+	name, values, ok := strings.Cut(sections[0], ":")
+	if !ok || name == "" || values == "" {
+		return nil, fmt.Errorf("%w %q: no value", errMalformedLine, line)
+	}
+
+	typ := Type(sections[1])
+	switch typ {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution, TypeSet:
+	default:
+		return nil, fmt.Errorf("%w %q: unknown type %q", errMalformedLine, line, typ)
+	}
+
+	template := Sample{Name: name, Type: typ, SampleRate: 1}
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || !(rate > 0 && rate <= 1) {
+				return nil, fmt.Errorf("%w %q: invalid sample rate", errMalformedLine, line)
+			}
+			template.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			template.Tags = parseTags(section[1:])
+		}
+	}
+
+	var samples []Sample
+	for value := range strings.SplitSeq(values, ":") {
+		s := template
+		if typ == TypeSet {
+			s.SetValue = value
+			samples = append(samples, s)
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w %q: invalid value %q", errMalformedLine, line, value)
+		}
+		s.Value = v
+		s.GaugeDelta = typ == TypeGauge && (value[0] == '+' || value[0] == '-')
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+func parseTags(s string) []Tag {
+	var tags []Tag
+	for tag := range strings.SplitSeq(s, ",") {
+		if tag == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(tag, ":")
+		tags = append(tags, Tag{Key: key, Value: value})
+	}
+	slices.SortStableFunc(tags, func(a, b Tag) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return tags
+}
@@ -0,0 +1,161 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+)
+
+const (
+	DefaultFlushInterval = 10 * time.Second
+	DefaultTimerType     = TimerTypeSummary
+)
+
+// Largest UDP payload, and longest line over TCP.
+const maxLineSize = 64 << 10
+
+// Received and malformed lines, and expired gauges, served on /debug/vars.
+var statsdStats = expvar.NewMap("statsd")
+
+type ServerConfig struct {
+	Addr string
+	// Interval over which samples are aggregated before they are written.
+	FlushInterval time.Duration
+	TimerType     TimerType
+}
+
+// StartServer listens for StatsD lines on UDP and TCP at cfg.Addr and writes
+// their aggregates to the pipeline every cfg.FlushInterval, for the default
+// tenant. It returns when ctx is canceled, after a last flush.
+func StartServer(ctx context.Context, pl *pipeline.Pipeline, cfg ServerConfig) error {
+	if cfg.FlushInterval <= 0 || (cfg.TimerType != TimerTypeSummary && cfg.TimerType != TimerTypeHistogram) {
+		return fmt.Errorf("invalid statsd config: %+v", cfg)
+	}
+
+	udp, err := net.ListenPacket("udp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		udp.Close()
+		return err
+	}
+
+	agg := NewAggregator(cfg.TimerType, time.Now())
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		<-ctx.Done()
+		udp.Close()
+		tcp.Close()
+		return nil
+	})
+	g.Go(func() error {
+		return ignoreClosed(ctx, serveUDP(udp, agg))
+	})
+	g.Go(func() error {
+		return ignoreClosed(ctx, serveTCP(tcp, agg))
+	})
+	g.Go(func() error {
+		flushLoop(ctx, pl, agg, cfg.FlushInterval)
+		return nil
+	})
+
+	log.Printf("StatsD server listening on %s (udp, tcp)", cfg.Addr)
+	return g.Wait()
+}
+
+// ignoreClosed drops the error of a listener closed on shutdown.
+func ignoreClosed(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func serveUDP(conn net.PacketConn, agg *Aggregator) error {
+	buf := make([]byte, maxLineSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		for line := range bytes.SplitSeq(buf[:n], []byte("\n")) {
+			handleLine(agg, line)
+		}
+	}
+}
+
+func serveTCP(lis net.Listener, agg *Aggregator) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+			for scanner.Scan() {
+				handleLine(agg, scanner.Bytes())
+			}
+		}()
+	}
+}
+
+func handleLine(agg *Aggregator, line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	statsdStats.Add("lines", 1)
+	samples, err := ParseLine(string(line))
+	if errors.Is(err, errNotMetric) {
+		return
+	}
+	if err != nil {
+		statsdStats.Add("invalid_lines", 1)
+		return
+	}
+	for _, s := range samples {
+		agg.Add(s)
+	}
+}
+
+// flushLoop writes the aggregates every interval, and once more when ctx is
+// canceled.
+func flushLoop(ctx context.Context, pl *pipeline.Pipeline, agg *Aggregator, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush(context.WithoutCancel(ctx), pl, agg)
+			return
+		case <-ticker.C:
+			flush(ctx, pl, agg)
+		}
+	}
+}
+
+func flush(ctx context.Context, pl *pipeline.Pipeline, agg *Aggregator) {
+	md := agg.Flush(time.Now())
+	if md.DataPointCount() == 0 {
+		return
+	}
+	if _, err := pl.ConsumeMetrics(ctx, md); err != nil {
+		log.Printf("failed to write statsd metrics: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package statsd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []Sample
+		wantErr bool
+	}{
+		{
+			line: "requests:1|c",
+			want: []Sample{{Name: "requests", Type: TypeCounter, Value: 1, SampleRate: 1}},
+		},
+		{
+			line: "requests:2|c|@0.5|#route:/api,env:prod,canary",
+			want: []Sample{{
+				Name: "requests", Type: TypeCounter, Value: 2, SampleRate: 0.5,
+				Tags: []Tag{{Key: "canary"}, {Key: "env", Value: "prod"}, {Key: "route", Value: "/api"}},
+			}},
+		},
+		{
+			line: "temperature:-3|g",
+			want: []Sample{{Name: "temperature", Type: TypeGauge, Value: -3, GaugeDelta: true, SampleRate: 1}},
+		},
+		{
+			line: "latency:10:20.5|ms|#a:b|c:container-id|T1700000000",
+			want: []Sample{
+				{Name: "latency", Type: TypeTimer, Value: 10, SampleRate: 1, Tags: []Tag{{Key: "a", Value: "b"}}},
+				{Name: "latency", Type: TypeTimer, Value: 20.5, SampleRate: 1, Tags: []Tag{{Key: "a", Value: "b"}}},
+			},
+		},
+		{
+			line: "users:alice|s",
+			want: []Sample{{Name: "users", Type: TypeSet, SetValue: "alice", SampleRate: 1}},
+		},
+		{line: "requests", wantErr: true},
+		{line: "requests:1", wantErr: true},
+		{line: ":1|c", wantErr: true},
+		{line: "requests:x|c", wantErr: true},
+		{line: "requests:NaN|g", wantErr: true},
+		{line: "requests:1|x", wantErr: true},
+		{line: "requests:1|c|@0", wantErr: true},
+		{line: "requests:1|c|@2", wantErr: true},
+		{line: "_e{5,4}:title|text", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLine(%q) error = %v, wantErr %t", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func addLines(t *testing.T, agg *Aggregator, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		samples, err := ParseLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range samples {
+			agg.Add(s)
+		}
+	}
+}
+
+// metricsByName returns the metrics of md, which the aggregator writes to a
+// single scope.
+func metricsByName(md pmetric.Metrics) map[string]pmetric.Metric {
+	metrics := map[string]pmetric.Metric{}
+	ms := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := range ms.Len() {
+		metrics[ms.At(i).Name()] = ms.At(i)
+	}
+	return metrics
+}
+
+func TestAggregator(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	agg := NewAggregator(TimerTypeSummary, start)
+	addLines(t, agg,
+		"requests:1|c|#route:/a",
+		"requests:1|c|@0.5|#route:/a",
+		"requests:3|c|#route:/b",
+		"temperature:20|g",
+		"temperature:+2|g",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+		"latency:10:20:30:40|ms",
+	)
+
+	md := agg.Flush(start.Add(10 * time.Second))
+	metrics := metricsByName(md)
+	if len(metrics) != 4 {
+		t.Fatalf("got %d metrics, want 4", len(metrics))
+	}
+
+	requests := metrics["requests"].Sum()
+	if requests.AggregationTemporality() != pmetric.AggregationTemporalityDelta || requests.DataPoints().Len() != 2 {
+		t.Fatalf("requests = %v with %d points", requests.AggregationTemporality(), requests.DataPoints().Len())
+	}
+	if v := requests.DataPoints().At(0).DoubleValue(); v != 3 {
+		t.Errorf("requests{route=/a} = %v, want 3", v)
+	}
+	if dp := requests.DataPoints().At(0); dp.StartTimestamp().AsTime() != start.UTC() {
+		t.Errorf("start timestamp = %v, want %v", dp.StartTimestamp(), start)
+	}
+
+	if v := metrics["temperature"].Gauge().DataPoints().At(0).DoubleValue(); v != 22 {
+		t.Errorf("temperature = %v, want 22", v)
+	}
+	if v := metrics["users"].Gauge().DataPoints().At(0).IntValue(); v != 2 {
+		t.Errorf("users = %v, want 2", v)
+	}
+
+	latency := metrics["latency"]
+	if latency.Unit() != "ms" {
+		t.Errorf("latency unit = %q, want ms", latency.Unit())
+	}
+	dp := latency.Summary().DataPoints().At(0)
+	if dp.Count() != 4 || dp.Sum() != 100 {
+		t.Errorf("latency count, sum = %d, %v, want 4, 100", dp.Count(), dp.Sum())
+	}
+	var quantiles []float64
+	for i := range dp.QuantileValues().Len() {
+		quantiles = append(quantiles, dp.QuantileValues().At(i).Value())
+	}
+	if want := []float64{10, 20, 40, 40, 40, 40}; !reflect.DeepEqual(quantiles, want) {
+		t.Errorf("latency quantiles = %v, want %v", quantiles, want)
+	}
+
+	// Only updated series are written, gauge deltas apply to the last value.
+	addLines(t, agg, "temperature:-5|g")
+	metrics = metricsByName(agg.Flush(start.Add(20 * time.Second)))
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(metrics))
+	}
+	if v := metrics["temperature"].Gauge().DataPoints().At(0).DoubleValue(); v != 17 {
+		t.Errorf("temperature = %v, want 17", v)
+	}
+
+	if md := agg.Flush(start.Add(30 * time.Second)); md.DataPointCount() != 0 {
+		t.Errorf("got %d data points after an empty interval, want 0", md.DataPointCount())
+	}
+}
+
+func TestAggregatorGaugeExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	agg := NewAggregator(TimerTypeSummary, now)
+	addLines(t, agg, "temperature:20|g", "pressure:1000|g")
+
+	// The first flush is of the interval the gauges were set in.
+	agg.Flush(now)
+	for range gaugeIdleFlushes {
+		addLines(t, agg, "pressure:+1|g")
+		agg.Flush(now)
+	}
+	if _, ok := agg.gauges[seriesKey{name: "temperature", typ: TypeGauge}]; ok {
+		t.Errorf("temperature kept after %d flushes without an update", gaugeIdleFlushes)
+	}
+
+	// An expired gauge starts over, an updated one keeps its value.
+	addLines(t, agg, "temperature:+2|g", "pressure:+1|g")
+	metrics := metricsByName(agg.Flush(now))
+	if v := metrics["temperature"].Gauge().DataPoints().At(0).DoubleValue(); v != 2 {
+		t.Errorf("temperature = %v, want 2", v)
+	}
+	if v := metrics["pressure"].Gauge().DataPoints().At(0).DoubleValue(); v != 1001+gaugeIdleFlushes {
+		t.Errorf("pressure = %v, want %d", v, 1001+gaugeIdleFlushes)
+	}
+}
+
+func TestAggregatorHistogram(t *testing.T) {
+	agg := NewAggregator(TimerTypeHistogram, time.Unix(1700000000, 0))
+	addLines(t, agg, "latency:4:5:6|h|@0.5", "latency:20000|h|@0.5")
+
+	metric := metricsByName(agg.Flush(time.Unix(1700000010, 0)))["latency"]
+	if metric.Unit() != "" {
+		t.Errorf("unit = %q, want none", metric.Unit())
+	}
+	dp := metric.Histogram().DataPoints().At(0)
+	if dp.Count() != 8 || dp.Sum() != 40030 || dp.Min() != 4 || dp.Max() != 20000 {
+		t.Errorf("count, sum, min, max = %d, %v, %v, %v", dp.Count(), dp.Sum(), dp.Min(), dp.Max())
+	}
+	want := []uint64{4, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}
+	if got := dp.BucketCounts().AsRaw(); !reflect.DeepEqual(got, want) {
+		t.Errorf("bucket counts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "database/sql/driver"
+
+// rowAppender is a sink for the rows of a single table. The DuckDB Appender
+// implements it for bulk ingest (see ingestTx).
+type rowAppender interface {
+	AppendRow(args ...driver.Value) error
+}
+
+// Catalog the tables live in. Empty means the default catalog.
+func (cfg StorageConfig) catalog() string {
+	if cfg.StorageType == DuckLake {
+		return cfg.DuckLakeName
+	}
+	return ""
+}
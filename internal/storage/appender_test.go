@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// stmtAppender executes a prepared INSERT statement once per row.
+type stmtAppender struct {
+	ctx  context.Context
+	stmt *sql.Stmt
+}
+
+func (a stmtAppender) AppendRow(args ...driver.Value) error {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		// JSON values are passed as json.RawMessage for the Appender, bind
+		// them as plain bytes and strings instead.
+		switch v := arg.(type) {
+		case json.RawMessage:
+			values[i] = []byte(v)
+		case []json.RawMessage:
+			raw := make([]string, len(v))
+			for j := range v {
+				raw[j] = string(v[j])
+			}
+			values[i] = raw
+		default:
+			values[i] = arg
+		}
+	}
+
+	_, err := a.stmt.ExecContext(a.ctx, values...)
+	return err
+}
+
+// withStatement calls fn with an appender that runs insertSQL once per row.
+// This is the row-at-a-time path used before the Appender, kept for
+// comparison in the benchmarks.
+func (s *Storage) withStatement(ctx context.Context, insertSQL string, fn func(a rowAppender) error) error {
+	stmt, err := s.DB.PrepareContext(ctx, insertSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return fn(stmtAppender{ctx: ctx, stmt: stmt})
+}
+
+func generateSampleTraces(count int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "test-service")
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("duckdb")
+	ss.Scope().SetVersion("1.0.0")
+	timestamp := time.Now()
+
+	for i := range count {
+		span := ss.Spans().AppendEmpty()
+		span.SetTraceID([16]byte{1, 2, 3, byte(i)})
+		span.SetSpanID([8]byte{1, 2, 3, byte(i)})
+		span.SetName("operation")
+		span.SetKind(ptrace.SpanKindServer)
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(timestamp))
+		span.SetEndTimestamp(pcommon.NewTimestampFromTime(timestamp.Add(time.Millisecond)))
+		span.Attributes().PutStr("http.method", "GET")
+		span.Status().SetCode(ptrace.StatusCodeOk)
+
+		event := span.Events().AppendEmpty()
+		event.SetName("event")
+		event.SetTimestamp(pcommon.NewTimestampFromTime(timestamp))
+		event.Attributes().PutInt("index", int64(i))
+
+		link := span.Links().AppendEmpty()
+		link.SetTraceID([16]byte{4, 5, 6, byte(i)})
+		link.SetSpanID([8]byte{4, 5, 6, byte(i)})
+	}
+
+	return traces
+}
+
+func generateSampleMetrics(count int) pmetric.Metrics {
+	metrics := pmetric.NewMetrics()
+
+	rm := metrics.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "test-service")
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName("duckdb")
+	sm.Scope().SetVersion("1.0.0")
+	timestamp := pcommon.NewTimestampFromTime(time.Now())
+
+	gauge := sm.Metrics().AppendEmpty()
+	gauge.SetName("gauge")
+	gauge.SetEmptyGauge()
+	sum := sm.Metrics().AppendEmpty()
+	sum.SetName("sum")
+	sum.SetEmptySum().SetIsMonotonic(true)
+	sum.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	histogram := sm.Metrics().AppendEmpty()
+	histogram.SetName("histogram")
+	histogram.SetEmptyHistogram()
+	expHistogram := sm.Metrics().AppendEmpty()
+	expHistogram.SetName("exponential_histogram")
+	expHistogram.SetEmptyExponentialHistogram()
+	summary := sm.Metrics().AppendEmpty()
+	summary.SetName("summary")
+	summary.SetEmptySummary()
+
+	for i := range count {
+		gdp := gauge.Gauge().DataPoints().AppendEmpty()
+		gdp.SetTimestamp(timestamp)
+		gdp.SetDoubleValue(float64(i))
+		gdp.Attributes().PutInt("index", int64(i))
+
+		sdp := sum.Sum().DataPoints().AppendEmpty()
+		sdp.SetTimestamp(timestamp)
+		sdp.SetIntValue(int64(i))
+
+		hdp := histogram.Histogram().DataPoints().AppendEmpty()
+		hdp.SetTimestamp(timestamp)
+		hdp.SetCount(3)
+		hdp.SetSum(6)
+		hdp.BucketCounts().FromRaw([]uint64{1, 2})
+		hdp.ExplicitBounds().FromRaw([]float64{1})
+
+		edp := expHistogram.ExponentialHistogram().DataPoints().AppendEmpty()
+		edp.SetTimestamp(timestamp)
+		edp.SetCount(3)
+		edp.SetScale(2)
+		edp.Positive().BucketCounts().FromRaw([]uint64{1, 2})
+
+		qdp := summary.Summary().DataPoints().AppendEmpty()
+		qdp.SetTimestamp(timestamp)
+		qdp.SetCount(1)
+		quantile := qdp.QuantileValues().AppendEmpty()
+		quantile.SetQuantile(0.5)
+		quantile.SetValue(1)
+	}
+
+	return metrics
+}
+
+func TestInsertTracesDataAndQuery(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		numSpans := 10
+		traces := generateSampleTraces(numSpans)
+
+		if err := InsertTracesData(ctx, s, traces); err != nil {
+			t.Fatalf("InsertTracesData failed: %v", err)
+		}
+
+		results, err := QueryTraces(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryTraces failed: %v", err)
+		}
+
+		if len(results) != numSpans {
+			t.Fatalf("Expected %d result, got %d", numSpans, len(results))
+		}
+
+		if len(results[0].EventsAttributes) != 1 || len(results[0].LinksAttributes) != 1 {
+			t.Errorf("Expected one event and one link, got %d and %d.",
+				len(results[0].EventsAttributes), len(results[0].LinksAttributes))
+		}
+	})
+}
+
+func TestIngestMetricsDataAndQuery(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		numDataPoints := 5
+		metrics := generateSampleMetrics(numDataPoints)
+
+		if err := IngestMetricsData(ctx, s, metrics); err != nil {
+			t.Fatalf("IngestMetricsData failed: %v", err)
+		}
+
+		gauges, err := QueryMetricsGauge(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsGauge failed: %v", err)
+		}
+		if len(gauges) != numDataPoints {
+			t.Fatalf("Expected %d gauge result, got %d", numDataPoints, len(gauges))
+		}
+		if _, ok := gauges[0].Attributes["index"]; !ok {
+			t.Errorf("Expected gauge attributes to contain index, got %v.", gauges[0].Attributes)
+		}
+
+		sums, err := QueryMetricsSum(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsSum failed: %v", err)
+		}
+		if len(sums) != numDataPoints {
+			t.Fatalf("Expected %d sum result, got %d", numDataPoints, len(sums))
+		}
+
+		histograms, err := QueryMetricsHistogram(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsHistogram failed: %v", err)
+		}
+		if len(histograms) != numDataPoints {
+			t.Fatalf("Expected %d histogram result, got %d", numDataPoints, len(histograms))
+		}
+
+		expHistograms, err := QueryMetricsExponentialHistogram(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsExponentialHistogram failed: %v", err)
+		}
+		if len(expHistograms) != numDataPoints {
+			t.Fatalf("Expected %d exponential histogram result, got %d", numDataPoints, len(expHistograms))
+		}
+
+		summaries, err := QueryMetricsSummary(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsSummary failed: %v", err)
+		}
+		if len(summaries) != numDataPoints {
+			t.Fatalf("Expected %d summary result, got %d", numDataPoints, len(summaries))
+		}
+	})
+}
+
+// Benchmarks comparing the Appender with the prepared statement path.
+
+var benchmarkSizes = []int{100, 1_000}
+
+func BenchmarkInsertLogs(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		logs := generateSampleLogs(size)
+
+		b.Run(fmt.Sprintf("appender/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				for b.Loop() {
+					if err := InsertLogsData(ctx, s, logs); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+
+		b.Run(fmt.Sprintf("statement/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				for b.Loop() {
+					err := s.withStatement(ctx, s.InsertLogsSQL, func(a rowAppender) error {
+						return appendLogsData(a, logs, tenant.Default)
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkInsertTraces(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		traces := generateSampleTraces(size)
+
+		b.Run(fmt.Sprintf("appender/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				for b.Loop() {
+					if err := InsertTracesData(ctx, s, traces); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+
+		b.Run(fmt.Sprintf("statement/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				for b.Loop() {
+					err := s.withStatement(ctx, s.InsertTracesSQL, func(a rowAppender) error {
+						return appendTracesData(a, traces, tenant.Default)
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkInsertMetrics(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		metrics := generateSampleMetrics(size)
+
+		b.Run(fmt.Sprintf("appender/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				for b.Loop() {
+					if err := IngestMetricsData(ctx, s, metrics); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+
+		b.Run(fmt.Sprintf("statement/%d", size), func(b *testing.B) {
+			withTestDB(b, func(ctx context.Context, s *Storage) {
+				insertSQL := map[pmetric.MetricType]string{
+					pmetric.MetricTypeGauge:                s.InsertMetricsGaugeSQL,
+					pmetric.MetricTypeSum:                  s.InsertMetricsSumSQL,
+					pmetric.MetricTypeHistogram:            s.InsertMetricsHistogramSQL,
+					pmetric.MetricTypeExponentialHistogram: s.InsertMetricsExponentialHistogramSQL,
+					pmetric.MetricTypeSummary:              s.InsertMetricsSummarySQL,
+				}
+
+				for b.Loop() {
+					metricsMap := NewMetricsModel(s)
+					addMetrics(metricsMap, metrics)
+
+					for metricType, m := range metricsMap {
+						err := s.withStatement(ctx, insertSQL[metricType], func(a rowAppender) error {
+							return m.insert(a, tenant.Default)
+						})
+						if err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+func addMetrics(metricsMap map[pmetric.MetricType]MetricsModel, md pmetric.Metrics) {
+	for i := range md.ResourceMetrics().Len() {
+		rm := md.ResourceMetrics().At(i)
+		for j := range rm.ScopeMetrics().Len() {
+			sm := rm.ScopeMetrics().At(j)
+			for k := range sm.Metrics().Len() {
+				m := sm.Metrics().At(k)
+				metricsMap[m.Type()].Add(rm.Resource().Attributes(), rm.SchemaUrl(), sm.Scope(), sm.SchemaUrl(), m)
+			}
+		}
+	}
+}
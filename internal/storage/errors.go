@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/duckdb/duckdb-go/v2"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+// Errors returned by this package are of one of three kinds:
+//   - not found, matched with IsNotFound, when the requested data does not exist.
+//   - permanent, matched with IsPermanent, when the same call fails again, for
+//     example a row that cannot be converted or a malformed query.
+//   - retryable, matched with IsRetryable, for everything else, such as
+//     transaction conflicts, IO errors or a canceled context.
+//
+// Permanent and retryable errors are marked with consumererror, so that
+// receivers map them to the matching gRPC code.
+
+// ErrNotFound is wrapped by errors for data that does not exist.
+var ErrNotFound = errors.New("not found")
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsPermanent(err error) bool {
+	return consumererror.IsPermanent(err)
+}
+
+func IsRetryable(err error) bool {
+	return err != nil && !IsNotFound(err) && !IsPermanent(err)
+}
+
+// classifyError marks err as permanent or retryable depending on its cause.
+// Errors that are already marked, or not found, are returned as is.
+func classifyError(err error) error {
+	if err == nil || IsNotFound(err) || IsPermanent(err) {
+		return err
+	}
+
+	var marked *consumererror.Error
+	if errors.As(err, &marked) {
+		return err
+	}
+
+	if isPermanentCause(err) {
+		return consumererror.NewPermanent(err)
+	}
+	return consumererror.NewRetryableError(err)
+}
+
+func isPermanentCause(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) {
+		return false
+	}
+
+	var valueErr *json.UnsupportedValueError
+	var typeErr *json.UnsupportedTypeError
+	if errors.As(err, &valueErr) || errors.As(err, &typeErr) {
+		return true
+	}
+
+	var duckErr *duckdb.Error
+	if errors.As(err, &duckErr) {
+		switch duckErr.Type {
+		case duckdb.ErrorTypeTransaction,
+			duckdb.ErrorTypeConnection,
+			duckdb.ErrorTypeNetwork,
+			duckdb.ErrorTypeHTTP,
+			duckdb.ErrorTypeIO,
+			duckdb.ErrorTypeInterrupt,
+			duckdb.ErrorTypeOutOfMemory:
+			return false
+		default:
+			return true
+		}
+	}
+
+	// Unknown causes are assumed to be transient.
+	return false
+}
+
+// scanError marks an error converting a result row as permanent, the same
+// row fails again on the next query.
+func scanError(err error) error {
+	return consumererror.NewPermanent(err)
+}
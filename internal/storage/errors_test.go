@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceNotFound(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		_, err := Trace(ctx, s, TraceParams{TraceID: "00000000000000000000000000000000"})
+		if !IsNotFound(err) {
+			t.Fatalf("Expected a not found error, got %v", err)
+		}
+		if IsRetryable(err) || IsPermanent(err) {
+			t.Errorf("Expected a not found error to be neither retryable nor permanent")
+		}
+	})
+}
+
+func TestQueryErrorKinds(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		if _, err := s.DB.ExecContext(ctx, "DROP TABLE "+s.Config.TracesTable); err != nil {
+			t.Fatalf("failed to drop traces table: %v", err)
+		}
+
+		// A missing table fails the same way on every call.
+		if _, err := TraceServices(ctx, s); !IsPermanent(err) {
+			t.Errorf("Expected a permanent error, got %v", err)
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := QueryLogs(canceled, s); !IsRetryable(err) {
+			t.Errorf("Expected a retryable error, got %v", err)
+		}
+	})
+}
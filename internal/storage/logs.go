@@ -2,12 +2,13 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -31,7 +32,8 @@ CREATE TABLE IF NOT EXISTS
 		scope_version			VARCHAR,
 		scope_attributes		JSON,
 		log_attributes			JSON,
-		event_name				VARCHAR
+		event_name				VARCHAR,
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertLogsSQL = `
@@ -52,10 +54,11 @@ INSERT INTO
 		scope_version,
 		scope_attributes,
 		log_attributes,
-		event_name
+		event_name,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryLogsSQL = `
 SELECT
@@ -77,6 +80,8 @@ SELECT
 	event_name
 FROM
 	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	ts DESC
 LIMIT
@@ -102,9 +107,19 @@ type LogRecord struct {
 	EventName          string         `json:"eventName"`
 }
 
-// TODO: add storage as receiver
-// TODO: move db, insertSQL to storage receiver
-func InsertLogsData(ctx context.Context, db *sql.DB, insertLogsSQL string, ld plog.Logs) error {
+// InsertLogsData writes all log records in ld to the logs table using the
+// DuckDB Appender, for the tenant of ctx. The records are committed in a
+// single transaction.
+func InsertLogsData(ctx context.Context, s *Storage, ld plog.Logs) error {
+	tenantID := tenant.FromContext(ctx)
+	return s.withTx(ctx, func(tx ingestTx) error {
+		return tx.append(s.Config.LogsTable, func(a rowAppender) error {
+			return appendLogsData(a, ld, tenantID)
+		})
+	})
+}
+
+func appendLogsData(a rowAppender, ld plog.Logs, tenantID string) error {
 	rsLogs := ld.ResourceLogs()
 	for i := range rsLogs.Len() {
 		logs := rsLogs.At(i)
@@ -147,23 +162,24 @@ func InsertLogsData(ctx context.Context, db *sql.DB, insertLogsSQL string, ld pl
 					timestamp = logRecord.ObservedTimestamp()
 				}
 
-				_, err := db.ExecContext(ctx, insertLogsSQL,
+				err := a.AppendRow(
 					timestamp.AsTime(),
 					logRecord.TraceID().String(),
 					logRecord.SpanID().String(),
-					logRecord.Flags(),
+					uint32(logRecord.Flags()),
 					logRecord.SeverityText(),
 					uint8(logRecord.SeverityNumber()),
 					serviceName,
 					logRecord.Body().AsString(),
 					resURL,
-					resAttrBytes,
+					json.RawMessage(resAttrBytes),
 					scopeURL,
 					scopeName,
 					scopeVersion,
-					scopeAttrBytes,
-					logAttrBytes,
+					json.RawMessage(scopeAttrBytes),
+					json.RawMessage(logAttrBytes),
 					logRecord.EventName(),
+					tenantID,
 				)
 				if err != nil {
 					return err
@@ -176,9 +192,9 @@ func InsertLogsData(ctx context.Context, db *sql.DB, insertLogsSQL string, ld pl
 }
 
 func QueryLogs(ctx context.Context, s *Storage) ([]LogRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryLogsSQL, s.Config.LogsTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryLogsSQL, s.Config.LogsTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -208,7 +224,7 @@ func QueryLogs(ctx context.Context, s *Storage) ([]LogRecord, error) {
 			&result.EventName,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
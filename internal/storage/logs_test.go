@@ -11,7 +11,7 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 )
 
-func withTestDB(t *testing.T, fn func(ctx context.Context, s *Storage)) {
+func withTestDB(t testing.TB, fn func(ctx context.Context, s *Storage)) {
 	ctx := context.Background()
 	cfg := StorageConfig{
 		StorageType:                      DuckDB,
@@ -23,6 +23,11 @@ func withTestDB(t *testing.T, fn func(ctx context.Context, s *Storage)) {
 		MetricsHistogramTable:            DefaultMetricsHistogramTableName,
 		MetricsExponentialHistogramTable: DefaultMetricsExponentialHistogramTableName,
 		MetricsSummaryTable:              DefaultMetricsSummaryTableName,
+		ProfilesSamplesTable:             DefaultProfilesSamplesTableName,
+		ProfilesStacksTable:              DefaultProfilesStacksTableName,
+		ProfilesLocationsTable:           DefaultProfilesLocationsTableName,
+		ProfilesFunctionsTable:           DefaultProfilesFunctionsTableName,
+		ProfilesMappingsTable:            DefaultProfilesMappingsTableName,
 	}
 
 	s, err := NewStorage(ctx, cfg)
@@ -73,7 +78,7 @@ func TestInsertLogsData(t *testing.T) {
 	withTestDB(t, func(ctx context.Context, s *Storage) {
 		logs := generateSampleLogs(1)
 
-		if err := InsertLogsData(ctx, s.DB, s.InsertLogsSQL, logs); err != nil {
+		if err := InsertLogsData(ctx, s, logs); err != nil {
 			t.Fatalf("insertLog failed: %v", err)
 		}
 	})
@@ -84,7 +89,7 @@ func TestInsertLogsDataAndQuery(t *testing.T) {
 		numLogs := 10
 		logs := generateSampleLogs(numLogs)
 
-		if err := InsertLogsData(ctx, s.DB, s.InsertLogsSQL, logs); err != nil {
+		if err := InsertLogsData(ctx, s, logs); err != nil {
 			t.Fatalf("InsertLogsData failed: %v", err)
 		}
 
@@ -118,7 +123,7 @@ func InsertLogsDataWithEmptyAttributes(t *testing.T) {
 		scopeLog.Scope().Attributes().Clear()
 		scopeLogRecords.Attributes().Clear()
 
-		if err := InsertLogsData(ctx, s.DB, s.InsertLogsSQL, logs); err != nil {
+		if err := InsertLogsData(ctx, s, logs); err != nil {
 			t.Fatalf("InsertLogsData failed: %v", err)
 		}
 
@@ -2,12 +2,13 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"sync"
 
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 // MetricsModel is used to group metric data and insert into duckdb
@@ -16,8 +17,14 @@ type MetricsModel interface {
 	// Add used to bind MetricsMetaData to a specific metric then put them into a slice
 	Add(resAttr pcommon.Map, resURL string, scopeInstr pcommon.InstrumentationScope, scopeURL string, metrics pmetric.Metric)
 
-	// insert is used to insert metric data to duckdb
-	insert(ctx context.Context, db *sql.DB) error
+	// insert is used to append metric data of a tenant to the model's table
+	insert(a rowAppender, tenantID string) error
+
+	// tableName is the table the model is written to
+	tableName() string
+
+	// dataPointCount is the number of data points added to the model
+	dataPointCount() int
 }
 
 // MetricsMetaData contain specific metric data
@@ -41,43 +48,44 @@ type MetricsRecordBase struct {
 	Attributes         map[string]any `json:"attributes"`
 }
 
-// InsertMetrics insert metric data into duckdb concurrently
+// InsertMetrics inserts metric data into duckdb for the tenant of ctx, using
+// one Appender per metric table. All tables are written in a single
+// transaction, so either every data point is committed or none is.
 func InsertMetrics(ctx context.Context, s *Storage, metricsMap map[pmetric.MetricType]MetricsModel) error {
-	errsChan := make(chan error, len(metricsMap))
-	wg := &sync.WaitGroup{}
-	for _, m := range metricsMap {
-		wg.Add(1)
-		go func(m MetricsModel, wg *sync.WaitGroup) {
-			errsChan <- m.insert(ctx, s.DB)
-			wg.Done()
-		}(m, wg)
-	}
-	wg.Wait()
-	close(errsChan)
-	var errs error
-	for err := range errsChan {
-		errs = errors.Join(errs, err)
-	}
-	return errs
+	tenantID := tenant.FromContext(ctx)
+	return s.withTx(ctx, func(tx ingestTx) error {
+		for _, m := range metricsMap {
+			if m.dataPointCount() == 0 {
+				continue
+			}
+			err := tx.append(m.tableName(), func(a rowAppender) error {
+				return m.insert(a, tenantID)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // NewMetricsModel create a model for contain different metric data
 func NewMetricsModel(s *Storage) map[pmetric.MetricType]MetricsModel {
 	return map[pmetric.MetricType]MetricsModel{
 		pmetric.MetricTypeGauge: &gaugeMetrics{
-			insertSQL: s.InsertMetricsGaugeSQL,
+			table: s.Config.MetricsGaugeTable,
 		},
 		pmetric.MetricTypeSum: &sumMetrics{
-			insertSQL: s.InsertMetricsSumSQL,
+			table: s.Config.MetricsSumTable,
 		},
 		pmetric.MetricTypeHistogram: &histogramMetrics{
-			insertSQL: s.InsertMetricsHistogramSQL,
+			table: s.Config.MetricsHistogramTable,
 		},
 		pmetric.MetricTypeExponentialHistogram: &expHistogramMetrics{
-			insertSQL: s.InsertMetricsExponentialHistogramSQL,
+			table: s.Config.MetricsExponentialHistogramTable,
 		},
 		pmetric.MetricTypeSummary: &summaryMetrics{
-			insertSQL: s.InsertMetricsSummarySQL,
+			table: s.Config.MetricsSummaryTable,
 		},
 	}
 }
@@ -94,12 +102,14 @@ func IngestMetricsData(ctx context.Context, s *Storage, md pmetric.Metrics) erro
 			scopeURL := metrics.ScopeMetrics().At(j).SchemaUrl()
 			for k := 0; k < rs.Len(); k++ {
 				r := rs.At(k)
+				// Metrics without a type have nothing to store, receivers
+				// report them through ValidateMetrics.
 				if r.Type() == pmetric.MetricTypeEmpty {
-					return errors.New("metrics type is unset")
+					continue
 				}
 				m, ok := metricsMap[r.Type()]
 				if !ok {
-					return errors.New("unsupported metrics type")
+					return consumererror.NewPermanent(errors.New("unsupported metrics type"))
 				}
 				m.Add(resAttr, metrics.SchemaUrl(), scopeInstr, scopeURL, r)
 			}
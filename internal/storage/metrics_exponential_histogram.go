@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -10,6 +9,8 @@ import (
 	"github.com/duckdb/duckdb-go/v2"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -36,7 +37,8 @@ CREATE TABLE IF NOT EXISTS
 		negative_offset			INTEGER,
 		negative_bucket_counts 	UBIGINT[],
 		min						DOUBLE,
-		max						DOUBLE
+		max						DOUBLE,
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertMetricsExponentialHistogramSQL = `
@@ -60,10 +62,11 @@ INSERT INTO
 		negative_offset,
 		negative_bucket_counts,
 		min,
-		max
+		max,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryMetricsExponentialHistogramSQL = `
 SELECT
@@ -88,6 +91,8 @@ SELECT
 	max
 FROM
 	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	timestamp DESC
 LIMIT
@@ -104,7 +109,7 @@ type expHistogramModel struct {
 
 type expHistogramMetrics struct {
 	expHistogramModels []*expHistogramModel
-	insertSQL          string
+	table              string
 	count              int
 }
 
@@ -125,7 +130,15 @@ func (e *expHistogramMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr
 	})
 }
 
-func (e *expHistogramMetrics) insert(ctx context.Context, db *sql.DB) error {
+func (e *expHistogramMetrics) tableName() string {
+	return e.table
+}
+
+func (e *expHistogramMetrics) dataPointCount() int {
+	return e.count
+}
+
+func (e *expHistogramMetrics) insert(a rowAppender, tenantID string) error {
 	if e.count == 0 {
 		return nil
 	}
@@ -142,21 +155,21 @@ func (e *expHistogramMetrics) insert(ctx context.Context, db *sql.DB) error {
 		for i := 0; i < model.expHistogram.DataPoints().Len(); i++ {
 			dp := model.expHistogram.DataPoints().At(i)
 
-			attrBytes, attrErr := json.Marshal(dp.Attributes())
+			attrBytes, attrErr := json.Marshal(dp.Attributes().AsRaw())
 			if attrErr != nil {
 				return fmt.Errorf("failed to marshal json metric attributes: %w", attrErr)
 			}
 
-			_, err := db.ExecContext(ctx, e.insertSQL,
+			err := a.AppendRow(
 				dp.Timestamp().AsTime(),
 				serviceName,
 				model.metricName,
 				model.metricDescription,
 				model.metricUnit,
-				resAttrBytes,
+				json.RawMessage(resAttrBytes),
 				model.metadata.ScopeInstr.Name(),
 				model.metadata.ScopeInstr.Version(),
-				attrBytes,
+				json.RawMessage(attrBytes),
 				dp.Count(),
 				dp.Sum(),
 				dp.Scale(),
@@ -167,6 +180,7 @@ func (e *expHistogramMetrics) insert(ctx context.Context, db *sql.DB) error {
 				dp.Negative().BucketCounts().AsRaw(),
 				dp.Min(),
 				dp.Max(),
+				tenantID,
 			)
 			if err != nil {
 				return err
@@ -192,9 +206,9 @@ type MetricsExponentialHistogramRecord struct {
 }
 
 func QueryMetricsExponentialHistogram(ctx context.Context, s *Storage) ([]MetricsExponentialHistogramRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsExponentialHistogramSQL, s.Config.MetricsExponentialHistogramTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsExponentialHistogramSQL, s.Config.MetricsExponentialHistogramTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -230,7 +244,7 @@ func QueryMetricsExponentialHistogram(ctx context.Context, s *Storage) ([]Metric
 			&result.Max,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
@@ -2,13 +2,14 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -26,7 +27,8 @@ CREATE TABLE IF NOT EXISTS
 		scope_name				VARCHAR,
 		scope_version			VARCHAR,
 		attributes				JSON,
-		value					DOUBLE
+		value					DOUBLE,
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertMetricsGaugeSQL = `
@@ -41,10 +43,11 @@ INSERT INTO
 		scope_name,
 		scope_version,
 		attributes,
-		value
+		value,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryMetricsGaugeSQL = `
 SELECT
@@ -59,7 +62,9 @@ SELECT
 	attributes,
 	value
 FROM
-	%s	
+	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	timestamp DESC
 LIMIT
@@ -76,7 +81,7 @@ type gaugeModel struct {
 
 type gaugeMetrics struct {
 	gaugeModels []*gaugeModel
-	insertSQL   string
+	table       string
 	count       int
 }
 
@@ -97,7 +102,15 @@ func (g *gaugeMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr pcommo
 	})
 }
 
-func (g *gaugeMetrics) insert(ctx context.Context, db *sql.DB) error {
+func (g *gaugeMetrics) tableName() string {
+	return g.table
+}
+
+func (g *gaugeMetrics) dataPointCount() int {
+	return g.count
+}
+
+func (g *gaugeMetrics) insert(a rowAppender, tenantID string) error {
 	if g.count == 0 {
 		return nil
 	}
@@ -114,22 +127,23 @@ func (g *gaugeMetrics) insert(ctx context.Context, db *sql.DB) error {
 		for i := 0; i < model.gauge.DataPoints().Len(); i++ {
 			dp := model.gauge.DataPoints().At(i)
 
-			attrBytes, attrErr := json.Marshal(dp.Attributes())
+			attrBytes, attrErr := json.Marshal(dp.Attributes().AsRaw())
 			if attrErr != nil {
 				return fmt.Errorf("failed to marshal json metric attributes: %w", attrErr)
 			}
 
-			_, err := db.ExecContext(ctx, g.insertSQL,
+			err := a.AppendRow(
 				dp.Timestamp().AsTime(),
 				serviceName,
 				model.metricName,
 				model.metricDescription,
 				model.metricUnit,
-				resAttrBytes,
+				json.RawMessage(resAttrBytes),
 				model.metadata.ScopeInstr.Name(),
 				model.metadata.ScopeInstr.Version(),
-				attrBytes,
+				json.RawMessage(attrBytes),
 				getValue(dp.IntValue(), dp.DoubleValue(), dp.ValueType()),
+				tenantID,
 			)
 			if err != nil {
 				return err
@@ -146,9 +160,9 @@ type MetricsGaugeRecord struct {
 }
 
 func QueryMetricsGauge(ctx context.Context, s *Storage) ([]MetricsGaugeRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsGaugeSQL, s.Config.MetricsGaugeTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsGaugeSQL, s.Config.MetricsGaugeTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -172,7 +186,7 @@ func QueryMetricsGauge(ctx context.Context, s *Storage) ([]MetricsGaugeRecord, e
 			&result.Value,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
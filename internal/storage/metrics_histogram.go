@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -10,6 +9,8 @@ import (
 	"github.com/duckdb/duckdb-go/v2"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -32,7 +33,8 @@ CREATE TABLE IF NOT EXISTS
 		bucket_counts			UBIGINT[],
 		explicit_bounds			DOUBLE[],
 		min						DOUBLE,
-		max						DOUBLE
+		max						DOUBLE,
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertMetricsHistogramSQL = `
@@ -52,10 +54,11 @@ INSERT INTO
 		bucket_counts,
 		explicit_bounds,
 		min,
-		max
+		max,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryMetricsHistogramSQL = `
 SELECT
@@ -75,7 +78,9 @@ SELECT
 	min,
 	max
 FROM
-	%s	
+	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	timestamp DESC
 LIMIT
@@ -92,7 +97,7 @@ type histogramModel struct {
 
 type histogramMetrics struct {
 	histogramModel []*histogramModel
-	insertSQL      string
+	table          string
 	count          int
 }
 
@@ -113,7 +118,15 @@ func (h *histogramMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr pc
 	})
 }
 
-func (h *histogramMetrics) insert(ctx context.Context, db *sql.DB) error {
+func (h *histogramMetrics) tableName() string {
+	return h.table
+}
+
+func (h *histogramMetrics) dataPointCount() int {
+	return h.count
+}
+
+func (h *histogramMetrics) insert(a rowAppender, tenantID string) error {
 	if h.count == 0 {
 		return nil
 	}
@@ -130,27 +143,28 @@ func (h *histogramMetrics) insert(ctx context.Context, db *sql.DB) error {
 		for i := 0; i < model.histogram.DataPoints().Len(); i++ {
 			dp := model.histogram.DataPoints().At(i)
 
-			attrBytes, attrErr := json.Marshal(dp.Attributes())
+			attrBytes, attrErr := json.Marshal(dp.Attributes().AsRaw())
 			if attrErr != nil {
 				return fmt.Errorf("failed to marshal json metric attributes: %w", attrErr)
 			}
 
-			_, err := db.ExecContext(ctx, h.insertSQL,
+			err := a.AppendRow(
 				dp.Timestamp().AsTime(),
 				serviceName,
 				model.metricName,
 				model.metricDescription,
 				model.metricUnit,
-				resAttrBytes,
+				json.RawMessage(resAttrBytes),
 				model.metadata.ScopeInstr.Name(),
 				model.metadata.ScopeInstr.Version(),
-				attrBytes,
+				json.RawMessage(attrBytes),
 				dp.Count(),
 				dp.Sum(),
 				dp.BucketCounts().AsRaw(),
 				dp.ExplicitBounds().AsRaw(),
 				dp.Min(),
 				dp.Max(),
+				tenantID,
 			)
 			if err != nil {
 				return err
@@ -172,9 +186,9 @@ type MetricsHistogramRecord struct {
 }
 
 func QueryMetricsHistogram(ctx context.Context, s *Storage) ([]MetricsHistogramRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsHistogramSQL, s.Config.MetricsHistogramTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsHistogramSQL, s.Config.MetricsHistogramTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -206,7 +220,7 @@ func QueryMetricsHistogram(ctx context.Context, s *Storage) ([]MetricsHistogramR
 			&result.Max,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
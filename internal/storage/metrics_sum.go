@@ -2,13 +2,14 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -28,7 +29,8 @@ CREATE TABLE IF NOT EXISTS
 		attributes				JSON,
 		value					DOUBLE,
 		aggregation_temporality	INTEGER,
-		isMonotonic				BOOLEAN
+		isMonotonic				BOOLEAN,
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertMetricsSumSQL = `
@@ -45,10 +47,11 @@ INSERT INTO
 		attributes,
 		value,
 		aggregation_temporality,
-		isMonotonic
+		isMonotonic,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryMetricsSumSQL = `
 SELECT
@@ -66,6 +69,8 @@ SELECT
 	isMonotonic
 FROM
 	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	timestamp DESC
 LIMIT
@@ -81,9 +86,9 @@ type sumModel struct {
 }
 
 type sumMetrics struct {
-	sumModel  []*sumModel
-	insertSQL string
-	count     int
+	sumModel []*sumModel
+	table    string
+	count    int
 }
 
 func (s *sumMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr pcommon.InstrumentationScope, scopeURL string, metrics pmetric.Metric) {
@@ -103,7 +108,15 @@ func (s *sumMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr pcommon.
 	})
 }
 
-func (s *sumMetrics) insert(ctx context.Context, db *sql.DB) error {
+func (s *sumMetrics) tableName() string {
+	return s.table
+}
+
+func (s *sumMetrics) dataPointCount() int {
+	return s.count
+}
+
+func (s *sumMetrics) insert(a rowAppender, tenantID string) error {
 	if s.count == 0 {
 		return nil
 	}
@@ -120,24 +133,25 @@ func (s *sumMetrics) insert(ctx context.Context, db *sql.DB) error {
 		for i := 0; i < model.sum.DataPoints().Len(); i++ {
 			dp := model.sum.DataPoints().At(i)
 
-			attrBytes, attrErr := json.Marshal(dp.Attributes())
+			attrBytes, attrErr := json.Marshal(dp.Attributes().AsRaw())
 			if attrErr != nil {
 				return fmt.Errorf("failed to marshal json metric attributes: %w", attrErr)
 			}
 
-			_, err := db.ExecContext(ctx, s.insertSQL,
+			err := a.AppendRow(
 				dp.Timestamp().AsTime(),
 				serviceName,
 				model.metricName,
 				model.metricDescription,
 				model.metricUnit,
-				resAttrBytes,
+				json.RawMessage(resAttrBytes),
 				model.metadata.ScopeInstr.Name(),
 				model.metadata.ScopeInstr.Version(),
-				attrBytes,
+				json.RawMessage(attrBytes),
 				getValue(dp.IntValue(), dp.DoubleValue(), dp.ValueType()),
 				int32(model.sum.AggregationTemporality()),
 				model.sum.IsMonotonic(),
+				tenantID,
 			)
 			if err != nil {
 				return err
@@ -156,9 +170,9 @@ type MetricsSumRecord struct {
 }
 
 func QueryMetricsSum(ctx context.Context, s *Storage) ([]MetricsSumRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsSumSQL, s.Config.MetricsSumTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsSumSQL, s.Config.MetricsSumTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -184,7 +198,7 @@ func QueryMetricsSum(ctx context.Context, s *Storage) ([]MetricsSumRecord, error
 			&result.IsMonotonic,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -10,6 +9,8 @@ import (
 	"github.com/duckdb/duckdb-go/v2"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -30,7 +31,8 @@ CREATE TABLE IF NOT EXISTS
 		count					BIGINT,
 		sum						DOUBLE,
 		quantile_quantiles		DOUBLE[],
-		quantile_values			DOUBLE[]
+		quantile_values			DOUBLE[],
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertMetricsSummarySQL = `
@@ -48,10 +50,11 @@ INSERT INTO
 		count,
 		sum,
 		quantile_quantiles,
-		quantile_values
+		quantile_values,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryMetricsSummarySQL = `
 SELECT
@@ -70,6 +73,8 @@ SELECT
 	quantile_values
 FROM
 	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	timestamp DESC
 LIMIT
@@ -86,7 +91,7 @@ type summaryModel struct {
 
 type summaryMetrics struct {
 	summaryModel []*summaryModel
-	insertSQL    string
+	table        string
 	count        int
 }
 
@@ -107,7 +112,15 @@ func (s *summaryMetrics) Add(resAttr pcommon.Map, resURL string, scopeInstr pcom
 	})
 }
 
-func (s *summaryMetrics) insert(ctx context.Context, db *sql.DB) error {
+func (s *summaryMetrics) tableName() string {
+	return s.table
+}
+
+func (s *summaryMetrics) dataPointCount() int {
+	return s.count
+}
+
+func (s *summaryMetrics) insert(a rowAppender, tenantID string) error {
 	if s.count == 0 {
 		return nil
 	}
@@ -123,27 +136,28 @@ func (s *summaryMetrics) insert(ctx context.Context, db *sql.DB) error {
 		for i := 0; i < model.summary.DataPoints().Len(); i++ {
 			dp := model.summary.DataPoints().At(i)
 
-			attrBytes, attrErr := json.Marshal(dp.Attributes())
+			attrBytes, attrErr := json.Marshal(dp.Attributes().AsRaw())
 			if attrErr != nil {
 				return fmt.Errorf("failed to marshal json metric attributes: %w", attrErr)
 			}
 
 			quantiles, values := convertValueAtQuantile(dp.QuantileValues())
 
-			_, err := db.ExecContext(ctx, s.insertSQL,
+			err := a.AppendRow(
 				dp.Timestamp().AsTime(),
 				serviceName,
 				model.metricName,
 				model.metricDescription,
 				model.metricUnit,
-				resAttrBytes,
+				json.RawMessage(resAttrBytes),
 				model.metadata.ScopeInstr.Name(),
 				model.metadata.ScopeInstr.Version(),
-				attrBytes,
+				json.RawMessage(attrBytes),
 				dp.Count(),
 				dp.Sum(),
 				quantiles,
 				values,
+				tenantID,
 			)
 			if err != nil {
 				return err
@@ -163,9 +177,9 @@ type MetricsSummaryRecord struct {
 }
 
 func QueryMetricsSummary(ctx context.Context, s *Storage) ([]MetricsSummaryRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsSummarySQL, s.Config.MetricsSummaryTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryMetricsSummarySQL, s.Config.MetricsSummaryTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -195,7 +209,7 @@ func QueryMetricsSummary(ctx context.Context, s *Storage) ([]MetricsSummaryRecor
 			&quantileValues,
 		)
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		// convert timestamp to unix epoch in microseconds
@@ -0,0 +1,640 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/duckdb/duckdb-go/v2"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+// Profiles are stored as one row per sample, with the profile, resource and
+// scope fields repeated on each row like the other signals. The stacks,
+// locations, functions and mappings the samples point to are stored in their
+// own tables.
+//
+// The dictionary tables are content addressed: an entry's ID is a hash of
+// its fields, so the same function, mapping, location or stack gets the same
+// ID in every request. An entry is only written if its ID is not stored yet
+// for the tenant, so each ID has one row.
+const (
+	DefaultProfilesSamplesTableName   = "otel_profiles_samples"
+	DefaultProfilesStacksTableName    = "otel_profiles_stacks"
+	DefaultProfilesLocationsTableName = "otel_profiles_locations"
+	DefaultProfilesFunctionsTableName = "otel_profiles_functions"
+	DefaultProfilesMappingsTableName  = "otel_profiles_mappings"
+
+	createProfilesSamplesTableSQL = `
+CREATE TABLE IF NOT EXISTS
+	%s (
+		ts							TIMESTAMP_NS,
+		profile_id					VARCHAR,
+		trace_id					VARCHAR,
+		span_id						VARCHAR,
+		service_name				VARCHAR,
+		resource_schema_url			VARCHAR,
+		resource_attributes			JSON,
+		scope_schema_url			VARCHAR,
+		scope_name					VARCHAR,
+		scope_version				VARCHAR,
+		scope_attributes			JSON,
+		profile_attributes			JSON,
+		duration					UBIGINT,
+		period_type					VARCHAR,
+		period_unit					VARCHAR,
+		period						BIGINT,
+		sample_type					VARCHAR,
+		sample_unit					VARCHAR,
+		original_payload_format		VARCHAR,
+		stack_id					UBIGINT,
+		sample_values				BIGINT[],
+		sample_timestamps			TIMESTAMP_NS[],
+		sample_attributes			JSON,
+		tenant_id					VARCHAR DEFAULT ''
+	);`
+
+	createProfilesStacksTableSQL = `
+CREATE TABLE IF NOT EXISTS
+	%s (
+		stack_id				UBIGINT,
+		location_ids			UBIGINT[],
+		tenant_id				VARCHAR DEFAULT ''
+	);`
+
+	createProfilesLocationsTableSQL = `
+CREATE TABLE IF NOT EXISTS
+	%s (
+		location_id				UBIGINT,
+		mapping_id				UBIGINT,
+		address					UBIGINT,
+		lines_function_ids		UBIGINT[],
+		lines_lines				BIGINT[],
+		lines_columns			BIGINT[],
+		attributes				JSON,
+		tenant_id				VARCHAR DEFAULT ''
+	);`
+
+	createProfilesFunctionsTableSQL = `
+CREATE TABLE IF NOT EXISTS
+	%s (
+		function_id				UBIGINT,
+		name					VARCHAR,
+		system_name				VARCHAR,
+		filename				VARCHAR,
+		start_line				BIGINT,
+		tenant_id				VARCHAR DEFAULT ''
+	);`
+
+	createProfilesMappingsTableSQL = `
+CREATE TABLE IF NOT EXISTS
+	%s (
+		mapping_id				UBIGINT,
+		memory_start			UBIGINT,
+		memory_limit			UBIGINT,
+		file_offset				UBIGINT,
+		filename				VARCHAR,
+		attributes				JSON,
+		tenant_id				VARCHAR DEFAULT ''
+	);`
+
+	// Frames of a stack, leaf first. Inlined functions of a location come
+	// before the function they were inlined into.
+	queryProfileSamplesSQL = `
+WITH
+	stacks AS (
+		SELECT
+			stack_id,
+			unnest(location_ids) AS location_id,
+			generate_subscripts(location_ids, 1) AS location_pos
+		FROM
+			%[2]s
+		WHERE
+			tenant_id = ?
+	),
+	lines AS (
+		SELECT
+			location_id,
+			unnest(lines_function_ids) AS function_id,
+			generate_subscripts(lines_function_ids, 1) AS line_pos
+		FROM
+			%[3]s
+		WHERE
+			tenant_id = ?
+	),
+	functions AS (
+		SELECT
+			function_id,
+			name
+		FROM
+			%[4]s
+		WHERE
+			tenant_id = ?
+	),
+	frames AS (
+		SELECT
+			stack_id,
+			list(name ORDER BY location_pos, line_pos) AS frames
+		FROM
+			stacks
+			JOIN lines USING (location_id)
+			JOIN functions USING (function_id)
+		GROUP BY
+			stack_id
+	)
+SELECT
+	s.ts,
+	s.profile_id,
+	s.trace_id,
+	s.span_id,
+	s.service_name,
+	s.sample_type,
+	s.sample_unit,
+	s.sample_values,
+	coalesce(f.frames, [])
+FROM
+	%[1]s AS s
+	LEFT JOIN frames AS f USING (stack_id)
+WHERE
+	s.tenant_id = ?
+ORDER BY
+	s.ts DESC
+LIMIT
+	100;`
+)
+
+type ProfileSample struct {
+	Timestamp   int64    `json:"timestamp"`
+	ProfileId   string   `json:"profileId"`
+	TraceId     string   `json:"traceId"`
+	SpanId      string   `json:"spanId"`
+	ServiceName string   `json:"serviceName"`
+	SampleType  string   `json:"sampleType"`
+	SampleUnit  string   `json:"sampleUnit"`
+	Values      []int64  `json:"values"`
+	Frames      []string `json:"frames"`
+}
+
+// InsertProfilesData writes the samples of all pds, and the dictionary
+// entries they reference that are not stored yet, for the tenant of ctx.
+// Every table is written in a single transaction.
+func InsertProfilesData(ctx context.Context, s *Storage, pds ...pprofile.Profiles) error {
+	tenantID := tenant.FromContext(ctx)
+	rows := newProfileRows(tenantID)
+	for _, pd := range pds {
+		if err := rows.add(pd); err != nil {
+			return classifyError(err)
+		}
+	}
+
+	// Two transactions would both find an entry missing and write it, the
+	// stored entries are only looked up by one at a time.
+	s.profilesMu.Lock()
+	defer s.profilesMu.Unlock()
+
+	return s.withTx(ctx, func(tx ingestTx) error {
+		for _, table := range []struct {
+			name, idColumn string
+			rows           [][]driver.Value
+		}{
+			{s.Config.ProfilesFunctionsTable, "function_id", rows.functions},
+			{s.Config.ProfilesMappingsTable, "mapping_id", rows.mappings},
+			{s.Config.ProfilesLocationsTable, "location_id", rows.locations},
+			{s.Config.ProfilesStacksTable, "stack_id", rows.stacks},
+			{s.Config.ProfilesSamplesTable, "", rows.samples},
+		} {
+			if table.idColumn != "" {
+				var err error
+				table.rows, err = newEntries(tx, table.name, table.idColumn, tenantID, table.rows)
+				if err != nil {
+					return err
+				}
+			}
+			if len(table.rows) == 0 {
+				continue
+			}
+			err := tx.append(table.name, func(a rowAppender) error {
+				for _, row := range table.rows {
+					if err := a.AppendRow(row...); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// newEntries returns the dictionary rows whose ID, their first value, is not
+// stored in table for tenantID yet.
+func newEntries(tx ingestTx, table, idColumn, tenantID string, rows [][]driver.Value) ([][]driver.Value, error) {
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	ids := make([]uint64, len(rows))
+	for i, row := range rows {
+		ids[i] = row[0].(uint64)
+	}
+
+	stored, err := tx.storedIDs(table, idColumn, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(rows, func(row []driver.Value) bool {
+		return stored[row[0].(uint64)]
+	}), nil
+}
+
+// profileRows collects the rows of each profiles table. Dictionary entries
+// are added once, the first time a sample references them.
+type profileRows struct {
+	tenantID string
+
+	samples   [][]driver.Value
+	stacks    [][]driver.Value
+	locations [][]driver.Value
+	functions [][]driver.Value
+	mappings  [][]driver.Value
+
+	seenStacks    map[uint64]bool
+	seenLocations map[uint64]bool
+	seenFunctions map[uint64]bool
+	seenMappings  map[uint64]bool
+}
+
+func newProfileRows(tenantID string) *profileRows {
+	return &profileRows{
+		tenantID:      tenantID,
+		seenStacks:    map[uint64]bool{},
+		seenLocations: map[uint64]bool{},
+		seenFunctions: map[uint64]bool{},
+		seenMappings:  map[uint64]bool{},
+	}
+}
+
+// firstSeen reports whether id has not been added to seen before.
+func firstSeen(seen map[uint64]bool, id uint64) bool {
+	if seen[id] {
+		return false
+	}
+	seen[id] = true
+	return true
+}
+
+func (r *profileRows) add(pd pprofile.Profiles) error {
+	dic := pd.Dictionary()
+
+	// Entry IDs by dictionary index, the same entry is usually referenced
+	// by many samples.
+	stackIDs := map[int32]uint64{}
+
+	rps := pd.ResourceProfiles()
+	for i := range rps.Len() {
+		rp := rps.At(i)
+		resAttr := rp.Resource().Attributes()
+		serviceName := getServiceName(resAttr)
+
+		resAttrBytes, err := json.Marshal(resAttr.AsRaw())
+		if err != nil {
+			return fmt.Errorf("failed to marshal json profile resource attributes: %w", err)
+		}
+
+		for j := range rp.ScopeProfiles().Len() {
+			sp := rp.ScopeProfiles().At(j)
+			scope := sp.Scope()
+
+			scopeAttrBytes, err := json.Marshal(scope.Attributes().AsRaw())
+			if err != nil {
+				return fmt.Errorf("failed to marshal json profile scope attributes: %w", err)
+			}
+
+			for k := range sp.Profiles().Len() {
+				profile := sp.Profiles().At(k)
+
+				profileAttrBytes, err := marshalAttributeIndices(dic, profile)
+				if err != nil {
+					return fmt.Errorf("failed to marshal json profile attributes: %w", err)
+				}
+
+				for l := range profile.Samples().Len() {
+					sample := profile.Samples().At(l)
+
+					stackID, ok := stackIDs[sample.StackIndex()]
+					if !ok {
+						stackID, err = r.addStack(dic, sample.StackIndex())
+						if err != nil {
+							return err
+						}
+						stackIDs[sample.StackIndex()] = stackID
+					}
+
+					sampleAttrBytes, err := marshalAttributeIndices(dic, sample)
+					if err != nil {
+						return fmt.Errorf("failed to marshal json profile sample attributes: %w", err)
+					}
+
+					traceID, spanID := sampleLink(dic, sample.LinkIndex())
+
+					timestamps := make([]time.Time, sample.TimestampsUnixNano().Len())
+					for m, ts := range sample.TimestampsUnixNano().All() {
+						timestamps[m] = pcommon.Timestamp(ts).AsTime()
+					}
+
+					r.samples = append(r.samples, []driver.Value{
+						profile.Time().AsTime(),
+						profile.ProfileID().String(),
+						traceID,
+						spanID,
+						serviceName,
+						rp.SchemaUrl(),
+						json.RawMessage(resAttrBytes),
+						sp.SchemaUrl(),
+						scope.Name(),
+						scope.Version(),
+						json.RawMessage(scopeAttrBytes),
+						json.RawMessage(profileAttrBytes),
+						profile.DurationNano(),
+						dictionaryString(dic, profile.PeriodType().TypeStrindex()),
+						dictionaryString(dic, profile.PeriodType().UnitStrindex()),
+						profile.Period(),
+						dictionaryString(dic, profile.SampleType().TypeStrindex()),
+						dictionaryString(dic, profile.SampleType().UnitStrindex()),
+						profile.OriginalPayloadFormat(),
+						stackID,
+						sample.Values().AsRaw(),
+						timestamps,
+						json.RawMessage(sampleAttrBytes),
+						r.tenantID,
+					})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *profileRows) addStack(dic pprofile.ProfilesDictionary, index int32) (uint64, error) {
+	// Index 0 is the empty stack, which the table may leave out.
+	locationIndices := pcommon.NewInt32Slice()
+	if int(index) < dic.StackTable().Len() {
+		locationIndices = dic.StackTable().At(int(index)).LocationIndices()
+	}
+
+	locationIDs := make([]uint64, locationIndices.Len())
+	for i, locationIndex := range locationIndices.All() {
+		id, err := r.addLocation(dic, locationIndex)
+		if err != nil {
+			return 0, err
+		}
+		locationIDs[i] = id
+	}
+
+	h := newEntryHash()
+	for _, id := range locationIDs {
+		h.uint64(id)
+	}
+	id := h.sum()
+
+	if firstSeen(r.seenStacks, id) {
+		r.stacks = append(r.stacks, []driver.Value{id, locationIDs, r.tenantID})
+	}
+	return id, nil
+}
+
+func (r *profileRows) addLocation(dic pprofile.ProfilesDictionary, index int32) (uint64, error) {
+	location := dic.LocationTable().At(int(index))
+
+	// A mapping index of 0 means the mapping is unknown.
+	var mappingID any
+	h := newEntryHash()
+	if location.MappingIndex() > 0 {
+		id, err := r.addMapping(dic, location.MappingIndex())
+		if err != nil {
+			return 0, err
+		}
+		mappingID = id
+		h.uint64(id)
+	}
+
+	lines := location.Lines()
+	functionIDs := make([]uint64, lines.Len())
+	lineNumbers := make([]int64, lines.Len())
+	columns := make([]int64, lines.Len())
+	for i, line := range lines.All() {
+		functionIDs[i] = r.addFunction(dic, line.FunctionIndex())
+		lineNumbers[i] = line.Line()
+		columns[i] = line.Column()
+		h.uint64(functionIDs[i])
+		h.int64(line.Line())
+		h.int64(line.Column())
+	}
+
+	attrBytes, err := marshalAttributeIndices(dic, location)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal json profile location attributes: %w", err)
+	}
+	h.uint64(location.Address())
+	h.bytes(attrBytes)
+	id := h.sum()
+
+	if firstSeen(r.seenLocations, id) {
+		r.locations = append(r.locations, []driver.Value{
+			id,
+			mappingID,
+			location.Address(),
+			functionIDs,
+			lineNumbers,
+			columns,
+			json.RawMessage(attrBytes),
+			r.tenantID,
+		})
+	}
+	return id, nil
+}
+
+func (r *profileRows) addFunction(dic pprofile.ProfilesDictionary, index int32) uint64 {
+	function := dic.FunctionTable().At(int(index))
+	name := dictionaryString(dic, function.NameStrindex())
+	systemName := dictionaryString(dic, function.SystemNameStrindex())
+	filename := dictionaryString(dic, function.FilenameStrindex())
+
+	h := newEntryHash()
+	h.string(name)
+	h.string(systemName)
+	h.string(filename)
+	h.int64(function.StartLine())
+	id := h.sum()
+
+	if firstSeen(r.seenFunctions, id) {
+		r.functions = append(r.functions, []driver.Value{
+			id,
+			name,
+			systemName,
+			filename,
+			function.StartLine(),
+			r.tenantID,
+		})
+	}
+	return id
+}
+
+func (r *profileRows) addMapping(dic pprofile.ProfilesDictionary, index int32) (uint64, error) {
+	mapping := dic.MappingTable().At(int(index))
+	filename := dictionaryString(dic, mapping.FilenameStrindex())
+
+	attrBytes, err := marshalAttributeIndices(dic, mapping)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal json profile mapping attributes: %w", err)
+	}
+
+	h := newEntryHash()
+	h.uint64(mapping.MemoryStart())
+	h.uint64(mapping.MemoryLimit())
+	h.uint64(mapping.FileOffset())
+	h.string(filename)
+	h.bytes(attrBytes)
+	id := h.sum()
+
+	if firstSeen(r.seenMappings, id) {
+		r.mappings = append(r.mappings, []driver.Value{
+			id,
+			mapping.MemoryStart(),
+			mapping.MemoryLimit(),
+			mapping.FileOffset(),
+			filename,
+			json.RawMessage(attrBytes),
+			r.tenantID,
+		})
+	}
+	return id, nil
+}
+
+// entryHash computes the ID of a dictionary entry from its fields.
+type entryHash struct {
+	h   hash.Hash64
+	buf [8]byte
+}
+
+func newEntryHash() *entryHash {
+	return &entryHash{h: fnv.New64a()}
+}
+
+func (e *entryHash) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:], v)
+	e.h.Write(e.buf[:])
+}
+
+func (e *entryHash) int64(v int64) {
+	e.uint64(uint64(v))
+}
+
+// bytes hashes b with its length, so that consecutive fields cannot run
+// into each other.
+func (e *entryHash) bytes(b []byte) {
+	e.uint64(uint64(len(b)))
+	e.h.Write(b)
+}
+
+func (e *entryHash) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *entryHash) sum() uint64 {
+	return e.h.Sum64()
+}
+
+type attributable interface {
+	AttributeIndices() pcommon.Int32Slice
+}
+
+func marshalAttributeIndices(dic pprofile.ProfilesDictionary, record attributable) ([]byte, error) {
+	attrs := pprofile.FromAttributeIndices(dic.AttributeTable(), record, dic)
+	return json.Marshal(attrs.AsRaw())
+}
+
+// dictionaryString returns the string at index, index 0 is the empty string.
+func dictionaryString(dic pprofile.ProfilesDictionary, index int32) string {
+	if int(index) >= dic.StringTable().Len() {
+		return ""
+	}
+	return dic.StringTable().At(int(index))
+}
+
+// sampleLink returns the trace and span a sample was recorded in, or empty
+// strings if the sample is not linked to a span.
+func sampleLink(dic pprofile.ProfilesDictionary, index int32) (string, string) {
+	if index == 0 || int(index) >= dic.LinkTable().Len() {
+		return "", ""
+	}
+
+	link := dic.LinkTable().At(int(index))
+	if link.TraceID().IsEmpty() {
+		return "", ""
+	}
+	return link.TraceID().String(), link.SpanID().String()
+}
+
+// QueryProfileSamples returns the latest samples of the tenant of ctx, with
+// the function names of their stack.
+func QueryProfileSamples(ctx context.Context, s *Storage) ([]ProfileSample, error) {
+	query := renderQuery(queryProfileSamplesSQL,
+		s.Config.ProfilesSamplesTable,
+		s.Config.ProfilesStacksTable,
+		s.Config.ProfilesLocationsTable,
+		s.Config.ProfilesFunctionsTable,
+	)
+	tenantID := tenant.FromContext(ctx)
+
+	rows, err := s.DB.QueryContext(ctx, query, tenantID, tenantID, tenantID, tenantID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	results := make([]ProfileSample, 0)
+
+	for rows.Next() {
+		var result ProfileSample
+
+		var timestamp time.Time
+		var values duckdb.Composite[[]int64]
+		var frames duckdb.Composite[[]string]
+
+		err := rows.Scan(
+			&timestamp,
+			&result.ProfileId,
+			&result.TraceId,
+			&result.SpanId,
+			&result.ServiceName,
+			&result.SampleType,
+			&result.SampleUnit,
+			&values,
+			&frames,
+		)
+		if err != nil {
+			return nil, scanError(err)
+		}
+
+		result.Timestamp = timestamp.UnixMicro()
+		result.Values = values.Get()
+		result.Frames = frames.Get()
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
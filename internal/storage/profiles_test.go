@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// generateSampleProfiles returns a CPU profile with count samples of the
+// stack main -> handle -> parse, parse inlined into handle.
+func generateSampleProfiles(count int) pprofile.Profiles {
+	pd := pprofile.NewProfiles()
+	dic := pd.Dictionary()
+
+	strings := dic.StringTable()
+	for _, s := range []string{"", "cpu", "nanoseconds", "main", "handle", "parse", "main.go", "/bin/app", "thread.name", "worker"} {
+		strings.Append(s)
+	}
+
+	// Index 0 of every table is the zero value.
+	dic.MappingTable().AppendEmpty()
+	dic.LocationTable().AppendEmpty()
+	dic.FunctionTable().AppendEmpty()
+	dic.LinkTable().AppendEmpty()
+	dic.StackTable().AppendEmpty()
+	dic.AttributeTable().AppendEmpty()
+
+	mapping := dic.MappingTable().AppendEmpty()
+	mapping.SetMemoryStart(0x1000)
+	mapping.SetMemoryLimit(0x2000)
+	mapping.SetFilenameStrindex(7)
+
+	for _, name := range []int32{3, 4, 5} {
+		function := dic.FunctionTable().AppendEmpty()
+		function.SetNameStrindex(name)
+		function.SetFilenameStrindex(6)
+	}
+
+	// The leaf location holds parse inlined into handle.
+	leaf := dic.LocationTable().AppendEmpty()
+	leaf.SetMappingIndex(1)
+	leaf.SetAddress(0x1100)
+	leaf.Lines().AppendEmpty().SetFunctionIndex(3)
+	leaf.Lines().AppendEmpty().SetFunctionIndex(2)
+	root := dic.LocationTable().AppendEmpty()
+	root.SetMappingIndex(1)
+	root.SetAddress(0x1200)
+	root.Lines().AppendEmpty().SetFunctionIndex(1)
+
+	dic.StackTable().AppendEmpty().LocationIndices().FromRaw([]int32{1, 2})
+
+	link := dic.LinkTable().AppendEmpty()
+	link.SetTraceID(pcommon.TraceID{1, 2, 3})
+	link.SetSpanID(pcommon.SpanID{4, 5, 6})
+
+	attr := dic.AttributeTable().AppendEmpty()
+	attr.SetKeyStrindex(8)
+	attr.Value().SetStr("worker")
+
+	rp := pd.ResourceProfiles().AppendEmpty()
+	rp.Resource().Attributes().PutStr("service.name", "profiled-service")
+	profile := rp.ScopeProfiles().AppendEmpty().Profiles().AppendEmpty()
+	profile.SetProfileID(pprofile.ProfileID{1})
+	profile.SetTime(pcommon.NewTimestampFromTime(time.Now()))
+	profile.SampleType().SetTypeStrindex(1)
+	profile.SampleType().SetUnitStrindex(2)
+
+	for i := range count {
+		sample := profile.Samples().AppendEmpty()
+		sample.SetStackIndex(1)
+		sample.SetLinkIndex(1)
+		sample.Values().Append(int64(i + 1))
+		sample.AttributeIndices().Append(1)
+	}
+
+	return pd
+}
+
+func TestInsertProfilesDataAndQuery(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		if err := InsertProfilesData(ctx, s, generateSampleProfiles(2), generateSampleProfiles(1)); err != nil {
+			t.Fatalf("InsertProfilesData failed: %v", err)
+		}
+		// A later batch references the same entries.
+		if err := InsertProfilesData(ctx, s, generateSampleProfiles(1)); err != nil {
+			t.Fatalf("InsertProfilesData failed: %v", err)
+		}
+
+		samples, err := QueryProfileSamples(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryProfileSamples failed: %v", err)
+		}
+		if len(samples) != 4 {
+			t.Fatalf("Expected 4 samples, got %d", len(samples))
+		}
+
+		sample := samples[0]
+		if sample.ServiceName != "profiled-service" || sample.SampleType != "cpu" || sample.SampleUnit != "nanoseconds" {
+			t.Errorf("Unexpected sample: %+v", sample)
+		}
+		if sample.TraceId != "01020300000000000000000000000000" || sample.SpanId != "0405060000000000" {
+			t.Errorf("Expected sample to be linked to its span, got trace %q span %q", sample.TraceId, sample.SpanId)
+		}
+		if frames := []string{"parse", "handle", "main"}; !slices.Equal(sample.Frames, frames) {
+			t.Errorf("Expected frames %v, got %v", frames, sample.Frames)
+		}
+
+		// All requests reference the same entries, they are written once.
+		for table, expected := range map[string]int{
+			s.Config.ProfilesStacksTable:    1,
+			s.Config.ProfilesLocationsTable: 2,
+			s.Config.ProfilesFunctionsTable: 3,
+			s.Config.ProfilesMappingsTable:  1,
+		} {
+			var count int
+			if err := s.DB.QueryRowContext(ctx, "SELECT count(*) FROM "+table).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != expected {
+				t.Errorf("Expected %d rows in %s, got %d", expected, table, count)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 )
 
 type StorageType string
@@ -26,6 +27,11 @@ type StorageConfig struct {
 	MetricsHistogramTable            string
 	MetricsExponentialHistogramTable string
 	MetricsSummaryTable              string
+	ProfilesSamplesTable             string
+	ProfilesStacksTable              string
+	ProfilesLocationsTable           string
+	ProfilesFunctionsTable           string
+	ProfilesMappingsTable            string
 
 	// DuckLake configuration
 	DuckLakeName              string
@@ -50,6 +56,9 @@ type Storage struct {
 	InsertMetricsHistogramSQL            string
 	InsertMetricsExponentialHistogramSQL string
 	InsertMetricsSummarySQL              string
+
+	// Held while profiles are written, see InsertProfilesData.
+	profilesMu sync.Mutex
 }
 
 func openDuckDB(dsn string) (*sql.DB, error) {
@@ -80,7 +89,10 @@ func (b DuckDBBackend) init(ctx context.Context, dsn string, cfg StorageConfig)
 		return nil, err
 	}
 
-	createTables(ctx, cfg, db)
+	if err := createTables(ctx, cfg, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
 
 	return db, nil
 }
@@ -94,7 +106,10 @@ func (b DuckLakeBackend) init(ctx context.Context, dsn string, cfg StorageConfig
 	}
 
 	setupDuckLake(ctx, cfg, db)
-	createTables(ctx, cfg, db)
+	if err := createTables(ctx, cfg, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
 
 	return db, nil
 }
@@ -173,6 +188,11 @@ func execQueries(ctx context.Context, db *sql.DB, queries []string) error {
 	return nil
 }
 
+// Tables created before tenants were stored lack the tenant_id column. It
+// is added last, matching the column order of the CREATE TABLE statements,
+// and the existing rows belong to the default tenant.
+const addTenantColumnSQL = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS tenant_id VARCHAR DEFAULT '';`
+
 // Create all tables used by sweetcorn.
 func createTables(ctx context.Context, cfg StorageConfig, db *sql.DB) error {
 	var createTableQueries = []string{
@@ -183,11 +203,38 @@ func createTables(ctx context.Context, cfg StorageConfig, db *sql.DB) error {
 		renderQuery(createMetricsHistogramTable, cfg.MetricsHistogramTable),
 		renderQuery(createMetricsExponentialHistogramTable, cfg.MetricsExponentialHistogramTable),
 		renderQuery(createMetricsSummaryTable, cfg.MetricsSummaryTable),
+		renderQuery(createProfilesSamplesTableSQL, cfg.ProfilesSamplesTable),
+		renderQuery(createProfilesStacksTableSQL, cfg.ProfilesStacksTable),
+		renderQuery(createProfilesLocationsTableSQL, cfg.ProfilesLocationsTable),
+		renderQuery(createProfilesFunctionsTableSQL, cfg.ProfilesFunctionsTable),
+		renderQuery(createProfilesMappingsTableSQL, cfg.ProfilesMappingsTable),
+	}
+
+	for _, table := range cfg.tables() {
+		createTableQueries = append(createTableQueries, renderQuery(addTenantColumnSQL, table))
 	}
 
 	return execQueries(ctx, db, createTableQueries)
 }
 
+// tables returns the names of all tables used by sweetcorn.
+func (cfg StorageConfig) tables() []string {
+	return []string{
+		cfg.LogsTable,
+		cfg.TracesTable,
+		cfg.MetricsGaugeTable,
+		cfg.MetricsSumTable,
+		cfg.MetricsHistogramTable,
+		cfg.MetricsExponentialHistogramTable,
+		cfg.MetricsSummaryTable,
+		cfg.ProfilesSamplesTable,
+		cfg.ProfilesStacksTable,
+		cfg.ProfilesLocationsTable,
+		cfg.ProfilesFunctionsTable,
+		cfg.ProfilesMappingsTable,
+	}
+}
+
 func setupDuckLake(ctx context.Context, cfg StorageConfig, db *sql.DB) error {
 	// TODO: add config validation.
 
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		teamA := tenant.NewContext(ctx, "team-a")
+		teamB := tenant.NewContext(ctx, "team-b")
+
+		if err := InsertLogsData(teamA, s, generateSampleLogs(3)); err != nil {
+			t.Fatalf("InsertLogsData failed: %v", err)
+		}
+		if err := InsertLogsData(teamB, s, generateSampleLogs(2)); err != nil {
+			t.Fatalf("InsertLogsData failed: %v", err)
+		}
+		if err := InsertTracesData(teamA, s, generateSampleTraces(4)); err != nil {
+			t.Fatalf("InsertTracesData failed: %v", err)
+		}
+
+		for _, tt := range []struct {
+			ctx    context.Context
+			logs   int
+			traces int
+		}{
+			{teamA, 3, 4},
+			{teamB, 2, 0},
+			{ctx, 0, 0},
+		} {
+			logs, err := QueryLogs(tt.ctx, s)
+			if err != nil {
+				t.Fatalf("QueryLogs failed: %v", err)
+			}
+			traces, err := QueryTraces(tt.ctx, s)
+			if err != nil {
+				t.Fatalf("QueryTraces failed: %v", err)
+			}
+			if len(logs) != tt.logs || len(traces) != tt.traces {
+				t.Errorf("Tenant %q: expected %d logs and %d spans, got %d and %d",
+					tenant.FromContext(tt.ctx), tt.logs, tt.traces, len(logs), len(traces))
+			}
+		}
+
+		services, err := TraceServices(teamB, s)
+		if err != nil {
+			t.Fatalf("TraceServices failed: %v", err)
+		}
+		if len(services) != 0 {
+			t.Errorf("Expected no services for team-b, got %v", services)
+		}
+	})
+}
+
+func TestAddTenantColumn(t *testing.T) {
+	ctx := context.Background()
+	cfg := StorageConfig{
+		StorageType:                      DuckDB,
+		DataDir:                          t.TempDir(),
+		DBName:                           "main.db",
+		LogsTable:                        DefaultLogsTableName,
+		TracesTable:                      DefaultTracesTableName,
+		MetricsSumTable:                  DefaultMetricsSumTableName,
+		MetricsGaugeTable:                DefaultMetricsGaugeTableName,
+		MetricsHistogramTable:            DefaultMetricsHistogramTableName,
+		MetricsExponentialHistogramTable: DefaultMetricsExponentialHistogramTableName,
+		MetricsSummaryTable:              DefaultMetricsSummaryTableName,
+		ProfilesSamplesTable:             DefaultProfilesSamplesTableName,
+		ProfilesStacksTable:              DefaultProfilesStacksTableName,
+		ProfilesLocationsTable:           DefaultProfilesLocationsTableName,
+		ProfilesFunctionsTable:           DefaultProfilesFunctionsTableName,
+		ProfilesMappingsTable:            DefaultProfilesMappingsTableName,
+	}
+
+	// A logs table as created before tenants were stored.
+	db, err := sql.Open("duckdb", cfg.DataDir+"/"+cfg.DBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ExecContext(ctx, `CREATE TABLE otel_logs (
+		ts TIMESTAMP_NS, trace_id VARCHAR, span_id VARCHAR, trace_flags UINTEGER,
+		severity_text VARCHAR, severity_number UTINYINT, service_name VARCHAR, body VARCHAR,
+		resource_schema_url VARCHAR, resource_attributes JSON, scope_schema_url VARCHAR,
+		scope_name VARCHAR, scope_version VARCHAR, scope_attributes JSON,
+		log_attributes JSON, event_name VARCHAR);
+		INSERT INTO otel_logs VALUES (TIMESTAMP_NS '2024-01-01 00:00:00', '', '', 0, 'INFO', 9,
+			'service', 'before', '', '{}', '', '', '', '{}', '{}', '');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewStorage(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	if err := InsertLogsData(ctx, s, generateSampleLogs(1)); err != nil {
+		t.Fatalf("InsertLogsData failed: %v", err)
+	}
+
+	logs, err := QueryLogs(ctx, s)
+	if err != nil {
+		t.Fatalf("QueryLogs failed: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("Expected the old and the new row in the default tenant, got %d rows", len(logs))
+	}
+}
@@ -6,11 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/duckdb/duckdb-go/v2"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const (
@@ -40,7 +41,8 @@ CREATE TABLE IF NOT EXISTS
 		links_trace_ids			VARCHAR[],
 		links_span_ids			VARCHAR[],
 		links_trace_states		VARCHAR[],
-		links_attributes		JSON[]
+		links_attributes		JSON[],
+		tenant_id				VARCHAR DEFAULT ''
 	);`
 
 	insertTracesSQL = `
@@ -67,10 +69,11 @@ INSERT INTO
 		links_trace_ids,
 		links_span_ids,
 		links_trace_states,
-		links_attributes
+		links_attributes,
+		tenant_id
 	)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	queryTracesSQL = `
 SELECT
@@ -98,6 +101,8 @@ SELECT
 	links_attributes
 FROM
 	%s
+WHERE
+	tenant_id = ?
 ORDER BY
 	ts DESC
 LIMIT
@@ -108,6 +113,8 @@ SELECT DISTINCT
     service_name
 FROM
 	%s
+WHERE
+	tenant_id = ?
 LIMIT
 	100;`
 
@@ -117,7 +124,8 @@ SELECT DISTINCT
 FROM
 	%s
 WHERE
-	service_name = ?
+	tenant_id = ?
+	AND service_name = ?
 	AND (? = '' OR span_kind = ?)
 LIMIT
 	100;`
@@ -147,7 +155,8 @@ SELECT
 FROM
 	%s
 WHERE
-	(? IS NULL OR service_name = ?)
+	tenant_id = ?
+	AND (? IS NULL OR service_name = ?)
 GROUP BY
 	trace_id
 LIMIT
@@ -172,7 +181,8 @@ SELECT
 FROM
 	%s
 WHERE
-	trace_id = ?
+	tenant_id = ?
+	AND trace_id = ?
 	AND (? = 0 OR epoch_us(ts) >= ?)
 	AND (? = 0 OR epoch_us(ts) <  ?)
 GROUP BY
@@ -186,14 +196,16 @@ SELECT DISTINCT
         FROM
 			%s AS p
         WHERE
-            p.span_id = c.parent_span_id
+            p.tenant_id = c.tenant_id
+            AND p.span_id = c.parent_span_id
     ) AS parent_service_name,
     c.service_name AS child_service_name,
     COUNT(*) AS count
 FROM
     %s as c
 WHERE
-    c.parent_span_id != ''
+    c.tenant_id = ?
+    AND c.parent_span_id != ''
 GROUP BY
     parent_service_name,
     child_service_name;`
@@ -284,9 +296,9 @@ type DependenciesData struct {
 	Count             int    `json:"callCount"`
 }
 
-var ErrTraceNotFound = errors.New("trace not found")
+var ErrTraceNotFound = fmt.Errorf("trace %w", ErrNotFound)
 
-func convertEvents(events ptrace.SpanEventSlice) (times []time.Time, names, attrs []string, err error) {
+func convertEvents(events ptrace.SpanEventSlice) (times []time.Time, names []string, attrs []json.RawMessage, err error) {
 	for i := 0; i < events.Len(); i++ {
 		event := events.At(i)
 		times = append(times, event.Timestamp().AsTime())
@@ -296,13 +308,13 @@ func convertEvents(events ptrace.SpanEventSlice) (times []time.Time, names, attr
 		if eventAttrErr != nil {
 			return nil, nil, nil, fmt.Errorf("failed to marshal json trace event attributes: %w", eventAttrErr)
 		}
-		attrs = append(attrs, string(eventAttrBytes))
+		attrs = append(attrs, json.RawMessage(eventAttrBytes))
 	}
 
 	return
 }
 
-func convertLinks(links ptrace.SpanLinkSlice) (traceIDs, spanIDs, states, attrs []string, err error) {
+func convertLinks(links ptrace.SpanLinkSlice) (traceIDs, spanIDs, states []string, attrs []json.RawMessage, err error) {
 	for i := 0; i < links.Len(); i++ {
 		link := links.At(i)
 		traceIDs = append(traceIDs, link.TraceID().String())
@@ -313,7 +325,7 @@ func convertLinks(links ptrace.SpanLinkSlice) (traceIDs, spanIDs, states, attrs
 		if linkAttrErr != nil {
 			return nil, nil, nil, nil, fmt.Errorf("failed to marshal json trace link attributes: %w", linkAttrErr)
 		}
-		attrs = append(attrs, string(linkAttrBytes))
+		attrs = append(attrs, json.RawMessage(linkAttrBytes))
 	}
 
 	return
@@ -323,7 +335,18 @@ func RenderDependenciesSQL(tableName string) string {
 	return fmt.Sprintf(dependenciesSQL, tableName, tableName)
 }
 
-func InsertTracesData(ctx context.Context, db *sql.DB, insertTracesSQL string, td ptrace.Traces) error {
+// InsertTracesData writes all spans in td to the traces table using the
+// DuckDB Appender. The spans are committed in a single transaction.
+func InsertTracesData(ctx context.Context, s *Storage, td ptrace.Traces) error {
+	tenantID := tenant.FromContext(ctx)
+	return s.withTx(ctx, func(tx ingestTx) error {
+		return tx.append(s.Config.TracesTable, func(a rowAppender) error {
+			return appendTracesData(a, td, tenantID)
+		})
+	})
+}
+
+func appendTracesData(a rowAppender, td ptrace.Traces, tenantID string) error {
 	rsSpans := td.ResourceSpans()
 
 	for i := range rsSpans.Len() {
@@ -365,7 +388,7 @@ func InsertTracesData(ctx context.Context, db *sql.DB, insertTracesSQL string, t
 					return fmt.Errorf("failed to convert json trace links: %w", linksErr)
 				}
 
-				_, err := db.ExecContext(ctx, insertTracesSQL,
+				err := a.AppendRow(
 					span.StartTimestamp().AsTime(),
 					span.TraceID().String(),
 					span.SpanID().String(),
@@ -374,11 +397,11 @@ func InsertTracesData(ctx context.Context, db *sql.DB, insertTracesSQL string, t
 					span.Name(),
 					span.Kind().String(),
 					serviceName,
-					resAttrBytes,
+					json.RawMessage(resAttrBytes),
 					scopeName,
 					scopeVersion,
-					spanAttrBytes,
-					spanDurationNanos,
+					json.RawMessage(spanAttrBytes),
+					uint64(spanDurationNanos),
 					spanStatus.Code().String(),
 					spanStatus.Message(),
 					eventTimes,
@@ -388,6 +411,7 @@ func InsertTracesData(ctx context.Context, db *sql.DB, insertTracesSQL string, t
 					linksSpanIDs,
 					linksTraceStates,
 					linksAttrs,
+					tenantID,
 				)
 				if err != nil {
 					return err
@@ -400,9 +424,9 @@ func InsertTracesData(ctx context.Context, db *sql.DB, insertTracesSQL string, t
 }
 
 func QueryTraces(ctx context.Context, s *Storage) ([]TraceRecord, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(queryTracesSQL, s.Config.TracesTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(queryTracesSQL, s.Config.TracesTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -449,7 +473,7 @@ func QueryTraces(ctx context.Context, s *Storage) ([]TraceRecord, error) {
 		)
 
 		if err != nil {
-			return nil, err
+			return nil, scanError(err)
 		}
 
 		result.EventsTimestamps = eventsTimestamps.Get()
@@ -474,9 +498,9 @@ func QueryTraces(ctx context.Context, s *Storage) ([]TraceRecord, error) {
 }
 
 func TraceServices(ctx context.Context, s *Storage) ([]string, error) {
-	rows, err := s.DB.QueryContext(ctx, renderQuery(traceServicesSQL, s.Config.TracesTable))
+	rows, err := s.DB.QueryContext(ctx, renderQuery(traceServicesSQL, s.Config.TracesTable), tenant.FromContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -484,14 +508,14 @@ func TraceServices(ctx context.Context, s *Storage) ([]string, error) {
 	for rows.Next() {
 		var result string
 		if err := rows.Scan(&result); err != nil {
-			log.Fatal(err)
+			return nil, scanError(err)
 		}
 
 		results = append(results, result)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, classifyError(err)
 	}
 
 	return results, nil
@@ -504,12 +528,13 @@ type TraceOperationsParams struct {
 
 func TraceOperations(ctx context.Context, s *Storage, params TraceOperationsParams) ([]string, error) {
 	rows, err := s.DB.QueryContext(ctx, renderQuery(traceOperationsSQL, s.Config.TracesTable),
+		tenant.FromContext(ctx),
 		params.ServiceName,
 		params.SpanKind,
 		params.SpanKind,
 	)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -517,14 +542,14 @@ func TraceOperations(ctx context.Context, s *Storage, params TraceOperationsPara
 	for rows.Next() {
 		var result string
 		if err := rows.Scan(&result); err != nil {
-			log.Fatal(err)
+			return nil, scanError(err)
 		}
 
 		results = append(results, result)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, classifyError(err)
 	}
 
 	return results, nil
@@ -543,11 +568,12 @@ type SearchTracesParams struct {
 
 func SearchTraces(ctx context.Context, s *Storage, params SearchTracesParams) ([]TraceResponse, error) {
 	rows, err := s.DB.QueryContext(ctx, renderQuery(tracesSQL, s.Config.TracesTable),
+		tenant.FromContext(ctx),
 		params.ServiceName,
 		params.ServiceName,
 	)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -562,7 +588,7 @@ func SearchTraces(ctx context.Context, s *Storage, params SearchTracesParams) ([
 		)
 
 		if err != nil {
-			log.Fatal(err)
+			return nil, scanError(err)
 		}
 
 		// processes
@@ -622,7 +648,7 @@ func SearchTraces(ctx context.Context, s *Storage, params SearchTracesParams) ([
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, classifyError(err)
 	}
 
 	return results, nil
@@ -646,6 +672,7 @@ func Trace(ctx context.Context, s *Storage, params TraceParams) (TraceResponse,
 	}
 
 	row := s.DB.QueryRowContext(ctx, renderQuery(traceSQL, s.Config.TracesTable),
+		tenant.FromContext(ctx),
 		params.TraceID,
 		startTime,
 		startTime,
@@ -660,11 +687,11 @@ func Trace(ctx context.Context, s *Storage, params TraceParams) (TraceResponse,
 		&result.TraceID,
 		&spans,
 	)
-	if err == sql.ErrNoRows {
+	if errors.Is(err, sql.ErrNoRows) {
 		return result, ErrTraceNotFound
 	}
 	if err != nil {
-		return result, err
+		return result, classifyError(err)
 	}
 
 	// processes
@@ -731,9 +758,10 @@ func Dependencies(ctx context.Context, s *Storage, params DependenciesParams) ([
 	rows, err := s.DB.QueryContext(
 		ctx,
 		renderQuery(dependenciesSQL, s.Config.TracesTable, s.Config.TracesTable),
+		tenant.FromContext(ctx),
 	)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
@@ -745,14 +773,14 @@ func Dependencies(ctx context.Context, s *Storage, params DependenciesParams) ([
 			&result.ChildServiceName,
 			&result.Count,
 		); err != nil {
-			log.Fatal(err)
+			return nil, scanError(err)
 		}
 
 		results = append(results, result)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, classifyError(err)
 	}
 
 	return results, nil
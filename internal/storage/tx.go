@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/duckdb/duckdb-go/v2"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+// ingestTx is a transaction spanning every table written by one ingest call.
+// Appenders created with append write into the transaction, so their rows
+// are only visible once the transaction commits.
+type ingestTx struct {
+	// The context of the ingest call, the transaction does not outlive it.
+	ctx     context.Context
+	conn    driver.Conn
+	catalog string
+}
+
+// append calls fn with a DuckDB Appender for table. Rows are written column
+// by column in the table's layout, so the values passed to AppendRow must
+// follow the column order of the CREATE TABLE statement.
+func (tx ingestTx) append(table string, fn func(a rowAppender) error) error {
+	appender, err := duckdb.NewAppender(tx.conn, tx.catalog, "", table)
+	if err != nil {
+		return fmt.Errorf("failed to create appender for %s: %w", table, tx.appenderError(table, err))
+	}
+
+	if err := fn(txAppender{appender}); err != nil {
+		return errors.Join(err, appender.Close())
+	}
+
+	return appender.Close()
+}
+
+// appenderError returns the cause of err, the failure to create an appender
+// for table. The appender only keeps the message of the DuckDB error, not its
+// type, so the table is looked up again with a query: a missing table fails
+// with the same catalog error as on read, and is as permanent. A table that
+// exists but cannot be appended to has columns of unsupported types.
+func (tx ingestTx) appenderError(table string, err error) error {
+	rows, lookupErr := tx.query(fmt.Sprintf("SELECT * FROM %s LIMIT 0;", table))
+	if lookupErr != nil {
+		return errors.Join(err, classifyError(lookupErr))
+	}
+	rows.Close()
+	return consumererror.NewPermanent(err)
+}
+
+// query runs query in the transaction.
+func (tx ingestTx) query(query string, args ...driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := tx.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, consumererror.NewPermanent(fmt.Errorf("unexpected driver connection type %T", tx.conn))
+	}
+	return queryer.QueryContext(tx.ctx, query, args)
+}
+
+// storedIDs returns which of ids are in column of table for tenantID,
+// including the rows appended by the transaction.
+func (tx ingestTx) storedIDs(table, column, tenantID string, ids []uint64) (map[uint64]bool, error) {
+	query := fmt.Sprintf("SELECT %[1]s FROM %[2]s WHERE tenant_id = ? AND list_contains(?, %[1]s);", column, table)
+	rows, err := tx.query(query, []driver.NamedValue{
+		{Ordinal: 1, Value: tenantID},
+		{Ordinal: 2, Value: ids},
+	}...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored ids of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	stored := make(map[uint64]bool)
+	dest := make([]driver.Value, 1)
+	for {
+		if err := rows.Next(dest); err != nil {
+			if errors.Is(err, io.EOF) {
+				return stored, nil
+			}
+			return nil, fmt.Errorf("failed to read stored ids of %s: %w", table, err)
+		}
+		id, ok := dest[0].(uint64)
+		if !ok {
+			return nil, consumererror.NewPermanent(fmt.Errorf("unexpected id type %T in %s", dest[0], table))
+		}
+		stored[id] = true
+	}
+}
+
+// txAppender marks row conversion errors as permanent, the same rows fail
+// again when the request is retried.
+type txAppender struct {
+	*duckdb.Appender
+}
+
+func (a txAppender) AppendRow(args ...driver.Value) error {
+	if err := a.Appender.AppendRow(args...); err != nil {
+		return consumererror.NewPermanent(err)
+	}
+	return nil
+}
+
+// withTx runs fn in a single transaction. Either all rows appended by fn are
+// committed or, if fn or the commit fails, none of them are. Errors are
+// marked with consumererror to tell whether the caller may retry.
+func (s *Storage) withTx(ctx context.Context, fn func(tx ingestTx) error) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return consumererror.NewRetryableError(fmt.Errorf("failed to get connection, nothing written, safe to retry: %w", err))
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN TRANSACTION;"); err != nil {
+		return consumererror.NewRetryableError(fmt.Errorf("failed to begin transaction, nothing written, safe to retry: %w", err))
+	}
+
+	err = conn.Raw(func(driverConn any) error {
+		dc, ok := driverConn.(driver.Conn)
+		if !ok {
+			return consumererror.NewPermanent(fmt.Errorf("unexpected driver connection type %T", driverConn))
+		}
+
+		return fn(ingestTx{ctx: ctx, conn: dc, catalog: s.Config.catalog()})
+	})
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "COMMIT;")
+	}
+	if err != nil {
+		// Roll back even if ctx is done, the connection goes back to the pool.
+		if _, rbErr := conn.ExecContext(context.Background(), "ROLLBACK;"); rbErr != nil {
+			// The connection is in an unknown state, do not reuse it.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		return rolledBackError(err)
+	}
+
+	return nil
+}
+
+// rolledBackError wraps the error of a rolled back transaction. No rows were
+// committed, so a retry never duplicates data. It only helps if the failure
+// was not caused by the data itself.
+func rolledBackError(err error) error {
+	if IsPermanent(classifyError(err)) {
+		return consumererror.NewPermanent(fmt.Errorf("write rolled back, retrying will fail again: %w", err))
+	}
+
+	return consumererror.NewRetryableError(fmt.Errorf("write rolled back, safe to retry: %w", err))
+}
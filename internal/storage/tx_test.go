@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// failingMetrics appends the rows of its model, then fails as if the
+// connection timed out.
+type failingMetrics struct {
+	MetricsModel
+}
+
+func (m failingMetrics) insert(a rowAppender, tenantID string) error {
+	if err := m.MetricsModel.insert(a, tenantID); err != nil {
+		return err
+	}
+	return context.DeadlineExceeded
+}
+
+func TestInsertMetricsRollback(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		metricsMap := NewMetricsModel(s)
+		md := generateSampleMetrics(5)
+		for _, m := range md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().All() {
+			if m.Type() == pmetric.MetricTypeGauge {
+				metricsMap[m.Type()].Add(pcommon.NewMap(), "", pcommon.NewInstrumentationScope(), "", m)
+			}
+		}
+		metricsMap[pmetric.MetricTypeGauge] = failingMetrics{metricsMap[pmetric.MetricTypeGauge]}
+
+		err := InsertMetrics(ctx, s, metricsMap)
+		if err == nil {
+			t.Fatal("expected InsertMetrics to fail")
+		}
+		if !IsRetryable(err) {
+			t.Errorf("expected a retryable error, got %v", err)
+		}
+
+		gauges, err := QueryMetricsGauge(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsGauge failed: %v", err)
+		}
+		if len(gauges) != 0 {
+			t.Errorf("Expected no gauge rows after rollback, got %d", len(gauges))
+		}
+	})
+}
+
+func TestIngestMetricsDataMissingTable(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		if _, err := s.DB.ExecContext(ctx, "DROP TABLE "+s.Config.MetricsSummaryTable); err != nil {
+			t.Fatalf("failed to drop summary table: %v", err)
+		}
+
+		// A missing table fails the same way on every write, as on read.
+		err := IngestMetricsData(ctx, s, generateSampleMetrics(5))
+		if !IsPermanent(err) {
+			t.Errorf("expected a permanent error, got %v", err)
+		}
+
+		gauges, err := QueryMetricsGauge(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryMetricsGauge failed: %v", err)
+		}
+		if len(gauges) != 0 {
+			t.Errorf("Expected no gauge rows after rollback, got %d", len(gauges))
+		}
+	})
+}
+
+func TestInsertLogsDataRollbackPermanent(t *testing.T) {
+	withTestDB(t, func(ctx context.Context, s *Storage) {
+		numLogs := 10
+		logs := generateSampleLogs(numLogs)
+
+		// NaN cannot be encoded as JSON, so the last record fails.
+		records := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+		records.At(numLogs-1).Attributes().PutDouble("ratio", math.NaN())
+
+		err := InsertLogsData(ctx, s, logs)
+		if err == nil {
+			t.Fatal("expected InsertLogsData to fail")
+		}
+		if !consumererror.IsPermanent(err) {
+			t.Errorf("expected a permanent error, got %v", err)
+		}
+
+		results, err := QueryLogs(ctx, s)
+		if err != nil {
+			t.Fatalf("QueryLogs failed: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no log rows after rollback, got %d", len(results))
+		}
+	})
+}
@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Rejected describes the records removed by validation, in the shape of an
+// OTLP partial success.
+// Ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#partial-success
+type Rejected struct {
+	// Number of log records, spans, data points or profiles that were
+	// removed.
+	Count int64
+	// Reasons for the rejection, empty if nothing was rejected.
+	Message string
+}
+
+// rejections counts rejected records per reason, keeping the order in which
+// the reasons were first seen.
+type rejections struct {
+	total   int64
+	reasons []string
+	counts  map[string]int64
+}
+
+func (r *rejections) add(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	if r.counts == nil {
+		r.counts = map[string]int64{}
+	}
+	if _, ok := r.counts[reason]; !ok {
+		r.reasons = append(r.reasons, reason)
+	}
+	r.counts[reason] += int64(n)
+	r.total += int64(n)
+}
+
+func (r *rejections) result(kind string) Rejected {
+	if r.total == 0 {
+		return Rejected{}
+	}
+
+	parts := make([]string, 0, len(r.reasons))
+	for _, reason := range r.reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", r.counts[reason], reason))
+	}
+	return Rejected{
+		Count:   r.total,
+		Message: fmt.Sprintf("rejected %d %s: %s", r.total, kind, strings.Join(parts, ", ")),
+	}
+}
+
+const reasonNonFiniteAttribute = "with a NaN or infinite attribute value"
+
+// finiteAttributes reports whether attrs can be encoded as JSON. encoding/json
+// rejects NaN and infinite floats, which would fail the whole batch.
+func finiteAttributes(attrs pcommon.Map) bool {
+	ok := true
+	attrs.Range(func(_ string, v pcommon.Value) bool {
+		ok = finiteValue(v)
+		return ok
+	})
+	return ok
+}
+
+func finiteValue(v pcommon.Value) bool {
+	switch v.Type() {
+	case pcommon.ValueTypeDouble:
+		return !math.IsNaN(v.Double()) && !math.IsInf(v.Double(), 0)
+	case pcommon.ValueTypeMap:
+		return finiteAttributes(v.Map())
+	case pcommon.ValueTypeSlice:
+		s := v.Slice()
+		for i := 0; i < s.Len(); i++ {
+			if !finiteValue(s.At(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateLogs removes the log records of ld that cannot be stored.
+func ValidateLogs(ld plog.Logs) Rejected {
+	var r rejections
+
+	ld.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
+		if !finiteAttributes(rl.Resource().Attributes()) {
+			r.add(reasonNonFiniteAttribute, countScopeLogs(rl.ScopeLogs()))
+			return true
+		}
+		rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
+			if !finiteAttributes(sl.Scope().Attributes()) {
+				r.add(reasonNonFiniteAttribute, sl.LogRecords().Len())
+				return true
+			}
+			sl.LogRecords().RemoveIf(func(lr plog.LogRecord) bool {
+				if !finiteAttributes(lr.Attributes()) {
+					r.add(reasonNonFiniteAttribute, 1)
+					return true
+				}
+				return false
+			})
+			return sl.LogRecords().Len() == 0
+		})
+		return rl.ScopeLogs().Len() == 0
+	})
+
+	return r.result("log records")
+}
+
+func countScopeLogs(sls plog.ScopeLogsSlice) int {
+	count := 0
+	for i := 0; i < sls.Len(); i++ {
+		count += sls.At(i).LogRecords().Len()
+	}
+	return count
+}
+
+// ValidateTraces removes the spans of td that cannot be stored.
+func ValidateTraces(td ptrace.Traces) Rejected {
+	var r rejections
+
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		if !finiteAttributes(rs.Resource().Attributes()) {
+			r.add(reasonNonFiniteAttribute, countScopeSpans(rs.ScopeSpans()))
+			return true
+		}
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				if reason := validateSpan(span); reason != "" {
+					r.add(reason, 1)
+					return true
+				}
+				return false
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+
+	return r.result("spans")
+}
+
+func countScopeSpans(sss ptrace.ScopeSpansSlice) int {
+	count := 0
+	for i := 0; i < sss.Len(); i++ {
+		count += sss.At(i).Spans().Len()
+	}
+	return count
+}
+
+// validateSpan returns why span cannot be stored, or "" if it can.
+func validateSpan(span ptrace.Span) string {
+	if span.TraceID().IsEmpty() {
+		return "with an empty trace ID"
+	}
+	if span.SpanID().IsEmpty() {
+		return "with an empty span ID"
+	}
+	if !finiteAttributes(span.Attributes()) {
+		return reasonNonFiniteAttribute
+	}
+	for i := 0; i < span.Events().Len(); i++ {
+		if !finiteAttributes(span.Events().At(i).Attributes()) {
+			return reasonNonFiniteAttribute
+		}
+	}
+	for i := 0; i < span.Links().Len(); i++ {
+		if !finiteAttributes(span.Links().At(i).Attributes()) {
+			return reasonNonFiniteAttribute
+		}
+	}
+	return ""
+}
+
+// ValidateMetrics removes the metrics and data points of md that cannot be
+// stored. A metric without a type has no data points, it counts as one
+// rejected data point so that it is reported to the client.
+func ValidateMetrics(md pmetric.Metrics) Rejected {
+	var r rejections
+
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		if !finiteAttributes(rm.Resource().Attributes()) {
+			for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+				r.add(reasonNonFiniteAttribute, countMetricsDataPoints(rm.ScopeMetrics().At(i).Metrics()))
+			}
+			return true
+		}
+		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
+			sm.Metrics().RemoveIf(func(m pmetric.Metric) bool {
+				return validateMetric(m, &r)
+			})
+			return sm.Metrics().Len() == 0
+		})
+		return rm.ScopeMetrics().Len() == 0
+	})
+
+	return r.result("data points")
+}
+
+func countMetricsDataPoints(ms pmetric.MetricSlice) int {
+	count := 0
+	for i := 0; i < ms.Len(); i++ {
+		if ms.At(i).Type() == pmetric.MetricTypeEmpty {
+			count++
+			continue
+		}
+		count += metricDataPointCount(ms.At(i))
+	}
+	return count
+}
+
+func metricDataPointCount(m pmetric.Metric) int {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return m.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return m.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return m.Summary().DataPoints().Len()
+	default:
+		return 0
+	}
+}
+
+// validateMetric removes the invalid data points of m and reports whether m
+// itself should be removed.
+func validateMetric(m pmetric.Metric, r *rejections) bool {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		m.Gauge().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+			return rejectDataPoint(r, validateNumberDataPoint(dp))
+		})
+		return m.Gauge().DataPoints().Len() == 0
+	case pmetric.MetricTypeSum:
+		m.Sum().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+			return rejectDataPoint(r, validateNumberDataPoint(dp))
+		})
+		return m.Sum().DataPoints().Len() == 0
+	case pmetric.MetricTypeHistogram:
+		m.Histogram().DataPoints().RemoveIf(func(dp pmetric.HistogramDataPoint) bool {
+			return rejectDataPoint(r, validateHistogramDataPoint(dp))
+		})
+		return m.Histogram().DataPoints().Len() == 0
+	case pmetric.MetricTypeExponentialHistogram:
+		m.ExponentialHistogram().DataPoints().RemoveIf(func(dp pmetric.ExponentialHistogramDataPoint) bool {
+			return rejectDataPoint(r, validateAttributes(dp.Attributes()))
+		})
+		return m.ExponentialHistogram().DataPoints().Len() == 0
+	case pmetric.MetricTypeSummary:
+		m.Summary().DataPoints().RemoveIf(func(dp pmetric.SummaryDataPoint) bool {
+			return rejectDataPoint(r, validateAttributes(dp.Attributes()))
+		})
+		return m.Summary().DataPoints().Len() == 0
+	default:
+		r.add("from metrics without a type", 1)
+		return true
+	}
+}
+
+func rejectDataPoint(r *rejections, reason string) bool {
+	if reason == "" {
+		return false
+	}
+	r.add(reason, 1)
+	return true
+}
+
+func validateAttributes(attrs pcommon.Map) string {
+	if !finiteAttributes(attrs) {
+		return reasonNonFiniteAttribute
+	}
+	return ""
+}
+
+func validateNumberDataPoint(dp pmetric.NumberDataPoint) string {
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeEmpty {
+		return "without a value"
+	}
+	return validateAttributes(dp.Attributes())
+}
+
+func validateHistogramDataPoint(dp pmetric.HistogramDataPoint) string {
+	if n := dp.BucketCounts().Len(); n > 0 && n != dp.ExplicitBounds().Len()+1 {
+		return "with bucket counts not matching the explicit bounds"
+	}
+	return validateAttributes(dp.Attributes())
+}
+
+// ValidateProfiles removes the profiles of pd that cannot be stored. A
+// profile is removed as a whole if any of its samples cannot be stored.
+func ValidateProfiles(pd pprofile.Profiles) Rejected {
+	var r rejections
+	v := profileValidator{dic: pd.Dictionary(), stacks: map[int32]string{}}
+
+	pd.ResourceProfiles().RemoveIf(func(rp pprofile.ResourceProfiles) bool {
+		if !finiteAttributes(rp.Resource().Attributes()) {
+			for i := 0; i < rp.ScopeProfiles().Len(); i++ {
+				r.add(reasonNonFiniteAttribute, rp.ScopeProfiles().At(i).Profiles().Len())
+			}
+			return true
+		}
+		rp.ScopeProfiles().RemoveIf(func(sp pprofile.ScopeProfiles) bool {
+			if !finiteAttributes(sp.Scope().Attributes()) {
+				r.add(reasonNonFiniteAttribute, sp.Profiles().Len())
+				return true
+			}
+			sp.Profiles().RemoveIf(func(p pprofile.Profile) bool {
+				if reason := v.profile(p); reason != "" {
+					r.add(reason, 1)
+					return true
+				}
+				return false
+			})
+			return sp.Profiles().Len() == 0
+		})
+		return rp.ScopeProfiles().Len() == 0
+	})
+
+	return r.result("profiles")
+}
+
+const reasonDanglingIndex = "with a dictionary index out of range"
+
+// profileValidator checks that the dictionary entries referenced by a
+// profile exist. Stacks are usually shared by many samples, the result is
+// kept per stack index.
+type profileValidator struct {
+	dic    pprofile.ProfilesDictionary
+	stacks map[int32]string
+}
+
+// profile returns why p cannot be stored, or "" if it can.
+func (v profileValidator) profile(p pprofile.Profile) string {
+	if !v.hasStrings(p.SampleType().TypeStrindex(), p.SampleType().UnitStrindex(), p.PeriodType().TypeStrindex(), p.PeriodType().UnitStrindex()) {
+		return reasonDanglingIndex
+	}
+	if reason := v.attributes(p.AttributeIndices()); reason != "" {
+		return reason
+	}
+
+	for i := 0; i < p.Samples().Len(); i++ {
+		sample := p.Samples().At(i)
+		if !optionalInRange(sample.LinkIndex(), v.dic.LinkTable().Len()) {
+			return reasonDanglingIndex
+		}
+		if reason := v.attributes(sample.AttributeIndices()); reason != "" {
+			return reason
+		}
+
+		reason, ok := v.stacks[sample.StackIndex()]
+		if !ok {
+			reason = v.stack(sample.StackIndex())
+			v.stacks[sample.StackIndex()] = reason
+		}
+		if reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (v profileValidator) stack(index int32) string {
+	if !optionalInRange(index, v.dic.StackTable().Len()) {
+		return reasonDanglingIndex
+	}
+	if int(index) >= v.dic.StackTable().Len() {
+		return ""
+	}
+
+	locations := v.dic.StackTable().At(int(index)).LocationIndices()
+	for i := 0; i < locations.Len(); i++ {
+		if reason := v.location(locations.At(i)); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (v profileValidator) location(index int32) string {
+	if !inRange(index, v.dic.LocationTable().Len()) {
+		return reasonDanglingIndex
+	}
+
+	location := v.dic.LocationTable().At(int(index))
+	if location.MappingIndex() > 0 {
+		if !inRange(location.MappingIndex(), v.dic.MappingTable().Len()) {
+			return reasonDanglingIndex
+		}
+		mapping := v.dic.MappingTable().At(int(location.MappingIndex()))
+		if !v.hasStrings(mapping.FilenameStrindex()) {
+			return reasonDanglingIndex
+		}
+		if reason := v.attributes(mapping.AttributeIndices()); reason != "" {
+			return reason
+		}
+	}
+
+	for i := 0; i < location.Lines().Len(); i++ {
+		index := location.Lines().At(i).FunctionIndex()
+		if !inRange(index, v.dic.FunctionTable().Len()) {
+			return reasonDanglingIndex
+		}
+		function := v.dic.FunctionTable().At(int(index))
+		if !v.hasStrings(function.NameStrindex(), function.SystemNameStrindex(), function.FilenameStrindex()) {
+			return reasonDanglingIndex
+		}
+	}
+
+	return v.attributes(location.AttributeIndices())
+}
+
+func (v profileValidator) attributes(indices pcommon.Int32Slice) string {
+	for i := 0; i < indices.Len(); i++ {
+		if !inRange(indices.At(i), v.dic.AttributeTable().Len()) {
+			return reasonDanglingIndex
+		}
+		attr := v.dic.AttributeTable().At(int(indices.At(i)))
+		if !v.hasStrings(attr.KeyStrindex(), attr.UnitStrindex()) {
+			return reasonDanglingIndex
+		}
+		if !finiteValue(attr.Value()) {
+			return reasonNonFiniteAttribute
+		}
+	}
+	return ""
+}
+
+func (v profileValidator) hasStrings(indices ...int32) bool {
+	for _, index := range indices {
+		if !optionalInRange(index, v.dic.StringTable().Len()) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRange reports whether index points into a table of n entries.
+func inRange(index int32, n int) bool {
+	return index >= 0 && int(index) < n
+}
+
+// optionalInRange is inRange for references where index 0 means unset. The
+// dictionary should hold a zero value at index 0, but senders may leave the
+// table empty if nothing refers to it.
+func optionalInRange(index int32, n int) bool {
+	return index == 0 || inRange(index, n)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"math"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestValidateLogs(t *testing.T) {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	records.AppendEmpty().Attributes().PutDouble("ok", 1.5)
+	records.AppendEmpty().Attributes().PutDouble("bad", math.NaN())
+	records.AppendEmpty().Attributes().PutEmptyMap("nested").PutDouble("bad", math.Inf(1))
+
+	rejected := ValidateLogs(ld)
+	if rejected.Count != 2 {
+		t.Errorf("Expected 2 rejected log records, got %d (%s)", rejected.Count, rejected.Message)
+	}
+	if ld.LogRecordCount() != 1 {
+		t.Errorf("Expected 1 remaining log record, got %d", ld.LogRecordCount())
+	}
+}
+
+func TestValidateTraces(t *testing.T) {
+	td := ptrace.NewTraces()
+	spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+
+	valid := spans.AppendEmpty()
+	valid.SetTraceID(pcommon.TraceID{1})
+	valid.SetSpanID(pcommon.SpanID{1})
+
+	noSpanID := spans.AppendEmpty()
+	noSpanID.SetTraceID(pcommon.TraceID{1})
+
+	spans.AppendEmpty() // no trace ID
+
+	rejected := ValidateTraces(td)
+	if rejected.Count != 2 {
+		t.Errorf("Expected 2 rejected spans, got %d (%s)", rejected.Count, rejected.Message)
+	}
+	if td.SpanCount() != 1 {
+		t.Errorf("Expected 1 remaining span, got %d", td.SpanCount())
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+
+	metrics.AppendEmpty().SetName("untyped")
+
+	gauge := metrics.AppendEmpty().SetEmptyGauge()
+	gauge.DataPoints().AppendEmpty().SetDoubleValue(1)
+	gauge.DataPoints().AppendEmpty() // no value
+
+	histogram := metrics.AppendEmpty().SetEmptyHistogram()
+	dp := histogram.DataPoints().AppendEmpty()
+	dp.BucketCounts().FromRaw([]uint64{1, 2})
+	dp.ExplicitBounds().FromRaw([]float64{1, 2})
+
+	rejected := ValidateMetrics(md)
+	if rejected.Count != 3 {
+		t.Errorf("Expected 3 rejected data points, got %d (%s)", rejected.Count, rejected.Message)
+	}
+	if md.MetricCount() != 1 || md.DataPointCount() != 1 {
+		t.Errorf("Expected 1 remaining metric with 1 data point, got %d and %d", md.MetricCount(), md.DataPointCount())
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	pd := generateSampleProfiles(1)
+	profiles := pd.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+
+	danglingStack := profiles.AppendEmpty()
+	danglingStack.Samples().AppendEmpty().SetStackIndex(42)
+
+	nonFinite := profiles.AppendEmpty()
+	attr := pd.Dictionary().AttributeTable().AppendEmpty()
+	attr.SetKeyStrindex(8)
+	attr.Value().SetDouble(math.NaN())
+	nonFinite.AttributeIndices().Append(int32(pd.Dictionary().AttributeTable().Len() - 1))
+
+	rejected := ValidateProfiles(pd)
+	if rejected.Count != 2 {
+		t.Errorf("Expected 2 rejected profiles, got %d (%s)", rejected.Count, rejected.Message)
+	}
+	if pd.ProfileCount() != 1 {
+		t.Errorf("Expected 1 remaining profile, got %d", pd.ProfileCount())
+	}
+}
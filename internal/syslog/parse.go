@@ -0,0 +1,224 @@
+// Package syslog receives syslog messages over UDP and TCP and translates
+// them to OTLP logs.
+//
+// Messages are parsed as RFC 5424 if they have its version after the
+// priority, and as RFC 3164 otherwise. TCP streams may use octet counting
+// or newline framing.
+// Ref: https://www.rfc-editor.org/rfc/rfc5424
+// Ref: https://www.rfc-editor.org/rfc/rfc3164
+// Ref: https://www.rfc-editor.org/rfc/rfc6587
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a parsed syslog message. Fields absent from the message, or
+// the nil value "-" of RFC 5424, are empty.
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	// StructuredData is the SD-PARAMs of each SD-ELEMENT, by SD-ID, in
+	// RFC 5424 messages.
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+var errMalformed = errors.New("malformed syslog message")
+
+// UTF-8 byte order mark, which may start the MSG of RFC 5424.
+const bom = "\xef\xbb\xbf"
+
+// Parse parses an RFC 5424 or RFC 3164 message. now gives the year of
+// RFC 3164 timestamps, which have none.
+func Parse(msg string, now time.Time) (Message, error) {
+	var m Message
+	pri, rest, err := parsePriority(msg)
+	if err != nil {
+		return m, err
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+
+	if after, ok := strings.CutPrefix(rest, "1 "); ok {
+		err = parseRFC5424(&m, after)
+	} else {
+		parseRFC3164(&m, rest, now)
+	}
+	return m, err
+}
+
+func parsePriority(msg string) (int, string, error) {
+	if !strings.HasPrefix(msg, "<") {
+		return 0, "", fmt.Errorf("%w: no priority", errMalformed)
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("%w: invalid priority", errMalformed)
+	}
+	pri, err := strconv.Atoi(msg[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", fmt.Errorf("%w: invalid priority %q", errMalformed, msg[1:end])
+	}
+	return pri, msg[end+1:], nil
+}
+
+// nextField returns the field up to the next space, and the rest after it.
+func nextField(s string) (field, rest string) {
+	field, rest, _ = strings.Cut(s, " ")
+	return field, rest
+}
+
+// nilValue returns the empty string for the RFC 5424 nil value "-".
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+func parseRFC5424(m *Message, s string) error {
+	var timestamp string
+	timestamp, s = nextField(s)
+	if timestamp != "-" {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return fmt.Errorf("%w: invalid timestamp %q", errMalformed, timestamp)
+		}
+		m.Timestamp = t
+	}
+
+	var hostname, appName, procID, msgID string
+	hostname, s = nextField(s)
+	appName, s = nextField(s)
+	procID, s = nextField(s)
+	msgID, s = nextField(s)
+	m.Hostname, m.AppName, m.ProcID, m.MsgID = nilValue(hostname), nilValue(appName), nilValue(procID), nilValue(msgID)
+
+	if after, ok := strings.CutPrefix(s, "-"); ok {
+		s = after
+	} else {
+		var err error
+		m.StructuredData, s, err = parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s != "" && s[0] != ' ' {
+		return fmt.Errorf("%w: no space after structured data", errMalformed)
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(s, " "), bom)
+	return nil
+}
+
+// parseStructuredData parses the SD-ELEMENTs at the start of s, and returns
+// the rest of s.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", fmt.Errorf("%w: invalid SD-ID", errMalformed)
+		}
+		params := map[string]string{}
+		sd[s[:end]] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("%w: invalid SD-PARAM", errMalformed)
+			}
+			name := s[:eq]
+			value, n, err := parseParamValue(s[eq+2:])
+			if err != nil {
+				return nil, "", err
+			}
+			params[name] = value
+			s = s[eq+2+n:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("%w: unterminated SD-ELEMENT", errMalformed)
+		}
+		s = s[1:]
+	}
+	return sd, s, nil
+}
+
+// parseParamValue parses a PARAM-VALUE up to its closing quote, unescaping
+// \", \\ and \]. It returns the number of bytes read, quote included.
+func parseParamValue(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+				b.WriteByte(s[i])
+			} else {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("%w: unterminated PARAM-VALUE", errMalformed)
+}
+
+// Layout of RFC 3164 timestamps, days are padded with a space.
+const rfc3164Layout = "Jan _2 15:04:05"
+
+// parseRFC3164 parses the lenient format of BSD syslog. A message without a
+// timestamp and hostname is all MSG.
+func parseRFC3164(m *Message, s string, now time.Time) {
+	if len(s) < len(rfc3164Layout) {
+		m.Message = s
+		return
+	}
+	t, err := time.ParseInLocation(rfc3164Layout, s[:len(rfc3164Layout)], now.Location())
+	if err != nil {
+		m.Message = s
+		return
+	}
+	// The year is the one that puts the timestamp closest to now, a message
+	// from December received in January is from last year.
+	m.Timestamp = t.AddDate(now.Year(), 0, 0)
+	if m.Timestamp.After(now.AddDate(0, 6, 0)) {
+		m.Timestamp = m.Timestamp.AddDate(-1, 0, 0)
+	}
+	s = strings.TrimPrefix(s[len(rfc3164Layout):], " ")
+
+	m.Hostname, s = nextField(s)
+
+	// TAG is the process name, optionally with [PID], followed by a colon.
+	if i := strings.IndexAny(s, ":[ "); i > 0 && (s[i] == ':' || s[i] == '[') {
+		m.AppName = s[:i]
+		rest := s[i:]
+		if strings.HasPrefix(rest, "[") {
+			if end := strings.IndexByte(rest, ']'); end > 0 {
+				m.ProcID = rest[1:end]
+				rest = rest[end+1:]
+			}
+		}
+		if after, ok := strings.CutPrefix(rest, ":"); ok {
+			s = strings.TrimPrefix(after, " ")
+		} else {
+			m.AppName, m.ProcID = "", ""
+		}
+	}
+	m.Message = s
+}
@@ -0,0 +1,241 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+)
+
+const (
+	// Largest message, and largest UDP payload.
+	maxMessageSize = 64 << 10
+	// Messages are passed to the pipeline in batches of up to batchSize,
+	// at least every batchInterval.
+	batchSize     = 1000
+	batchInterval = 100 * time.Millisecond
+)
+
+// Received and malformed messages, served on /debug/vars.
+var syslogStats = expvar.NewMap("syslog")
+
+type ServerConfig struct {
+	Addr string
+	// TLS, if set, is used to serve TCP over TLS (RFC 5425). UDP is always
+	// plain.
+	TLS *tls.Config
+}
+
+// StartServer listens for syslog messages on UDP and TCP at cfg.Addr and
+// queues them to the pipeline, for the default tenant. It returns when ctx
+// is canceled.
+func StartServer(ctx context.Context, pl *pipeline.Pipeline, cfg ServerConfig) error {
+	udp, err := net.ListenPacket("udp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	if cfg.TLS != nil {
+		tcp = tls.NewListener(tcp, cfg.TLS)
+	}
+
+	messages := make(chan Message, batchSize)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		<-ctx.Done()
+		udp.Close()
+		tcp.Close()
+		return nil
+	})
+	g.Go(func() error {
+		return ignoreClosed(ctx, serveUDP(ctx, udp, messages))
+	})
+	g.Go(func() error {
+		return ignoreClosed(ctx, serveTCP(ctx, tcp, messages))
+	})
+	g.Go(func() error {
+		batchLoop(ctx, pl, messages)
+		return nil
+	})
+
+	log.Printf("Syslog server listening on %s (udp, tcp, tls=%t)", cfg.Addr, cfg.TLS != nil)
+	return g.Wait()
+}
+
+// ignoreClosed drops the error of a listener closed on shutdown.
+func ignoreClosed(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// serveUDP reads one message per datagram.
+func serveUDP(ctx context.Context, conn net.PacketConn, messages chan<- Message) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		handleMessage(ctx, string(bytes.TrimRight(buf[:n], "\r\n\x00")), messages)
+	}
+}
+
+// serveTCP serves each connection in its own goroutine. Connections are
+// closed when ctx is canceled, and serveTCP returns once they are done.
+func serveTCP(ctx context.Context, lis net.Listener, messages chan<- Message) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+
+			err := readFrames(bufio.NewReaderSize(conn, maxMessageSize), func(msg string) {
+				handleMessage(ctx, msg, messages)
+			})
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog: closing connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// readFrames calls fn for each message of a TCP stream. A frame starting
+// with a digit is octet counted, "LEN SP MSG", any other is terminated by a
+// newline.
+func readFrames(r *bufio.Reader, fn func(msg string)) error {
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		if first[0] >= '0' && first[0] <= '9' {
+			n, err := readFrameLength(r)
+			if err != nil {
+				return err
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return err
+			}
+			fn(string(buf))
+			continue
+		}
+
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return fmt.Errorf("message longer than %d bytes", maxMessageSize)
+		}
+		if msg := strings.TrimRight(string(line), "\r\n"); msg != "" {
+			fn(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readFrameLength(r *bufio.Reader) (int, error) {
+	n := 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c == ' ' {
+			return n, nil
+		}
+		if c < '0' || c > '9' {
+			return 0, errors.New("invalid octet count")
+		}
+		n = n*10 + int(c-'0')
+		if n > maxMessageSize {
+			return 0, fmt.Errorf("message longer than %d bytes", maxMessageSize)
+		}
+	}
+}
+
+// handleMessage parses msg and sends it to the batch loop. Messages
+// received after ctx is canceled are dropped, the batch loop no longer
+// reads them.
+func handleMessage(ctx context.Context, msg string, messages chan<- Message) {
+	if msg == "" {
+		return
+	}
+
+	syslogStats.Add("messages", 1)
+	m, err := Parse(msg, time.Now())
+	if err != nil {
+		syslogStats.Add("invalid_messages", 1)
+		return
+	}
+	select {
+	case messages <- m:
+	case <-ctx.Done():
+	}
+}
+
+// batchLoop passes messages to the pipeline in batches, until ctx is
+// canceled.
+func batchLoop(ctx context.Context, pl *pipeline.Pipeline, messages <-chan Message) {
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	batch := make([]Message, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		ld := ToLogs(batch, pcommon.NewTimestampFromTime(time.Now()))
+		// Syslog has no acknowledgements, messages that cannot be queued
+		// are lost.
+		if _, err := pl.ConsumeLogs(ctx, ld); err != nil {
+			log.Printf("failed to write syslog messages: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush(context.WithoutCancel(ctx))
+			return
+		case m := <-messages:
+			batch = append(batch, m)
+			if len(batch) == batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+var testNow = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		now  time.Time
+		want Message
+	}{
+		{
+			name: "rfc5424",
+			msg:  `<165>1 2024-03-10T11:59:58.123Z web-1 nginx 4321 ID47 [exampleSDID@32473 iut="3" eventID="1011"][meta seq="\"7\" \\ \]"] ` + bom + "request served",
+			want: Message{
+				Facility: 20, Severity: 5,
+				Timestamp: time.Date(2024, 3, 10, 11, 59, 58, 123e6, time.UTC),
+				Hostname:  "web-1", AppName: "nginx", ProcID: "4321", MsgID: "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventID": "1011"},
+					"meta":              {"seq": `"7" \ ]`},
+				},
+				Message: "request served",
+			},
+		},
+		{
+			name: "rfc5424 nil values",
+			msg:  "<14>1 - - - - - -",
+			want: Message{Facility: 1, Severity: 6},
+		},
+		{
+			name: "rfc5424 sd-element without params",
+			msg:  "<14>1 - host app - - [origin]",
+			want: Message{
+				Facility: 1, Severity: 6, Hostname: "host", AppName: "app",
+				StructuredData: map[string]map[string]string{"origin": {}},
+			},
+		},
+		{
+			name: "rfc3164",
+			msg:  "<34>Mar  9 22:14:15 mymachine su[230]: 'su root' failed",
+			want: Message{
+				Facility: 4, Severity: 2,
+				Timestamp: time.Date(2024, 3, 9, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine", AppName: "su", ProcID: "230",
+				Message: "'su root' failed",
+			},
+		},
+		{
+			name: "rfc3164 without pid",
+			msg:  "<13>Mar 10 11:00:00 host cron: job done",
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC),
+				Hostname:  "host", AppName: "cron", Message: "job done",
+			},
+		},
+		{
+			name: "rfc3164 without tag",
+			msg:  "<13>Mar 10 11:00:00 host just a message",
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC),
+				Hostname:  "host", Message: "just a message",
+			},
+		},
+		{
+			name: "rfc3164 from last year",
+			msg:  "<13>Dec 31 23:59:59 host app: bye",
+			now:  time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC),
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+				Hostname:  "host", AppName: "app", Message: "bye",
+			},
+		},
+		{
+			name: "rfc3164 without header",
+			msg:  "<13>no header here",
+			want: Message{Facility: 1, Severity: 5, Message: "no header here"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			if now.IsZero() {
+				now = testNow
+			}
+			got, err := Parse(tt.msg, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, msg := range []string{
+		"",
+		"no priority",
+		"<192>1 - - - - - -",
+		"<abc>message",
+		"<14>1 yesterday - - - - -",
+		"<14>1 - - - - - [unterminated",
+		`<14>1 - - - - - [id name="value]`,
+		"<14>1 - - - - - [id]message",
+	} {
+		if _, err := Parse(msg, testNow); !errors.Is(err, errMalformed) {
+			t.Errorf("Parse(%q) error = %v, want %v", msg, err, errMalformed)
+		}
+	}
+}
+
+func TestReadFrames(t *testing.T) {
+	stream := "12 <14>1 - - -\n" + // octet counted, with a newline in the message
+		"<13>newline framed\r\n" +
+		"\n" +
+		"5 <13>a" +
+		"<13>unterminated"
+
+	var got []string
+	err := readFrames(bufio.NewReader(strings.NewReader(stream)), func(msg string) {
+		got = append(got, msg)
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("readFrames() error = %v, want EOF", err)
+	}
+	want := []string{"<14>1 - - -\n", "<13>newline framed", "<13>a", "<13>unterminated"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+
+	for _, stream := range []string{"12x <14>", "99999999 <14>"} {
+		err := readFrames(bufio.NewReader(strings.NewReader(stream)), func(string) {})
+		if err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("readFrames(%q) error = %v, want framing error", stream, err)
+		}
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing reads messages, as after the batch loop returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan Message)
+	done := make(chan error, 2)
+	go func() { done <- serveUDP(ctx, udp, messages) }()
+	go func() { done <- serveTCP(ctx, tcp, messages) }()
+
+	for _, lis := range []net.Addr{udp.LocalAddr(), tcp.Addr()} {
+		conn, err := net.Dial(lis.Network(), lis.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("<13>blocked\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Let the servers block on the send.
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	udp.Close()
+	tcp.Close()
+	for range 2 {
+		select {
+		case err := <-done:
+			if !errors.Is(err, net.ErrClosed) {
+				t.Errorf("serve error = %v, want ErrClosed", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("servers did not return after shutdown")
+		}
+	}
+}
+
+func TestToLogs(t *testing.T) {
+	observed := pcommon.NewTimestampFromTime(testNow)
+	ld := ToLogs([]Message{
+		{
+			Facility: 20, Severity: 3, Timestamp: testNow,
+			Hostname: "web-1", AppName: "nginx", ProcID: "4321", MsgID: "ID47",
+			StructuredData: map[string]map[string]string{"meta": {"seq": "7"}},
+			Message:        "first",
+		},
+		{Facility: 20, Severity: 6, Hostname: "web-1", AppName: "nginx", ProcID: "4321", Message: "second"},
+		{Facility: 1, Severity: 0, Hostname: "web-2", ProcID: "worker", Message: "third"},
+	}, observed)
+
+	if ld.ResourceLogs().Len() != 2 || ld.LogRecordCount() != 3 {
+		t.Fatalf("got %d resources and %d log records, want 2 and 3", ld.ResourceLogs().Len(), ld.LogRecordCount())
+	}
+
+	rl := ld.ResourceLogs().At(0)
+	wantResource := map[string]any{"host.name": "web-1", "service.name": "nginx", "process.pid": int64(4321)}
+	if got := rl.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource = %v, want %v", got, wantResource)
+	}
+	records := rl.ScopeLogs().At(0).LogRecords()
+	lr := records.At(0)
+	if lr.Body().Str() != "first" || lr.Timestamp().AsTime() != testNow || lr.ObservedTimestamp() != observed {
+		t.Errorf("log record = %q at %v, observed %v", lr.Body().Str(), lr.Timestamp(), lr.ObservedTimestamp())
+	}
+	if lr.SeverityNumber() != plog.SeverityNumberError || lr.SeverityText() != "err" {
+		t.Errorf("severity = %v %q, want ERROR err", lr.SeverityNumber(), lr.SeverityText())
+	}
+	wantAttrs := map[string]any{
+		"syslog.facility": int64(20),
+		"syslog.msgid":    "ID47",
+		"meta":            map[string]any{"seq": "7"},
+	}
+	if got := lr.Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+	if ts := records.At(1).Timestamp(); ts != 0 {
+		t.Errorf("timestamp of a message without one = %v, want 0", ts)
+	}
+
+	rl = ld.ResourceLogs().At(1)
+	wantResource = map[string]any{"host.name": "web-2", "syslog.procid": "worker"}
+	if got := rl.Resource().Attributes().AsRaw(); !reflect.DeepEqual(got, wantResource) {
+		t.Errorf("resource = %v, want %v", got, wantResource)
+	}
+	if sev := rl.ScopeLogs().At(0).LogRecords().At(0).SeverityNumber(); sev != plog.SeverityNumberFatal2 {
+		t.Errorf("severity of emerg = %v, want FATAL2", sev)
+	}
+}
@@ -0,0 +1,110 @@
+package syslog
+
+import (
+	"strconv"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Resource attributes of the sender.
+const (
+	attrHostName    = "host.name"
+	attrServiceName = "service.name"
+	attrProcessPID  = "process.pid"
+	// Non-numeric PROCIDs, which process.pid cannot hold.
+	attrProcID = "syslog.procid"
+)
+
+// Log attributes of the header fields without a resource attribute.
+const (
+	attrFacility = "syslog.facility"
+	attrMsgID    = "syslog.msgid"
+)
+
+// Severity numbers and texts of the syslog severities, as in the OTel
+// Collector's syslog parser.
+var (
+	severityNumbers = [8]plog.SeverityNumber{
+		plog.SeverityNumberFatal2, // emerg
+		plog.SeverityNumberError3, // alert
+		plog.SeverityNumberError2, // crit
+		plog.SeverityNumberError,  // err
+		plog.SeverityNumberWarn,   // warning
+		plog.SeverityNumberInfo2,  // notice
+		plog.SeverityNumberInfo,   // info
+		plog.SeverityNumberDebug,  // debug
+	}
+	severityTexts = [8]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+)
+
+type resourceKey struct {
+	hostname string
+	appName  string
+	procID   string
+}
+
+// ToLogs translates msgs to OTLP logs:
+//
+//   - HOSTNAME, APP-NAME and PROCID become the host.name, service.name and
+//     process.pid resource attributes, messages from the same sender share
+//     a resource.
+//   - The severity becomes the severity number and text, the facility and
+//     MSGID become attributes.
+//   - Each SD-ELEMENT becomes a map attribute named after its SD-ID.
+//
+// Messages without a timestamp only have the observed timestamp.
+func ToLogs(msgs []Message, observed pcommon.Timestamp) plog.Logs {
+	ld := plog.NewLogs()
+	scopes := map[resourceKey]plog.ScopeLogs{}
+
+	for _, m := range msgs {
+		key := resourceKey{hostname: m.Hostname, appName: m.AppName, procID: m.ProcID}
+		sl, ok := scopes[key]
+		if !ok {
+			rl := ld.ResourceLogs().AppendEmpty()
+			putResource(rl.Resource().Attributes(), key)
+			sl = rl.ScopeLogs().AppendEmpty()
+			scopes[key] = sl
+		}
+
+		lr := sl.LogRecords().AppendEmpty()
+		if !m.Timestamp.IsZero() {
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(m.Timestamp))
+		}
+		lr.SetObservedTimestamp(observed)
+		lr.SetSeverityNumber(severityNumbers[m.Severity])
+		lr.SetSeverityText(severityTexts[m.Severity])
+		lr.Body().SetStr(m.Message)
+
+		attrs := lr.Attributes()
+		attrs.PutInt(attrFacility, int64(m.Facility))
+		if m.MsgID != "" {
+			attrs.PutStr(attrMsgID, m.MsgID)
+		}
+		for id, params := range m.StructuredData {
+			sd := attrs.PutEmptyMap(id)
+			for name, value := range params {
+				sd.PutStr(name, value)
+			}
+		}
+	}
+
+	return ld
+}
+
+func putResource(attrs pcommon.Map, key resourceKey) {
+	if key.hostname != "" {
+		attrs.PutStr(attrHostName, key.hostname)
+	}
+	if key.appName != "" {
+		attrs.PutStr(attrServiceName, key.appName)
+	}
+	if key.procID != "" {
+		if pid, err := strconv.ParseInt(key.procID, 10, 64); err == nil {
+			attrs.PutInt(attrProcessPID, pid)
+		} else {
+			attrs.PutStr(attrProcID, key.procID)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package tenant identifies the tenant a request belongs to. Every row is
+// stored with the tenant it was ingested for, and queries only return the
+// rows of the requesting tenant.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+)
+
+// Header carries the tenant of a request, as in Loki, Mimir and Tempo.
+const Header = "X-Scope-OrgID"
+
+// Default is the tenant of requests that do not name one. A single-tenant
+// deployment stores and queries everything under it.
+const Default = ""
+
+// Maximum length of a tenant ID.
+const maxLength = 150
+
+var (
+	ErrInvalid  = errors.New("invalid tenant")
+	ErrMismatch = errors.New("tenant does not match the authenticated principal")
+)
+
+type tenantKey struct{}
+
+// NewContext returns a copy of ctx carrying the tenant ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant ID carried by ctx, or Default.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok {
+		return id
+	}
+	return Default
+}
+
+// Resolve returns the tenant of a request from the value of its tenant
+// header and the principal authenticated in ctx. An authenticated client
+// writes as its principal and may only repeat it in the header.
+func Resolve(ctx context.Context, header string) (string, error) {
+	if principal, ok := auth.FromContext(ctx); ok {
+		if header != "" && header != principal {
+			return "", fmt.Errorf("%w: %q", ErrMismatch, header)
+		}
+		return principal, nil
+	}
+
+	if header == "" {
+		return Default, nil
+	}
+	if err := Validate(header); err != nil {
+		return "", err
+	}
+	return header, nil
+}
+
+// Validate checks that id only uses the characters allowed in tenant IDs:
+// letters, digits and !-_.*'()
+func Validate(id string) error {
+	if len(id) > maxLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalid, maxLength)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '!', r == '-', r == '_', r == '.', r == '*', r == '\'', r == '(', r == ')':
+		default:
+			return fmt.Errorf("%w: unsupported character %q", ErrInvalid, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+)
+
+func TestResolve(t *testing.T) {
+	anonymous := context.Background()
+	authenticated := auth.NewContext(context.Background(), "team-a")
+
+	tests := []struct {
+		ctx    context.Context
+		header string
+		tenant string
+		err    error
+	}{
+		{anonymous, "", Default, nil},
+		{anonymous, "team-b", "team-b", nil},
+		{anonymous, "team/b", "", ErrInvalid},
+		{anonymous, strings.Repeat("a", 151), "", ErrInvalid},
+		{authenticated, "", "team-a", nil},
+		{authenticated, "team-a", "team-a", nil},
+		{authenticated, "team-b", "", ErrMismatch},
+	}
+	for _, tt := range tests {
+		id, err := Resolve(tt.ctx, tt.header)
+		if id != tt.tenant || !errors.Is(err, tt.err) {
+			t.Errorf("Resolve(%q) = %q, %v, expected %q, %v", tt.header, id, err, tt.tenant, tt.err)
+		}
+	}
+}
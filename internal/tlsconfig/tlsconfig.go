@@ -0,0 +1,190 @@
+// Package tlsconfig builds server TLS configurations from certificate files
+// on disk. The files are watched for changes, so certificates can be renewed
+// without restarting the server.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const DefaultReloadInterval = time.Minute
+
+type Config struct {
+	// PEM encoded server certificate chain and private key.
+	CertFile string
+	KeyFile  string
+	// PEM encoded CA bundle. If set, clients must present a certificate
+	// signed by one of these CAs (mutual TLS).
+	ClientCAFile string
+	// Minimum time between two checks of the files for changes. The check
+	// happens on the next handshake once the interval has passed.
+	ReloadInterval time.Duration
+}
+
+// Enabled reports whether TLS is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// NewServerConfig loads the certificates of cfg and returns a TLS config for
+// servers. It returns nil if TLS is not enabled.
+func NewServerConfig(cfg Config) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		if cfg.ClientCAFile != "" {
+			return nil, errors.New("client CA file requires a server certificate and key")
+		}
+		return nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are required")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = DefaultReloadInterval
+	}
+
+	r := &reloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+
+	// Client certificates are checked in VerifyConnection rather than
+	// through ClientCAs, so that a reloaded CA bundle applies to new
+	// connections.
+	if cfg.ClientCAFile != "" {
+		tlsCfg.ClientAuth = tls.RequireAnyClientCert
+		tlsCfg.VerifyConnection = r.verifyClient
+	}
+
+	return tlsCfg, nil
+}
+
+// reloader holds the current certificate and client CAs, and reloads them
+// when the files change.
+type reloader struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+func (r *reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *reloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// maybeReload reloads the files if one of them changed since the last load.
+// A failed reload keeps the previous certificates, so that a half written
+// file does not break new connections.
+func (r *reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.cfg.ReloadInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	changed := false
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(r.modTimes[file]) {
+			changed = true
+		}
+	}
+	r.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		log.Printf("Failed to reload TLS certificates, keeping the previous ones: %v", err)
+		return
+	}
+	log.Printf("Reloaded TLS certificate %s", r.cfg.CertFile)
+}
+
+func (r *reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *reloader) verifyClient(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("client certificate required")
+	}
+
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
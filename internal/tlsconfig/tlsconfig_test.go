@@ -0,0 +1,237 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newCert creates a certificate for cn, signed by parent or self-signed if
+// parent is nil.
+func newCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write saves c as PEM files and returns their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve accepts TLS connections until the test ends, completing the
+// handshake of each.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+// dial connects to addr and returns the common name of the server
+// certificate.
+func dial(addr string, cfg *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// With TLS 1.3 the server verifies the client certificate after the
+	// client handshake is done, a rejection shows up on the first read.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil, 0)
+	certFile, keyFile := newCert(t, "server", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	cfg, err := NewServerConfig(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewServerConfig failed: %v", err)
+	}
+	addr := serve(t, cfg)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	cn, err := dial(addr, &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatalf("TLS handshake failed: %v", err)
+	}
+	if cn != "server" {
+		t.Errorf("Expected server certificate, got %q", cn)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil, 0)
+	certFile, keyFile := newCert(t, "server", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	cfg, err := NewServerConfig(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewServerConfig failed: %v", err)
+	}
+	addr := serve(t, cfg)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := newCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+	if _, err := dial(addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.tlsCertificate()}}); err != nil {
+		t.Errorf("Expected client certificate to be accepted, got %v", err)
+	}
+
+	if _, err := dial(addr, &tls.Config{RootCAs: roots}); err == nil {
+		t.Error("Expected connection without a client certificate to be rejected")
+	}
+
+	otherCA := newCert(t, "other-ca", nil, 0)
+	untrusted := newCert(t, "client", otherCA, x509.ExtKeyUsageClientAuth)
+	if _, err := dial(addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{untrusted.tlsCertificate()}}); err == nil {
+		t.Error("Expected client certificate of an unknown CA to be rejected")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil, 0)
+	certFile, keyFile := newCert(t, "before", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	cfg, err := NewServerConfig(Config{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("NewServerConfig failed: %v", err)
+	}
+	addr := serve(t, cfg)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCfg := &tls.Config{RootCAs: roots, SessionTicketsDisabled: true}
+
+	if cn, err := dial(addr, clientCfg); err != nil || cn != "before" {
+		t.Fatalf("Expected certificate %q, got %q (%v)", "before", cn, err)
+	}
+
+	newCert(t, "after", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	// Make sure the modification time changes on coarse grained filesystems.
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cn, err := dial(addr, clientCfg); err != nil || cn != "after" {
+		t.Fatalf("Expected certificate %q, got %q (%v)", "after", cn, err)
+	}
+}
+
+func TestNewServerConfigDisabled(t *testing.T) {
+	cfg, err := NewServerConfig(Config{})
+	if err != nil || cfg != nil {
+		t.Errorf("Expected no TLS config, got %v (%v)", cfg, err)
+	}
+
+	if _, err := NewServerConfig(Config{ClientCAFile: "ca.crt"}); err == nil {
+		t.Error("Expected an error for a client CA without a server certificate")
+	}
+}
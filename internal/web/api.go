@@ -2,8 +2,10 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,11 +14,16 @@ import (
 
 	"github.com/rs/cors"
 
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
 	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+	"github.com/alkmst-xyz/sweetcorn/internal/tenant"
 )
 
 const webDefaultContentType = "application/json"
 
+// Time queries in flight have to finish once the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
 const (
 	jaegerTraceIDParam   = "traceID"
 	jaegerStartTimeParam = "start"
@@ -26,11 +33,15 @@ const (
 	jaegerOperationParam = "operation"
 )
 
-var errServiceParameterRequired = fmt.Errorf("parameter '%s' is required", jaegerServiceParam)
+var (
+	errServiceParameterRequired = fmt.Errorf("parameter '%s' is required", jaegerServiceParam)
+	errInvalidTimeParameter     = errors.New("time parameters must be Unix timestamps in microseconds")
+	errTenantRequiresAuth       = fmt.Errorf("the %s header requires authentication to be enabled", tenant.Header)
+)
 
 type WebService struct {
-	ctx     context.Context
 	storage *storage.Storage
+	auth    auth.Authenticator
 }
 
 type jaegerResponse struct {
@@ -54,10 +65,11 @@ func (s WebService) getHealthzHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s WebService) getLogsHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryLogs(s.ctx, s.storage)
+	res, err := storage.QueryLogs(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -67,10 +79,11 @@ func (s WebService) getLogsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s WebService) getTracesHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryTraces(s.ctx, s.storage)
+	res, err := storage.QueryTraces(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -80,10 +93,11 @@ func (s WebService) getTracesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s WebService) getMetricsGaugeHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryMetricsGauge(s.ctx, s.storage)
+	res, err := storage.QueryMetricsGauge(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -93,10 +107,11 @@ func (s WebService) getMetricsGaugeHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (s WebService) getMetricsSumHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryMetricsSum(s.ctx, s.storage)
+	res, err := storage.QueryMetricsSum(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -106,10 +121,11 @@ func (s WebService) getMetricsSumHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (s WebService) getMetricsHistogramHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryMetricsHistogram(s.ctx, s.storage)
+	res, err := storage.QueryMetricsHistogram(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -119,10 +135,11 @@ func (s WebService) getMetricsHistogramHandler(w http.ResponseWriter, r *http.Re
 }
 
 func (s WebService) getMetricsExponentialHistogramHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryMetricsExponentialHistogram(s.ctx, s.storage)
+	res, err := storage.QueryMetricsExponentialHistogram(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -132,10 +149,11 @@ func (s WebService) getMetricsExponentialHistogramHandler(w http.ResponseWriter,
 }
 
 func (s WebService) getMetricsSummaryHandler(w http.ResponseWriter, r *http.Request) {
-	res, err := storage.QueryMetricsSummary(s.ctx, s.storage)
+	res, err := storage.QueryMetricsSummary(r.Context(), s.storage)
 	if err != nil {
+		log.Printf("Error: HTTP handler %s: %v", r.URL.Path, err)
 		w.Header().Set("Content-Type", webDefaultContentType)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusCodeFromError(err))
 		return
 	}
 
@@ -145,8 +163,8 @@ func (s WebService) getMetricsSummaryHandler(w http.ResponseWriter, r *http.Requ
 }
 
 func (s WebService) jaegerServices(w http.ResponseWriter, r *http.Request) {
-	data, err := storage.TraceServices(s.ctx, s.storage)
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	data, err := storage.TraceServices(r.Context(), s.storage)
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -167,12 +185,12 @@ func (s WebService) jaegerOperations(w http.ResponseWriter, r *http.Request) {
 	}
 	spanKind := r.FormValue(jaegerSpanKindParam)
 
-	data, err := storage.TraceOperations(s.ctx, s.storage, storage.TraceOperationsParams{
+	data, err := storage.TraceOperations(r.Context(), s.storage, storage.TraceOperationsParams{
 		ServiceName: service,
 		SpanKind:    spanKind,
 	})
 
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -188,11 +206,11 @@ func (s WebService) jaegerOperationsLegacy(w http.ResponseWriter, r *http.Reques
 	// Here we expect service name to not be empty because it the result of a path match.
 	service := r.PathValue(jaegerServiceParam)
 
-	data, err := storage.TraceOperations(s.ctx, s.storage, storage.TraceOperationsParams{
+	data, err := storage.TraceOperations(r.Context(), s.storage, storage.TraceOperationsParams{
 		ServiceName: service,
 		SpanKind:    "",
 	})
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -247,12 +265,12 @@ func parseSearchTracesParams(r *http.Request) (storage.SearchTracesParams, bool)
 func (s WebService) jaegerSearchTraces(w http.ResponseWriter, r *http.Request) {
 	params, ok := parseSearchTracesParams(r)
 	if !ok {
-		// TODO: return error
+		jaegerHandleError(w, errInvalidTimeParameter, http.StatusBadRequest)
 		return
 	}
 
-	data, err := storage.SearchTraces(s.ctx, s.storage, params)
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	data, err := storage.SearchTraces(r.Context(), s.storage, params)
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -349,14 +367,8 @@ func (s WebService) jaegerTrace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := storage.Trace(s.ctx, s.storage, params)
-
-	if errors.Is(err, storage.ErrTraceNotFound) {
-		jaegerHandleError(w, err, http.StatusNotFound)
-		return
-	}
-
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	data, err := storage.Trace(r.Context(), s.storage, params)
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -392,12 +404,12 @@ func parseDependenciesParams(r *http.Request) (storage.DependenciesParams, bool)
 func (s WebService) jaegerDependencies(w http.ResponseWriter, r *http.Request) {
 	params, ok := parseDependenciesParams(r)
 	if !ok {
-		// TODO: return error
+		jaegerHandleError(w, errInvalidTimeParameter, http.StatusBadRequest)
 		return
 	}
 
-	data, err := storage.Dependencies(s.ctx, s.storage, params)
-	if jaegerHandleError(w, err, http.StatusInternalServerError) {
+	data, err := storage.Dependencies(r.Context(), s.storage, params)
+	if jaegerHandleStorageError(w, err) {
 		return
 	}
 
@@ -408,10 +420,19 @@ func (s WebService) jaegerDependencies(w http.ResponseWriter, r *http.Request) {
 	jaegerWriteResponse(w, &resp)
 }
 
-func StartWebApp(ctx context.Context, storage *storage.Storage, addr string) error {
+type ServerConfig struct {
+	Addr string
+	// TLS, if set, is used to serve HTTPS.
+	TLS *tls.Config
+	// Auth, if set, is required to accept the credentials of every query,
+	// and the principal is the tenant queried.
+	Auth auth.Authenticator
+}
+
+func StartWebApp(ctx context.Context, storage *storage.Storage, cfg ServerConfig) error {
 	s := &WebService{
-		ctx:     ctx,
 		storage: storage,
+		auth:    cfg.Auth,
 	}
 
 	mux := http.NewServeMux()
@@ -426,34 +447,54 @@ func StartWebApp(ctx context.Context, storage *storage.Storage, addr string) err
 
 	// API routes
 	mux.HandleFunc("GET /api/v1/healthz", s.getHealthzHandler)
-	mux.HandleFunc("GET /api/v1/logs", s.getLogsHandler)
-	mux.HandleFunc("GET /api/v1/traces", s.getTracesHandler)
-	mux.HandleFunc("GET /api/v1/metrics/gauge", s.getMetricsGaugeHandler)
-	mux.HandleFunc("GET /api/v1/metrics/sum", s.getMetricsSumHandler)
-	mux.HandleFunc("GET /api/v1/metrics/histogram", s.getMetricsHistogramHandler)
-	mux.HandleFunc("GET /api/v1/metrics/exponential-histogram", s.getMetricsExponentialHistogramHandler)
-	mux.HandleFunc("GET /api/v1/metrics/summary", s.getMetricsSummaryHandler)
+	mux.HandleFunc("GET /api/v1/logs", s.query(s.getLogsHandler))
+	mux.HandleFunc("GET /api/v1/traces", s.query(s.getTracesHandler))
+	mux.HandleFunc("GET /api/v1/metrics/gauge", s.query(s.getMetricsGaugeHandler))
+	mux.HandleFunc("GET /api/v1/metrics/sum", s.query(s.getMetricsSumHandler))
+	mux.HandleFunc("GET /api/v1/metrics/histogram", s.query(s.getMetricsHistogramHandler))
+	mux.HandleFunc("GET /api/v1/metrics/exponential-histogram", s.query(s.getMetricsExponentialHistogramHandler))
+	mux.HandleFunc("GET /api/v1/metrics/summary", s.query(s.getMetricsSummaryHandler))
+
+	// Internal stats, such as ingest queue depth and flush latency.
+	mux.HandleFunc("GET /debug/vars", s.query(expvar.Handler().ServeHTTP))
 
 	// Jaeger Query Internal HTTP API
 	// Ref: https://www.jaegertracing.io/docs/2.9/architecture/apis/#internal-http-json
 	// TODO: remove hard coded path match parameters
-	mux.HandleFunc("GET /jaeger/api/services", s.jaegerServices)
-	mux.HandleFunc("GET /jaeger/api/operations", s.jaegerOperations)
-	mux.HandleFunc("GET /jaeger/api/services/{service}/operations", s.jaegerOperationsLegacy)
-	mux.HandleFunc("GET /jaeger/api/traces", s.jaegerSearchTraces)
-	mux.HandleFunc("GET /jaeger/api/traces/{traceID}", s.jaegerTrace)
-	mux.HandleFunc("GET /jaeger/api/dependencies", s.jaegerDependencies)
+	mux.HandleFunc("GET /jaeger/api/services", s.query(s.jaegerServices))
+	mux.HandleFunc("GET /jaeger/api/operations", s.query(s.jaegerOperations))
+	mux.HandleFunc("GET /jaeger/api/services/{service}/operations", s.query(s.jaegerOperationsLegacy))
+	mux.HandleFunc("GET /jaeger/api/traces", s.query(s.jaegerSearchTraces))
+	mux.HandleFunc("GET /jaeger/api/traces/{traceID}", s.query(s.jaegerTrace))
+	mux.HandleFunc("GET /jaeger/api/dependencies", s.query(s.jaegerDependencies))
 
 	// grafana is hitting this endpoint somehow!!
-	mux.HandleFunc("GET /api/traces", s.jaegerSearchTraces)
+	mux.HandleFunc("GET /api/traces", s.query(s.jaegerSearchTraces))
 
 	server := &http.Server{
-		Addr:    addr,
-		Handler: cors.Default().Handler(loggingMiddleware(mux)),
+		Addr:      cfg.Addr,
+		Handler:   cors.Default().Handler(loggingMiddleware(mux)),
+		TLSConfig: cfg.TLS,
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	log.Printf("Sweetcorn server listening on %s (tls=%t, auth=%t)", cfg.Addr, cfg.TLS != nil, cfg.Auth != nil)
+	var err error
+	if cfg.TLS != nil {
+		// The certificate comes from TLSConfig.
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return <-shutdown
 	}
-	log.Printf("Sweetcorn server listening on %s", addr)
-	err := server.ListenAndServe()
-
 	return err
 }
 
@@ -474,13 +515,73 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// query wraps next so that it only runs for requests with valid credentials,
+// when authentication is enabled, and adds the tenant they may read to the
+// request context. An authenticated client reads the tenant of its
+// principal. Without authentication, anyone could name any tenant in the
+// X-Scope-OrgID header, so only the default tenant can be read.
+func (s WebService) query(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		header := r.Header.Get(tenant.Header)
+
+		if s.auth != nil {
+			principal, err := s.auth.Authenticate(r.Header.Get("Authorization"))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="sweetcorn"`)
+				jaegerHandleError(w, err, http.StatusUnauthorized)
+				return
+			}
+			ctx = auth.NewContext(ctx, principal)
+		} else if header != "" && header != tenant.Default {
+			jaegerHandleError(w, errTenantRequiresAuth, http.StatusForbidden)
+			return
+		}
+
+		tenantID, err := tenant.Resolve(ctx, header)
+		if errors.Is(err, tenant.ErrMismatch) {
+			jaegerHandleError(w, err, http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			jaegerHandleError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		next(w, r.WithContext(tenant.NewContext(ctx, tenantID)))
+	}
+}
+
+// statusCodeFromError maps a storage error to an HTTP status code. Retryable
+// errors, such as a transaction conflict, are reported as 503 so that clients
+// may try again.
+func statusCodeFromError(err error) int {
+	switch {
+	case storage.IsNotFound(err):
+		return http.StatusNotFound
+	case storage.IsPermanent(err):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// jaegerHandleStorageError writes err, returned by a storage query, with the
+// status code matching its kind.
+func jaegerHandleStorageError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	return jaegerHandleError(w, err, statusCodeFromError(err))
+}
+
 func jaegerHandleError(w http.ResponseWriter, err error, code int) bool {
 	if err == nil {
 		return false
 	}
 
-	if code == http.StatusInternalServerError {
-		log.Panicf("Error: HTTP handler, Internal Server Error: %v", err)
+	if code >= http.StatusInternalServerError {
+		log.Printf("Error: HTTP handler, %s: %v", http.StatusText(code), err)
 	}
 
 	h := w.Header()
@@ -498,7 +599,7 @@ func jaegerHandleError(w http.ResponseWriter, err error, code int) bool {
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Panicf("Error: failed writing HTTP error response: %v", err)
+		log.Printf("Error: failed writing HTTP error response: %v", err)
 	}
 
 	return true
@@ -508,8 +609,8 @@ func jaegerWriteResponse(w http.ResponseWriter, response any) {
 	w.Header().Set("Content-Type", webDefaultContentType)
 	w.WriteHeader(http.StatusOK)
 
-	err := json.NewEncoder(w).Encode(response)
-	if err != nil {
-		jaegerHandleError(w, fmt.Errorf("failed writing HTTP response: %w", err), http.StatusInternalServerError)
+	// The status is already sent, all that is left is to log the error.
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error: failed writing HTTP response: %v", err)
 	}
 }
@@ -0,0 +1,227 @@
+package zipkin
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Tags with a meaning in the OTel Zipkin exporter mapping. They are not
+// copied to the span attributes.
+// Ref: https://opentelemetry.io/docs/specs/otel/trace/sdk_exporters/zipkin/
+const (
+	tagError             = "error"
+	tagStatusCode        = "otel.status_code"
+	tagStatusDescription = "otel.status_description"
+	tagScopeName         = "otel.scope.name"
+	tagScopeVersion      = "otel.scope.version"
+	tagLibraryName       = "otel.library.name"
+	tagLibraryVersion    = "otel.library.version"
+)
+
+// Attributes set from the endpoints of a span.
+const (
+	attrServiceName        = "service.name"
+	attrPeerService        = "peer.service"
+	attrNetworkPeerAddress = "network.peer.address"
+	attrNetworkPeerPort    = "network.peer.port"
+	attrNetworkLocalAddr   = "network.local.address"
+	attrNetworkLocalPort   = "network.local.port"
+)
+
+type scopeKey struct {
+	service string
+	name    string
+	version string
+}
+
+// ToTraces translates spans to OTLP traces:
+//
+//   - localEndpoint.serviceName becomes the service.name resource attribute.
+//   - remoteEndpoint becomes the peer.service, network.peer.address and
+//     network.peer.port attributes.
+//   - Annotations become span events and tags become span attributes.
+//   - The error tag sets the status to error, with the tag value as the
+//     message unless it is empty or "true". otel.status_code and
+//     otel.status_description take precedence.
+//   - otel.scope.name and otel.scope.version, or their otel.library.*
+//     predecessors, become the scope.
+//
+// 64-bit trace IDs are padded to 128 bits. The request fails if a span has a
+// missing or malformed ID.
+func ToTraces(spans []Span) (ptrace.Traces, error) {
+	td := ptrace.NewTraces()
+	resources := map[string]ptrace.ResourceSpans{}
+	scopes := map[scopeKey]ptrace.ScopeSpans{}
+
+	for i, span := range spans {
+		service := ""
+		if span.LocalEndpoint != nil {
+			service = span.LocalEndpoint.ServiceName
+		}
+
+		rs, ok := resources[service]
+		if !ok {
+			rs = td.ResourceSpans().AppendEmpty()
+			if service != "" {
+				rs.Resource().Attributes().PutStr(attrServiceName, service)
+			}
+			resources[service] = rs
+		}
+
+		key := scopeKey{service: service}
+		key.name, key.version = scopeOf(span.Tags)
+		ss, ok := scopes[key]
+		if !ok {
+			ss = rs.ScopeSpans().AppendEmpty()
+			ss.Scope().SetName(key.name)
+			ss.Scope().SetVersion(key.version)
+			scopes[key] = ss
+		}
+
+		if err := translateSpan(span, ss.Spans().AppendEmpty()); err != nil {
+			return ptrace.Traces{}, fmt.Errorf("span %d: %w", i, err)
+		}
+	}
+
+	return td, nil
+}
+
+func scopeOf(tags map[string]string) (name, version string) {
+	if name, ok := tags[tagScopeName]; ok {
+		return name, tags[tagScopeVersion]
+	}
+	return tags[tagLibraryName], tags[tagLibraryVersion]
+}
+
+func translateSpan(span Span, dest ptrace.Span) error {
+	traceID, err := parseTraceID(span.TraceID)
+	if err != nil {
+		return err
+	}
+	dest.SetTraceID(traceID)
+
+	spanID, err := parseSpanID(span.ID)
+	if err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+	dest.SetSpanID(spanID)
+
+	if span.ParentID != "" {
+		parentID, err := parseSpanID(span.ParentID)
+		if err != nil {
+			return fmt.Errorf("parentId: %w", err)
+		}
+		dest.SetParentSpanID(parentID)
+	}
+
+	dest.SetName(span.Name)
+	dest.SetKind(spanKind(span.Kind))
+	dest.SetStartTimestamp(microseconds(span.Timestamp))
+	dest.SetEndTimestamp(microseconds(span.Timestamp + span.Duration))
+
+	attrs := dest.Attributes()
+	if e := span.LocalEndpoint; e != nil {
+		putEndpoint(attrs, e, attrNetworkLocalAddr, attrNetworkLocalPort)
+	}
+	if e := span.RemoteEndpoint; e != nil {
+		if e.ServiceName != "" {
+			attrs.PutStr(attrPeerService, e.ServiceName)
+		}
+		putEndpoint(attrs, e, attrNetworkPeerAddress, attrNetworkPeerPort)
+	}
+	for k, v := range span.Tags {
+		switch k {
+		case tagError, tagStatusCode, tagStatusDescription,
+			tagScopeName, tagScopeVersion, tagLibraryName, tagLibraryVersion:
+			continue
+		}
+		attrs.PutStr(k, v)
+	}
+	setStatus(span.Tags, dest.Status())
+
+	for _, a := range span.Annotations {
+		event := dest.Events().AppendEmpty()
+		event.SetTimestamp(microseconds(a.Timestamp))
+		event.SetName(a.Value)
+	}
+
+	return nil
+}
+
+func putEndpoint(attrs pcommon.Map, e *Endpoint, addressKey, portKey string) {
+	switch {
+	case e.IPv6 != "":
+		attrs.PutStr(addressKey, e.IPv6)
+	case e.IPv4 != "":
+		attrs.PutStr(addressKey, e.IPv4)
+	}
+	if e.Port != 0 {
+		attrs.PutInt(portKey, int64(e.Port))
+	}
+}
+
+func setStatus(tags map[string]string, dest ptrace.Status) {
+	if code, ok := tags[tagStatusCode]; ok {
+		switch strings.ToUpper(code) {
+		case "OK":
+			dest.SetCode(ptrace.StatusCodeOk)
+		case "ERROR":
+			dest.SetCode(ptrace.StatusCodeError)
+			dest.SetMessage(tags[tagStatusDescription])
+		}
+		return
+	}
+
+	if msg, ok := tags[tagError]; ok {
+		dest.SetCode(ptrace.StatusCodeError)
+		if msg != "true" {
+			dest.SetMessage(msg)
+		}
+	}
+}
+
+func spanKind(kind string) ptrace.SpanKind {
+	switch kind {
+	case "CLIENT":
+		return ptrace.SpanKindClient
+	case "SERVER":
+		return ptrace.SpanKindServer
+	case "PRODUCER":
+		return ptrace.SpanKindProducer
+	case "CONSUMER":
+		return ptrace.SpanKindConsumer
+	default:
+		return ptrace.SpanKindInternal
+	}
+}
+
+func microseconds(us uint64) pcommon.Timestamp {
+	return pcommon.Timestamp(us * 1000)
+}
+
+// parseTraceID parses a 64 or 128-bit hex trace ID.
+func parseTraceID(s string) (pcommon.TraceID, error) {
+	var id pcommon.TraceID
+	if len(s) != 16 && len(s) != 32 {
+		return id, fmt.Errorf("traceId %q is not 16 or 32 hex characters", s)
+	}
+	if _, err := hex.Decode(id[len(id)-len(s)/2:], []byte(s)); err != nil {
+		return id, fmt.Errorf("traceId: %w", err)
+	}
+	return id, nil
+}
+
+func parseSpanID(s string) (pcommon.SpanID, error) {
+	var id pcommon.SpanID
+	if len(s) != 16 {
+		return id, fmt.Errorf("%q is not 16 hex characters", s)
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return id, err
+	}
+	return id, nil
+}
@@ -0,0 +1,169 @@
+// Package zipkin decodes Zipkin v2 spans and translates them to OTLP
+// traces.
+// Ref: https://zipkin.io/zipkin-api/#/default/post_spans
+package zipkin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire"
+)
+
+// Span is a Zipkin v2 span. Timestamps and durations are in microseconds.
+type Span struct {
+	TraceID        string            `json:"traceId"`
+	ParentID       string            `json:"parentId,omitempty"`
+	ID             string            `json:"id"`
+	Kind           string            `json:"kind,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Timestamp      uint64            `json:"timestamp,omitempty"`
+	Duration       uint64            `json:"duration,omitempty"`
+	Debug          bool              `json:"debug,omitempty"`
+	Shared         bool              `json:"shared,omitempty"`
+	LocalEndpoint  *Endpoint         `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *Endpoint         `json:"remoteEndpoint,omitempty"`
+	Annotations    []Annotation      `json:"annotations,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int32  `json:"port,omitempty"`
+}
+
+type Annotation struct {
+	Timestamp uint64 `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// DecodeJSON decodes a JSON list of spans.
+func DecodeJSON(buf []byte) ([]Span, error) {
+	var spans []Span
+	if err := json.Unmarshal(buf, &spans); err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+// Span kinds of the protobuf encoding, in the order of zipkin.proto3.
+var protoKinds = []string{"", "CLIENT", "SERVER", "PRODUCER", "CONSUMER"}
+
+// DecodeProto decodes a zipkin.proto3 ListOfSpans. IDs are converted to the
+// hex strings of the JSON encoding.
+// Ref: https://github.com/openzipkin/zipkin-api/blob/master/zipkin.proto
+func DecodeProto(buf []byte) ([]Span, error) {
+	var spans []Span
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		if num != 1 {
+			return nil
+		}
+		span, err := decodeSpan(f.Bytes)
+		if err != nil {
+			return err
+		}
+		spans = append(spans, span)
+		return nil
+	})
+	return spans, err
+}
+
+func decodeSpan(buf []byte) (Span, error) {
+	var span Span
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		var err error
+		switch num {
+		case 1:
+			span.TraceID = fmt.Sprintf("%x", f.Bytes)
+		case 2:
+			span.ParentID = fmt.Sprintf("%x", f.Bytes)
+		case 3:
+			span.ID = fmt.Sprintf("%x", f.Bytes)
+		case 4:
+			if f.Num < uint64(len(protoKinds)) {
+				span.Kind = protoKinds[f.Num]
+			}
+		case 5:
+			span.Name = f.String()
+		case 6:
+			span.Timestamp = f.Num
+		case 7:
+			span.Duration = f.Num
+		case 8:
+			span.LocalEndpoint, err = decodeEndpoint(f.Bytes)
+		case 9:
+			span.RemoteEndpoint, err = decodeEndpoint(f.Bytes)
+		case 10:
+			var a Annotation
+			a, err = decodeAnnotation(f.Bytes)
+			span.Annotations = append(span.Annotations, a)
+		case 11:
+			var key, value string
+			key, value, err = decodeMapEntry(f.Bytes)
+			if span.Tags == nil {
+				span.Tags = map[string]string{}
+			}
+			span.Tags[key] = value
+		case 12:
+			span.Debug = f.Bool()
+		case 13:
+			span.Shared = f.Bool()
+		}
+		return err
+	})
+	return span, err
+}
+
+func decodeEndpoint(buf []byte) (*Endpoint, error) {
+	var e Endpoint
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			e.ServiceName = f.String()
+		case 2:
+			if addr, ok := netip.AddrFromSlice(f.Bytes); ok {
+				e.IPv4 = addr.String()
+			}
+		case 3:
+			if addr, ok := netip.AddrFromSlice(f.Bytes); ok {
+				e.IPv6 = addr.String()
+			}
+		case 4:
+			e.Port = int32(f.Num)
+		}
+		return nil
+	})
+	return &e, err
+}
+
+func decodeAnnotation(buf []byte) (Annotation, error) {
+	var a Annotation
+	err := pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			a.Timestamp = f.Num
+		case 2:
+			a.Value = f.String()
+		}
+		return nil
+	})
+	return a, err
+}
+
+func decodeMapEntry(buf []byte) (key, value string, err error) {
+	err = pbwire.Decode(buf, func(num protowire.Number, f pbwire.Field) error {
+		switch num {
+		case 1:
+			key = f.String()
+		case 2:
+			value = f.String()
+		}
+		return nil
+	})
+	return key, value, err
+}
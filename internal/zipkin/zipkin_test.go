@@ -0,0 +1,153 @@
+package zipkin
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/alkmst-xyz/sweetcorn/internal/pbwire/pbwiretest"
+)
+
+const spansJSON = `[
+  {
+    "traceId": "5af7183fb1d4cf5f",
+    "parentId": "6b221d5bc9e6496c",
+    "id": "352bff9a74ca9ad2",
+    "kind": "CLIENT",
+    "name": "get /api",
+    "timestamp": 1556604172355737,
+    "duration": 1431,
+    "localEndpoint": {"serviceName": "frontend", "ipv4": "192.168.99.1", "port": 3306},
+    "remoteEndpoint": {"serviceName": "backend", "ipv4": "172.19.0.2", "port": 9000},
+    "annotations": [{"timestamp": 1556604172355800, "value": "ws"}],
+    "tags": {"http.method": "GET", "error": "connection reset", "otel.scope.name": "net/http"}
+  }
+]`
+
+func TestDecodeJSONAndToTraces(t *testing.T) {
+	spans, err := DecodeJSON([]byte(spansJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td, err := ToTraces(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.SpanCount() != 1 {
+		t.Fatalf("got %d spans, want 1", td.SpanCount())
+	}
+
+	rs := td.ResourceSpans().At(0)
+	if v, _ := rs.Resource().Attributes().Get("service.name"); v.Str() != "frontend" {
+		t.Errorf("service.name = %q, want frontend", v.Str())
+	}
+	ss := rs.ScopeSpans().At(0)
+	if ss.Scope().Name() != "net/http" {
+		t.Errorf("scope name = %q, want net/http", ss.Scope().Name())
+	}
+
+	span := ss.Spans().At(0)
+	wantTraceID := pcommon.TraceID{0, 0, 0, 0, 0, 0, 0, 0, 0x5a, 0xf7, 0x18, 0x3f, 0xb1, 0xd4, 0xcf, 0x5f}
+	if span.TraceID() != wantTraceID {
+		t.Errorf("trace ID = %s, want %s", span.TraceID(), wantTraceID)
+	}
+	if span.ParentSpanID().String() != "6b221d5bc9e6496c" {
+		t.Errorf("parent span ID = %s", span.ParentSpanID())
+	}
+	if span.Kind() != ptrace.SpanKindClient {
+		t.Errorf("kind = %v, want client", span.Kind())
+	}
+	if span.StartTimestamp() != 1556604172355737000 || span.EndTimestamp() != 1556604172357168000 {
+		t.Errorf("start, end = %d, %d", span.StartTimestamp(), span.EndTimestamp())
+	}
+	if span.Status().Code() != ptrace.StatusCodeError || span.Status().Message() != "connection reset" {
+		t.Errorf("status = %v %q", span.Status().Code(), span.Status().Message())
+	}
+
+	wantAttrs := map[string]any{
+		"http.method":           "GET",
+		"peer.service":          "backend",
+		"network.peer.address":  "172.19.0.2",
+		"network.peer.port":     int64(9000),
+		"network.local.address": "192.168.99.1",
+		"network.local.port":    int64(3306),
+	}
+	if got := span.Attributes().AsRaw(); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+
+	if span.Events().Len() != 1 || span.Events().At(0).Name() != "ws" {
+		t.Fatalf("events = %v", span.Events())
+	}
+	if span.Events().At(0).Timestamp() != 1556604172355800000 {
+		t.Errorf("event timestamp = %d", span.Events().At(0).Timestamp())
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	var endpoint []byte
+	endpoint = pbwiretest.AppendBytes(endpoint, 1, []byte("frontend"))
+	endpoint = pbwiretest.AppendBytes(endpoint, 2, []byte{192, 168, 99, 1})
+	endpoint = protowire.AppendTag(endpoint, 4, protowire.VarintType)
+	endpoint = protowire.AppendVarint(endpoint, 3306)
+
+	var tag []byte
+	tag = pbwiretest.AppendBytes(tag, 1, []byte("http.method"))
+	tag = pbwiretest.AppendBytes(tag, 2, []byte("GET"))
+
+	var annotation []byte
+	annotation = protowire.AppendTag(annotation, 1, protowire.Fixed64Type)
+	annotation = protowire.AppendFixed64(annotation, 1556604172355800)
+	annotation = pbwiretest.AppendBytes(annotation, 2, []byte("ws"))
+
+	var span []byte
+	span = pbwiretest.AppendBytes(span, 1, []byte{0x5a, 0xf7, 0x18, 0x3f, 0xb1, 0xd4, 0xcf, 0x5f})
+	span = pbwiretest.AppendBytes(span, 3, []byte{0x35, 0x2b, 0xff, 0x9a, 0x74, 0xca, 0x9a, 0xd2})
+	span = protowire.AppendTag(span, 4, protowire.VarintType)
+	span = protowire.AppendVarint(span, 2)
+	span = pbwiretest.AppendBytes(span, 5, []byte("get /api"))
+	span = protowire.AppendTag(span, 6, protowire.Fixed64Type)
+	span = protowire.AppendFixed64(span, 1556604172355737)
+	span = protowire.AppendTag(span, 7, protowire.VarintType)
+	span = protowire.AppendVarint(span, 1431)
+	span = pbwiretest.AppendBytes(span, 8, endpoint)
+	span = pbwiretest.AppendBytes(span, 10, annotation)
+	span = pbwiretest.AppendBytes(span, 11, tag)
+
+	spans, err := DecodeProto(pbwiretest.AppendBytes(nil, 1, span))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Span{{
+		TraceID:       "5af7183fb1d4cf5f",
+		ID:            "352bff9a74ca9ad2",
+		Kind:          "SERVER",
+		Name:          "get /api",
+		Timestamp:     1556604172355737,
+		Duration:      1431,
+		LocalEndpoint: &Endpoint{ServiceName: "frontend", IPv4: "192.168.99.1", Port: 3306},
+		Annotations:   []Annotation{{Timestamp: 1556604172355800, Value: "ws"}},
+		Tags:          map[string]string{"http.method": "GET"},
+	}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("got %+v, want %+v", spans, want)
+	}
+}
+
+func TestToTracesInvalidID(t *testing.T) {
+	for _, span := range []Span{
+		{TraceID: "", ID: "352bff9a74ca9ad2"},
+		{TraceID: "5af7183fb1d4cf5f", ID: "352bff"},
+		{TraceID: "zzf7183fb1d4cf5f", ID: "352bff9a74ca9ad2"},
+		{TraceID: "5af7183fb1d4cf5f", ID: "352bff9a74ca9ad2", ParentID: "x"},
+	} {
+		if _, err := ToTraces([]Span{span}); err == nil {
+			t.Errorf("ToTraces(%+v) succeeded, want error", span)
+		}
+	}
+}
@@ -4,13 +4,28 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	_ "github.com/duckdb/duckdb-go/v2"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/alkmst-xyz/sweetcorn/internal/auth"
+	"github.com/alkmst-xyz/sweetcorn/internal/elasticsearch"
+	"github.com/alkmst-xyz/sweetcorn/internal/filelog"
+	"github.com/alkmst-xyz/sweetcorn/internal/fluent"
 	"github.com/alkmst-xyz/sweetcorn/internal/otlp"
 	"github.com/alkmst-xyz/sweetcorn/internal/otlphttp"
+	"github.com/alkmst-xyz/sweetcorn/internal/pipeline"
+	"github.com/alkmst-xyz/sweetcorn/internal/ratelimit"
+	"github.com/alkmst-xyz/sweetcorn/internal/redact"
+	"github.com/alkmst-xyz/sweetcorn/internal/statsd"
 	"github.com/alkmst-xyz/sweetcorn/internal/storage"
+	"github.com/alkmst-xyz/sweetcorn/internal/syslog"
+	"github.com/alkmst-xyz/sweetcorn/internal/tlsconfig"
 	"github.com/alkmst-xyz/sweetcorn/internal/web"
 )
 
@@ -18,9 +33,42 @@ func main() {
 	dataDir := flag.String("data-dir", ".sweetcorn_data", "Data directory.")
 	dbName := flag.String("db-name", "main.db", "Main DuckDB file name.")
 	storageType := flag.String("storage-type", "duckdb", "Storage type.")
+	queueSize := flag.Int("queue-size", pipeline.DefaultQueueSize, "Maximum number of queued requests per signal. Requests are acknowledged once queued: records that cannot be written after retries are dropped (at most once). 0 writes each request before it is acknowledged, and returns storage errors to the client.")
+	batchSize := flag.Int("batch-size", pipeline.DefaultBatchSize, "Number of records after which a batch is written.")
+	flushInterval := flag.Duration("flush-interval", pipeline.DefaultFlushInterval, "Maximum time records are buffered before they are written.")
+	flushWorkers := flag.Int("flush-workers", pipeline.DefaultWorkers, "Number of workers writing batches per signal.")
+	tlsCertFile := flag.String("tls-cert-file", "", "PEM server certificate. Enables TLS on all servers.")
+	tlsKeyFile := flag.String("tls-key-file", "", "PEM server private key.")
+	tlsClientCAFile := flag.String("tls-client-ca-file", "", "PEM CA bundle. Requires clients to present a certificate signed by it (mutual TLS).")
+	tlsReloadInterval := flag.Duration("tls-reload-interval", tlsconfig.DefaultReloadInterval, "How often the TLS files are checked for changes.")
+	authTokenFile := flag.String("auth-token-file", "", "File of \"principal:token\" lines. Requires OTLP clients to send a bearer token.")
+	authHtpasswdFile := flag.String("auth-htpasswd-file", "", "htpasswd file (bcrypt or SHA1). Requires OTLP clients to use basic auth.")
+	statsdAddr := flag.String("statsd-addr", "", "UDP and TCP address of the StatsD receiver, such as :8125. Empty disables it. StatsD has no authentication, anyone reaching the address can write metrics.")
+	statsdFlushInterval := flag.Duration("statsd-flush-interval", statsd.DefaultFlushInterval, "Interval over which StatsD metrics are aggregated.")
+	statsdTimerType := flag.String("statsd-timer-type", string(statsd.DefaultTimerType), "Metric type of StatsD timers, histograms and distributions: summary or histogram.")
+	fluentAddr := flag.String("fluent-addr", "", "TCP address of the Fluent Forward receiver, such as :24224. Empty disables it. Clients are not authenticated, anyone reaching the address can write logs.")
+	esTimestampField := flag.String("elasticsearch-timestamp-field", elasticsearch.DefaultMapping.TimestampField, "Field of Elasticsearch bulk documents that becomes the log timestamp.")
+	esMessageField := flag.String("elasticsearch-message-field", elasticsearch.DefaultMapping.MessageField, "Field of Elasticsearch bulk documents that becomes the log body.")
+	esSeverityField := flag.String("elasticsearch-severity-field", elasticsearch.DefaultMapping.SeverityField, "Field of Elasticsearch bulk documents that becomes the log severity.")
+	esServiceField := flag.String("elasticsearch-service-field", elasticsearch.DefaultMapping.ServiceField, "Field of Elasticsearch bulk documents that becomes service.name.")
+	syslogAddr := flag.String("syslog-addr", "", "UDP and TCP address of the syslog receiver, such as :5514. Empty disables it. Syslog has no authentication, anyone reaching the address can write logs.")
+	filelogInclude := flag.String("filelog-include", "", "Comma-separated glob patterns of the log files to tail. Empty disables the file tailer.")
+	filelogExclude := flag.String("filelog-exclude", "", "Comma-separated glob patterns of the matched files to leave out.")
+	filelogStartAt := flag.String("filelog-start-at", string(filelog.DefaultStartAt), "Where files found on start are read from, without a saved offset: beginning or end.")
+	filelogLineStart := flag.String("filelog-line-start-pattern", "", "Regular expression matching the first line of a multiline record. Empty makes each line a record.")
+	filelogPollInterval := flag.Duration("filelog-poll-interval", filelog.DefaultPollInterval, "How often tailed files are checked for new lines.")
+	maxRequestBodySize := flag.Int64("max-request-body-size", otlphttp.DefaultMaxRequestBodySize, "Maximum size in bytes of an HTTP request body as sent. Larger requests are rejected with 413.")
+	maxDecompressedBodySize := flag.Int64("max-decompressed-body-size", otlphttp.DefaultMaxDecompressedBodySize, "Maximum size in bytes of an HTTP request body after decompression.")
+	grpcMaxRecvMsgSize := flag.Int("grpc-max-recv-msg-size", otlp.DefaultMaxRecvMsgSize, "Maximum size in bytes of a received gRPC message, compressed or not.")
+	rateLimitKey := flag.String("rate-limit-key", string(ratelimit.DefaultKey), "What ingest rate limits apply to: service.name, tenant or client.")
+	rateLimitRecords := flag.Float64("rate-limit-records", 0, "Records accepted per second and key on the OTLP receivers. 0 disables the limit.")
+	rateLimitBytes := flag.Float64("rate-limit-bytes", 0, "Bytes accepted per second and key on the OTLP receivers, as encoded in OTLP protobuf. 0 disables the limit.")
+	redactionConfigFile := flag.String("redaction-config-file", "", "JSON file of the attribute keys to allow, deny or hash, and the patterns to mask, before data is stored.")
 	flag.Parse()
 
-	ctx := context.Background()
+	// stop the servers on SIGINT or SIGTERM, then write what is queued
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// create storage
 	storageConfig := storage.StorageConfig{
@@ -34,13 +82,71 @@ func main() {
 		MetricsHistogramTable:            storage.DefaultMetricsHistogramTableName,
 		MetricsExponentialHistogramTable: storage.DefaultMetricsExponentialHistogramTableName,
 		MetricsSummaryTable:              storage.DefaultMetricsSummaryTableName,
+		ProfilesSamplesTable:             storage.DefaultProfilesSamplesTableName,
+		ProfilesStacksTable:              storage.DefaultProfilesStacksTableName,
+		ProfilesLocationsTable:           storage.DefaultProfilesLocationsTableName,
+		ProfilesFunctionsTable:           storage.DefaultProfilesFunctionsTableName,
+		ProfilesMappingsTable:            storage.DefaultProfilesMappingsTableName,
 		DuckLakeName:                     storage.DefaultDuckLakeName,
 	}
-	storage, err := storage.NewStorage(ctx, storageConfig)
+	store, err := storage.NewStorage(ctx, storageConfig)
 	if err != nil {
 		log.Fatalf("failed to initialize storage: %v", err)
 	}
-	defer storage.Close()
+
+	// redact sensitive data, nil if redaction is disabled
+	var redactor *redact.Redactor
+	if *redactionConfigFile != "" {
+		redactor, err = redact.LoadFile(*redactionConfigFile)
+		if err != nil {
+			log.Fatalf("failed to load redaction config: %v", err)
+		}
+	}
+
+	// create ingest pipeline
+	pipelineConfig := pipeline.Config{
+		QueueSize:     *queueSize,
+		BatchSize:     *batchSize,
+		FlushInterval: *flushInterval,
+		Workers:       *flushWorkers,
+		Redactor:      redactor,
+	}
+	pl, err := pipeline.New(store, pipelineConfig)
+	if err != nil {
+		log.Fatalf("failed to initialize pipeline: %v", err)
+	}
+	pl.Start(ctx)
+
+	// load TLS certificates, nil if TLS is disabled. Each server gets its own
+	// clone, net/http modifies the config it is given.
+	tlsConfig, err := tlsconfig.NewServerConfig(tlsconfig.Config{
+		CertFile:       *tlsCertFile,
+		KeyFile:        *tlsKeyFile,
+		ClientCAFile:   *tlsClientCAFile,
+		ReloadInterval: *tlsReloadInterval,
+	})
+	if err != nil {
+		log.Fatalf("failed to load TLS config: %v", err)
+	}
+
+	// authenticate OTLP clients, nil if authentication is disabled
+	authenticator, err := auth.New(auth.Config{
+		TokenFile:    *authTokenFile,
+		HtpasswdFile: *authHtpasswdFile,
+	})
+	if err != nil {
+		log.Fatalf("failed to load credentials: %v", err)
+	}
+
+	// throttle ingest, nil if no rate limit is set
+	rateLimiter, err := ratelimit.New(ratelimit.Config{
+		Key:              ratelimit.Key(*rateLimitKey),
+		RecordsPerSecond: *rateLimitRecords,
+		BytesPerSecond:   *rateLimitBytes,
+	})
+	if err != nil {
+		log.Fatalf("failed to initialize rate limits: %v", err)
+	}
 
 	// start servers
 	const httpAddr = ":4318"
@@ -50,16 +156,82 @@ func main() {
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return otlphttp.StartHTTPServer(ctx, storage, httpAddr)
+		return otlphttp.StartHTTPServer(ctx, pl, otlphttp.ServerConfig{
+			Addr: httpAddr,
+			TLS:  tlsConfig.Clone(),
+			Auth: authenticator,
+			Elasticsearch: elasticsearch.Mapping{
+				TimestampField: *esTimestampField,
+				MessageField:   *esMessageField,
+				SeverityField:  *esSeverityField,
+				ServiceField:   *esServiceField,
+			},
+			RateLimiter:             rateLimiter,
+			MaxRequestBodySize:      *maxRequestBodySize,
+			MaxDecompressedBodySize: *maxDecompressedBodySize,
+		})
 	})
 	g.Go(func() error {
-		return otlp.StartGRPCServer(ctx, storage, grpcAddr)
+		return otlp.StartGRPCServer(ctx, pl, otlp.ServerConfig{
+			Addr:           grpcAddr,
+			TLS:            tlsConfig.Clone(),
+			Auth:           authenticator,
+			RateLimiter:    rateLimiter,
+			MaxRecvMsgSize: *grpcMaxRecvMsgSize,
+		})
 	})
+	if *statsdAddr != "" {
+		g.Go(func() error {
+			return statsd.StartServer(ctx, pl, statsd.ServerConfig{
+				Addr:          *statsdAddr,
+				FlushInterval: *statsdFlushInterval,
+				TimerType:     statsd.TimerType(*statsdTimerType),
+			})
+		})
+	}
+	if *fluentAddr != "" {
+		g.Go(func() error {
+			return fluent.StartServer(ctx, pl, fluent.ServerConfig{Addr: *fluentAddr, TLS: tlsConfig.Clone()})
+		})
+	}
+	if *syslogAddr != "" {
+		g.Go(func() error {
+			return syslog.StartServer(ctx, pl, syslog.ServerConfig{Addr: *syslogAddr, TLS: tlsConfig.Clone()})
+		})
+	}
+	if *filelogInclude != "" {
+		g.Go(func() error {
+			return filelog.StartTailer(ctx, pl, filelog.Config{
+				Include:          splitList(*filelogInclude),
+				Exclude:          splitList(*filelogExclude),
+				StartAt:          filelog.StartAt(*filelogStartAt),
+				LineStartPattern: *filelogLineStart,
+				PollInterval:     *filelogPollInterval,
+				OffsetsFile:      filepath.Join(*dataDir, "filelog_offsets.json"),
+			})
+		})
+	}
 	g.Go(func() error {
-		return web.StartWebApp(ctx, storage, appAddr)
+		return web.StartWebApp(ctx, store, web.ServerConfig{Addr: appAddr, TLS: tlsConfig.Clone(), Auth: authenticator})
 	})
 
-	if err := g.Wait(); err != nil {
+	// the servers stop on a signal, or when one of them fails
+	err = g.Wait()
+	log.Printf("Servers stopped, writing queued data")
+	pl.Shutdown()
+	store.Close()
+	if err != nil {
 		log.Fatalf("Server exited with error: %v", err)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}